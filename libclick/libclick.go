@@ -384,6 +384,16 @@ func SendNow(data interface{}) error {
 	return nil
 }
 
+// QueueFull reports whether the queue of events waiting to be batched up and
+// sent is at capacity, meaning the next Send will block (with BlockOnSend) or
+// be dropped.
+func QueueFull() bool {
+	if t, ok := tx.(*txDefaultClient); ok {
+		return len(t.muster.Work) >= cap(t.muster.Work)
+	}
+	return false
+}
+
 // Responses returns the channel from which the caller can read the responses
 // to sent events.
 func Responses() chan Response {
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/AIntelligenceGame/clicktail/libclick"
+	"github.com/AIntelligenceGame/clicktail/tail"
 
 	// "github.com/honeycombio/libhoney-go"
 	//libclick "github.com/Altinity/libclick-go"
@@ -21,15 +22,28 @@ var BuildID string
 var version string
 
 var ValidParsers = []string{
+	"apache",
 	"arangodb",
+	"clickhouse",
+	"cloudfront",
+	"csv",
+	"elb",
+	"envoy",
+	"haproxy",
+	"iis",
 	"json",
 	"keyval",
 	"mongo",
 	"mysql",
 	"mysqlaudit",
+	"mysqlerror",
+	"mysqlgeneral",
 	"nginx",
 	"postgresql",
+	"redis",
 	"regex",
+	"tsv",
+	"w3c",
 }
 
 // setVersion sets the internal version ID and updates libclick's user-agent
@@ -80,17 +94,37 @@ func HandleOtherModes(fp *flag.Parser, modes OtherModes) {
 
 func AddParserDefaultOptions(options *GlobalOptions) {
 	switch {
-	case options.Reqs.ParserName == "nginx":
-		// automatically normalize the request when using the nginx parser
+	case options.Reqs.ParserName == "nginx",
+		options.Reqs.ParserName == "apache",
+		options.Reqs.ParserName == "haproxy",
+		options.Reqs.ParserName == "elb":
+		// automatically normalize the request when using the access log
+		// parsers that log it as one field
 		options.RequestShape = append(options.RequestShape, "request")
 	}
-	if options.Reqs.ParserName != "mysql" {
-		// mysql is the only parser that requires in-parser sampling because it has
-		// a multi-line log format.
+	switch options.Reqs.ParserName {
+	case "clickhouse", "mysql", "mysqlaudit", "mysqlerror", "mysqlgeneral", "redis":
+		// the mysql, redis and clickhouse parsers require in-parser sampling
+		// because they have multi-line log formats.
+		options.TailSample = false
+	default:
 		// Sample all other parser when tailing to conserve CPU
 		options.TailSample = true
-	} else {
-		options.TailSample = false
+	}
+	if options.Tail.ContainerFormat != "" {
+		if len(options.Reqs.LogFiles) == 0 {
+			options.Reqs.LogFiles = []string{tail.DefaultContainerLogs}
+		}
+		// strip the container runtime header before any user supplied prefix
+		options.PrefixRegex = tail.ContainerPrefixRegex + strings.TrimPrefix(options.PrefixRegex, "^")
+	}
+	for _, f := range options.Reqs.LogFiles {
+		if tail.IsSyslogSource(f) {
+			// journald and syslog sources put a header in front of each message;
+			// strip it before any user supplied prefix
+			options.PrefixRegex = tail.SourcePrefixRegex + strings.TrimPrefix(options.PrefixRegex, "^")
+			break
+		}
 	}
 	if len(options.DynSample) != 0 {
 		// when using dynamic sampling, we make the sampling decision after parsing
@@ -111,10 +145,22 @@ func SanityCheckOptions(options *GlobalOptions) {
 	fmt.Println("Write key required to be specified with the --writekey flag.")
 	Usage()
 	os.Exit(1)*/
-	case len(options.Reqs.LogFiles) == 0:
+	case options.Reqs.ParserName == "redis" && len(options.Reqs.LogFiles) == 0 && options.Redis.Host == "":
+		fmt.Println("Polling SLOWLOG GET without log files requires the --redis.host flag.")
+		Usage()
+		os.Exit(1)
+	case len(options.Reqs.LogFiles) == 0 && !PollOnly(options):
 		fmt.Println("Log file name or '-' required to be specified with the --file flag.")
 		Usage()
 		os.Exit(1)
+	case mixedSourceKinds(options.Reqs.LogFiles):
+		fmt.Println("journald and syslog sources can't be read alongside files, STDIN or HTTP; run a separate clicktail for each.")
+		Usage()
+		os.Exit(1)
+	case options.Reqs.ParserName == "mysql" && (options.MySQL.DigestPoll || options.MySQL.HistoryPoll) && options.MySQL.Host == "":
+		fmt.Println("Polling performance_schema requires the --mysql.host flag.")
+		Usage()
+		os.Exit(1)
 	case options.Reqs.Dataset == "":
 		fmt.Println("Dataset name required with the --dataset flag.")
 		Usage()
@@ -152,10 +198,10 @@ func SanityCheckOptions(options *GlobalOptions) {
 		}
 	}
 
-	// Make sure input files exist
+	// Make sure input files exist. Container logs may show up later on.
 	shouldExit := false
 	for _, f := range options.Reqs.LogFiles {
-		if f == "-" {
+		if tail.IsStreamSource(f) || options.Tail.ContainerFormat != "" {
 			continue
 		}
 		if files, err := filepath.Glob(f); err != nil || files == nil {
@@ -169,6 +215,36 @@ func SanityCheckOptions(options *GlobalOptions) {
 	}
 }
 
+// PollOnly returns true when there are no log files to tail and the parser
+// gets its events by polling the database instead
+func PollOnly(options *GlobalOptions) bool {
+	if len(options.Reqs.LogFiles) != 0 {
+		return false
+	}
+	switch options.Reqs.ParserName {
+	case "mysql":
+		return options.MySQL.DigestPoll || options.MySQL.HistoryPoll
+	case "redis":
+		return options.Redis.Host != ""
+	}
+	return false
+}
+
+// mixedSourceKinds returns true when some of the log files are journald or
+// syslog sources and some aren't. The header of those sources is stripped by
+// the prefix regex, which applies to every line read.
+func mixedSourceKinds(logFiles []string) bool {
+	var syslog, other bool
+	for _, f := range logFiles {
+		if tail.IsSyslogSource(f) {
+			syslog = true
+		} else {
+			other = true
+		}
+	}
+	return syslog && other
+}
+
 func Usage() {
 	fmt.Print(`
 Usage: clicktail -p <parser> -f </path/to/logfile> -d <mydata> [optional arguments]
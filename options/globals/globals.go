@@ -1,15 +1,25 @@
 package globals
 
 import (
+	"github.com/AIntelligenceGame/clicktail/parsers/apache"
 	"github.com/AIntelligenceGame/clicktail/parsers/arangodb"
+	"github.com/AIntelligenceGame/clicktail/parsers/clickhouse"
+	"github.com/AIntelligenceGame/clicktail/parsers/csv"
+	"github.com/AIntelligenceGame/clicktail/parsers/elb"
+	"github.com/AIntelligenceGame/clicktail/parsers/envoy"
+	"github.com/AIntelligenceGame/clicktail/parsers/haproxy"
 	"github.com/AIntelligenceGame/clicktail/parsers/htjson"
 	"github.com/AIntelligenceGame/clicktail/parsers/keyval"
 	"github.com/AIntelligenceGame/clicktail/parsers/mongodb"
 	"github.com/AIntelligenceGame/clicktail/parsers/mysql"
 	"github.com/AIntelligenceGame/clicktail/parsers/mysqlaudit"
+	"github.com/AIntelligenceGame/clicktail/parsers/mysqlerror"
+	"github.com/AIntelligenceGame/clicktail/parsers/mysqlgeneral"
 	"github.com/AIntelligenceGame/clicktail/parsers/nginx"
 	"github.com/AIntelligenceGame/clicktail/parsers/postgresql"
+	"github.com/AIntelligenceGame/clicktail/parsers/redis"
 	"github.com/AIntelligenceGame/clicktail/parsers/regex"
+	"github.com/AIntelligenceGame/clicktail/parsers/w3c"
 	"github.com/AIntelligenceGame/clicktail/tail"
 )
 
@@ -50,20 +60,30 @@ type GlobalOptions struct {
 
 	Tail tail.TailOptions `group:"Tail Options" namespace:"tail"`
 
-	ArangoDB   arangodb.Options   `group:"ArangoDB Parser Options" namespace:"arangodb"`
-	JSON       htjson.Options     `group:"JSON Parser Options" namespace:"json"`
-	KeyVal     keyval.Options     `group:"KeyVal Parser Options" namespace:"keyval"`
-	Mongo      mongodb.Options    `group:"MongoDB Parser Options" namespace:"mongo"`
-	MySQL      mysql.Options      `group:"MySQL Parser Options" namespace:"mysql"`
-	MySQLAudit mysqlaudit.Options `group:"MySQL Audit Parser Options" namespace:"mysqlaudit"`
-	Nginx      nginx.Options      `group:"Nginx Parser Options" namespace:"nginx"`
-	PostgreSQL postgresql.Options `group:"PostgreSQL Parser Options" namespace:"postgresql"`
-	Regex      regex.Options      `group:"Regex Parser Options" namespace:"regex"`
+	Apache       apache.Options       `group:"Apache Parser Options" namespace:"apache"`
+	ArangoDB     arangodb.Options     `group:"ArangoDB Parser Options" namespace:"arangodb"`
+	ClickHouse   clickhouse.Options   `group:"ClickHouse Parser Options" namespace:"clickhouse"`
+	CSV          csv.Options          `group:"CSV Parser Options" namespace:"csv"`
+	ELB          elb.Options          `group:"ELB Parser Options" namespace:"elb"`
+	Envoy        envoy.Options        `group:"Envoy Parser Options" namespace:"envoy"`
+	HAProxy      haproxy.Options      `group:"HAProxy Parser Options" namespace:"haproxy"`
+	JSON         htjson.Options       `group:"JSON Parser Options" namespace:"json"`
+	KeyVal       keyval.Options       `group:"KeyVal Parser Options" namespace:"keyval"`
+	Mongo        mongodb.Options      `group:"MongoDB Parser Options" namespace:"mongo"`
+	MySQL        mysql.Options        `group:"MySQL Parser Options" namespace:"mysql"`
+	MySQLAudit   mysqlaudit.Options   `group:"MySQL Audit Parser Options" namespace:"mysqlaudit"`
+	MySQLError   mysqlerror.Options   `group:"MySQL Error Log Parser Options" namespace:"mysqlerror"`
+	MySQLGeneral mysqlgeneral.Options `group:"MySQL General Log Parser Options" namespace:"mysqlgeneral"`
+	Nginx        nginx.Options        `group:"Nginx Parser Options" namespace:"nginx"`
+	PostgreSQL   postgresql.Options   `group:"PostgreSQL Parser Options" namespace:"postgresql"`
+	Redis        redis.Options        `group:"Redis Parser Options" namespace:"redis"`
+	Regex        regex.Options        `group:"Regex Parser Options" namespace:"regex"`
+	W3C          w3c.Options          `group:"W3C Parser Options" namespace:"w3c"`
 }
 type RequiredOptions struct {
 	ParserName string `short:"p" long:"parser" description:"Parser module to use. Use --list to list available options."`
 	//WriteKey   string   `short:"k" long:"writekey" description:"Team write key"`
-	LogFiles []string `short:"f" long:"file" description:"Log file(s) to parse. Use '-' for STDIN, use this flag multiple times to tail multiple files, or use a glob (/path/to/foo-*.log)"`
+	LogFiles []string `short:"f" long:"file" description:"Log file(s) to parse. Use '-' for STDIN, journald: (optionally followed by a comma separated list of units) for the systemd journal, or syslog+udp://host:port / syslog+tcp://host:port to listen for syslog messages (journald and syslog sources can't be mixed with other kinds), or http://host:port/path to accept lines POSTed as text or JSON. Use this flag multiple times to tail multiple files, or use a glob (/path/to/foo-*.log)"`
 	Dataset  string   `short:"d" long:"dataset" description:"Name of the dataset"`
 }
 
@@ -0,0 +1,153 @@
+// Package apache consumes Apache httpd access logs
+package apache
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/AIntelligenceGame/clicktail/parsers/fieldtype"
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/httime"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+const commonLogFormatTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+type Options struct {
+	LogFormat       string   `long:"log_format" description:"LogFormat string of the access log, or the nickname of a standard one: common, combined, combinedio or vhost_combined" default:"combined"`
+	TimeFieldName   string   `long:"timefield" description:"Name of the field that contains a timestamp"`
+	TimeFieldFormat string   `long:"time_format" description:"Timestamp format to use (strftime and Golang time.Parse supported)"`
+	FieldTypes      []string `long:"field_type" description:"Type to convert a field to instead of guessing, as field:type[:arg], eg. \"remote_host:ip\". Types are string, int, float, bool, duration (arg is the unit, default ms), ip, timestamp (arg is the format) and size (eg. 10KB, in bytes). May be specified multiple times."`
+
+	NumParsers int `hidden:"true" description:"number of apache parsers to spin up"`
+}
+
+type Parser struct {
+	conf       Options
+	lineParser *LogFormatLineParser
+}
+
+func (p *Parser) Init(options interface{}) error {
+	p.conf = *options.(*Options)
+	if p.conf.LogFormat == "" {
+		return errors.New("missing required option --apache.log_format=<LogFormat string or nickname>")
+	}
+	fieldTypes, err := fieldtype.ParseFields(p.conf.FieldTypes)
+	if err != nil {
+		return err
+	}
+	format, err := compileLogFormat(p.conf.LogFormat)
+	if err != nil {
+		return err
+	}
+	p.lineParser = &LogFormatLineParser{
+		format:     format,
+		fieldTypes: fieldTypes,
+	}
+	return nil
+}
+
+// LogFormatLineParser parses lines written with a LogFormat
+type LogFormatLineParser struct {
+	format     *logFormat
+	fieldTypes fieldtype.Fields
+}
+
+// ParseLine returns the fields of the line, typed. The time is left as
+// logged, to be parsed into the event's timestamp.
+func (l *LogFormatLineParser) ParseLine(line string) (map[string]interface{}, error) {
+	fields, ok := l.format.parse(line)
+	if !ok {
+		logrus.WithFields(logrus.Fields{
+			"logline": line,
+		}).Debug("failed to parse apache log line")
+		return nil, errors.New("access log line does not match the LogFormat")
+	}
+	timeFields := make(map[string]string, 1)
+	for _, k := range []string{timeLocalField, timeField} {
+		if v, ok := fields[k]; ok {
+			timeFields[k] = v
+			delete(fields, k)
+		}
+	}
+	parsed := l.fieldTypes.ConvertOrInfer(fields)
+	for k, v := range timeFields {
+		parsed[k] = v
+	}
+	return parsed, nil
+}
+
+func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+	// parse lines one by one
+	wg := sync.WaitGroup{}
+	numParsers := 1
+	if p.conf.NumParsers > 0 {
+		numParsers = p.conf.NumParsers
+	}
+	for i := 0; i < numParsers; i++ {
+		wg.Add(1)
+		go func() {
+			for line := range lines {
+				line = strings.TrimSpace(line)
+				logrus.WithFields(logrus.Fields{
+					"line": line,
+				}).Debug("Attempting to process apache log line")
+
+				// take care of any headers on the line
+				var prefixFields map[string]interface{}
+				if prefixRegex != nil {
+					var prefix string
+					prefix, fields := prefixRegex.FindStringSubmatchMap(line)
+					line = strings.TrimPrefix(line, prefix)
+					prefixFields = p.lineParser.fieldTypes.ConvertOrInfer(fields)
+				}
+
+				parsedLine, err := p.lineParser.ParseLine(line)
+				if err != nil {
+					continue
+				}
+				// merge the prefix fields and the parsed line contents
+				for k, v := range prefixFields {
+					parsedLine[k] = v
+				}
+
+				send <- event.Event{
+					Timestamp: p.getTimestamp(parsedLine),
+					Data:      parsedLine,
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	logrus.Debug("lines channel is closed, ending apache processor")
+}
+
+// getTimestamp returns the time of the line from the user-defined field, or
+// the time the LogFormat logs, and removes it from the event
+func (p *Parser) getTimestamp(data map[string]interface{}) time.Time {
+	if p.conf.TimeFieldName != "" {
+		return httime.GetTimestamp(data, p.conf.TimeFieldName, p.conf.TimeFieldFormat)
+	}
+	format := p.lineParser.format
+	switch format.timeKind {
+	case clfTime:
+		return httime.GetTimestamp(data, timeLocalField, commonLogFormatTimeLayout)
+	case strftimeTime:
+		return httime.GetTimestamp(data, timeField, format.timeFormat)
+	case unixTime:
+		value, _ := data[timeField].(string)
+		delete(data, timeField)
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			perSecond := format.timeUnit
+			return time.Unix(n/perSecond, (n%perSecond)*(int64(time.Second)/perSecond))
+		}
+		logrus.WithField("time", value).Debug("couldn't parse apache time, using the current time")
+	}
+	return httime.Now()
+}
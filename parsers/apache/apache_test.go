@@ -0,0 +1,121 @@
+package apache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+func TestParseLine(t *testing.T) {
+	tsts := []struct {
+		format   string
+		line     string
+		expected map[string]interface{}
+	}{
+		{
+			"common",
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 -`,
+			map[string]interface{}{
+				"remote_host":     "127.0.0.1",
+				"remote_user":     "frank",
+				"time_local":      "10/Oct/2000:13:55:36 -0700",
+				"request":         "GET /apache_pb.gif HTTP/1.0",
+				"status":          int64(200),
+				"body_bytes_sent": int64(0),
+			},
+		},
+		{
+			"combined",
+			`10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /search?q=\"x\" HTTP/1.1" 200 2326 "-" "Mozilla/5.0 \x22quoted\x22"`,
+			map[string]interface{}{
+				"remote_host":     "10.0.0.1",
+				"time_local":      "10/Oct/2000:13:55:36 -0700",
+				"request":         `GET /search?q="x" HTTP/1.1`,
+				"status":          int64(200),
+				"body_bytes_sent": int64(2326),
+				"http_user_agent": `Mozilla/5.0 "quoted"`,
+			},
+		},
+		{
+			"vhost_combined",
+			`www.example.com:443 10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/2.0" 304 0 "https://example.com/" "curl/7.68.0"`,
+			map[string]interface{}{
+				"server_name":     "www.example.com",
+				"server_port":     int64(443),
+				"remote_host":     "10.0.0.1",
+				"time_local":      "10/Oct/2000:13:55:36 -0700",
+				"request":         "GET / HTTP/2.0",
+				"status":          int64(304),
+				"bytes_sent":      int64(0),
+				"http_referer":    "https://example.com/",
+				"http_user_agent": "curl/7.68.0",
+			},
+		},
+		{
+			// copied from httpd.conf, with a conditional header and timings
+			`%a %{X-Forwarded-For}i \"%m %U%q\" %>s %B %D %{ms}T %!200,304{Cookie}C %{%Y-%m-%d %H:%M:%S}t`,
+			`10.0.0.2 203.0.113.9 "POST /login?next=%2F" 302 0 15230 15 abc123 2000-10-10 13:55:36`,
+			map[string]interface{}{
+				"remote_addr":          "10.0.0.2",
+				"http_x_forwarded_for": "203.0.113.9",
+				"request_method":       "POST",
+				"uri":                  "/login",
+				"query_string":         "?next=%2F",
+				"status":               int64(302),
+				"body_bytes_sent":      int64(0),
+				"request_time_us":      int64(15230),
+				"request_time_ms":      int64(15),
+				"cookie_cookie":        "abc123",
+				"time":                 "2000-10-10 13:55:36",
+			},
+		},
+	}
+	for _, tt := range tsts {
+		p := &Parser{}
+		err := p.Init(&Options{LogFormat: tt.format})
+		assert.NoError(t, err, tt.format)
+		parsed, err := p.lineParser.ParseLine(tt.line)
+		assert.NoError(t, err, tt.line)
+		assert.Equal(t, tt.expected, parsed, tt.format)
+	}
+}
+
+func TestInit(t *testing.T) {
+	for _, format := range []string{"", "%Z", "%{}i", "no directives", `%{Referer}`} {
+		p := &Parser{}
+		assert.Error(t, p.Init(&Options{LogFormat: format}), format)
+	}
+	p := &Parser{}
+	assert.Error(t, p.Init(&Options{LogFormat: "common", FieldTypes: []string{"status"}}))
+}
+
+func TestProcessLines(t *testing.T) {
+	tsts := []struct {
+		format   string
+		line     string
+		expected time.Time
+	}{
+		{"common", `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" 200 2326`, time.Date(2000, 10, 10, 20, 55, 36, 0, time.UTC)},
+		{`%h %{%d/%b/%Y %H:%M:%S}t %>s`, `127.0.0.1 10/Oct/2000 20:55:36 200`, time.Date(2000, 10, 10, 20, 55, 36, 0, time.UTC)},
+		{`%h [%{msec}t] %>s`, `127.0.0.1 [971211336123] 200`, time.Date(2000, 10, 10, 20, 55, 36, 123000000, time.UTC)},
+	}
+	for _, tt := range tsts {
+		p := &Parser{}
+		assert.NoError(t, p.Init(&Options{LogFormat: tt.format}))
+		lines := make(chan string)
+		send := make(chan event.Event)
+		go func() {
+			lines <- tt.line
+			close(lines)
+		}()
+		go p.ProcessLines(lines, send, nil)
+		ev := <-send
+		assert.True(t, tt.expected.Equal(ev.Timestamp), "%s: expected %s, got %s", tt.format, tt.expected, ev.Timestamp)
+		assert.Equal(t, int64(200), ev.Data["status"])
+		assert.Nil(t, ev.Data["time"])
+		assert.Nil(t, ev.Data["time_local"])
+	}
+}
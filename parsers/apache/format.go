@@ -0,0 +1,306 @@
+package apache
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A LogFormat string is literal text and % directives, such as
+//
+//	%h %l %u %t \"%r\" %>s %b \"%{Referer}i\" \"%{User-agent}i\" %D
+//
+// Directives may have an argument in braces before the letter, and status
+// conditions (%400,501{User-agent}i) or a < or > for the original or final
+// request (%>s), which don't change what's logged.
+// See https://httpd.apache.org/docs/current/mod/mod_log_config.html#formats
+
+// standardLogFormats are the formats of the default httpd.conf, by nickname
+var standardLogFormats = map[string]string{
+	"common":         `%h %l %u %t "%r" %>s %b`,
+	"combined":       `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"`,
+	"combinedio":     `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i" %I %O`,
+	"vhost_combined": `%v:%p %h %l %u %t "%r" %>s %O "%{Referer}i" "%{User-Agent}i"`,
+}
+
+// directiveFields are the fields of directives without an argument, named
+// like the nginx variables where there's one that's the same
+var directiveFields = map[string]string{
+	"a": "remote_addr",
+	"A": "local_addr",
+	"b": "body_bytes_sent",
+	"B": "body_bytes_sent",
+	"D": "request_time_us",
+	"f": "filename",
+	"h": "remote_host",
+	"H": "server_protocol",
+	"I": "bytes_received",
+	"k": "keepalive_requests",
+	"l": "remote_logname",
+	"L": "log_id",
+	"m": "request_method",
+	"O": "bytes_sent",
+	"p": "server_port",
+	"P": "pid",
+	"q": "query_string",
+	"r": "request",
+	"R": "handler",
+	"s": "status",
+	"S": "bytes_transferred",
+	"t": timeLocalField,
+	"T": "request_time",
+	"u": "remote_user",
+	"U": "uri",
+	"v": "server_name",
+	"V": "request_server_name",
+	"X": "connection_status",
+}
+
+// argFieldPrefixes are the prefixes of the fields of directives whose
+// argument is a name, such as a header
+var argFieldPrefixes = map[string]string{
+	"i":   "http_",
+	"o":   "sent_http_",
+	"C":   "cookie_",
+	"e":   "env_",
+	"n":   "note_",
+	"x":   "",
+	"c":   "",
+	"^ti": "trailer_in_",
+	"^to": "trailer_out_",
+}
+
+const (
+	timeLocalField = "time_local"
+	timeField      = "time"
+)
+
+var (
+	reDirective = regexp.MustCompile(`^%[!0-9,]*[<>]?(?:\{([^}]*)\})?(\^t[io]|[A-Za-z])`)
+	reNonWord   = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// timeKind is how the time of a log format is written
+type timeKind int
+
+const (
+	noTime timeKind = iota
+	// [10/Oct/2000:13:55:36 -0700]
+	clfTime
+	// strftime, given as the argument of %t
+	strftimeTime
+	// seconds, milliseconds or microseconds since the epoch
+	unixTime
+)
+
+// logFormat is a LogFormat string compiled into a regex
+type logFormat struct {
+	regexp *regexp.Regexp
+	// the fields of the regex's groups, in order
+	fields []string
+	// fields logged as "-" when they're 0 rather than empty
+	zeroDash map[string]bool
+
+	timeKind timeKind
+	// the strftime format, or the number of units per second, of the time
+	timeFormat string
+	timeUnit   int64
+}
+
+// compileLogFormat compiles a LogFormat string, or the nickname of a
+// standard one
+func compileLogFormat(format string) (*logFormat, error) {
+	if standard, ok := standardLogFormats[format]; ok {
+		format = standard
+	}
+	// accept formats copied from httpd.conf, where quotes are escaped
+	format = strings.NewReplacer(`\"`, `"`, `\t`, "\t", `\n`, "\n").Replace(format)
+
+	original := format
+	lf := &logFormat{zeroDash: make(map[string]bool)}
+	var re strings.Builder
+	re.WriteString("^")
+	for len(format) > 0 {
+		if format[0] != '%' {
+			re.WriteString(regexp.QuoteMeta(format[:1]))
+			format = format[1:]
+			continue
+		}
+		if strings.HasPrefix(format, "%%") {
+			re.WriteString("%")
+			format = format[2:]
+			continue
+		}
+		m := reDirective.FindStringSubmatch(format)
+		if m == nil {
+			return nil, fmt.Errorf("invalid LogFormat directive at %q", format)
+		}
+		format = format[len(m[0]):]
+		arg, code := m[1], m[2]
+		field, err := lf.directiveField(arg, code)
+		if err != nil {
+			return nil, err
+		}
+		lf.fields = append(lf.fields, field)
+		switch {
+		case code == "t" && arg == "":
+			re.WriteString(`\[([^\]]*)\]`)
+		case code == "q":
+			// the query string is empty or starts with ?, so it can follow %U
+			re.WriteString(`((?:\?[^\s"]*)?)`)
+		case field == timeField && lf.timeKind == strftimeTime:
+			re.WriteString(`(` + strftimePattern(lf.timeFormat) + `)`)
+		case format == "":
+			re.WriteString(`(.*)`)
+		case format[0] == '"':
+			// quotes in the value are escaped
+			re.WriteString(`((?:[^"\\]|\\.)*)`)
+		case format[0] == '%':
+			re.WriteString(`(.*?)`)
+		default:
+			re.WriteString(`([^` + regexp.QuoteMeta(format[:1]) + `]*)`)
+		}
+		if code == "b" {
+			lf.zeroDash[field] = true
+		}
+	}
+	re.WriteString("$")
+	if len(lf.fields) == 0 {
+		return nil, fmt.Errorf("LogFormat %q has no directives", original)
+	}
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return nil, err
+	}
+	lf.regexp = compiled
+	return lf, nil
+}
+
+// strftimePattern matches a time written with a strftime format, which may
+// have spaces in it
+func strftimePattern(format string) string {
+	words := strings.Fields(format)
+	for i := range words {
+		words[i] = `\S+`
+	}
+	return strings.Join(words, " +")
+}
+
+// directiveField returns the field of a directive, and notes how the time
+// is written for %t
+func (lf *logFormat) directiveField(arg, code string) (string, error) {
+	if prefix, ok := argFieldPrefixes[code]; ok {
+		if arg == "" {
+			return "", fmt.Errorf("LogFormat directive %%%s needs a name, as in %%{name}%s", code, code)
+		}
+		return prefix + strings.Trim(reNonWord.ReplaceAllString(strings.ToLower(arg), "_"), "_"), nil
+	}
+	field, ok := directiveFields[code]
+	if !ok {
+		return "", fmt.Errorf("unknown LogFormat directive %%%s", code)
+	}
+	if arg == "" {
+		if code == "t" {
+			lf.timeKind = clfTime
+		}
+		return field, nil
+	}
+	switch code {
+	case "a":
+		if arg == "c" {
+			return "peer_addr", nil
+		}
+	case "p":
+		switch arg {
+		case "local":
+			return "local_port", nil
+		case "remote":
+			return "remote_port", nil
+		}
+	case "P":
+		if arg == "tid" || arg == "hextid" {
+			return "tid", nil
+		}
+	case "T":
+		switch arg {
+		case "ms":
+			return "request_time_ms", nil
+		case "us":
+			return "request_time_us", nil
+		}
+	case "t":
+		return lf.timeDirectiveField(arg), nil
+	}
+	return field, nil
+}
+
+// timeDirectiveField returns the field of %{format}t
+func (lf *logFormat) timeDirectiveField(arg string) string {
+	// the time the request was received is the default
+	arg = strings.TrimPrefix(strings.TrimPrefix(arg, "begin:"), "end:")
+	switch arg {
+	case "sec", "msec", "usec":
+		lf.timeKind = unixTime
+		lf.timeUnit = map[string]int64{"sec": 1, "msec": 1e3, "usec": 1e6}[arg]
+		return timeField
+	case "msec_frac", "usec_frac":
+		return "time_" + arg
+	}
+	lf.timeKind = strftimeTime
+	lf.timeFormat = arg
+	return timeField
+}
+
+// parse returns the fields of a line, as logged
+func (lf *logFormat) parse(line string) (map[string]string, bool) {
+	match := lf.regexp.FindStringSubmatch(line)
+	if match == nil {
+		return nil, false
+	}
+	fields := make(map[string]string, len(lf.fields))
+	for i, field := range lf.fields {
+		value := match[i+1]
+		if value == "-" && lf.zeroDash[field] {
+			value = "0"
+		}
+		if _, ok := fields[field]; !ok || fields[field] == "-" {
+			fields[field] = unescape(value)
+		}
+	}
+	return fields, true
+}
+
+// unescape undoes the escaping of quotes, backslashes and non-printable
+// characters httpd does in requests and headers
+func unescape(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'x':
+			if i+2 < len(value) {
+				if c, err := strconv.ParseUint(value[i+1:i+3], 16, 8); err == nil {
+					b.WriteByte(byte(c))
+					i += 2
+					continue
+				}
+			}
+			b.WriteString(`\x`)
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
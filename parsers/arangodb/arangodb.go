@@ -2,7 +2,11 @@
 package arangodb
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"errors"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -12,18 +16,36 @@ import (
 	"github.com/honeycombio/honeytail/httime"
 	"github.com/honeycombio/honeytail/parsers"
 	"github.com/sirupsen/logrus"
+
+	"github.com/AIntelligenceGame/clicktail/parsers/fingerprint"
 )
 
 const numParsers = 20
 
+// Sample log lines, by format
+//
+// Text, with the optional log ID (3.8+), thread and role:
+// 2016-10-31T16:03:02Z [6402] INFO {requests} "http-request-end","0x7f87ba86b290","127.0.0.1","GET","HTTP/1.1",200,0,64,"/_api/version",0.000139
+// 2021-05-10T09:00:00.123Z [12345-140219716011776] S INFO [cf3f4] {general} ArangoDB (version 3.8.0 [linux]) is ready for business. Have fun!
+// 2021-05-10T09:01:00Z [12345] WARNING [8bcee] {queries} slow query: 'FOR u IN users FILTER u.age > 30 RETURN u', database: _system, user: root, took: 12.345678 s
+//
+// JSON (3.8+, --log.use-json-format):
+// {"time":"2021-05-10T09:00:00Z","pid":12345,"level":"INFO","topic":"general","id":"cf3f4","message":"ArangoDB (version 3.8.0 [linux]) is ready for business. Have fun!"}
+
 const (
-	iso8601UTCTimeFormat   = "2006-01-02T15:04:05Z"
-	iso8601LocalTimeFormat = "2006-01-02T15:04:05"
+	iso8601UTCTimeFormat   = "2006-01-02T15:04:05.999999999Z07:00"
+	iso8601LocalTimeFormat = "2006-01-02T15:04:05.999999999"
 
 	timestampFieldName  = "timestamp"
+	hostnameFieldName   = "hostname"
 	pidFieldName        = "pid"
+	threadIDFieldName   = "threadId"
+	threadNameFieldName = "threadName"
+	roleFieldName       = "role"
 	logLevelFieldName   = "logLevel"
+	logIDFieldName      = "logId"
 	logTopicFieldName   = "logTopic"
+	messageFieldName    = "message"
 	idFieldName         = "id"
 	sourceIPFieldName   = "sourceIP"
 	methodFieldName     = "method"
@@ -33,6 +55,22 @@ const (
 	resBodyLenFieldName = "resBodyLen"
 	fullURLFieldName    = "fullURL"
 	totalTimeFieldName  = "totalTime"
+
+	// slow query attributes
+	queryFieldName           = "query"
+	queryTimeFieldName       = "queryTime"
+	streamingFieldName       = "streaming"
+	bindVarsFieldName        = "bindVars"
+	databaseFieldName        = "database"
+	userFieldName            = "user"
+	queryIDFieldName         = "queryId"
+	peakMemoryUsageFieldName = "peakMemoryUsage"
+	fingerprintFieldName     = "fingerprint"
+	checksumFieldName        = "checksum"
+
+	// topics are sent as they're logged, in braces
+	requestsTopic = "{requests}"
+	queriesTopic  = "{queries}"
 )
 
 var timestampFormats = []string{
@@ -40,6 +78,36 @@ var timestampFormats = []string{
 	iso8601LocalTimeFormat,
 }
 
+var (
+	// the text log line: timestamp, optional hostname, [pid-threadid-threadname],
+	// optional role letter, level, optional [logid] and optional {topic}
+	reTextLine = parsers.ExtRegexp{Regexp: regexp.MustCompile(`^(?P<timestamp>\S+) (?:(?P<hostname>[^\s\[]\S*) )?\[(?P<pid>[0-9]+)(?:-(?P<tid>[0-9]+)(?:-(?P<tname>[^\]]+))?)?\] (?:(?P<role>[A-Z-]) )?(?P<level>[A-Z]+) (?:\[(?P<logid>[0-9a-f]{5})\] )?(?:(?P<topic>\{[^}]+\}) )?(?P<message>.*)$`)}
+
+	reSlowQuery = parsers.ExtRegexp{Regexp: regexp.MustCompile(`^slow (?P<streaming>streaming )?query: '(?P<query>.*)'(?P<details>.*), took: (?P<took>[0-9.]+) s`)}
+	// the details logged between the query and the time it took vary by
+	// version, so they're picked out one by one
+	reBindVars        = regexp.MustCompile(`, bind vars: (\{.*?\})(?:, [a-z ]+: |$)`)
+	reDatabase        = regexp.MustCompile(`, database: ([^,]+)`)
+	reUser            = regexp.MustCompile(`, user: ([^,]+)`)
+	reQueryID         = regexp.MustCompile(`, id: ([0-9]+)`)
+	rePeakMemoryUsage = regexp.MustCompile(`, peak memory usage: ([0-9]+)`)
+
+	// AQL comments, which fingerprint doesn't know about
+	reAQLLineComment = regexp.MustCompile(`//[^\n]*`)
+	// AQL arrays of literals, eg. IN [?, ?, ?]
+	reAQLArray = regexp.MustCompile(`\[[\s?,]*\?[\s?,]*\]`)
+
+	// JSON log attributes that are renamed to match the text log's
+	jsonFieldNames = map[string]string{
+		"time":   timestampFieldName,
+		"level":  logLevelFieldName,
+		"topic":  logTopicFieldName,
+		"id":     logIDFieldName,
+		"tid":    threadIDFieldName,
+		"thread": threadNameFieldName,
+	}
+)
+
 // Options type for line parser, so far there are none.
 type Options struct {
 }
@@ -54,34 +122,6 @@ type Parser struct {
 type ArangoLineParser struct {
 }
 
-func firstWord(line *string) (word string, abort bool) {
-	var pos = strings.IndexByte(*line, ' ')
-	if pos < 0 {
-		return "", true
-	}
-	word = (*line)[:pos]
-	*line = (*line)[pos+1:]
-	abort = false
-	return
-}
-
-func removeBrackets(word string) string {
-	var l = len(word)
-	if l < 2 {
-		return word
-	}
-	if word[0] == '(' && word[l-1] == ')' {
-		return word[1 : l-1]
-	}
-	if word[0] == '[' && word[l-1] == ']' {
-		return word[1 : l-1]
-	}
-	if word[0] == '{' && word[l-1] == '}' {
-		return word[1 : l-1]
-	}
-	return word
-}
-
 func removeQuotes(word string) string {
 	if len(word) == 0 {
 		return word
@@ -95,68 +135,177 @@ func removeQuotes(word string) string {
 	return word
 }
 
-// ParseLine method for an ArangoLineParser implementing LineParser.
-func (m *ArangoLineParser) ParseLine(line string) (_ map[string]interface{}, err error) {
-	// Do the actual work here, we look for log lines in the log topic "requests",
-	// there are two types, one is a DEBUG line (could be switched off) containing
-	// the request body, the other is the INFO line marking the end of the
-	// request.
-	var v = make(map[string]interface{})
-	err = errors.New("Line is not a request log line.")
-	var abort bool
-	var s string
-
-	v[timestampFieldName], abort = firstWord(&line)
-	if abort {
-		return
+// ParseLine method for an ArangoLineParser implementing LineParser. It parses
+// the text and the JSON log format, of every topic.
+func (m *ArangoLineParser) ParseLine(line string) (map[string]interface{}, error) {
+	var v map[string]interface{}
+	var err error
+	if strings.HasPrefix(line, "{") {
+		v, err = parseJSONLine(line)
+	} else {
+		v, err = parseTextLine(line)
 	}
-
-	s, abort = firstWord(&line)
-	if abort {
-		return
+	if err != nil {
+		return nil, err
 	}
-	v[pidFieldName] = removeBrackets(s)
-
-	v[logLevelFieldName], abort = firstWord(&line)
-	if abort {
-		return
+	message, _ := v[messageFieldName].(string)
+	topic, _ := v[logTopicFieldName].(string)
+	switch topic {
+	case requestsTopic:
+		parseRequest(v, message)
+	case queriesTopic:
+		parseSlowQuery(v, message)
 	}
+	return v, nil
+}
 
-	s, abort = firstWord(&line)
-	if abort {
-		return
+// parseTextLine splits a text log line into its header fields and message
+func parseTextLine(line string) (map[string]interface{}, error) {
+	_, mg := reTextLine.FindStringSubmatchMap(line)
+	if mg == nil {
+		return nil, errors.New("Line is not an ArangoDB log line.")
 	}
-	v[logTopicFieldName] = s
-
-	if s != "{requests}" {
-		return
+	v := map[string]interface{}{
+		timestampFieldName: mg["timestamp"],
+		pidFieldName:       mg["pid"],
+		logLevelFieldName:  mg["level"],
+		messageFieldName:   mg["message"],
 	}
+	optional := map[string]string{
+		hostnameFieldName:   mg["hostname"],
+		threadNameFieldName: mg["tname"],
+		roleFieldName:       mg["role"],
+		logIDFieldName:      mg["logid"],
+		logTopicFieldName:   mg["topic"],
+	}
+	for k, s := range optional {
+		if s != "" {
+			v[k] = s
+		}
+	}
+	if tid, err := strconv.ParseInt(mg["tid"], 10, 64); err == nil {
+		v[threadIDFieldName] = tid
+	}
+	return v, nil
+}
 
-	var fields = strings.Split(line, ",")
-	if v[logLevelFieldName] == "DEBUG" {
-		if len(fields) != 6 {
-			return
+// parseJSONLine decodes a JSON log line, naming the fields as the text log's
+// are
+func parseJSONLine(line string) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+	var raw map[string]interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	v := make(map[string]interface{}, len(raw))
+	for k, value := range raw {
+		if name, ok := jsonFieldNames[k]; ok {
+			k = name
 		}
-		v[idFieldName] = removeQuotes(fields[1])
-		v[sourceIPFieldName] = removeQuotes(fields[2])
-		v[methodFieldName] = removeQuotes(fields[3])
-		v[protocolFieldName] = removeQuotes(fields[4])
-		v[fullURLFieldName] = removeQuotes(fields[5])
-	} else {
-		if len(fields) != 10 {
-			return
+		if n, ok := value.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				value = i
+			} else if f, err := n.Float64(); err == nil {
+				value = f
+			}
 		}
-		v[idFieldName] = removeQuotes(fields[1])
-		v[sourceIPFieldName] = removeQuotes(fields[2])
-		v[methodFieldName] = removeQuotes(fields[3])
-		v[protocolFieldName] = removeQuotes(fields[4])
+		v[k] = value
+	}
+	// the topic is in braces and the pid is a string in the text log
+	if topic, ok := v[logTopicFieldName].(string); ok && topic != "" {
+		v[logTopicFieldName] = "{" + topic + "}"
+	}
+	if pid, ok := v[pidFieldName].(int64); ok {
+		v[pidFieldName] = strconv.FormatInt(pid, 10)
+	}
+	if t, ok := v[timestampFieldName].(int64); ok {
+		v[timestampFieldName] = strconv.FormatInt(t, 10)
+	} else if t, ok := v[timestampFieldName].(float64); ok {
+		v[timestampFieldName] = strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	return v, nil
+}
+
+// parseRequest adds the fields of a {requests} topic line. There are two
+// types, one is a DEBUG line (could be switched off) containing the request
+// body, the other is the INFO line marking the end of the request. Other
+// lines of the topic are sent as they are.
+func parseRequest(v map[string]interface{}, message string) {
+	reader := csv.NewReader(strings.NewReader(message))
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	fields, err := reader.Read()
+	if err != nil {
+		return
+	}
+	for i := range fields {
+		fields[i] = removeQuotes(fields[i])
+	}
+	switch {
+	case len(fields) >= 10:
+		v[idFieldName] = fields[1]
+		v[sourceIPFieldName] = fields[2]
+		v[methodFieldName] = fields[3]
+		v[protocolFieldName] = fields[4]
 		v[resCodeFieldName], _ = strconv.ParseInt(fields[5], 10, 32)
 		v[reqBodyLenFieldName], _ = strconv.ParseInt(fields[6], 10, 64)
 		v[resBodyLenFieldName], _ = strconv.ParseInt(fields[7], 10, 64)
-		v[fullURLFieldName] = removeQuotes(fields[8])
+		v[fullURLFieldName] = fields[8]
 		v[totalTimeFieldName], _ = strconv.ParseFloat(fields[9], 64)
+	case len(fields) >= 6:
+		v[idFieldName] = fields[1]
+		v[sourceIPFieldName] = fields[2]
+		v[methodFieldName] = fields[3]
+		v[protocolFieldName] = fields[4]
+		v[fullURLFieldName] = fields[5]
+	default:
+		return
 	}
-	return v, nil
+	delete(v, messageFieldName)
+}
+
+// parseSlowQuery adds the fields of a slow query line of the {queries}
+// topic, with the AQL normalized like the mysql parser's queries
+func parseSlowQuery(v map[string]interface{}, message string) {
+	_, mg := reSlowQuery.FindStringSubmatchMap(message)
+	if mg == nil {
+		return
+	}
+	query := mg["query"]
+	v[queryFieldName] = query
+	v[streamingFieldName] = mg["streaming"] != ""
+	if took, err := strconv.ParseFloat(mg["took"], 64); err == nil {
+		v[queryTimeFieldName] = took
+	}
+	details := mg["details"]
+	if m := reBindVars.FindStringSubmatch(details); m != nil {
+		v[bindVarsFieldName] = m[1]
+	}
+	if m := reDatabase.FindStringSubmatch(details); m != nil {
+		v[databaseFieldName] = m[1]
+	}
+	if m := reUser.FindStringSubmatch(details); m != nil {
+		v[userFieldName] = m[1]
+	}
+	if m := reQueryID.FindStringSubmatch(details); m != nil {
+		v[queryIDFieldName], _ = strconv.ParseInt(m[1], 10, 64)
+	}
+	if m := rePeakMemoryUsage.FindStringSubmatch(details); m != nil {
+		v[peakMemoryUsageFieldName], _ = strconv.ParseInt(m[1], 10, 64)
+	}
+	fp := normalizeAQL(query)
+	v[fingerprintFieldName] = fp
+	v[checksumFieldName] = fingerprint.Checksum(fp)
+}
+
+// normalizeAQL abstracts an AQL query the way fingerprint does SQL: literals
+// are replaced by ?, whitespace and comments are normalized, and arrays of
+// literals are collapsed to [?+]
+func normalizeAQL(query string) string {
+	query = reAQLLineComment.ReplaceAllString(query, "")
+	fp := fingerprint.Fingerprint(query)
+	return reAQLArray.ReplaceAllString(fp, "[?+]")
 }
 
 // Init method for parser object.
@@ -220,6 +369,8 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 	logrus.Debug("lines channel is closed, ending arangodb processor")
 }
 
+// parseTimestamp parses the ISO 8601 timestamps, in UTC or local time, and
+// the unix timestamps (optionally in milliseconds) of --log.time-format
 func (p *Parser) parseTimestamp(values map[string]interface{}) (time.Time, error) {
 	timestampValue, ok := values[timestampFieldName].(string)
 	if ok {
@@ -231,6 +382,14 @@ func (p *Parser) parseTimestamp(values map[string]interface{}) (time.Time, error
 				return timestamp, nil
 			}
 		}
+		if unix, ferr := strconv.ParseFloat(timestampValue, 64); ferr == nil {
+			if strings.IndexByte(timestampValue, '.') < 0 && len(timestampValue) > 10 {
+				// timestamp-millis
+				unix /= 1000
+			}
+			sec, frac := math.Modf(unix)
+			return time.Unix(int64(sec), int64(frac*float64(time.Second))).UTC(), nil
+		}
 		return time.Time{}, err
 	}
 
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/honeycombio/honeytail/event"
+
+	"github.com/AIntelligenceGame/clicktail/parsers/fingerprint"
 )
 
 const (
@@ -38,6 +40,7 @@ func TestProcessLines(t *testing.T) {
 				includeData: map[string]interface{}{
 					"pid":      "6402",
 					"logLevel": "DEBUG",
+					"logTopic": "{requests}",
 					"id":       "0x7f87ba86b290",
 					"sourceIP": "127.0.0.1",
 					"method":   "GET",
@@ -54,6 +57,7 @@ func TestProcessLines(t *testing.T) {
 				includeData: map[string]interface{}{
 					"pid":          "6402",
 					"logLevel":     "INFO",
+					"logTopic":     "{requests}",
 					"id":           "0x7f87ba86b290",
 					"sourceIP":     "127.0.0.1",
 					"method":       "GET",
@@ -110,3 +114,129 @@ func TestProcessLines(t *testing.T) {
 		}
 	}
 }
+
+func TestParseLine(t *testing.T) {
+	tlm := []struct {
+		line     string
+		expected map[string]interface{}
+	}{
+		{
+			line: `2021-05-10T09:00:00.123Z [12345-140219716011776] S INFO [cf3f4] {general} ArangoDB (version 3.8.0 [linux]) is ready for business. Have fun!`,
+			expected: map[string]interface{}{
+				"timestamp": "2021-05-10T09:00:00.123Z",
+				"pid":       "12345",
+				"threadId":  int64(140219716011776),
+				"role":      "S",
+				"logLevel":  "INFO",
+				"logId":     "cf3f4",
+				"logTopic":  "{general}",
+				"message":   "ArangoDB (version 3.8.0 [linux]) is ready for business. Have fun!",
+			},
+		},
+		{
+			line: `2016-10-31T16:03:02Z [6402] INFO ArangoDB (version 3.0.12 [linux]) is ready for business. Have fun!`,
+			expected: map[string]interface{}{
+				"timestamp": "2016-10-31T16:03:02Z",
+				"pid":       "6402",
+				"logLevel":  "INFO",
+				"message":   "ArangoDB (version 3.0.12 [linux]) is ready for business. Have fun!",
+			},
+		},
+		{
+			line: `2021-05-10T09:01:00Z [12345] WARNING [e6b16] {replication} could not connect to leader at tcp://10.0.0.1:8529`,
+			expected: map[string]interface{}{
+				"timestamp": "2021-05-10T09:01:00Z",
+				"pid":       "12345",
+				"logLevel":  "WARNING",
+				"logId":     "e6b16",
+				"logTopic":  "{replication}",
+				"message":   "could not connect to leader at tcp://10.0.0.1:8529",
+			},
+		},
+		{
+			line: `2021-05-10T09:01:00Z [12345] WARNING [8bcee] {queries} slow query: 'FOR u IN users FILTER u.age > 30 AND u.id IN [1, 2, 3] RETURN u', bind vars: {"a":1}, database: _system, user: root, id: 77, peak memory usage: 32768, took: 12.345678 s`,
+			expected: map[string]interface{}{
+				"timestamp":       "2021-05-10T09:01:00Z",
+				"pid":             "12345",
+				"logLevel":        "WARNING",
+				"logId":           "8bcee",
+				"logTopic":        "{queries}",
+				"message":         `slow query: 'FOR u IN users FILTER u.age > 30 AND u.id IN [1, 2, 3] RETURN u', bind vars: {"a":1}, database: _system, user: root, id: 77, peak memory usage: 32768, took: 12.345678 s`,
+				"query":           "FOR u IN users FILTER u.age > 30 AND u.id IN [1, 2, 3] RETURN u",
+				"queryTime":       12.345678,
+				"streaming":       false,
+				"bindVars":        `{"a":1}`,
+				"database":        "_system",
+				"user":            "root",
+				"queryId":         int64(77),
+				"peakMemoryUsage": int64(32768),
+				"fingerprint":     "for u in users filter u.age > ? and u.id in [?+] return u",
+				"checksum":        fingerprint.Checksum("for u in users filter u.age > ? and u.id in [?+] return u"),
+			},
+		},
+		{
+			line: `{"time":"2021-05-10T09:02:00Z","pid":12345,"level":"WARNING","topic":"queries","id":"8bcee","hostname":"db1","role":"SINGLE","tid":42,"thread":"SchedWorker","message":"slow streaming query: 'FOR d IN docs SORT d.x RETURN d', took: 3.5 s"}`,
+			expected: map[string]interface{}{
+				"timestamp":   "2021-05-10T09:02:00Z",
+				"pid":         "12345",
+				"logLevel":    "WARNING",
+				"logTopic":    "{queries}",
+				"logId":       "8bcee",
+				"hostname":    "db1",
+				"role":        "SINGLE",
+				"threadId":    int64(42),
+				"threadName":  "SchedWorker",
+				"message":     "slow streaming query: 'FOR d IN docs SORT d.x RETURN d', took: 3.5 s",
+				"query":       "FOR d IN docs SORT d.x RETURN d",
+				"queryTime":   3.5,
+				"streaming":   true,
+				"fingerprint": "for d in docs sort d.x return d",
+				"checksum":    fingerprint.Checksum("for d in docs sort d.x return d"),
+			},
+		},
+		{
+			line: `{"time":"2021-05-10T09:02:01Z","pid":12345,"level":"INFO","topic":"requests","id":"e7b3c","message":"\"http-request-end\",\"0x7f87ba86b290\",\"127.0.0.1\",\"GET\",\"HTTP/1.1\",200,0,64,\"/_api/version\",0.000139"}`,
+			expected: map[string]interface{}{
+				"timestamp":    "2021-05-10T09:02:01Z",
+				"pid":          "12345",
+				"logLevel":     "INFO",
+				"logTopic":     "{requests}",
+				"logId":        "e7b3c",
+				"id":           "0x7f87ba86b290",
+				"sourceIP":     "127.0.0.1",
+				"method":       "GET",
+				"protocol":     "HTTP/1.1",
+				"responseCode": int64(200),
+				"reqBodyLen":   int64(0),
+				"resBodyLen":   int64(64),
+				"fullURL":      "/_api/version",
+				"totalTime":    0.000139,
+			},
+		},
+	}
+	m := &ArangoLineParser{}
+	for _, tc := range tlm {
+		v, err := m.ParseLine(tc.line)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %s: %v", tc.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tc.expected) {
+			t.Errorf("Parsed data didn't match up for %s.\n  Expected: %+v\n  Actual: %+v", tc.line, tc.expected, v)
+		}
+	}
+
+	if _, err := m.ParseLine("not an arangodb log line"); err == nil {
+		t.Error("Expected an error for a line that isn't an ArangoDB log line")
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	p := &Parser{}
+	for _, ts := range []string{"2016-10-31T16:03:02Z", "2016-10-31T16:03:02.000Z", "1477929782", "1477929782000"} {
+		timestamp, err := p.parseTimestamp(map[string]interface{}{"timestamp": ts})
+		if err != nil || !timestamp.Equal(T1) {
+			t.Errorf("Parsed timestamp didn't match up for %s.\n  Expected: %+v\n  Actual: %+v (%v)", ts, T1, timestamp, err)
+		}
+	}
+}
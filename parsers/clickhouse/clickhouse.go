@@ -0,0 +1,198 @@
+// Package clickhouse parses the ClickHouse server's text log,
+// clickhouse-server.log and clickhouse-server.err.log
+package clickhouse
+
+import (
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/AIntelligenceGame/clicktail/parsers/fieldtype"
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/httime"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+// Sample log lines, by server version
+//
+// 19.x and later, with the query ID in braces, empty outside of queries:
+// 2026.10.19 10:21:00.123456 [ 48 ] {} <Information> Application: Ready for connections.
+// 2026.10.19 10:21:05.004312 [ 61 ] {5b1a2f4e-8c3d-4e0a-9f1b-2c3d4e5f6a7b} <Debug> executeQuery: (from [::1]:50412) SELECT count() FROM hits
+// 2026.10.19 10:21:05.011207 [ 61 ] {5b1a2f4e-8c3d-4e0a-9f1b-2c3d4e5f6a7b} <Information> executeQuery: Read 8873898 rows, 67.70 MiB in 0.006745 sec., 1315625370 rows/sec., 9.80 GiB/sec.
+//
+// Older versions, without the query ID:
+// 2018.05.20 10:00:00.000123 [ 1 ] <Information> Application: Ready for connections.
+//
+// Lines that don't start with a timestamp, such as the stack trace of an
+// exception, continue the message of the line before.
+
+const (
+	// Event attributes
+	threadIDKey      = "thread_id"
+	queryIDKey       = "query_id"
+	levelKey         = "level"
+	loggerKey        = "logger"
+	messageKey       = "message"
+	exceptionCodeKey = "exception_code"
+	readRowsKey      = "read_rows"
+	readBytesKey     = "read_bytes"
+	elapsedKey       = "elapsed"
+
+	timeFormat = "2006.01.02 15:04:05.999999"
+)
+
+var (
+	reEntry = parsers.ExtRegexp{Regexp: regexp.MustCompile(`^(?P<time>[0-9]{4}\.[0-9]{2}\.[0-9]{2} [0-9]{2}:[0-9]{2}:[0-9]{2}(?:\.[0-9]+)?) \[ *(?P<thread>[0-9]+) *\] (?:\{(?P<query>[^}]*)\} )?<(?P<level>[A-Za-z]+)> (?:(?P<logger>[^:]*?): )?(?P<message>.*)$`)}
+	// the summary logged when a query finishes
+	reReadRows = parsers.ExtRegexp{Regexp: regexp.MustCompile(`^Read (?P<rows>[0-9]+) rows, (?P<bytes>[0-9.]+ [KMGTPE]?i?B) in (?P<elapsed>[0-9.]+) sec\.`)}
+	reCode     = parsers.ExtRegexp{Regexp: regexp.MustCompile(`\bCode: (?P<code>[0-9]+)[.,]`)}
+
+	sizeConverter, _ = fieldtype.New(fieldtype.Size, "")
+)
+
+type Options struct {
+	Levels []string `long:"level" description:"Only send entries with this level (eg Error, Warning). May be specified multiple times. Defaults to all levels"`
+}
+
+type Parser struct {
+	// set SampleRate to cause the parser to drop events after before they're
+	// parsed to save CPU
+	SampleRate int
+
+	conf   Options
+	levels map[string]bool
+}
+
+func (p *Parser) Init(options interface{}) error {
+	p.conf = *options.(*Options)
+	if len(p.conf.Levels) > 0 {
+		p.levels = make(map[string]bool, len(p.conf.Levels))
+		for _, l := range p.conf.Levels {
+			p.levels[strings.ToLower(l)] = true
+		}
+	}
+	return nil
+}
+
+func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+	var (
+		groupedLines []string
+		// the fields of the prefix of the entry's first line
+		groupPrefixFields map[string]string
+	)
+	flush := func() {
+		if len(groupedLines) == 0 {
+			return
+		}
+		// if sampling is disabled or sampler says keep, pass along this group.
+		if p.SampleRate <= 1 || rand.Intn(p.SampleRate) == 0 {
+			data, timestamp := handleEvent(groupedLines)
+			if len(data) != 0 && p.keep(data) {
+				// merge the prefix fields and the parsed entry contents
+				for k, v := range groupPrefixFields {
+					data[k] = v
+				}
+				send <- event.Event{
+					Timestamp:  timestamp,
+					SampleRate: p.SampleRate,
+					Data:       data,
+				}
+			}
+		}
+		groupedLines = nil
+		groupPrefixFields = nil
+	}
+	for line := range lines {
+		line = strings.TrimRight(line, "\r\n")
+		// take care of any headers on the line
+		var prefixFields map[string]string
+		if prefixRegex != nil {
+			var prefix string
+			prefix, prefixFields = prefixRegex.FindStringSubmatchMap(line)
+			line = strings.TrimPrefix(line, prefix)
+		}
+		if reEntry.MatchString(line) {
+			flush()
+			groupedLines = []string{line}
+			groupPrefixFields = prefixFields
+			continue
+		}
+		if len(groupedLines) == 0 {
+			logrus.WithFields(logrus.Fields{
+				"line": line,
+			}).Debug("skipping line that doesn't start an entry")
+			continue
+		}
+		groupedLines = append(groupedLines, line)
+	}
+	// send the last event, if there was one collected
+	flush()
+	logrus.Debug("lines channel is closed, ending clickhouse processor")
+}
+
+// keep returns false for events filtered out by --clickhouse.level
+func (p *Parser) keep(data map[string]interface{}) bool {
+	if p.levels == nil {
+		return true
+	}
+	level, _ := data[levelKey].(string)
+	return p.levels[strings.ToLower(level)]
+}
+
+// handleEvent turns the lines of one log entry into an event
+func handleEvent(rawE []string) (map[string]interface{}, time.Time) {
+	if len(rawE) == 0 {
+		return nil, time.Time{}
+	}
+	_, mg := reEntry.FindStringSubmatchMap(rawE[0])
+	if mg == nil {
+		return nil, time.Time{}
+	}
+	data := map[string]interface{}{}
+	if thread, err := strconv.ParseInt(mg["thread"], 10, 64); err == nil {
+		data[threadIDKey] = thread
+	}
+	if mg["query"] != "" {
+		data[queryIDKey] = mg["query"]
+	}
+	data[levelKey] = mg["level"]
+	if mg["logger"] != "" {
+		data[loggerKey] = mg["logger"]
+	}
+	message := strings.TrimRight(strings.Join(append([]string{mg["message"]}, rawE[1:]...), "\n"), " \n")
+	data[messageKey] = message
+	if _, rg := reReadRows.FindStringSubmatchMap(message); rg != nil {
+		if rows, err := strconv.ParseInt(rg["rows"], 10, 64); err == nil {
+			data[readRowsKey] = rows
+		}
+		if bytes, err := sizeConverter.Convert(rg["bytes"]); err == nil {
+			data[readBytesKey] = bytes
+		}
+		if elapsed, err := strconv.ParseFloat(rg["elapsed"], 64); err == nil {
+			data[elapsedKey] = elapsed
+		}
+	}
+	if _, cg := reCode.FindStringSubmatchMap(message); cg != nil {
+		if code, err := strconv.ParseInt(cg["code"], 10, 64); err == nil {
+			data[exceptionCodeKey] = code
+		}
+	}
+	return data, parseTime(mg["time"])
+}
+
+// parseTime parses the entry's timestamp, falling back to now
+func parseTime(t string) time.Time {
+	timestamp, err := httime.Parse(timeFormat, t)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"time":  t,
+			"error": err,
+		}).Debug("failed to parse time")
+		return httime.Now()
+	}
+	return timestamp
+}
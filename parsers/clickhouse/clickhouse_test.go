@@ -0,0 +1,135 @@
+package clickhouse
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+func TestHandleEvent(t *testing.T) {
+	testCases := []struct {
+		lines    []string
+		expected map[string]interface{}
+		time     time.Time
+	}{
+		{
+			lines: []string{"2026.10.19 10:21:00.123456 [ 48 ] {} <Information> Application: Ready for connections."},
+			expected: map[string]interface{}{
+				threadIDKey: int64(48),
+				levelKey:    "Information",
+				loggerKey:   "Application",
+				messageKey:  "Ready for connections.",
+			},
+			time: time.Date(2026, 10, 19, 10, 21, 0, 123456000, time.UTC),
+		},
+		{
+			lines: []string{"2026.10.19 10:21:05.011207 [ 61 ] {5b1a2f4e-8c3d-4e0a-9f1b-2c3d4e5f6a7b} <Information> executeQuery: Read 8873898 rows, 67.70 MiB in 0.006745 sec., 1315625370 rows/sec., 9.80 GiB/sec."},
+			expected: map[string]interface{}{
+				threadIDKey:  int64(61),
+				queryIDKey:   "5b1a2f4e-8c3d-4e0a-9f1b-2c3d4e5f6a7b",
+				levelKey:     "Information",
+				loggerKey:    "executeQuery",
+				messageKey:   "Read 8873898 rows, 67.70 MiB in 0.006745 sec., 1315625370 rows/sec., 9.80 GiB/sec.",
+				readRowsKey:  int64(8873898),
+				readBytesKey: int64(70988595),
+				elapsedKey:   0.006745,
+			},
+			time: time.Date(2026, 10, 19, 10, 21, 5, 11207000, time.UTC),
+		},
+		{
+			lines: []string{
+				"2026.10.19 10:22:00.000001 [ 62 ] {0f0e} <Error> executeQuery: Code: 60. DB::Exception: Table default.x doesn't exist. (UNKNOWN_TABLE) (version 22.8.1.1) (from [::1]:50414) (in query: SELECT * FROM x), Stack trace (when copying this message, always include the lines below):",
+				"",
+				"0. DB::Exception::Exception() @ 0xa3d3bda in /usr/bin/clickhouse",
+				"1. DB::Context::getTable() @ 0x1234567 in /usr/bin/clickhouse",
+				"",
+			},
+			expected: map[string]interface{}{
+				threadIDKey:      int64(62),
+				queryIDKey:       "0f0e",
+				levelKey:         "Error",
+				loggerKey:        "executeQuery",
+				messageKey:       "Code: 60. DB::Exception: Table default.x doesn't exist. (UNKNOWN_TABLE) (version 22.8.1.1) (from [::1]:50414) (in query: SELECT * FROM x), Stack trace (when copying this message, always include the lines below):\n\n0. DB::Exception::Exception() @ 0xa3d3bda in /usr/bin/clickhouse\n1. DB::Context::getTable() @ 0x1234567 in /usr/bin/clickhouse",
+				exceptionCodeKey: int64(60),
+			},
+			time: time.Date(2026, 10, 19, 10, 22, 0, 1000, time.UTC),
+		},
+		{
+			lines: []string{"2018.05.20 10:00:00.000123 [ 1 ] <Warning> default.hits (StorageReplicatedMergeTree): No metadata in ZooKeeper"},
+			expected: map[string]interface{}{
+				threadIDKey: int64(1),
+				levelKey:    "Warning",
+				loggerKey:   "default.hits (StorageReplicatedMergeTree)",
+				messageKey:  "No metadata in ZooKeeper",
+			},
+			time: time.Date(2018, 5, 20, 10, 0, 0, 123000, time.UTC),
+		},
+	}
+	for _, tc := range testCases {
+		data, timestamp := handleEvent(tc.lines)
+		assert.Equal(t, tc.expected, data)
+		assert.Equal(t, tc.time, timestamp)
+	}
+}
+
+func TestProcessLines(t *testing.T) {
+	p := &Parser{}
+	p.Init(&Options{Levels: []string{"error", "information"}})
+	lines := make(chan string)
+	send := make(chan event.Event, 10)
+	go func() {
+		for _, line := range []string{
+			"stray line before the first entry",
+			"2026.10.19 10:21:05.004312 [ 61 ] {q1} <Debug> executeQuery: (from [::1]:50412) SELECT 1",
+			"2026.10.19 10:21:05.011207 [ 61 ] {q1} <Information> executeQuery: Read 1 rows, 1.00 B in 0.000597 sec., 1675 rows/sec., 1.64 KiB/sec.",
+			"2026.10.19 10:22:00.000001 [ 62 ] {q2} <Error> TCPHandler: Code: 210. DB::NetException: Connection reset by peer, Stack trace:",
+			"",
+			"0. Poco::Net::SocketImpl::error() @ 0x1 in /usr/bin/clickhouse",
+		} {
+			lines <- line
+		}
+		close(lines)
+	}()
+	p.ProcessLines(lines, send, nil)
+	close(send)
+
+	var events []event.Event
+	for ev := range send {
+		events = append(events, ev)
+	}
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, "q1", events[0].Data[queryIDKey])
+		assert.Equal(t, int64(1), events[0].Data[readRowsKey])
+		assert.Equal(t, int64(1), events[0].Data[readBytesKey])
+		assert.Equal(t, int64(210), events[1].Data[exceptionCodeKey])
+		assert.Equal(t, "Code: 210. DB::NetException: Connection reset by peer, Stack trace:\n\n0. Poco::Net::SocketImpl::error() @ 0x1 in /usr/bin/clickhouse", events[1].Data[messageKey])
+	}
+}
+
+func TestPrefixFields(t *testing.T) {
+	p := &Parser{}
+	p.Init(&Options{})
+	prefix := &parsers.ExtRegexp{Regexp: regexp.MustCompile(`^(?P<hostname>\S+): `)}
+	lines := make(chan string)
+	send := make(chan event.Event, 10)
+	go func() {
+		for _, line := range []string{
+			"ch1: 2026.10.19 10:22:00.000001 [ 62 ] {q2} <Error> TCPHandler: Code: 210. DB::NetException: Connection reset by peer, Stack trace:",
+			"ch2: 0. Poco::Net::SocketImpl::error() @ 0x1 in /usr/bin/clickhouse",
+		} {
+			lines <- line
+		}
+		close(lines)
+	}()
+	p.ProcessLines(lines, send, prefix)
+	close(send)
+
+	ev := <-send
+	assert.Equal(t, "ch1", ev.Data["hostname"])
+	assert.Equal(t, "Code: 210. DB::NetException: Connection reset by peer, Stack trace:\n0. Poco::Net::SocketImpl::error() @ 0x1 in /usr/bin/clickhouse", ev.Data[messageKey])
+}
@@ -0,0 +1,377 @@
+// Package csv consumes CSV and TSV logs, with the columns named by a header
+// row or given in the config
+package csv
+
+import (
+	"bufio"
+	stdcsv "encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/AIntelligenceGame/clicktail/parsers/fieldtype"
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/httime"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+type Options struct {
+	Columns         string   `long:"columns" description:"Comma separated names of the columns. If not set, they're read from the header row at the start of the first log file, or taken from the first line read when reading stdin; a header row is skipped either way."`
+	Delimiter       string   `long:"delimiter" description:"Character the columns are separated by; use \"tab\" or \"\\t\" for TSV. Defaults to a tab for the tsv parser and a comma otherwise."`
+	Comment         string   `long:"comment" description:"Lines starting with this character are skipped, eg. \"#\""`
+	TimeFieldName   string   `long:"timefield" description:"Name of the column that contains a timestamp"`
+	TimeFieldFormat string   `long:"time_format" description:"Timestamp format to use (strftime and Golang time.Parse supported)"`
+	FieldTypes      []string `long:"field_type" description:"Type to convert a column to instead of guessing, as field:type[:arg], eg. \"zip:string\". Types are string, int, float, bool, duration (arg is the unit, default ms), ip, timestamp (arg is the format) and size (eg. 10KB, in bytes). May be specified multiple times."`
+
+	NumParsers int      `hidden:"true" description:"number of csv parsers to spin up"`
+	LogFiles   []string `hidden:"true" description:"log files to read the header row from"`
+}
+
+// maxRecordLines is the most lines a record can span. Past it, a quote was
+// most likely never closed, and the lines are dropped rather than buffered
+// until the end of the file.
+const maxRecordLines = 1000
+
+type Parser struct {
+	conf       Options
+	lineParser *CSVLineParser
+}
+
+func (p *Parser) Init(options interface{}) error {
+	p.conf = *options.(*Options)
+	delimiter, err := parseDelimiter(p.conf.Delimiter)
+	if err != nil {
+		return err
+	}
+	var comment rune
+	if p.conf.Comment != "" {
+		if comment, err = parseDelimiter(p.conf.Comment); err != nil {
+			return fmt.Errorf("invalid comment character %q", p.conf.Comment)
+		}
+	}
+	fieldTypes, err := fieldtype.ParseFields(p.conf.FieldTypes)
+	if err != nil {
+		return err
+	}
+	p.lineParser = &CSVLineParser{
+		delimiter:  delimiter,
+		comment:    comment,
+		fieldTypes: fieldTypes,
+	}
+	if p.conf.Columns != "" {
+		columns := strings.Split(p.conf.Columns, ",")
+		for i, column := range columns {
+			columns[i] = strings.TrimSpace(column)
+			if columns[i] == "" {
+				return fmt.Errorf("invalid --csv.columns %q, column %d has no name", p.conf.Columns, i+1)
+			}
+		}
+		p.lineParser.columns = columns
+		return nil
+	}
+	// tailing usually resumes mid-file or starts at its end, so the header
+	// row has to be read from the start of the file
+	columns, err := p.lineParser.readHeaderFromFiles(p.conf.LogFiles)
+	if err != nil {
+		return err
+	}
+	p.lineParser.columns = columns
+	return nil
+}
+
+// readHeaderFromFiles returns the columns of the header row of the first of
+// the files that exists and isn't empty, or nil if there's none
+func (c *CSVLineParser) readHeaderFromFiles(patterns []string) ([]string, error) {
+	for _, pattern := range patterns {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			if info, err := os.Stat(file); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			columns, err := c.readHeader(file)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't read the csv header row of %s: %s", file, err)
+			}
+			if columns != nil {
+				return columns, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// readHeader returns the columns of the first record of a file, or nil if it
+// has none
+func (c *CSVLineParser) readHeader(file string) ([]string, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	r := bufio.NewReader(fh)
+	var pending []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if line == "" && err == io.EOF {
+			return nil, nil
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(pending) == 0 {
+			if strings.TrimSpace(line) == "" || (c.comment != 0 && strings.HasPrefix(line, string(c.comment))) {
+				if err == io.EOF {
+					return nil, nil
+				}
+				continue
+			}
+		}
+		pending = append(pending, line)
+		text := strings.Join(pending, "\n")
+		if openQuote(text) {
+			if err == io.EOF || len(pending) >= maxRecordLines {
+				return nil, errors.New("the header row has an unclosed quote")
+			}
+			continue
+		}
+		values, perr := c.parseRecord(text)
+		if perr != nil {
+			return nil, perr
+		}
+		return headerColumns(values)
+	}
+}
+
+// headerColumns returns the column names of a header row
+func headerColumns(values []string) ([]string, error) {
+	columns := make([]string, len(values))
+	for i, v := range values {
+		columns[i] = strings.TrimSpace(v)
+		if columns[i] == "" {
+			return nil, fmt.Errorf("column %d of the header row has no name", i+1)
+		}
+	}
+	return columns, nil
+}
+
+// parseDelimiter returns the single character of a delimiter, which may be
+// written as tab or \t
+func parseDelimiter(delimiter string) (rune, error) {
+	switch delimiter {
+	case "":
+		return ',', nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(delimiter)
+	if size != len(delimiter) || r == '"' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("invalid delimiter %q, expected a single character", delimiter)
+	}
+	return r, nil
+}
+
+// CSVLineParser parses records into fields named by the columns
+type CSVLineParser struct {
+	delimiter  rune
+	comment    rune
+	columns    []string
+	fieldTypes fieldtype.Fields
+}
+
+// parseRecord splits a record, which may span lines, into its values
+func (c *CSVLineParser) parseRecord(record string) ([]string, error) {
+	reader := stdcsv.NewReader(strings.NewReader(record))
+	reader.Comma = c.delimiter
+	reader.FieldsPerRecord = -1
+	return reader.Read()
+}
+
+// isHeader returns whether the values are the header row
+func (c *CSVLineParser) isHeader(values []string) bool {
+	if len(values) != len(c.columns) {
+		return false
+	}
+	for i, v := range values {
+		if strings.TrimSpace(v) != c.columns[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLine returns the values of a record by column, typed. Empty values
+// are left out.
+func (c *CSVLineParser) ParseLine(record string) (map[string]interface{}, error) {
+	values, err := c.parseRecord(record)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) > len(c.columns) {
+		logrus.WithFields(logrus.Fields{
+			"record":  record,
+			"values":  len(values),
+			"columns": len(c.columns),
+		}).Debug("record has more values than columns, dropping the extra ones")
+	}
+	fields := make(map[string]string, len(c.columns))
+	for i, v := range values {
+		if i < len(c.columns) && v != "" {
+			fields[c.columns[i]] = v
+		}
+	}
+	return c.fieldTypes.ConvertOrInfer(fields), nil
+}
+
+// record is one or more lines with a complete CSV record, and the fields of
+// the prefix of its first line
+type record struct {
+	text         string
+	prefixFields map[string]string
+}
+
+func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+	records := make(chan record)
+	go p.readRecords(lines, records, prefixRegex)
+
+	wg := sync.WaitGroup{}
+	numParsers := 1
+	if p.conf.NumParsers > 0 {
+		numParsers = p.conf.NumParsers
+	}
+	for i := 0; i < numParsers; i++ {
+		wg.Add(1)
+		go func() {
+			for rec := range records {
+				parsedLine, err := p.lineParser.ParseLine(rec.text)
+				if err != nil {
+					logrus.WithFields(logrus.Fields{
+						"record": rec.text,
+						"error":  err,
+					}).Debug("skipping record; failed to parse.")
+					continue
+				}
+				if len(parsedLine) == 0 {
+					continue
+				}
+				// merge the prefix fields and the parsed record contents
+				for k, v := range rec.prefixFields {
+					parsedLine[k] = v
+				}
+
+				send <- event.Event{
+					Timestamp: httime.GetTimestamp(parsedLine, p.conf.TimeFieldName, p.conf.TimeFieldFormat),
+					Data:      parsedLine,
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	logrus.Debug("lines channel is closed, ending csv processor")
+}
+
+// readRecords joins the lines of quoted values with newlines in them into
+// records, and takes the columns from the header row if they aren't
+// configured. It's the only reader of lines, so records stay whole.
+func (p *Parser) readRecords(lines <-chan string, records chan<- record, prefixRegex *parsers.ExtRegexp) {
+	defer close(records)
+	var (
+		pending      []string
+		prefixFields map[string]string
+	)
+	for line := range lines {
+		line = strings.TrimRight(line, "\r")
+		logrus.WithFields(logrus.Fields{
+			"line": line,
+		}).Debug("Attempting to process csv log line")
+
+		if len(pending) == 0 {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if p.lineParser.comment != 0 && strings.HasPrefix(line, string(p.lineParser.comment)) {
+				continue
+			}
+			// take care of any headers on the line
+			prefixFields = nil
+			if prefixRegex != nil {
+				var prefix string
+				prefix, prefixFields = prefixRegex.FindStringSubmatchMap(line)
+				line = strings.TrimPrefix(line, prefix)
+			}
+		}
+		pending = append(pending, line)
+		text := strings.Join(pending, "\n")
+		if openQuote(text) {
+			if len(pending) < maxRecordLines {
+				// a quoted value goes on to the next line
+				continue
+			}
+			logrus.WithFields(logrus.Fields{
+				"lines": len(pending),
+				"start": pending[0],
+			}).Warn("skipping record; its quoted value wasn't closed within the line limit.")
+			pending = pending[:0]
+			continue
+		}
+		pending = pending[:0]
+
+		if err := p.handleHeader(text); err != errNotHeader {
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"record": text,
+					"error":  err,
+				}).Error("couldn't parse the csv header row")
+			}
+			continue
+		}
+		records <- record{text: text, prefixFields: prefixFields}
+	}
+	if len(pending) > 0 {
+		logrus.WithFields(logrus.Fields{
+			"record": strings.Join(pending, "\n"),
+		}).Debug("skipping record; the file ended inside a quoted value.")
+	}
+}
+
+var errNotHeader = errors.New("not a header row")
+
+// handleHeader takes the columns from the first record if they aren't
+// configured, and returns errNotHeader for records that aren't a header row
+func (p *Parser) handleHeader(text string) error {
+	values, err := p.lineParser.parseRecord(text)
+	if err != nil {
+		// it'll be logged when it's parsed
+		return errNotHeader
+	}
+	if p.lineParser.columns == nil {
+		columns, err := headerColumns(values)
+		if err != nil {
+			return err
+		}
+		p.lineParser.columns = columns
+		return nil
+	}
+	if p.lineParser.isHeader(values) {
+		// repeated when files are rotated or concatenated
+		return nil
+	}
+	return errNotHeader
+}
+
+// openQuote returns whether the text ends inside a quoted value. Escaped
+// quotes ("") toggle twice, so counting them all works.
+func openQuote(text string) bool {
+	return strings.Count(text, `"`)%2 == 1
+}
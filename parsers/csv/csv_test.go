@@ -0,0 +1,140 @@
+package csv
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+func processLines(t *testing.T, opts *Options, input []string) []event.Event {
+	p := &Parser{}
+	assert.NoError(t, p.Init(opts))
+	lines := make(chan string)
+	send := make(chan event.Event)
+	go func() {
+		for _, line := range input {
+			lines <- line
+		}
+		close(lines)
+	}()
+	go func() {
+		p.ProcessLines(lines, send, nil)
+		close(send)
+	}()
+	var events []event.Event
+	for ev := range send {
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestProcessLinesHeaderRow(t *testing.T) {
+	events := processLines(t, &Options{
+		TimeFieldName: "time",
+		FieldTypes:    []string{"zip:string"},
+	}, []string{
+		`time,user,zip,took,note`,
+		`2017-11-07T01:43:39Z,alice,02134,1.5,"said ""hi"", then left"`,
+		`time,user,zip,took,note`,
+		`2017-11-07T01:43:40Z,bob,10001,,"line one`,
+		`line two"`,
+	})
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, time.Date(2017, 11, 7, 1, 43, 39, 0, time.UTC), events[0].Timestamp.UTC())
+	assert.Equal(t, map[string]interface{}{
+		"user": "alice",
+		"zip":  "02134",
+		"took": 1.5,
+		"note": `said "hi", then left`,
+	}, events[0].Data)
+	assert.Equal(t, map[string]interface{}{
+		"user": "bob",
+		"zip":  "10001",
+		"note": "line one\nline two",
+	}, events[1].Data)
+}
+
+func TestProcessLinesConfiguredColumns(t *testing.T) {
+	events := processLines(t, &Options{
+		Columns:   "host, status, bytes",
+		Delimiter: "tab",
+		Comment:   "#",
+	}, []string{
+		"#Fields: host status bytes",
+		"host\tstatus\tbytes",
+		"example.com\t200\t512\textra",
+		"",
+		"example.org\t404",
+	})
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, map[string]interface{}{
+		"host":   "example.com",
+		"status": int64(200),
+		"bytes":  int64(512),
+	}, events[0].Data)
+	assert.Equal(t, map[string]interface{}{
+		"host":   "example.org",
+		"status": int64(404),
+	}, events[1].Data)
+}
+
+func TestInit(t *testing.T) {
+	for _, opts := range []*Options{
+		{Delimiter: ",,"},
+		{Delimiter: `"`},
+		{Comment: "//"},
+		{FieldTypes: []string{"zip"}},
+		{Columns: "host,,bytes"},
+	} {
+		p := &Parser{}
+		assert.Error(t, p.Init(opts), "%+v", opts)
+	}
+	p := &Parser{}
+	assert.NoError(t, p.Init(&Options{Delimiter: `\t`}))
+	assert.Equal(t, '\t', p.lineParser.delimiter)
+	assert.NoError(t, p.Init(&Options{Delimiter: ";"}))
+	assert.Equal(t, ';', p.lineParser.delimiter)
+}
+
+func TestInitReadsHeaderFromFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "requests.csv")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("# written by app\n\n\"user\nname\",zip\nalice,02134\n"), 0644))
+
+	// resuming mid-file, the first line read is data, not the header
+	events := processLines(t, &Options{
+		Comment:  "#",
+		LogFiles: []string{filepath.Join(dir, "missing.csv"), filepath.Join(dir, "*.csv")},
+	}, []string{
+		"bob,10001",
+		"\"user\nname\",zip",
+	})
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, map[string]interface{}{
+		"user\nname": "bob",
+		"zip":        int64(10001),
+	}, events[0].Data)
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte("user,,zip\n"), 0644))
+	p := &Parser{}
+	assert.Error(t, p.Init(&Options{LogFiles: []string{file}}))
+}
+
+func TestProcessLinesUnclosedQuote(t *testing.T) {
+	input := []string{`alice,"never closed`}
+	for i := 1; i < maxRecordLines; i++ {
+		input = append(input, "more")
+	}
+	input = append(input, "bob,2")
+	events := processLines(t, &Options{Columns: "user,n"}, input)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, map[string]interface{}{
+		"user": "bob",
+		"n":    int64(2),
+	}, events[0].Data)
+}
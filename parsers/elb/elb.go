@@ -0,0 +1,232 @@
+// Package elb consumes AWS Application and Classic Load Balancer access logs
+package elb
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/AIntelligenceGame/clicktail/parsers/fieldtype"
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/httime"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+// applicationFields are the fields of an ALB log entry, in order. Newer
+// fields are appended to the format, so entries may have fewer or more.
+// https://docs.aws.amazon.com/elasticloadbalancing/latest/application/load-balancer-access-logs.html
+var applicationFields = []string{
+	"type",
+	"time",
+	"elb",
+	"client:port",
+	"target:port",
+	"request_processing_time",
+	"target_processing_time",
+	"response_processing_time",
+	"elb_status_code",
+	"target_status_code",
+	"received_bytes",
+	"sent_bytes",
+	"request",
+	"user_agent",
+	"ssl_cipher",
+	"ssl_protocol",
+	"target_group_arn",
+	"trace_id",
+	"domain_name",
+	"chosen_cert_arn",
+	"matched_rule_priority",
+	"request_creation_time",
+	"actions_executed",
+	"redirect_url",
+	"error_reason",
+	"target_port_list",
+	"target_status_code_list",
+	"classification",
+	"classification_reason",
+	"conn_trace_id",
+}
+
+// classicFields are the fields of a Classic Load Balancer log entry
+// https://docs.aws.amazon.com/elasticloadbalancing/latest/classic/access-log-collection.html
+var classicFields = []string{
+	"time",
+	"elb",
+	"client:port",
+	"backend:port",
+	"request_processing_time",
+	"backend_processing_time",
+	"response_processing_time",
+	"elb_status_code",
+	"backend_status_code",
+	"received_bytes",
+	"sent_bytes",
+	"request",
+	"user_agent",
+	"ssl_cipher",
+	"ssl_protocol",
+}
+
+// applicationTypes are the request types ALB entries start with
+var applicationTypes = map[string]bool{
+	"http":  true,
+	"https": true,
+	"h2":    true,
+	"grpcs": true,
+	"ws":    true,
+	"wss":   true,
+}
+
+const timeField = "time"
+
+type Options struct {
+	FieldTypes []string `long:"field_type" description:"Type to convert a field to instead of guessing, as field:type[:arg], eg. \"client_ip:ip\". Types are string, int, float, bool, duration (arg is the unit, default ms), ip, timestamp (arg is the format) and size (eg. 10KB, in bytes). May be specified multiple times."`
+
+	NumParsers int `hidden:"true" description:"number of elb parsers to spin up"`
+}
+
+type Parser struct {
+	conf       Options
+	lineParser *ELBLineParser
+}
+
+func (p *Parser) Init(options interface{}) error {
+	p.conf = *options.(*Options)
+	fieldTypes, err := fieldtype.ParseFields(p.conf.FieldTypes)
+	if err != nil {
+		return err
+	}
+	p.lineParser = &ELBLineParser{fieldTypes: fieldTypes}
+	return nil
+}
+
+// ELBLineParser parses ALB and Classic Load Balancer entries, telling them
+// apart by the request type ALB entries start with
+type ELBLineParser struct {
+	fieldTypes fieldtype.Fields
+}
+
+func (e *ELBLineParser) ParseLine(line string) (map[string]interface{}, error) {
+	values := splitFields(line)
+	if len(values) < len(classicFields) {
+		return nil, errors.New("not a load balancer access log entry, it has too few fields")
+	}
+	names := classicFields
+	if applicationTypes[values[0]] {
+		names = applicationFields
+	}
+	fields := make(map[string]string, len(values))
+	for i, v := range values {
+		if i >= len(names) {
+			break
+		}
+		name := names[i]
+		if strings.HasSuffix(name, ":port") {
+			addHostPort(fields, strings.TrimSuffix(name, ":port"), v)
+			continue
+		}
+		fields[name] = v
+	}
+	timestamp := fields[timeField]
+	delete(fields, timeField)
+	parsed := e.fieldTypes.ConvertOrInfer(fields)
+	if timestamp != "" {
+		parsed[timeField] = timestamp
+	}
+	return parsed, nil
+}
+
+// addHostPort adds the ip and port of an ip:port value. The ip may be IPv6.
+func addHostPort(fields map[string]string, name, value string) {
+	i := strings.LastIndexByte(value, ':')
+	if value == "-" || i < 0 {
+		fields[name+"_ip"] = value
+		return
+	}
+	fields[name+"_ip"] = strings.TrimSuffix(strings.TrimPrefix(value[:i], "["), "]")
+	fields[name+"_port"] = value[i+1:]
+}
+
+// splitFields splits an entry on spaces, keeping quoted fields whole. A
+// quote only ends a field if it's followed by a space or the end of the
+// line, since user agents may have quotes in them.
+func splitFields(line string) []string {
+	var fields []string
+	for len(line) > 0 {
+		if line[0] == ' ' {
+			line = line[1:]
+			continue
+		}
+		if line[0] == '"' {
+			end := strings.Index(line[1:], `" `)
+			if end < 0 {
+				fields = append(fields, strings.TrimSuffix(line[1:], `"`))
+				break
+			}
+			fields = append(fields, line[1:end+1])
+			line = line[end+2:]
+			continue
+		}
+		end := strings.IndexByte(line, ' ')
+		if end < 0 {
+			end = len(line)
+		}
+		fields = append(fields, line[:end])
+		line = line[end:]
+	}
+	return fields
+}
+
+func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+	// parse lines one by one
+	wg := sync.WaitGroup{}
+	numParsers := 1
+	if p.conf.NumParsers > 0 {
+		numParsers = p.conf.NumParsers
+	}
+	for i := 0; i < numParsers; i++ {
+		wg.Add(1)
+		go func() {
+			for line := range lines {
+				line = strings.TrimSpace(line)
+				logrus.WithFields(logrus.Fields{
+					"line": line,
+				}).Debug("Attempting to process elb log line")
+
+				// take care of any headers on the line
+				var prefixFields map[string]interface{}
+				if prefixRegex != nil {
+					var prefix string
+					prefix, fields := prefixRegex.FindStringSubmatchMap(line)
+					line = strings.TrimPrefix(line, prefix)
+					prefixFields = p.lineParser.fieldTypes.ConvertOrInfer(fields)
+				}
+
+				parsedLine, err := p.lineParser.ParseLine(line)
+				if err != nil {
+					logrus.WithFields(logrus.Fields{
+						"line":  line,
+						"error": err,
+					}).Debug("skipping line; failed to parse.")
+					continue
+				}
+				// merge the prefix fields and the parsed line contents
+				for k, v := range prefixFields {
+					parsedLine[k] = v
+				}
+
+				send <- event.Event{
+					Timestamp: httime.GetTimestamp(parsedLine, timeField, time.RFC3339Nano),
+					Data:      parsedLine,
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	logrus.Debug("lines channel is closed, ending elb processor")
+}
@@ -0,0 +1,102 @@
+package elb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+const (
+	albLine     = `h2 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 10.0.1.252:48160 10.0.0.66:9000 0.000 0.002 0.000 200 200 5 257 "GET https://10.0.2.105:773/ HTTP/2.0" "Mozilla/5.0 (compatible; \"quoted\")" ECDHE-RSA-AES128-GCM-SHA256 TLSv1.2 arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067 "Root=1-58337327-72bd00b0343d75b906739c42" "-" "-" 1 2018-07-02T22:22:48.364000Z "redirect" "https://example.com:80/" "-" "10.0.0.66:9000" "200" "-" "-"`
+	classicLine = `2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 - -1 -1 -1 503 0 0 0 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.38.0" - -`
+)
+
+func TestParseLine(t *testing.T) {
+	tsts := []struct {
+		line     string
+		expected map[string]interface{}
+	}{
+		{
+			albLine,
+			map[string]interface{}{
+				"type":                     "h2",
+				"time":                     "2018-07-02T22:23:00.186641Z",
+				"elb":                      "app/my-loadbalancer/50dc6c495c0c9188",
+				"client_ip":                "10.0.1.252",
+				"client_port":              int64(48160),
+				"target_ip":                "10.0.0.66",
+				"target_port":              int64(9000),
+				"request_processing_time":  0.0,
+				"target_processing_time":   0.002,
+				"response_processing_time": 0.0,
+				"elb_status_code":          int64(200),
+				"target_status_code":       int64(200),
+				"received_bytes":           int64(5),
+				"sent_bytes":               int64(257),
+				"request":                  "GET https://10.0.2.105:773/ HTTP/2.0",
+				"user_agent":               `Mozilla/5.0 (compatible; \"quoted\")`,
+				"ssl_cipher":               "ECDHE-RSA-AES128-GCM-SHA256",
+				"ssl_protocol":             "TLSv1.2",
+				"target_group_arn":         "arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067",
+				"trace_id":                 "Root=1-58337327-72bd00b0343d75b906739c42",
+				"matched_rule_priority":    int64(1),
+				"request_creation_time":    "2018-07-02T22:22:48.364000Z",
+				"actions_executed":         "redirect",
+				"redirect_url":             "https://example.com:80/",
+				"target_port_list":         "10.0.0.66:9000",
+				"target_status_code_list":  int64(200),
+			},
+		},
+		{
+			classicLine,
+			map[string]interface{}{
+				"time":                     "2015-05-13T23:39:43.945958Z",
+				"elb":                      "my-loadbalancer",
+				"client_ip":                "192.168.131.39",
+				"client_port":              int64(2817),
+				"request_processing_time":  int64(-1),
+				"backend_processing_time":  int64(-1),
+				"response_processing_time": int64(-1),
+				"elb_status_code":          int64(503),
+				"backend_status_code":      int64(0),
+				"received_bytes":           int64(0),
+				"sent_bytes":               int64(0),
+				"request":                  "GET http://www.example.com:80/ HTTP/1.1",
+				"user_agent":               "curl/7.38.0",
+			},
+		},
+	}
+	p := &Parser{}
+	assert.NoError(t, p.Init(&Options{}))
+	for _, tt := range tsts {
+		parsed, err := p.lineParser.ParseLine(tt.line)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, parsed)
+	}
+	_, err := p.lineParser.ParseLine(`http 2018-07-02T22:23:00.186641Z truncated`)
+	assert.Error(t, err)
+}
+
+func TestSplitFields(t *testing.T) {
+	assert.Equal(t, []string{"a", "", "b c", `d"e`, "f"}, splitFields(`a "" "b c" "d"e" "f"`))
+	assert.Equal(t, []string{"a", "unterminated"}, splitFields(`a "unterminated`))
+}
+
+func TestProcessLines(t *testing.T) {
+	p := &Parser{}
+	assert.NoError(t, p.Init(&Options{FieldTypes: []string{"target_status_code_list:string"}}))
+	lines := make(chan string)
+	send := make(chan event.Event)
+	go func() {
+		lines <- albLine
+		close(lines)
+	}()
+	go p.ProcessLines(lines, send, nil)
+	ev := <-send
+	assert.Equal(t, time.Date(2018, 7, 2, 22, 23, 0, 186641000, time.UTC), ev.Timestamp.UTC())
+	assert.Nil(t, ev.Data["time"])
+	assert.Equal(t, "200", ev.Data["target_status_code_list"])
+}
@@ -0,0 +1,279 @@
+// Package envoy consumes Envoy access logs, in the default format, a custom
+// format string or JSON
+package envoy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/AIntelligenceGame/clicktail/parsers/fieldtype"
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/httime"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+// defaultLogFormat is what Envoy logs without a format
+// https://www.envoyproxy.io/docs/envoy/latest/configuration/observability/access_log/usage#default-format-string
+const defaultLogFormat = `[%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" ` +
+	`%RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% ` +
+	`"%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"`
+
+const startTimeField = "start_time"
+
+var (
+	// %REQ(X?Y):Z%
+	reOperator = regexp.MustCompile(`^%([A-Z0-9_]+)(?:\(([^)]*)\))?(?::\d+)?%`)
+	reNonWord  = regexp.MustCompile(`[^a-z0-9]+`)
+	// the fraction of START_TIME formats, such as .%3f, which time.Parse
+	// accepts after the seconds without being in the layout
+	reFraction = regexp.MustCompile(`[.,]%[0-9]?f`)
+)
+
+type Options struct {
+	LogFormat  string   `long:"log_format" description:"Format string of the access log, eg. \"[%START_TIME%] %REQ(:METHOD)% %RESPONSE_CODE%\". Defaults to Envoy's default format. Lines written with a json_format are parsed as JSON whatever this is."`
+	FieldTypes []string `long:"field_type" description:"Type to convert a field to instead of guessing, as field:type[:arg], eg. \"x_forwarded_for:string\". Types are string, int, float, bool, duration (arg is the unit, default ms), ip, timestamp (arg is the format) and size (eg. 10KB, in bytes). May be specified multiple times."`
+
+	NumParsers int `hidden:"true" description:"number of envoy parsers to spin up"`
+}
+
+type Parser struct {
+	conf       Options
+	lineParser *LogLineParser
+}
+
+func (p *Parser) Init(options interface{}) error {
+	p.conf = *options.(*Options)
+	format := p.conf.LogFormat
+	if format == "" {
+		format = defaultLogFormat
+	}
+	fieldTypes, err := fieldtype.ParseFields(p.conf.FieldTypes)
+	if err != nil {
+		return err
+	}
+	lineParser, err := newLogLineParser(format)
+	if err != nil {
+		return err
+	}
+	lineParser.fieldTypes = fieldTypes
+	p.lineParser = lineParser
+	return nil
+}
+
+// LogLineParser parses lines written with a format string, or as JSON
+type LogLineParser struct {
+	regexp *regexp.Regexp
+	// the fields of the regex's groups, in order
+	fields []string
+	// the strftime format of START_TIME, if it isn't the default RFC3339
+	startTimeFormat string
+	fieldTypes      fieldtype.Fields
+}
+
+// newLogLineParser compiles a format string into a regex, one group per
+// command operator
+func newLogLineParser(format string) (*LogLineParser, error) {
+	// formats are usually configured with the trailing newline
+	format = strings.TrimRight(format, "\n")
+	original := format
+	l := &LogLineParser{}
+	var re strings.Builder
+	re.WriteString("^")
+	for len(format) > 0 {
+		if format[0] != '%' {
+			re.WriteString(regexp.QuoteMeta(format[:1]))
+			format = format[1:]
+			continue
+		}
+		m := reOperator.FindStringSubmatch(format)
+		if m == nil {
+			return nil, fmt.Errorf("invalid envoy command operator at %q", format)
+		}
+		format = format[len(m[0]):]
+		field := operatorField(m[1], m[2])
+		l.fields = append(l.fields, field)
+		switch {
+		case field == startTimeField && m[2] != "":
+			l.startTimeFormat = reFraction.ReplaceAllString(m[2], "")
+			re.WriteString(`(` + strftimePattern(m[2]) + `)`)
+		case format == "":
+			re.WriteString(`(.*)`)
+		case format[0] == '%':
+			re.WriteString(`(.*?)`)
+		default:
+			re.WriteString(`([^` + regexp.QuoteMeta(format[:1]) + `]*)`)
+		}
+	}
+	re.WriteString("$")
+	if len(l.fields) == 0 {
+		return nil, fmt.Errorf("envoy log format %q has no command operators", original)
+	}
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return nil, err
+	}
+	l.regexp = compiled
+	return l, nil
+}
+
+// strftimePattern matches a time written with a strftime format, which may
+// have spaces in it
+func strftimePattern(format string) string {
+	words := strings.Fields(format)
+	for i := range words {
+		words[i] = `\S+`
+	}
+	return strings.Join(words, " +")
+}
+
+// operatorField returns the field of a command operator. Headers are named
+// like the JSON format's keys usually are: pseudo-headers by their name
+// (method, path, authority), others snake cased, with response_ and
+// trailer_ prefixes for RESP and TRAILER.
+func operatorField(operator, arg string) string {
+	switch operator {
+	case "REQ", "RESP", "TRAILER":
+		header := arg
+		// X-ENVOY-ORIGINAL-PATH?:PATH is the path
+		if i := strings.IndexByte(arg, '?'); i >= 0 {
+			header = arg[:i]
+			if alt := arg[i+1:]; strings.HasPrefix(alt, ":") {
+				header = alt
+			}
+		}
+		name := snakeCase(header)
+		switch operator {
+		case "RESP":
+			return "response_" + name
+		case "TRAILER":
+			return "trailer_" + name
+		}
+		return name
+	}
+	return snakeCase(operator)
+}
+
+func snakeCase(s string) string {
+	return strings.Trim(reNonWord.ReplaceAllString(strings.ToLower(s), "_"), "_")
+}
+
+// ParseLine returns the fields of the line, typed. JSON lines are returned as
+// they were logged.
+func (l *LogLineParser) ParseLine(line string) (map[string]interface{}, error) {
+	if strings.HasPrefix(line, "{") {
+		return l.parseJSON(line)
+	}
+	match := l.regexp.FindStringSubmatch(line)
+	if match == nil {
+		logrus.WithFields(logrus.Fields{
+			"logline": line,
+		}).Debug("failed to parse envoy log line")
+		return nil, errors.New("access log line does not match the log format")
+	}
+	fields := make(map[string]string, len(l.fields))
+	for i, field := range l.fields {
+		if field != startTimeField {
+			fields[field] = match[i+1]
+		}
+	}
+	parsed := l.fieldTypes.ConvertOrInfer(fields)
+	for i, field := range l.fields {
+		if field == startTimeField {
+			parsed[field] = match[i+1]
+		}
+	}
+	return parsed, nil
+}
+
+func (l *LogLineParser) parseJSON(line string) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+	var data map[string]interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return nil, err
+	}
+	for k, v := range data {
+		switch v := v.(type) {
+		case json.Number:
+			if i, err := v.Int64(); err == nil {
+				data[k] = i
+			} else if f, err := v.Float64(); err == nil {
+				data[k] = f
+			}
+		case string:
+			if v == "-" || v == "" {
+				delete(data, k)
+			} else if typed, ok := l.fieldTypes.Convert(k, v); ok {
+				data[k] = typed
+			}
+		case nil:
+			delete(data, k)
+		}
+	}
+	return data, nil
+}
+
+func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+	// parse lines one by one
+	wg := sync.WaitGroup{}
+	numParsers := 1
+	if p.conf.NumParsers > 0 {
+		numParsers = p.conf.NumParsers
+	}
+	for i := 0; i < numParsers; i++ {
+		wg.Add(1)
+		go func() {
+			for line := range lines {
+				line = strings.TrimSpace(line)
+				logrus.WithFields(logrus.Fields{
+					"line": line,
+				}).Debug("Attempting to process envoy log line")
+
+				// take care of any headers on the line
+				var prefixFields map[string]interface{}
+				if prefixRegex != nil {
+					var prefix string
+					prefix, fields := prefixRegex.FindStringSubmatchMap(line)
+					line = strings.TrimPrefix(line, prefix)
+					prefixFields = p.lineParser.fieldTypes.ConvertOrInfer(fields)
+				}
+
+				parsedLine, err := p.lineParser.ParseLine(line)
+				if err != nil {
+					continue
+				}
+				// merge the prefix fields and the parsed line contents
+				for k, v := range prefixFields {
+					parsedLine[k] = v
+				}
+
+				send <- event.Event{
+					Timestamp: p.getTimestamp(parsedLine),
+					Data:      parsedLine,
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	logrus.Debug("lines channel is closed, ending envoy processor")
+}
+
+// getTimestamp returns START_TIME, RFC3339 unless the format gives it one,
+// and removes it from the event
+func (p *Parser) getTimestamp(data map[string]interface{}) time.Time {
+	if _, ok := data[startTimeField]; !ok {
+		return httime.Now()
+	}
+	if p.lineParser.startTimeFormat != "" {
+		return httime.GetTimestamp(data, startTimeField, p.lineParser.startTimeFormat)
+	}
+	return httime.GetTimestamp(data, startTimeField, time.RFC3339Nano)
+}
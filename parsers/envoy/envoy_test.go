@@ -0,0 +1,97 @@
+package envoy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+func TestParseLineDefaultFormat(t *testing.T) {
+	p := &Parser{}
+	assert.NoError(t, p.Init(&Options{}))
+	parsed, err := p.lineParser.ParseLine(`[2016-04-15T20:17:00.310Z] "POST /api/v1/locations HTTP/2" 204 - 154 0 226 100 "10.0.35.28" "nsq2http" "cc21d9b0-cf5c-432b-8c7e-98aeb7988cd2" "locations" "tcp://10.0.2.1:80"`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"start_time":                             "2016-04-15T20:17:00.310Z",
+		"method":                                 "POST",
+		"path":                                   "/api/v1/locations",
+		"protocol":                               "HTTP/2",
+		"response_code":                          int64(204),
+		"bytes_received":                         int64(154),
+		"bytes_sent":                             int64(0),
+		"duration":                               int64(226),
+		"response_x_envoy_upstream_service_time": int64(100),
+		"x_forwarded_for":                        "10.0.35.28",
+		"user_agent":                             "nsq2http",
+		"x_request_id":                           "cc21d9b0-cf5c-432b-8c7e-98aeb7988cd2",
+		"authority":                              "locations",
+		"upstream_host":                          "tcp://10.0.2.1:80",
+	}, parsed)
+}
+
+func TestParseLineCustomFormat(t *testing.T) {
+	p := &Parser{}
+	assert.NoError(t, p.Init(&Options{
+		LogFormat:  "%START_TIME(%Y/%m/%d %H:%M:%S.%3f)% %DOWNSTREAM_REMOTE_ADDRESS% %REQ(:PATH):10% %RESPONSE_FLAGS% %TRAILER(grpc-status)%\n",
+		FieldTypes: []string{"trailer_grpc_status:string"},
+	}))
+	parsed, err := p.lineParser.ParseLine(`2016/04/15 20:17:00.310 10.0.0.1:5000 /api/v1/lo UH 0`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"start_time":                "2016/04/15 20:17:00.310",
+		"downstream_remote_address": "10.0.0.1:5000",
+		"path":                      "/api/v1/lo",
+		"response_flags":            "UH",
+		"trailer_grpc_status":       "0",
+	}, parsed)
+	assert.Equal(t, "%Y/%m/%d %H:%M:%S", p.lineParser.startTimeFormat)
+
+	_, err = p.lineParser.ParseLine(`not an access log line`)
+	assert.Error(t, err)
+
+	for _, format := range []string{"no operators", "%REQ(:PATH)", "%%"} {
+		assert.Error(t, p.Init(&Options{LogFormat: format}), format)
+	}
+}
+
+func TestParseLineJSON(t *testing.T) {
+	p := &Parser{}
+	assert.NoError(t, p.Init(&Options{}))
+	parsed, err := p.lineParser.ParseLine(`{"start_time":"2016-04-15T20:17:00.310Z","method":"GET","response_code":200,"duration":1.5,"upstream_host":null,"response_flags":"-"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"start_time":    "2016-04-15T20:17:00.310Z",
+		"method":        "GET",
+		"response_code": int64(200),
+		"duration":      1.5,
+	}, parsed)
+}
+
+func TestProcessLines(t *testing.T) {
+	tsts := []struct {
+		format string
+		line   string
+	}{
+		{"", `[2016-04-15T20:17:00.310Z] "GET / HTTP/1.1" 200 - 0 12 3 2 "-" "curl/7.68.0" "8a1c" "example.com" "10.0.2.1:80"`},
+		{"%START_TIME(%Y/%m/%d %H:%M:%S.%3f)% %RESPONSE_CODE%", `2016/04/15 20:17:00.310 200`},
+		{"", `{"start_time":"2016-04-15T20:17:00.310Z","response_code":200}`},
+	}
+	for _, tt := range tsts {
+		p := &Parser{}
+		assert.NoError(t, p.Init(&Options{LogFormat: tt.format}))
+		lines := make(chan string)
+		send := make(chan event.Event)
+		go func() {
+			lines <- tt.line
+			close(lines)
+		}()
+		go p.ProcessLines(lines, send, nil)
+		ev := <-send
+		assert.Equal(t, time.Date(2016, 4, 15, 20, 17, 0, 310000000, time.UTC), ev.Timestamp.UTC(), tt.line)
+		assert.Nil(t, ev.Data["start_time"])
+		assert.Equal(t, int64(200), ev.Data["response_code"])
+	}
+}
@@ -0,0 +1,357 @@
+// Package fieldtype converts the strings parsers capture into typed values,
+// so numbers, durations and so on are sent as such rather than as strings
+// ClickHouse won't put in numeric columns.
+//
+// Types are given per field as "field:type[:arg]":
+//
+//	bytes:int
+//	ratio:float
+//	cached:bool
+//	took:duration:ms
+//	client:ip
+//	started:timestamp:%Y-%m-%d %H:%M:%S
+//	size:size
+package fieldtype
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/honeycombio/honeytail/httime"
+)
+
+const (
+	String    = "string"
+	Int       = "int"
+	Float     = "float"
+	Bool      = "bool"
+	Duration  = "duration"
+	IP        = "ip"
+	Timestamp = "timestamp"
+	Size      = "size"
+
+	// TimestampLayout is how timestamps are sent, the same as the _time
+	// column
+	TimestampLayout = "2006-01-02T15:04:05"
+
+	unixTimestampFormat = "%s"
+)
+
+// durationUnits are the units a duration can be converted to
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+// sizeUnits are the multipliers of the size suffixes, lower cased. Like
+// nginx, redis and most logs, K is 1024 whether or not it's written KiB.
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1 << 40,
+	"tib": 1 << 40,
+	"p":   1 << 50,
+	"pb":  1 << 50,
+	"pib": 1 << 50,
+}
+
+// strftimeLayouts converts the common strftime directives to Go layouts
+var strftimeLayouts = strings.NewReplacer(
+	"%Y", "2006",
+	"%y", "06",
+	"%m", "01",
+	"%b", "Jan",
+	"%B", "January",
+	"%h", "Jan",
+	"%d", "02",
+	"%e", "_2",
+	"%a", "Mon",
+	"%A", "Monday",
+	"%H", "15",
+	"%k", "15",
+	"%I", "03",
+	"%l", "_3",
+	"%M", "04",
+	"%S", "05",
+	"%f", "999999",
+	"%L", "999",
+	"%p", "PM",
+	"%z", "-0700",
+	"%Z", "MST",
+	"%F", "2006-01-02",
+	"%T", "15:04:05",
+	"%R", "15:04",
+	"%D", "01/02/06",
+	"%%", "%",
+)
+
+// defaultTimestampLayouts are tried, in order, for timestamps without a
+// format
+var defaultTimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05.999999999 -0700",
+	"2006-01-02 15:04:05.999999999",
+	"02/Jan/2006:15:04:05 -0700",
+	time.RubyDate,
+	time.UnixDate,
+}
+
+// Converter converts values to a type
+type Converter struct {
+	Type string
+	Arg  string
+
+	unit   time.Duration
+	layout string
+}
+
+// New returns a converter to the type. arg is the unit of durations
+// (ns, us, ms, s, m or h, default ms) and the strftime or Go format of
+// timestamps; other types don't take one.
+func New(typ, arg string) (*Converter, error) {
+	c := &Converter{Type: typ, Arg: arg}
+	switch typ {
+	case String, Int, Float, Bool, IP, Size:
+		if arg != "" {
+			return nil, fmt.Errorf("type %s doesn't take an argument, got %q", typ, arg)
+		}
+	case Duration:
+		if arg == "" {
+			arg = "ms"
+		}
+		unit, ok := durationUnits[arg]
+		if !ok {
+			return nil, fmt.Errorf("unknown duration unit %q, expected ns, us, ms, s, m or h", arg)
+		}
+		c.unit = unit
+	case Timestamp:
+		c.layout = arg
+		if strings.Contains(arg, "%") && arg != unixTimestampFormat {
+			c.layout = strftimeLayouts.Replace(arg)
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q, expected string, int, float, bool, duration, ip, timestamp or size", typ)
+	}
+	return c, nil
+}
+
+// Convert returns the value as the type, or an error if it isn't one
+func (c *Converter) Convert(value string) (interface{}, error) {
+	value = strings.TrimSpace(value)
+	switch c.Type {
+	case String:
+		return value, nil
+	case Int:
+		return strconv.ParseInt(value, 10, 64)
+	case Float:
+		return strconv.ParseFloat(value, 64)
+	case Bool:
+		return parseBool(value)
+	case Duration:
+		return c.parseDuration(value)
+	case IP:
+		return parseIP(value)
+	case Timestamp:
+		return c.parseTimestamp(value)
+	case Size:
+		return parseSize(value)
+	}
+	return nil, fmt.Errorf("unknown type %q", c.Type)
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "y", "on":
+		return true, nil
+	case "no", "n", "off":
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// parseDuration returns the duration in the converter's unit. Bare numbers
+// are taken to be in that unit already.
+func (c *Converter) parseDuration(value string) (float64, error) {
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	return float64(d) / float64(c.unit), nil
+}
+
+// parseIP returns the canonical form of an IP address, without the brackets
+// or zone an IPv6 address may be written with
+func parseIP(value string) (string, error) {
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	if i := strings.IndexByte(value, '%'); i >= 0 {
+		value = value[:i]
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP address %q", value)
+	}
+	return ip.String(), nil
+}
+
+func (c *Converter) parseTimestamp(value string) (string, error) {
+	var (
+		t   time.Time
+		err error
+	)
+	switch c.layout {
+	case unixTimestampFormat:
+		t, err = parseUnix(value)
+	case "":
+		if t, err = parseUnix(value); err == nil {
+			break
+		}
+		for _, layout := range defaultTimestampLayouts {
+			if t, err = httime.Parse(layout, value); err == nil {
+				break
+			}
+		}
+	default:
+		t, err = httime.Parse(c.layout, value)
+	}
+	if err != nil {
+		return "", err
+	}
+	return t.Format(TimestampLayout), nil
+}
+
+// parseUnix parses seconds since the epoch, with an optional fraction
+func parseUnix(value string) (time.Time, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second))).In(httime.Location), nil
+}
+
+// parseSize returns a size such as "10KB" or "1.5 GiB" in bytes
+func parseSize(value string) (int64, error) {
+	i := strings.IndexFunc(value, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(value)
+	}
+	n, err := strconv.ParseFloat(value[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	multiplier, ok := sizeUnits[strings.ToLower(strings.TrimSpace(value[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit in size %q", value)
+	}
+	return int64(math.Round(n * multiplier)), nil
+}
+
+// Fields are the converters of fields, by name
+type Fields map[string]*Converter
+
+// ParseFields parses "field:type[:arg]" specs. The arg may itself contain
+// colons, as timestamp formats do.
+func ParseFields(specs []string) (Fields, error) {
+	fields := make(Fields, len(specs))
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, ":", 3)
+		if len(parts) < 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid field type %q, expected field:type[:arg]", spec)
+		}
+		var arg string
+		if len(parts) == 3 {
+			arg = parts[2]
+		}
+		c, err := New(parts[1], arg)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %s", parts[0], err)
+		}
+		fields[parts[0]] = c
+	}
+	return fields, nil
+}
+
+// Convert returns the value of the field as its type. ok is false if the
+// field has no type or the value isn't one, in which case it should be kept
+// (or inferred) as it is.
+func (f Fields) Convert(name, value string) (typed interface{}, ok bool) {
+	c, found := f[name]
+	if !found {
+		return nil, false
+	}
+	typed, err := c.Convert(value)
+	if err != nil {
+		return nil, false
+	}
+	return typed, true
+}
+
+// Apply converts the string values of the typed fields in data, in place.
+// Values that aren't their type are left as they are.
+func (f Fields) Apply(data map[string]interface{}) {
+	for name := range f {
+		value, ok := data[name].(string)
+		if !ok {
+			continue
+		}
+		if typed, ok := f.Convert(name, value); ok {
+			data[name] = typed
+		}
+	}
+}
+
+// Infer returns the value as a float or int if it's a number, or as is. ok
+// is false for "-", which access logs write for no value.
+func Infer(value string) (typed interface{}, ok bool) {
+	switch {
+	case value == "-":
+		return nil, false
+	case strings.Contains(value, "."):
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f, true
+		}
+	default:
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i, true
+		}
+	}
+	return value, true
+}
+
+// ConvertOrInfer converts the fields with a type and infers the type of the
+// rest, leaving out those without a value
+func (f Fields) ConvertOrInfer(fields map[string]string) map[string]interface{} {
+	typed := make(map[string]interface{}, len(fields))
+	for name, value := range fields {
+		if v, ok := f.Convert(name, value); ok {
+			typed[name] = v
+		} else if v, ok := Infer(value); ok {
+			typed[name] = v
+		}
+	}
+	return typed
+}
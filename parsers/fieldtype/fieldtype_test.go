@@ -0,0 +1,123 @@
+package fieldtype
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvert(t *testing.T) {
+	tsts := []struct {
+		typ, arg string
+		in       string
+		expected interface{}
+	}{
+		{String, "", "foo", "foo"},
+		{Int, "", "42", int64(42)},
+		{Int, "", "-7", int64(-7)},
+		{Float, "", "0.25", 0.25},
+		{Bool, "", "true", true},
+		{Bool, "", "yes", true},
+		{Bool, "", "OFF", false},
+		{Duration, "", "1.5s", 1500.0},
+		{Duration, "", "250", 250.0},
+		{Duration, "s", "1m30s", 90.0},
+		{Duration, "us", "2ms", 2000.0},
+		{IP, "", "10.0.0.1", "10.0.0.1"},
+		{IP, "", "[2001:DB8::0001]", "2001:db8::1"},
+		{IP, "", "fe80::1%eth0", "fe80::1"},
+		{Timestamp, "", "2017-11-07T01:43:39.314Z", "2017-11-07T01:43:39"},
+		{Timestamp, "", "1510019019", "2017-11-07T01:43:39"},
+		{Timestamp, "%s", "1510019019.5", "2017-11-07T01:43:39"},
+		{Timestamp, "%d/%b/%Y:%H:%M:%S %z", "07/Nov/2017:02:43:39 +0100", "2017-11-07T02:43:39"},
+		{Timestamp, "2006-01-02 15:04:05", "2017-11-07 01:43:39", "2017-11-07T01:43:39"},
+		{Size, "", "512", int64(512)},
+		{Size, "", "10KB", int64(10240)},
+		{Size, "", "1.5 MiB", int64(1572864)},
+		{Size, "", "2g", int64(2147483648)},
+	}
+	for _, tt := range tsts {
+		c, err := New(tt.typ, tt.arg)
+		assert.NoError(t, err, tt.typ)
+		typed, err := c.Convert(tt.in)
+		assert.NoError(t, err, tt.in)
+		assert.Equal(t, tt.expected, typed, tt.in)
+	}
+}
+
+func TestConvertInvalid(t *testing.T) {
+	tsts := []struct {
+		typ string
+		in  string
+	}{
+		{Int, "4.2"},
+		{Float, "-"},
+		{Bool, "maybe"},
+		{Duration, "soon"},
+		{IP, "300.0.0.1"},
+		{Timestamp, "yesterday"},
+		{Size, "10 parsecs"},
+		{Size, "KB"},
+	}
+	for _, tt := range tsts {
+		c, err := New(tt.typ, "")
+		assert.NoError(t, err, tt.typ)
+		_, err = c.Convert(tt.in)
+		assert.Error(t, err, tt.in)
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	fields, err := ParseFields([]string{"bytes:int", "took:duration:s", "at:timestamp:%H:%M:%S"})
+	assert.NoError(t, err)
+	assert.Equal(t, Int, fields["bytes"].Type)
+	assert.Equal(t, "s", fields["took"].Arg)
+	assert.Equal(t, "%H:%M:%S", fields["at"].Arg)
+
+	for _, spec := range []string{"bytes", ":int", "bytes:integer", "took:duration:days", "bytes:int:10"} {
+		_, err := ParseFields([]string{spec})
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestApply(t *testing.T) {
+	fields, err := ParseFields([]string{"bytes:int", "took:duration", "client:ip", "status:int"})
+	assert.NoError(t, err)
+	data := map[string]interface{}{
+		"bytes":  "1024",
+		"took":   "0.5s",
+		"client": "not an ip",
+		"status": 200,
+		"path":   "/",
+	}
+	fields.Apply(data)
+	assert.Equal(t, map[string]interface{}{
+		"bytes":  int64(1024),
+		"took":   500.0,
+		"client": "not an ip",
+		"status": 200,
+		"path":   "/",
+	}, data)
+
+	_, ok := Fields(nil).Convert("bytes", "1")
+	assert.False(t, ok)
+}
+
+func TestConvertOrInfer(t *testing.T) {
+	fields, err := ParseFields([]string{"version:string", "took:duration"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"status":  int64(200),
+		"ratio":   0.5,
+		"release": "5.1.0",
+		"version": "10",
+		"took":    20.0,
+	}, fields.ConvertOrInfer(map[string]string{
+		"status":  "200",
+		"ratio":   "0.5",
+		"release": "5.1.0",
+		"version": "10",
+		"took":    "20ms",
+		"user":    "-",
+	}))
+}
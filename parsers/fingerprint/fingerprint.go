@@ -0,0 +1,161 @@
+// Package fingerprint abstracts SQL queries the same way pt-query-digest does,
+// so that events can be grouped by query and joined with its reports.
+package fingerprint
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// These follow QueryRewriter::fingerprint in the Percona Toolkit. RE2 has no
+// lookahead or backreferences, so the expressions that need them are done by
+// hand below.
+var (
+	reMysqldump      = regexp.MustCompile("^SELECT /\\*!40001 SQL_NO_CACHE \\*/ \\* FROM `")
+	rePerconaToolkit = regexp.MustCompile(`/\*\w+\.\w+:[0-9]/[0-9]\*/`)
+	reCall           = regexp.MustCompile(`(?i)^\s*(call\s+\S+)\(`)
+	reMultiInsert    = regexp.MustCompile(`(?is)^((?:INSERT|REPLACE)(?: IGNORE)?\s+INTO.+?VALUES\s*\(.*?\))\s*,\s*\(`)
+	reMultiComment   = regexp.MustCompile(`(?s)/\*[^!].*?\*/`)
+	reOneComment     = regexp.MustCompile(`(?:--|#)[^'"\r\n]*([\r\n]|$)`)
+	reUse            = regexp.MustCompile(`(?i)^use \S+$`)
+	reEscapedQuote   = regexp.MustCompile(`\\["']`)
+	reDoubleQuoted   = regexp.MustCompile(`(?s)".*?"`)
+	reSingleQuoted   = regexp.MustCompile(`(?s)'.*?'`)
+	reBoolean        = regexp.MustCompile(`(?i)\bfalse\b|\btrue\b`)
+	reNumber         = regexp.MustCompile(`\b[0-9+-][0-9a-f.xb+-]*`)
+	reNumberLeftover = regexp.MustCompile(`[xb.+-]\?`)
+	reWhitespace     = regexp.MustCompile(`[ \n\t\r\f]+`)
+	reNull           = regexp.MustCompile(`\bnull\b`)
+	reInList         = regexp.MustCompile(`\b(in|values?)(?:[\s,]*\([\s?,]*\))+`)
+	reUnionStart     = regexp.MustCompile(`\bselect\s`)
+	reUnion          = regexp.MustCompile(`^\sunion(?:\sall)?\s`)
+	reLimit          = regexp.MustCompile(`\blimit \?(?:, ?\?| offset \?)?`)
+	reOrderBy        = regexp.MustCompile(`(?i)\border by `)
+	reAsc            = regexp.MustCompile(`(?i)\s+asc`)
+)
+
+// Fingerprint returns the abstracted form of query: literals are replaced by
+// ?, comments and whitespace are normalized, IN() lists and repeated UNIONs
+// are collapsed and everything is lowercased.
+func Fingerprint(query string) string {
+	switch {
+	case reMysqldump.MatchString(query):
+		return "mysqldump"
+	case rePerconaToolkit.MatchString(query):
+		return "percona-toolkit"
+	case strings.HasPrefix(query, "administrator command: "):
+		return query
+	}
+	if m := reCall.FindStringSubmatch(query); m != nil {
+		return strings.ToLower(m[1])
+	}
+	// the values of multi-row inserts get collapsed anyway; don't bother with
+	// more than the first row
+	if m := reMultiInsert.FindStringSubmatch(query); m != nil {
+		query = m[1]
+	}
+
+	query = reMultiComment.ReplaceAllString(query, "")
+	query = reOneComment.ReplaceAllString(query, "$1")
+	if reUse.MatchString(query) {
+		return "use ?"
+	}
+
+	query = reEscapedQuote.ReplaceAllString(query, "")
+	query = reDoubleQuoted.ReplaceAllString(query, "?")
+	query = reSingleQuoted.ReplaceAllString(query, "?")
+	query = reBoolean.ReplaceAllString(query, "?")
+	query = reNumber.ReplaceAllString(query, "?")
+	query = reNumberLeftover.ReplaceAllString(query, "?")
+
+	query = strings.TrimLeft(query, " \t\n\r\f\v")
+	query = strings.TrimSuffix(query, "\n")
+	query = reWhitespace.ReplaceAllString(query, " ")
+	query = strings.ToLower(query)
+	query = reNull.ReplaceAllString(query, "?")
+	query = reInList.ReplaceAllString(query, "$1(?+)")
+	query = collapseUnions(query)
+	if loc := reLimit.FindStringIndex(query); loc != nil {
+		query = query[:loc[0]] + "limit ?" + query[loc[1]:]
+	}
+	// ASC is the default sort order, so ORDER BY a ASC is the same as ORDER BY a
+	if loc := reOrderBy.FindStringIndex(query); loc != nil {
+		query = query[:loc[1]] + removeAsc(query[loc[1]:])
+	}
+	return query
+}
+
+// Checksum returns the 64 bit query checksum pt-query-digest reports (in hex)
+// alongside the fingerprint: the last 16 hex digits of its MD5.
+func Checksum(fingerprint string) uint64 {
+	sum := md5.Sum([]byte(fingerprint))
+	checksum, _ := strconv.ParseUint(hex.EncodeToString(sum[8:]), 16, 64)
+	return checksum
+}
+
+// collapseUnions replaces repeats of the same select joined by UNION [ALL]
+// with a comment, the equivalent of
+// s/\b(select\s.*?)(?:(\sunion(?:\sall)?)\s\1)+/$1 \/*repeat$2*\//g
+func collapseUnions(query string) string {
+	var out strings.Builder
+	for {
+		loc := reUnionStart.FindStringIndex(query)
+		if loc == nil {
+			break
+		}
+		start := loc[0]
+		matched := false
+		// find the shortest select that's repeated, as .*? would
+		for end := loc[1]; end <= len(query) && !matched; end++ {
+			sel := query[start:end]
+			rest := query[end:]
+			union := ""
+			for {
+				m := reUnion.FindString(rest)
+				if m == "" || !strings.HasPrefix(rest[len(m):], sel) {
+					break
+				}
+				union = strings.TrimRight(m, " \t\n\r\f\v")
+				rest = rest[len(m)+len(sel):]
+			}
+			if union != "" {
+				out.WriteString(query[:start])
+				out.WriteString(sel + " /*repeat" + union + "*/")
+				query = rest
+				matched = true
+			}
+		}
+		if !matched {
+			out.WriteString(query[:loc[1]])
+			query = query[loc[1]:]
+		}
+	}
+	out.WriteString(query)
+	return out.String()
+}
+
+// removeAsc drops every ASC keyword from what follows ORDER BY
+func removeAsc(s string) string {
+	var out strings.Builder
+	for {
+		// ASC must follow at least one character, as with (.+?)\s+ASC
+		loc := reAsc.FindStringIndex(s)
+		if loc != nil && loc[0] == 0 {
+			if next := reAsc.FindStringIndex(s[1:]); next != nil {
+				loc = []int{next[0] + 1, next[1] + 1}
+			} else {
+				loc = nil
+			}
+		}
+		if loc == nil {
+			break
+		}
+		out.WriteString(s[:loc[0]])
+		s = s[loc[1]:]
+	}
+	out.WriteString(s)
+	return out.String()
+}
@@ -0,0 +1,47 @@
+package fingerprint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprint(t *testing.T) {
+	tsts := []struct {
+		in       string
+		expected string
+	}{
+		{"SELECT /*!40001 SQL_NO_CACHE */ * FROM `film`", "mysqldump"},
+		{"REPLACE /*foo.bar:3/3*/ INTO checksum.checksum", "percona-toolkit"},
+		{"administrator command: Init DB", "administrator command: Init DB"},
+		{"CALL foo(1, 2, 3)", "call foo"},
+		{"use `foo`", "use ?"},
+		{"SELECT * from foo where a = 5", "select * from foo where a = ?"},
+		{"select 'hello', \"hello\", 'it\\'s' from foo\n", "select ?, ?, ? from foo"},
+		{"select null, TRUE from t where x = -1.5e3", "select ?, ? from t where x = ?"},
+		{"SELECT * FROM db1.tbl1 WHERE id = 0xff", "select * from db1.tbl1 where id = ?"},
+		{"  select *\n\tfrom foo -- comment\nwhere a = 1", "select * from foo where a = ?"},
+		{"select /* comment */ 1 /*!40000 hint */", "select ? /*!? hint */"},
+		{"SELECT * from foo where a in (5) and b in (5, 8,9 ,9 , 10)", "select * from foo where a in(?+) and b in(?+)"},
+		{"insert into foo(a, b, c) values(2, 4, 5)", "insert into foo(a, b, c) values(?+)"},
+		{"insert into foo(a, b, c) values(2, 4, 5) , (2,4,5)", "insert into foo(a, b, c) values(?+)"},
+		{"select * from foo limit 5", "select * from foo limit ?"},
+		{"select * from foo limit 5, 10", "select * from foo limit ?"},
+		{"select * from foo limit 5 offset 10", "select * from foo limit ?"},
+		{
+			"select * from t where a = 1 union select * from t where a = 2 union all select * from t where a = 3",
+			"select * from t where a = ? /*repeat union all*/",
+		},
+		{"select a from t union select b from t", "select a from t union select b from t"},
+		{"SELECT * FROM products ORDER BY name ASC, shape ASC", "select * from products order by name, shape"},
+		{"SELECT * FROM products ORDER BY name DESC, shape asc", "select * from products order by name desc, shape"},
+	}
+	for _, tt := range tsts {
+		assert.Equal(t, tt.expected, Fingerprint(tt.in), tt.in)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	assert.Equal(t, uint64(0xbe3ec070d8756e8b), Checksum("select * from foo where a = ?"))
+	assert.Equal(t, uint64(0x16219655761820a2), Checksum("select ?"))
+}
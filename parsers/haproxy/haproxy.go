@@ -0,0 +1,253 @@
+// Package haproxy consumes HAProxy HTTP and TCP logs
+package haproxy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/AIntelligenceGame/clicktail/parsers/fieldtype"
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/httime"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+const (
+	formatAuto = "auto"
+	formatHTTP = "http"
+	formatTCP  = "tcp"
+
+	// 06/Feb/2009:12:14:14.655
+	acceptDateLayout = "02/Jan/2006:15:04:05.000"
+)
+
+var (
+	// Feb  6 12:14:14 localhost haproxy[14389]:
+	reSyslogHeader = parsers.ExtRegexp{Regexp: regexp.MustCompile(`^(?:[A-Z][a-z]{2} +\d+ \d\d:\d\d:\d\d|\d{4}-\d\d-\d\dT\S+) (?P<hostname>\S+) [\w.-]+\[(?P<pid>\d+)\]: `)}
+
+	// 10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 {1wt.eu} {} "GET /index.html HTTP/1.1"
+	reHTTPLine = parsers.ExtRegexp{Regexp: regexp.MustCompile(`^` + frontPattern +
+		` (?P<time_request>-?\d+)/(?P<time_queue>-?\d+)/(?P<time_connect>-?\d+)/(?P<time_response>-?\d+)/(?P<time_total>\+?-?\d+)` +
+		` (?P<status_code>-?\d+) (?P<bytes_read>\+?\d+) (?P<captured_request_cookie>\S+) (?P<captured_response_cookie>\S+)` +
+		` (?P<termination_state>\S{4}) ` + connectionsPattern +
+		`(?P<captured_headers>(?: \{[^}]*\})*) "(?P<request>[^"]*)"?$`)}
+
+	// 10.0.1.2:33313 [06/Feb/2009:12:12:51.443] fnt bck/srv1 0/0/5007 212 -- 0/0/0/0/3 0/0
+	reTCPLine = parsers.ExtRegexp{Regexp: regexp.MustCompile(`^` + frontPattern +
+		` (?P<time_queue>-?\d+)/(?P<time_connect>-?\d+)/(?P<time_total>\+?-?\d+) (?P<bytes_read>\+?\d+)` +
+		` (?P<termination_state>\S{2}) ` + connectionsPattern + `$`)}
+
+	reCapturedHeaders = regexp.MustCompile(`\{([^}]*)\}`)
+	reNonWord         = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+const (
+	frontPattern = `(?P<client_ip>\S+):(?P<client_port>\d+) \[(?P<accept_date>[^\]]+)\]` +
+		` (?P<frontend_name>\S+) (?P<backend_name>[^/\s]+)/(?P<server_name>\S+)`
+	connectionsPattern = `(?P<actconn>\d+)/(?P<feconn>\d+)/(?P<beconn>\d+)/(?P<srv_conn>\d+)/(?P<retries>\+?\d+)` +
+		` (?P<srv_queue>\d+)/(?P<backend_queue>\d+)`
+)
+
+type Options struct {
+	Format          string   `long:"format" description:"Log format: http (option httplog), tcp (option tcplog) or auto to accept both" default:"auto"`
+	RequestHeaders  []string `long:"request_header" description:"Name of a request header captured with \"capture request header\", in the order they're declared. Captured headers are sent as request_header_<name>; without names they're sent together as captured_request_headers. May be specified multiple times."`
+	ResponseHeaders []string `long:"response_header" description:"Name of a response header captured with \"capture response header\", in the order they're declared. May be specified multiple times."`
+	FieldTypes      []string `long:"field_type" description:"Type to convert a field to instead of guessing, as field:type[:arg], eg. \"client_ip:ip\". Types are string, int, float, bool, duration (arg is the unit, default ms), ip, timestamp (arg is the format) and size (eg. 10KB, in bytes). May be specified multiple times."`
+
+	NumParsers int `hidden:"true" description:"number of haproxy parsers to spin up"`
+}
+
+type Parser struct {
+	conf       Options
+	lineParser *LogLineParser
+}
+
+func (p *Parser) Init(options interface{}) error {
+	p.conf = *options.(*Options)
+	var lineRegexes []*parsers.ExtRegexp
+	switch p.conf.Format {
+	case formatAuto, "":
+		lineRegexes = []*parsers.ExtRegexp{&reHTTPLine, &reTCPLine}
+	case formatHTTP:
+		lineRegexes = []*parsers.ExtRegexp{&reHTTPLine}
+	case formatTCP:
+		lineRegexes = []*parsers.ExtRegexp{&reTCPLine}
+	default:
+		return fmt.Errorf("unknown haproxy log format %q, expected http, tcp or auto", p.conf.Format)
+	}
+	fieldTypes, err := fieldtype.ParseFields(p.conf.FieldTypes)
+	if err != nil {
+		return err
+	}
+	p.lineParser = &LogLineParser{
+		lineRegexes:     lineRegexes,
+		requestHeaders:  headerFields("request_header_", p.conf.RequestHeaders),
+		responseHeaders: headerFields("response_header_", p.conf.ResponseHeaders),
+		fieldTypes:      fieldTypes,
+	}
+	return nil
+}
+
+// headerFields returns the fields of captured headers, by position
+func headerFields(prefix string, names []string) []string {
+	fields := make([]string, len(names))
+	for i, name := range names {
+		fields[i] = prefix + strings.Trim(reNonWord.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	}
+	return fields
+}
+
+// LogLineParser parses HAProxy log lines
+type LogLineParser struct {
+	lineRegexes     []*parsers.ExtRegexp
+	requestHeaders  []string
+	responseHeaders []string
+	fieldTypes      fieldtype.Fields
+}
+
+// ParseLine returns the fields of a connection or request log line. Other
+// lines, such as servers going up and down, aren't parsed.
+func (l *LogLineParser) ParseLine(line string) (map[string]interface{}, error) {
+	prefix, header := reSyslogHeader.FindStringSubmatchMap(line)
+	line = strings.TrimPrefix(line, prefix)
+
+	for i, re := range l.lineRegexes {
+		_, fields := re.FindStringSubmatchMap(line)
+		if len(fields) == 0 {
+			continue
+		}
+		logType := formatHTTP
+		if re == &reTCPLine {
+			logType = formatTCP
+		}
+		logrus.WithFields(logrus.Fields{
+			"line":  line,
+			"regex": i,
+		}).Debug("haproxy line matched")
+
+		if captured, ok := fields["captured_headers"]; ok {
+			delete(fields, "captured_headers")
+			l.addCapturedHeaders(fields, captured)
+		}
+		state := fields["termination_state"]
+		if state[0] != '-' {
+			fields["termination_cause"] = state[:1]
+		}
+		if state[1] != '-' {
+			fields["termination_phase"] = state[1:2]
+		}
+		for k, v := range header {
+			fields[k] = v
+		}
+		parsed := l.fieldTypes.ConvertOrInfer(fields)
+		parsed["log_type"] = logType
+		return parsed, nil
+	}
+	return nil, fmt.Errorf("not a haproxy connection or request log line")
+}
+
+// addCapturedHeaders adds the headers captured in {} blocks, the request's
+// then the response's. A lone block is the response's if only response
+// headers are named.
+func (l *LogLineParser) addCapturedHeaders(fields map[string]string, captured string) {
+	blocks := reCapturedHeaders.FindAllStringSubmatch(captured, 2)
+	var request, response *string
+	switch len(blocks) {
+	case 1:
+		if len(l.requestHeaders) == 0 && len(l.responseHeaders) > 0 {
+			response = &blocks[0][1]
+		} else {
+			request = &blocks[0][1]
+		}
+	case 2:
+		request, response = &blocks[0][1], &blocks[1][1]
+	}
+	if request != nil {
+		addHeaders(fields, *request, "captured_request_headers", l.requestHeaders)
+	}
+	if response != nil {
+		addHeaders(fields, *response, "captured_response_headers", l.responseHeaders)
+	}
+}
+
+// addHeaders adds the |-separated values of a block as the named fields,
+// or the whole block as the field if there are no names
+func addHeaders(fields map[string]string, block string, field string, names []string) {
+	if len(names) == 0 {
+		if block != "" {
+			fields[field] = block
+		}
+		return
+	}
+	for i, value := range strings.Split(block, "|") {
+		if i < len(names) && value != "" {
+			fields[names[i]] = value
+		}
+	}
+}
+
+func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+	// parse lines one by one
+	wg := sync.WaitGroup{}
+	numParsers := 1
+	if p.conf.NumParsers > 0 {
+		numParsers = p.conf.NumParsers
+	}
+	for i := 0; i < numParsers; i++ {
+		wg.Add(1)
+		go func() {
+			for line := range lines {
+				line = strings.TrimSpace(line)
+				logrus.WithFields(logrus.Fields{
+					"line": line,
+				}).Debug("Attempting to process haproxy log line")
+
+				// take care of any headers on the line
+				var prefixFields map[string]interface{}
+				if prefixRegex != nil {
+					var prefix string
+					prefix, fields := prefixRegex.FindStringSubmatchMap(line)
+					line = strings.TrimPrefix(line, prefix)
+					prefixFields = p.lineParser.fieldTypes.ConvertOrInfer(fields)
+				}
+
+				parsedLine, err := p.lineParser.ParseLine(line)
+				if err != nil {
+					logrus.WithFields(logrus.Fields{
+						"line": line,
+					}).Debug("skipping haproxy line")
+					continue
+				}
+				// merge the prefix fields and the parsed line contents
+				for k, v := range prefixFields {
+					parsedLine[k] = v
+				}
+
+				send <- event.Event{
+					Timestamp: getTimestamp(parsedLine),
+					Data:      parsedLine,
+				}
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	logrus.Debug("lines channel is closed, ending haproxy processor")
+}
+
+// getTimestamp returns the time the connection was accepted, and removes it
+// from the event
+func getTimestamp(data map[string]interface{}) time.Time {
+	value, _ := data["accept_date"].(string)
+	delete(data, "accept_date")
+	t, err := httime.Parse(acceptDateLayout, value)
+	if err != nil {
+		logrus.WithField("accept_date", value).Debug("couldn't parse haproxy accept date, using the current time")
+		return httime.Now()
+	}
+	return t
+}
@@ -0,0 +1,124 @@
+package haproxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+func TestParseLineHTTP(t *testing.T) {
+	p := &Parser{}
+	assert.NoError(t, p.Init(&Options{Format: formatHTTP, RequestHeaders: []string{"Host", "X-Forwarded-For"}}))
+	parsed, err := p.lineParser.ParseLine(`Feb  6 12:14:14 localhost haproxy[14389]: 10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in~ static/srv1 10/0/30/69/+109 503 2750 - - SCDN 1/1/1/1/+2 0/3 {1wt.eu|} {nginx} "GET /index.html HTTP/1.1"`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"hostname":                  "localhost",
+		"pid":                       int64(14389),
+		"client_ip":                 "10.0.1.2",
+		"client_port":               int64(33317),
+		"accept_date":               "06/Feb/2009:12:14:14.655",
+		"frontend_name":             "http-in~",
+		"backend_name":              "static",
+		"server_name":               "srv1",
+		"time_request":              int64(10),
+		"time_queue":                int64(0),
+		"time_connect":              int64(30),
+		"time_response":             int64(69),
+		"time_total":                int64(109),
+		"status_code":               int64(503),
+		"bytes_read":                int64(2750),
+		"termination_state":         "SCDN",
+		"termination_cause":         "S",
+		"termination_phase":         "C",
+		"actconn":                   int64(1),
+		"feconn":                    int64(1),
+		"beconn":                    int64(1),
+		"srv_conn":                  int64(1),
+		"retries":                   int64(2),
+		"srv_queue":                 int64(0),
+		"backend_queue":             int64(3),
+		"request_header_host":       "1wt.eu",
+		"captured_response_headers": "nginx",
+		"request":                   "GET /index.html HTTP/1.1",
+		"log_type":                  formatHTTP,
+	}, parsed)
+}
+
+func TestParseLineTCP(t *testing.T) {
+	p := &Parser{}
+	assert.NoError(t, p.Init(&Options{}))
+	parsed, err := p.lineParser.ParseLine(`10.0.1.2:33313 [06/Feb/2009:12:12:51.443] fnt bck/<NOSRV> 0/-1/5007 212 -- 0/0/0/0/3 0/0`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"client_ip":         "10.0.1.2",
+		"client_port":       int64(33313),
+		"accept_date":       "06/Feb/2009:12:12:51.443",
+		"frontend_name":     "fnt",
+		"backend_name":      "bck",
+		"server_name":       "<NOSRV>",
+		"time_queue":        int64(0),
+		"time_connect":      int64(-1),
+		"time_total":        int64(5007),
+		"bytes_read":        int64(212),
+		"termination_state": "--",
+		"actconn":           int64(0),
+		"feconn":            int64(0),
+		"beconn":            int64(0),
+		"srv_conn":          int64(0),
+		"retries":           int64(3),
+		"srv_queue":         int64(0),
+		"backend_queue":     int64(0),
+		"log_type":          formatTCP,
+	}, parsed)
+}
+
+func TestParseLineOther(t *testing.T) {
+	p := &Parser{}
+	assert.NoError(t, p.Init(&Options{Format: formatTCP}))
+	for _, line := range []string{
+		`Feb  6 12:14:14 localhost haproxy[14389]: Proxy http-in started.`,
+		`Feb  6 12:14:14 localhost haproxy[14389]: 10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 "GET / HTTP/1.1"`,
+	} {
+		_, err := p.lineParser.ParseLine(line)
+		assert.Error(t, err, line)
+	}
+	assert.Error(t, p.Init(&Options{Format: "syslog"}))
+}
+
+func TestCapturedHeaders(t *testing.T) {
+	tsts := []struct {
+		opts     Options
+		expected map[string]string
+	}{
+		{Options{}, map[string]string{"captured_request_headers": "a|b"}},
+		{Options{ResponseHeaders: []string{"Server"}}, map[string]string{"response_header_server": "a"}},
+		{Options{RequestHeaders: []string{"Host", "Referer"}}, map[string]string{"request_header_host": "a", "request_header_referer": "b"}},
+	}
+	for _, tt := range tsts {
+		p := &Parser{}
+		assert.NoError(t, p.Init(&tt.opts))
+		fields := make(map[string]string)
+		p.lineParser.addCapturedHeaders(fields, " {a|b}")
+		assert.Equal(t, tt.expected, fields)
+	}
+}
+
+func TestProcessLines(t *testing.T) {
+	p := &Parser{}
+	assert.NoError(t, p.Init(&Options{}))
+	lines := make(chan string)
+	send := make(chan event.Event)
+	go func() {
+		lines <- `Feb  6 12:14:14 localhost haproxy[14389]: Proxy http-in started.`
+		lines <- `10.0.1.2:33313 [06/Feb/2009:12:12:51.443] fnt bck/srv1 0/0/5007 212 -- 0/0/0/0/3 0/0`
+		close(lines)
+	}()
+	go p.ProcessLines(lines, send, nil)
+	ev := <-send
+	assert.Equal(t, time.Date(2009, 2, 6, 12, 12, 51, 443000000, time.UTC), ev.Timestamp.UTC())
+	assert.Nil(t, ev.Data["accept_date"])
+	assert.Equal(t, "srv1", ev.Data["server_name"])
+}
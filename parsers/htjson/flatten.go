@@ -0,0 +1,378 @@
+package htjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	arraysKeep      = "keep"
+	arraysExplode   = "explode"
+	arraysStringify = "stringify"
+
+	defaultFlattenSeparator = "_"
+)
+
+// FlattenOptions control how nested objects and arrays are turned into the
+// flat fields ClickHouse columns need. They're embedded in the Options of the
+// parsers that produce nested maps, so each has them in its namespace.
+type FlattenOptions struct {
+	Flatten          bool     `long:"flatten" description:"Flatten nested objects into top level fields, so {\"a\":{\"b\":1}} is sent as a_b"`
+	FlattenSeparator string   `long:"flatten_separator" description:"String to join the keys of flattened objects with" default:"_"`
+	Stringify        []string `long:"stringify" description:"Path of a subtree to send as a JSON string, eg. \"request.headers\" or \"items[*].meta\". May be specified multiple times."`
+	Arrays           string   `long:"arrays" description:"What to do with arrays: keep them as they are (for Array() columns), explode arrays of objects into one array per key (for Nested columns), or stringify them" default:"keep"`
+	Fields           []string `long:"field" description:"Path of a field to send, optionally renamed as path:name, eg. \"$.request.headers['user-agent']:user_agent\". If any are given, only those fields are sent. May be specified multiple times."`
+}
+
+// Flattener applies FlattenOptions to parsed events
+type Flattener struct {
+	flatten   bool
+	separator string
+	arrays    string
+	stringify []jsonPath
+	fields    []selectedField
+}
+
+// selectedField is a field picked with --field, and what it's sent as
+type selectedField struct {
+	path jsonPath
+	name string
+}
+
+// NewFlattener returns a flattener for the options, or nil if they leave
+// events as they are
+func NewFlattener(opts FlattenOptions) (*Flattener, error) {
+	f := &Flattener{
+		flatten:   opts.Flatten,
+		separator: opts.FlattenSeparator,
+		arrays:    opts.Arrays,
+	}
+	if f.separator == "" {
+		f.separator = defaultFlattenSeparator
+	}
+	switch f.arrays {
+	case "":
+		f.arrays = arraysKeep
+	case arraysKeep, arraysExplode, arraysStringify:
+	default:
+		return nil, fmt.Errorf("unknown arrays mode %q, expected keep, explode or stringify", opts.Arrays)
+	}
+	for _, spec := range opts.Stringify {
+		path, err := parsePath(spec)
+		if err != nil {
+			return nil, err
+		}
+		f.stringify = append(f.stringify, path)
+	}
+	for _, spec := range opts.Fields {
+		field, err := f.parseField(spec)
+		if err != nil {
+			return nil, err
+		}
+		f.fields = append(f.fields, field)
+	}
+	if !f.flatten && f.arrays == arraysKeep && len(f.stringify) == 0 && len(f.fields) == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// parseField parses path[:name]. Without a name, the field is named by its
+// path's keys joined with the separator.
+func (f *Flattener) parseField(spec string) (selectedField, error) {
+	pathSpec, name := spec, ""
+	if i := strings.LastIndexByte(spec, ':'); i > strings.LastIndexByte(spec, ']') {
+		pathSpec, name = spec[:i], spec[i+1:]
+	}
+	path, err := parsePath(pathSpec)
+	if err != nil {
+		return selectedField{}, err
+	}
+	if name == "" {
+		var keys []string
+		for _, seg := range path {
+			switch seg.kind {
+			case keySegment:
+				keys = append(keys, seg.key)
+			case indexSegment:
+				keys = append(keys, strconv.Itoa(seg.index))
+			}
+		}
+		name = strings.Join(keys, f.separator)
+	}
+	if name == "" {
+		return selectedField{}, fmt.Errorf("field %q has no name, give it one as path:name", spec)
+	}
+	return selectedField{path: path, name: name}, nil
+}
+
+// Apply returns the event with the subtrees stringified, the fields
+// selected, and objects and arrays flattened as configured. A nil Flattener
+// returns it as it is.
+func (f *Flattener) Apply(data map[string]interface{}) map[string]interface{} {
+	if f == nil {
+		return data
+	}
+	for _, path := range f.stringify {
+		path.transform(data, stringify)
+	}
+	src := data
+	if len(f.fields) > 0 {
+		src = make(map[string]interface{}, len(f.fields))
+		for _, field := range f.fields {
+			if v, ok := field.path.get(data); ok {
+				src[field.name] = v
+			}
+		}
+	}
+	out := make(map[string]interface{}, len(src))
+	for k, v := range src {
+		f.flattenInto(out, k, v)
+	}
+	return out
+}
+
+func (f *Flattener) join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + f.separator + key
+}
+
+// flattenInto adds the value to out as the field name, or as fields
+// prefixed with it if it's a flattened object or an exploded array
+func (f *Flattener) flattenInto(out map[string]interface{}, name string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if !f.flatten {
+			out[name] = v
+			return
+		}
+		for k, child := range v {
+			f.flattenInto(out, f.join(name, k), child)
+		}
+	case []interface{}:
+		switch f.arrays {
+		case arraysStringify:
+			out[name] = stringify(v)
+		case arraysExplode:
+			f.explodeInto(out, name, v)
+		default:
+			out[name] = v
+		}
+	default:
+		out[name] = v
+	}
+}
+
+// explodeInto turns an array of objects into an array per key, lined up by
+// position and with nil where an object doesn't have the key, so
+// [{"a":1},{"a":2,"b":3}] is sent as a [1,2] and b [nil,3]. Other arrays
+// are kept.
+func (f *Flattener) explodeInto(out map[string]interface{}, name string, array []interface{}) {
+	if len(array) == 0 {
+		out[name] = array
+		return
+	}
+	elems := make([]map[string]interface{}, len(array))
+	for i, elem := range array {
+		obj, ok := elem.(map[string]interface{})
+		if !ok {
+			out[name] = array
+			return
+		}
+		// the objects' own nested objects are flattened whatever the
+		// options, so every key holds an array of scalars
+		flat := make(map[string]interface{}, len(obj))
+		nested := &Flattener{flatten: true, separator: f.separator, arrays: f.arrays}
+		for k, child := range obj {
+			nested.flattenInto(flat, k, child)
+		}
+		elems[i] = flat
+	}
+	for i, elem := range elems {
+		for k, v := range elem {
+			field := f.join(name, k)
+			values, ok := out[field].([]interface{})
+			if !ok {
+				values = make([]interface{}, len(elems))
+				out[field] = values
+			}
+			values[i] = v
+		}
+	}
+}
+
+// stringify returns the value as JSON
+func stringify(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+type segmentKind int
+
+const (
+	keySegment segmentKind = iota
+	indexSegment
+	// [*], every element of an array
+	wildcardSegment
+)
+
+type pathSegment struct {
+	kind  segmentKind
+	key   string
+	index int
+}
+
+// jsonPath is a JSONPath-like path into an event: keys separated by dots,
+// with [n] for array elements, [*] for all of them and ["key"] for keys
+// with dots or brackets in them, optionally starting with $.
+type jsonPath []pathSegment
+
+func parsePath(spec string) (jsonPath, error) {
+	s := strings.TrimPrefix(spec, "$")
+	var path jsonPath
+	for len(s) > 0 {
+		switch {
+		case s[0] == '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q, unclosed [", spec)
+			}
+			inner := s[1:end]
+			if len(inner) > 1 && (inner[0] == '"' || inner[0] == '\'') {
+				// the key may have ] in it, so look for the closing quote
+				quote := inner[0]
+				closing := strings.IndexByte(s[2:], quote)
+				if closing < 0 || !strings.HasPrefix(s[2+closing+1:], "]") {
+					return nil, fmt.Errorf("invalid path %q, unclosed quote", spec)
+				}
+				path = append(path, pathSegment{kind: keySegment, key: s[2 : 2+closing]})
+				s = s[2+closing+2:]
+				continue
+			}
+			switch {
+			case inner == "*":
+				path = append(path, pathSegment{kind: wildcardSegment})
+			default:
+				i, err := strconv.Atoi(inner)
+				if err != nil || i < 0 {
+					return nil, fmt.Errorf("invalid path %q, expected an index, * or a quoted key in []", spec)
+				}
+				path = append(path, pathSegment{kind: indexSegment, index: i})
+			}
+			s = s[end+1:]
+		default:
+			if s[0] == '.' {
+				if len(path) == 0 && len(s) == len(spec) {
+					return nil, fmt.Errorf("invalid path %q, starts with a dot", spec)
+				}
+				s = s[1:]
+			}
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid path %q, empty key", spec)
+			}
+			path = append(path, pathSegment{kind: keySegment, key: s[:end]})
+			s = s[end:]
+		}
+	}
+	if len(path) == 0 {
+		return nil, fmt.Errorf("invalid path %q, no keys", spec)
+	}
+	return path, nil
+}
+
+// get returns the value at the path. Values under a wildcard are returned
+// as an array of those that were found.
+func (p jsonPath) get(v interface{}) (interface{}, bool) {
+	if len(p) == 0 {
+		return v, true
+	}
+	seg, rest := p[0], p[1:]
+	switch seg.kind {
+	case keySegment:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		child, ok := obj[seg.key]
+		if !ok {
+			return nil, false
+		}
+		return rest.get(child)
+	case indexSegment:
+		array, ok := v.([]interface{})
+		if !ok || seg.index >= len(array) {
+			return nil, false
+		}
+		return rest.get(array[seg.index])
+	case wildcardSegment:
+		array, ok := v.([]interface{})
+		if !ok {
+			return nil, false
+		}
+		values := make([]interface{}, 0, len(array))
+		for _, elem := range array {
+			if child, ok := rest.get(elem); ok {
+				values = append(values, child)
+			}
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+// transform replaces the values at the path, in place
+func (p jsonPath) transform(v interface{}, fn func(interface{}) interface{}) {
+	if len(p) == 0 {
+		return
+	}
+	seg, rest := p[0], p[1:]
+	switch seg.kind {
+	case keySegment:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		child, ok := obj[seg.key]
+		if !ok {
+			return
+		}
+		if len(rest) == 0 {
+			obj[seg.key] = fn(child)
+			return
+		}
+		rest.transform(child, fn)
+	case indexSegment:
+		array, ok := v.([]interface{})
+		if !ok || seg.index >= len(array) {
+			return
+		}
+		if len(rest) == 0 {
+			array[seg.index] = fn(array[seg.index])
+			return
+		}
+		rest.transform(array[seg.index], fn)
+	case wildcardSegment:
+		array, ok := v.([]interface{})
+		if !ok {
+			return
+		}
+		for i := range array {
+			if len(rest) == 0 {
+				array[i] = fn(array[i])
+			} else {
+				rest.transform(array[i], fn)
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package htjson
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+const nestedLine = `{"time":"2017-11-07T01:43:39Z","request":{"method":"GET","headers":{"host":"example.com","user-agent":"curl"}},"tags":["a","b"],"items":[{"id":1,"meta":{"x":1}},{"id":2,"name":"two"}]}`
+
+func TestFlatten(t *testing.T) {
+	tsts := []struct {
+		opts     FlattenOptions
+		expected map[string]interface{}
+	}{
+		{
+			FlattenOptions{Flatten: true},
+			map[string]interface{}{
+				"time":                       "2017-11-07T01:43:39Z",
+				"request_method":             "GET",
+				"request_headers_host":       "example.com",
+				"request_headers_user-agent": "curl",
+				"tags":                       []interface{}{"a", "b"},
+				"items": []interface{}{
+					map[string]interface{}{"id": float64(1), "meta": map[string]interface{}{"x": float64(1)}},
+					map[string]interface{}{"id": float64(2), "name": "two"},
+				},
+			},
+		},
+		{
+			FlattenOptions{Flatten: true, FlattenSeparator: ".", Arrays: arraysExplode, Stringify: []string{"request.headers"}},
+			map[string]interface{}{
+				"time":            "2017-11-07T01:43:39Z",
+				"request.method":  "GET",
+				"request.headers": `{"host":"example.com","user-agent":"curl"}`,
+				"tags":            []interface{}{"a", "b"},
+				"items.id":        []interface{}{float64(1), float64(2)},
+				"items.meta.x":    []interface{}{float64(1), nil},
+				"items.name":      []interface{}{nil, "two"},
+			},
+		},
+		{
+			FlattenOptions{Arrays: arraysStringify, Stringify: []string{"items[*].meta"}},
+			map[string]interface{}{
+				"time": "2017-11-07T01:43:39Z",
+				"request": map[string]interface{}{
+					"method":  "GET",
+					"headers": map[string]interface{}{"host": "example.com", "user-agent": "curl"},
+				},
+				"tags":  `["a","b"]`,
+				"items": `[{"id":1,"meta":"{\"x\":1}"},{"id":2,"name":"two"}]`,
+			},
+		},
+		{
+			FlattenOptions{Flatten: true, Fields: []string{
+				"time",
+				"$.request.headers['user-agent']:user_agent",
+				"request.headers",
+				"items[*].id:item_ids",
+				"items[1].name",
+				"missing.field",
+			}},
+			map[string]interface{}{
+				"time":                       "2017-11-07T01:43:39Z",
+				"user_agent":                 "curl",
+				"request_headers_host":       "example.com",
+				"request_headers_user-agent": "curl",
+				"item_ids":                   []interface{}{float64(1), float64(2)},
+				"items_1_name":               "two",
+			},
+		},
+	}
+	for _, tt := range tsts {
+		p := &Parser{}
+		if err := p.Init(&Options{FlattenOptions: tt.opts}); err != nil {
+			t.Fatalf("Init(%+v) unexpectedly returned error %s", tt.opts, err)
+		}
+		resp, err := p.lineParser.ParseLine(nestedLine)
+		if err != nil {
+			t.Error("ParseLine unexpectedly returned error ", err)
+		}
+		resp = p.flattener.Apply(resp)
+		if !reflect.DeepEqual(resp, tt.expected) {
+			t.Errorf("with %+v, response %+v didn't match expected %+v", tt.opts, resp, tt.expected)
+		}
+	}
+}
+
+func TestNewFlattener(t *testing.T) {
+	f, err := NewFlattener(FlattenOptions{FlattenSeparator: "_", Arrays: arraysKeep})
+	if f != nil || err != nil {
+		t.Errorf("expected no flattener for the default options, got %+v, %v", f, err)
+	}
+	for _, opts := range []FlattenOptions{
+		{Arrays: "split"},
+		{Stringify: []string{"a..b"}},
+		{Stringify: []string{"a[x]"}},
+		{Fields: []string{"a['b"}},
+		{Fields: []string{".a"}},
+		{Fields: []string{"[*]"}},
+	} {
+		if _, err := NewFlattener(opts); err == nil {
+			t.Errorf("NewFlattener(%+v) should err, instead got nil", opts)
+		}
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	path, err := parsePath(`$.a["b.c"][2][*].d`)
+	if err != nil {
+		t.Fatal("parsePath unexpectedly returned error ", err)
+	}
+	expected := jsonPath{
+		{kind: keySegment, key: "a"},
+		{kind: keySegment, key: "b.c"},
+		{kind: indexSegment, index: 2},
+		{kind: wildcardSegment},
+		{kind: keySegment, key: "d"},
+	}
+	if !reflect.DeepEqual(path, expected) {
+		t.Errorf("path %+v didn't match expected %+v", path, expected)
+	}
+}
+
+func TestProcessLinesSelectedFieldsKeepTimestamp(t *testing.T) {
+	p := &Parser{}
+	err := p.Init(&Options{
+		TimeFieldName:  "time",
+		FlattenOptions: FlattenOptions{Fields: []string{"request.method:method"}},
+	})
+	if err != nil {
+		t.Fatal("Parser Init unexpectedly returned error ", err)
+	}
+	lines := make(chan string, 1)
+	send := make(chan event.Event, 1)
+	lines <- nestedLine
+	close(lines)
+	p.ProcessLines(lines, send, nil)
+	ev := <-send
+	if expected := time.Date(2017, 11, 7, 1, 43, 39, 0, time.UTC); !ev.Timestamp.Equal(expected) {
+		t.Errorf("expected the timestamp %s from the unselected time field, got %s", expected, ev.Timestamp)
+	}
+	if expected := map[string]interface{}{"method": "GET"}; !reflect.DeepEqual(ev.Data, expected) {
+		t.Errorf("response %+v didn't match expected %+v", ev.Data, expected)
+	}
+}
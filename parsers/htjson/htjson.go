@@ -18,12 +18,16 @@ type Options struct {
 	TimeFieldName   string `long:"timefield" description:"Name of the field that contains a timestamp"`
 	TimeFieldFormat string `long:"format" description:"Format of the timestamp found in timefield (supports strftime and Golang time formats)"`
 
+	FlattenOptions
+
 	NumParsers int `hidden:"true" description:"number of htjson parsers to spin up"`
 }
 
 type Parser struct {
 	conf       Options
 	lineParser parsers.LineParser
+	// flattens nested objects and arrays, if configured
+	flattener *Flattener
 
 	warnedAboutTime bool
 }
@@ -31,6 +35,11 @@ type Parser struct {
 func (p *Parser) Init(options interface{}) error {
 	p.conf = *options.(*Options)
 
+	flattener, err := NewFlattener(p.conf.FlattenOptions)
+	if err != nil {
+		return err
+	}
+	p.flattener = flattener
 	p.lineParser = &JSONLineParser{}
 	return nil
 }
@@ -80,6 +89,9 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 					continue
 				}
 				timestamp := httime.GetTimestamp(parsedLine, p.conf.TimeFieldName, p.conf.TimeFieldFormat)
+				// flatten and select fields once the timestamp is taken, so
+				// the time field needn't be selected
+				parsedLine = p.flattener.Apply(parsedLine)
 
 				// merge the prefix fields and the parsed line contents
 				for k, v := range prefixFields {
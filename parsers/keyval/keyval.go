@@ -2,6 +2,7 @@
 package keyval
 
 import (
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
@@ -10,16 +11,21 @@ import (
 	"github.com/kr/logfmt"
 	"github.com/sirupsen/logrus"
 
+	"github.com/AIntelligenceGame/clicktail/parsers/fieldtype"
 	"github.com/honeycombio/honeytail/event"
 	"github.com/honeycombio/honeytail/httime"
 	"github.com/honeycombio/honeytail/parsers"
 )
 
 type Options struct {
-	TimeFieldName   string `long:"timefield" description:"Name of the field that contains a timestamp"`
-	TimeFieldFormat string `long:"format" description:"Format of the timestamp found in timefield (supports strftime and Golang time formats)"`
-	FilterRegex     string `long:"filter_regex" description:"a regular expression that will filter the input stream and only parse lines that match"`
-	InvertFilter    bool   `long:"invert_filter" description:"change the filter_regex to only process lines that do *not* match"`
+	TimeFieldName   string   `long:"timefield" description:"Name of the field that contains a timestamp"`
+	TimeFieldFormat string   `long:"format" description:"Format of the timestamp found in timefield (supports strftime and Golang time formats)"`
+	FilterRegex     string   `long:"filter_regex" description:"a regular expression that will filter the input stream and only parse lines that match"`
+	InvertFilter    bool     `long:"invert_filter" description:"change the filter_regex to only process lines that do *not* match"`
+	FieldTypes      []string `long:"field_type" description:"Type to convert a field to instead of guessing, as field:type[:arg], eg. \"took:duration:ms\". Types are string, int, float, bool, duration (arg is the unit, default ms), ip, timestamp (arg is the format) and size (eg. 10KB, in bytes). May be specified multiple times."`
+	KeySeparator    string   `long:"key_separator" description:"String to replace the dots of nested keys with, eg. \"_\" to send a.b=1 as a_b. Keys are kept as they are if it's not set."`
+	GuessDurations  bool     `long:"guess_durations" description:"Send values that look like durations, such as 1.5s or 250ms, as numbers in --keyval.duration_unit. Use --keyval.field_type to convert only some fields."`
+	DurationUnit    string   `long:"duration_unit" description:"Unit to send guessed durations in: ns, us, ms, s, m or h" default:"ms"`
 
 	NumParsers int `hidden:"true" description:"number of keyval parsers to spin up"`
 }
@@ -41,18 +47,50 @@ func (p *Parser) Init(options interface{}) error {
 		}
 	}
 
-	p.lineParser = &KeyValLineParser{}
+	fieldTypes, err := fieldtype.ParseFields(p.conf.FieldTypes)
+	if err != nil {
+		return err
+	}
+	lineParser := &KeyValLineParser{
+		fieldTypes:   fieldTypes,
+		keySeparator: p.conf.KeySeparator,
+	}
+	if p.conf.GuessDurations {
+		unit := p.conf.DurationUnit
+		if unit == "" {
+			unit = "ms"
+		}
+		durations, err := fieldtype.New(fieldtype.Duration, unit)
+		if err != nil {
+			return fmt.Errorf("invalid --keyval.duration_unit: %s", err)
+		}
+		lineParser.durations = durations
+	}
+	p.lineParser = lineParser
 	return nil
 }
 
 type KeyValLineParser struct {
+	// types of fields that shouldn't be guessed
+	fieldTypes fieldtype.Fields
+	// what the dots of nested keys are replaced with, if anything
+	keySeparator string
+	// converts values that look like durations, if they're guessed
+	durations *fieldtype.Converter
 }
 
 func (j *KeyValLineParser) ParseLine(line string) (map[string]interface{}, error) {
 	parsed := make(map[string]interface{})
 	f := func(key, val []byte) error {
 		keyStr := string(key)
+		if j.keySeparator != "" {
+			keyStr = strings.Replace(keyStr, ".", j.keySeparator, -1)
+		}
 		valStr := string(val)
+		if typed, ok := j.fieldTypes.Convert(keyStr, valStr); ok {
+			parsed[keyStr] = typed
+			return nil
+		}
 		if b, err := strconv.ParseBool(valStr); err == nil {
 			parsed[keyStr] = b
 			return nil
@@ -65,6 +103,12 @@ func (j *KeyValLineParser) ParseLine(line string) (map[string]interface{}, error
 			parsed[keyStr] = f
 			return nil
 		}
+		if j.durations != nil {
+			if d, err := j.durations.Convert(valStr); err == nil {
+				parsed[keyStr] = d
+				return nil
+			}
+		}
 		parsed[keyStr] = valStr
 		return nil
 	}
@@ -261,3 +261,86 @@ func TestAllEmpty(t *testing.T) {
 		}
 	}
 }
+
+func TestParseLineFieldTypes(t *testing.T) {
+	p := &Parser{}
+	err := p.Init(&Options{
+		FieldTypes: []string{"took:duration:ms", "sent:size", "version:string", "on:bool"},
+	})
+	if err != nil {
+		t.Fatal("Parser Init with field types unexpectedly returned error ", err)
+	}
+	resp, err := p.lineParser.ParseLine(`took=1.5s sent=2KB version=1.10 on=yes count=3`)
+	if err != nil {
+		t.Error("ParseLine unexpectedly returned error ", err)
+	}
+	expected := map[string]interface{}{
+		"took":    1500.0,
+		"sent":    int64(2048),
+		"version": "1.10",
+		"on":      true,
+		"count":   3,
+	}
+	if !reflect.DeepEqual(resp, expected) {
+		t.Errorf("response %+v didn't match expected %+v", resp, expected)
+	}
+
+	if err := p.Init(&Options{FieldTypes: []string{"took"}}); err == nil {
+		t.Error("Parser Init with a broken field type should err, instead got nil")
+	}
+}
+
+func TestParseLineNestedKeysAndDurations(t *testing.T) {
+	p := &Parser{}
+	err := p.Init(&Options{
+		KeySeparator:   "_",
+		GuessDurations: true,
+		DurationUnit:   "s",
+	})
+	if err != nil {
+		t.Fatal("Parser Init unexpectedly returned error ", err)
+	}
+	resp, err := p.lineParser.ParseLine(`req.method=GET req.took=1m30s db.queries=3 at=info`)
+	if err != nil {
+		t.Error("ParseLine unexpectedly returned error ", err)
+	}
+	expected := map[string]interface{}{
+		"req_method": "GET",
+		"req_took":   90.0,
+		"db_queries": 3,
+		"at":         "info",
+	}
+	if !reflect.DeepEqual(resp, expected) {
+		t.Errorf("response %+v didn't match expected %+v", resp, expected)
+	}
+
+	// without options, keys are kept and durations are left as strings
+	if err := p.Init(&Options{DurationUnit: "ms"}); err != nil {
+		t.Fatal("Parser Init unexpectedly returned error ", err)
+	}
+	resp, err = p.lineParser.ParseLine(`req.took=250us`)
+	if err != nil {
+		t.Error("ParseLine unexpectedly returned error ", err)
+	}
+	expected = map[string]interface{}{"req.took": "250us"}
+	if !reflect.DeepEqual(resp, expected) {
+		t.Errorf("response %+v didn't match expected %+v", resp, expected)
+	}
+
+	// guessed durations are in milliseconds by default
+	if err := p.Init(&Options{GuessDurations: true}); err != nil {
+		t.Fatal("Parser Init unexpectedly returned error ", err)
+	}
+	resp, err = p.lineParser.ParseLine(`req.took=250us`)
+	if err != nil {
+		t.Error("ParseLine unexpectedly returned error ", err)
+	}
+	expected = map[string]interface{}{"req.took": 0.25}
+	if !reflect.DeepEqual(resp, expected) {
+		t.Errorf("response %+v didn't match expected %+v", resp, expected)
+	}
+
+	if err := p.Init(&Options{GuessDurations: true, DurationUnit: "days"}); err == nil {
+		t.Error("Parser Init with an unknown duration unit should err, instead got nil")
+	}
+}
@@ -0,0 +1,163 @@
+package mongodb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// From 4.4, mongod logs structured JSON instead of text:
+//
+// {"t":{"$date":"2020-05-20T19:18:40.604+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"test.coll","command":{"find":"coll","filter":{"a":1},"$db":"test"},"planSummary":"COLLSCAN","keysExamined":0,"docsExamined":1,"nreturned":1,"reslen":230,"durationMillis":0}}
+//
+// We map it onto the fields the text format parses into, so both are
+// processed (and queried) the same way.
+
+const (
+	jsonLogPrefix = `{"t":`
+
+	// the JSON format writes offsets with a colon
+	iso8601OffsetTimeFormat = "2006-01-02T15:04:05.000-07:00"
+
+	replSetConfigMessage = "New replica set config in use"
+)
+
+// attrFieldNames maps the attr of the JSON format to the fields of the text
+// format. The rest of attr is kept as is.
+var attrFieldNames = map[string]string{
+	"durationMillis": "duration_ms",
+	"ns":             namespaceFieldName,
+	"type":           "operation",
+}
+
+var errNotJSONLogLine = errors.New("not a JSON log line")
+
+// isJSONLogLine returns true for lines in the 4.4+ JSON format
+func isJSONLogLine(line string) bool {
+	return strings.HasPrefix(line, jsonLogPrefix)
+}
+
+// jsonLogLine is a line of the JSON format
+type jsonLogLine struct {
+	T struct {
+		Date json.RawMessage `json:"$date"`
+	} `json:"t"`
+	S    string                     `json:"s"`
+	C    string                     `json:"c"`
+	ID   *int64                     `json:"id"`
+	Ctx  string                     `json:"ctx"`
+	Msg  string                     `json:"msg"`
+	Attr map[string]json.RawMessage `json:"attr"`
+}
+
+// parseJSONLogLine parses a line of the JSON format into the fields the
+// text format would have
+func parseJSONLogLine(line string) (map[string]interface{}, error) {
+	var l jsonLogLine
+	if err := json.Unmarshal([]byte(line), &l); err != nil {
+		return nil, err
+	}
+	if len(l.T.Date) == 0 {
+		return nil, errNotJSONLogLine
+	}
+	values := make(map[string]interface{}, len(l.Attr)+8)
+	timestamp, err := jsonLogDate(l.T.Date)
+	if err != nil {
+		return nil, err
+	}
+	values[timestampFieldName] = timestamp
+	values["severity"] = jsonLogSeverity(l.S)
+	values["component"] = l.C
+	values["context"] = l.Ctx
+	values["message"] = l.Msg
+	if l.ID != nil {
+		values["log_id"] = *l.ID
+	}
+
+	for k, raw := range l.Attr {
+		var v interface{}
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+		if name, ok := attrFieldNames[k]; ok {
+			k = name
+		}
+		values[k] = v
+		if k == "command" {
+			// the command name is the first key of the command
+			if name := firstKey(raw); name != "" {
+				values["command_type"] = name
+			}
+		}
+	}
+	return values, nil
+}
+
+// jsonLogDate returns the timestamp of the line in a format parseTimestamp
+// knows. It's normally an ISO 8601 date, but can be set to milliseconds
+// since the epoch.
+func jsonLogDate(raw json.RawMessage) (string, error) {
+	var date string
+	if err := json.Unmarshal(raw, &date); err == nil {
+		return date, nil
+	}
+	var long struct {
+		NumberLong string `json:"$numberLong"`
+	}
+	if err := json.Unmarshal(raw, &long); err != nil {
+		return "", err
+	}
+	millis, err := strconv.ParseInt(long.NumberLong, 10, 64)
+	if err != nil {
+		return "", err
+	}
+	return time.Unix(0, millis*int64(time.Millisecond)).UTC().Format(iso8601OffsetTimeFormat), nil
+}
+
+// jsonLogSeverity converts the severity to the names the text format uses
+func jsonLogSeverity(s string) string {
+	switch {
+	case s == "F":
+		return "fatal"
+	case s == "E":
+		return "error"
+	case s == "W":
+		return "warning"
+	case s == "I":
+		return "informational"
+	case strings.HasPrefix(s, "D"):
+		return "debug"
+	}
+	return s
+}
+
+// firstKey returns the first key of a JSON object
+func firstKey(raw json.RawMessage) string {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return ""
+	}
+	if t, err := dec.Token(); err == nil {
+		if key, ok := t.(string); ok {
+			return key
+		}
+	}
+	return ""
+}
+
+// replicaSetFromConfig returns the name of the replica set from the config
+// logged when it changes
+func replicaSetFromConfig(values map[string]interface{}) string {
+	if msg, ok := values["message"].(string); !ok || msg != replSetConfigMessage {
+		return ""
+	}
+	config, ok := values["config"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	name, _ := config["_id"].(string)
+	return name
+}
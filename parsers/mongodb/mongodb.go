@@ -11,6 +11,7 @@ import (
 	queryshape "github.com/honeycombio/mongodbtools/queryshape"
 	"github.com/sirupsen/logrus"
 
+	"github.com/AIntelligenceGame/clicktail/parsers/htjson"
 	"github.com/honeycombio/honeytail/event"
 	"github.com/honeycombio/honeytail/httime"
 	"github.com/honeycombio/honeytail/parsers"
@@ -41,6 +42,7 @@ const (
 )
 
 var timestampFormats = []string{
+	iso8601OffsetTimeFormat,
 	iso8601LocalTimeFormat,
 	iso8601UTCTimeFormat,
 	ctimeTimeFormat,
@@ -50,11 +52,14 @@ var timestampFormats = []string{
 type Options struct {
 	LogPartials bool `long:"log_partials" description:"Send what was successfully parsed from a line (only if the error occured in the log line's message)."`
 
+	htjson.FlattenOptions
+
 	NumParsers int `hidden:"true" description:"number of mongo parsers to spin up"`
 }
 
 type Parser struct {
-	conf Options
+	conf      Options
+	flattener *htjson.Flattener
 
 	lock              sync.RWMutex
 	currentReplicaSet string
@@ -64,12 +69,17 @@ type MongoLineParser struct {
 }
 
 func (m *MongoLineParser) ParseLine(line string) (map[string]interface{}, error) {
+	if isJSONLogLine(line) {
+		return parseJSONLogLine(line)
+	}
 	return logparser.ParseLogLine(line)
 }
 
 func (p *Parser) Init(options interface{}) error {
 	p.conf = *options.(*Options)
-	return nil
+	var err error
+	p.flattener, err = htjson.NewFlattener(p.conf.FlattenOptions)
+	return err
 }
 
 func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
@@ -125,6 +135,11 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 						}
 					}
 
+					if replicaSet := replicaSetFromConfig(values); replicaSet != "" {
+						p.lock.Lock()
+						p.currentReplicaSet = replicaSet
+						p.lock.Unlock()
+					}
 					if ns, ok := values["namespace"].(string); ok && ns == "admin.$cmd" {
 						if cmdType, ok := values["command_type"]; ok && cmdType == "replSetHeartbeat" {
 							if cmd, ok := values["command"].(map[string]interface{}); ok {
@@ -159,7 +174,7 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 
 					send <- event.Event{
 						Timestamp: timestamp,
-						Data:      values,
+						Data:      p.flattener.Apply(values),
 					}
 				} else {
 					logFailure(line, err, "logline didn't parse, skipping.")
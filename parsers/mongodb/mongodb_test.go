@@ -6,6 +6,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/AIntelligenceGame/clicktail/parsers/htjson"
 	"github.com/honeycombio/honeytail/event"
 	"github.com/honeycombio/honeytail/httime"
 	"github.com/honeycombio/honeytail/httime/httimetest"
@@ -31,6 +32,9 @@ const (
 	UPDATE_SIMPLE_COMMAND  = `Tue Sep 13 21:10:33.961 I COMMAND  [conn11896572] command data.$cmd command: update { update: "currentMood", updates: [ { q: { mood: "bright" }, u: { $set: { mood: "dark" } } } ], writeConcern: { getLastError: 1, w: 1 }, ordered: true } keyUpdates:0 writeConflicts:0 numYields:0 reslen:95 locks:{ Global: { acquireCount: { r: 1, w: 1 } }, Database: { acquireCount: { w: 1 } }, Collection: { acquireCount: { w: 1 } } } user_key_comparison_count:466 block_cache_hit_count:10 block_read_count:0 block_read_byte:0 internal_key_skipped_count:17 internal_delete_skipped_count:0 get_from_memtable_count:0 seek_on_memtable_count:2 seek_child_seek_count:12 0ms`
 	UPDATE_COMMAND         = `Tue Sep 13 21:10:33.961 I COMMAND  [conn11896572] command data.$cmd command: update { update: "avengers", updates: [ { q: { hulkForm: "Bruce Banner" }, u: { $set: { hulkForm: "Big Green" }, $setOnInsert: { hulkForm: "Big Green" } }, upsert: true } ], writeConcern: { getLastError: 1, w: 1 }, ordered: true } keyUpdates:0 writeConflicts:0 numYields:0 reslen:95 locks:{ Global: { acquireCount: { r: 1, w: 1 } }, Database: { acquireCount: { w: 1 } }, Collection: { acquireCount: { w: 1 } } } user_key_comparison_count:466 block_cache_hit_count:10 block_read_count:0 block_read_byte:0 internal_key_skipped_count:17 internal_delete_skipped_count:0 get_from_memtable_count:0 seek_on_memtable_count:2 seek_child_seek_count:12 0ms`
 	DELETE_SIMPLE_COMMAND  = `Tue Sep 13 21:10:33.961 I COMMAND  [conn11974626] command appdata387.$cmd command: delete { delete: "currentMood", deletes: [ { q: { mood: "bright" } } ], writeConcern: { getLastError: 1, w: 1 } } keyUpdates:0 writeConflicts:0 numYields:0 reslen:80 locks:{ Global: { acquireCount: { r: 1, w: 1 } }, Database: { acquireCount: { w: 1 } }, Collection: { acquireCount: { w: 1 } } } user_key_comparison_count:392 block_cache_hit_count:10 block_read_count:0 block_read_byte:0 internal_key_skipped_count:0 internal_delete_skipped_count:0 get_from_memtable_count:0 seek_on_memtable_count:2 seek_child_seek_count:12 0ms`
+	JSON_4_4_FIND          = `{"t":{"$date":"2020-05-20T19:18:40.604+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"test.coll","appName":"MongoDB Shell","command":{"find":"coll","filter":{"a":1,"b":{"$gt":5}},"lsid":{"id":{"$uuid":"4a3ad4e1-9d0c-4b3c-a7b1-6fb1d4e0a2a2"}},"$db":"test"},"planSummary":"IXSCAN { a: 1 }","keysExamined":3,"docsExamined":2,"cursorExhausted":true,"numYields":0,"nreturned":1,"reslen":230,"locks":{"Global":{"acquireCount":{"r":1}},"Database":{"acquireCount":{"r":1}},"Collection":{"acquireCount":{"r":1}}},"protocol":"op_msg","durationMillis":105}}`
+	JSON_4_4_REPLSET       = `{"t":{"$date":"2020-05-20T15:18:41.000-04:00"},"s":"I","c":"REPL","id":21392,"ctx":"ReplCoord-0","msg":"New replica set config in use","attr":{"config":{"_id":"rs0","version":2,"members":[{"_id":0,"host":"mongo1:27017"}]}}}`
+	JSON_4_4_ERROR         = `{"t":{"$date":{"$numberLong":"1589998722000"}},"s":"E","c":"NETWORK","id":22944,"ctx":"conn13","msg":"Connection ended","attr":{"remote":"127.0.0.1:53000","connectionCount":0}}`
 	DELETE_COMMAND         = `Tue Sep 13 21:10:33.961 I COMMAND  [conn11974626] command appdata387.$cmd command: delete { delete: "avengerMembers", deletes: [ { q: { hulkForm: "Big Green", issue: { $ne: 4 } }, limit: 1 } ], writeConcern: { getLastError: 1, w: 1 } } keyUpdates:0 writeConflicts:0 numYields:0 reslen:80 locks:{ Global: { acquireCount: { r: 1, w: 1 } }, Database: { acquireCount: { w: 1 } }, Collection: { acquireCount: { w: 1 } } } user_key_comparison_count:392 block_cache_hit_count:10 block_read_count:0 block_read_byte:0 internal_key_skipped_count:0 internal_delete_skipped_count:0 get_from_memtable_count:0 seek_on_memtable_count:2 seek_child_seek_count:12 0ms`
 )
 
@@ -52,6 +56,9 @@ var (
 	MONGO_3_4_SHARDING_TIME, _     = time.ParseInLocation(iso8601LocalTimeFormat, "2016-10-20T22:27:59.516+0000", time.UTC)
 	UPDATE_COMMAND_TIME, _         = time.ParseInLocation(ctimeTimeFormat, "Tue Sep 13 21:10:33.961", time.UTC)
 	DELETE_COMMAND_TIME, _         = time.ParseInLocation(ctimeTimeFormat, "Tue Sep 13 21:10:33.961", time.UTC)
+	JSON_4_4_FIND_TIME             = time.Date(2020, time.May, 20, 19, 18, 40, 604000000, time.UTC)
+	JSON_4_4_REPLSET_TIME          = time.Date(2020, time.May, 20, 19, 18, 41, 0, time.UTC)
+	JSON_4_4_ERROR_TIME            = time.Date(2020, time.May, 20, 18, 18, 42, 0, time.UTC)
 )
 
 func init() {
@@ -415,6 +422,61 @@ func TestProcessLines(t *testing.T) {
 				excludeKeys: []string{},
 			},
 		},
+		{
+			line: JSON_4_4_REPLSET,
+			expected: processed{
+				time: JSON_4_4_REPLSET_TIME,
+				includeData: map[string]interface{}{
+					"severity":    "informational",
+					"component":   "REPL",
+					"context":     "ReplCoord-0",
+					"message":     "New replica set config in use",
+					"log_id":      int64(21392),
+					"replica_set": "rs0",
+				},
+			},
+		},
+		{
+			line: JSON_4_4_FIND,
+			expected: processed{
+				time: JSON_4_4_FIND_TIME,
+				includeData: map[string]interface{}{
+					"severity":             "informational",
+					"component":            "COMMAND",
+					"context":              "conn12",
+					"message":              "Slow query",
+					"operation":            "command",
+					"namespace":            "test.coll",
+					"database":             "test",
+					"collection":           "coll",
+					"command_type":         "find",
+					"appName":              "MongoDB Shell",
+					"planSummary":          "IXSCAN { a: 1 }",
+					"keysExamined":         float64(3),
+					"docsExamined":         float64(2),
+					"nreturned":            float64(1),
+					"duration_ms":          float64(105),
+					"global_read_lock":     float64(1),
+					"collection_read_lock": float64(1),
+					"query":                map[string]interface{}{"a": float64(1), "b": map[string]interface{}{"$gt": float64(5)}},
+					"normalized_query":     `{ "a": 1, "b": { "$gt": 1 } }`,
+					"replica_set":          "rs0",
+				},
+				excludeKeys: []string{"locks", "durationMillis", "ns", "timestamp"},
+			},
+		},
+		{
+			line: JSON_4_4_ERROR,
+			expected: processed{
+				time: JSON_4_4_ERROR_TIME,
+				includeData: map[string]interface{}{
+					"severity":        "error",
+					"component":       "NETWORK",
+					"remote":          "127.0.0.1:53000",
+					"connectionCount": float64(0),
+				},
+			},
+		},
 	}
 	m := &Parser{
 		conf: Options{
@@ -453,3 +515,27 @@ func TestProcessLines(t *testing.T) {
 	}
 	close(send)
 }
+
+func TestProcessLinesFlatten(t *testing.T) {
+	m := &Parser{}
+	err := m.Init(&Options{
+		FlattenOptions: htjson.FlattenOptions{
+			Flatten:   true,
+			Stringify: []string{"query"},
+		},
+	})
+	assert.Nil(t, err)
+	lines := make(chan string, 1)
+	send := make(chan event.Event, 1)
+	lines <- JSON_4_4_FIND
+	close(lines)
+	m.ProcessLines(lines, send, nil)
+	ev := <-send
+	assert.Equal(t, "coll", ev.Data["command_find"])
+	assert.Equal(t, "test", ev.Data["command_$db"])
+	assert.Equal(t, `{"a":1,"b":{"$gt":5}}`, ev.Data["query"])
+	_, ok := ev.Data["command"]
+	assert.False(t, ok)
+
+	assert.NotNil(t, m.Init(&Options{FlattenOptions: htjson.FlattenOptions{Arrays: "split"}}))
+}
@@ -0,0 +1,133 @@
+package mysql
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Every flavour of the slow log writes its per query statistics as
+// `# Key: value  Key: value` comment lines, but which keys show up, and on
+// which line, depends on the server and its settings:
+//
+// MySQL 8.0.14+ with log_slow_extra:
+// # Query_time: 0.000216  Lock_time: 0.000096 Rows_sent: 1  Rows_examined: 1 Thread_id: 8 Errno: 0 Killed: 0 Bytes_received: 0 Bytes_sent: 75 Read_first: 0 Read_last: 0 Read_key: 1 ...
+//
+// MariaDB:
+// # Thread_id: 42  Schema: test  QC_hit: No
+// # Rows_affected: 0  Bytes_sent: 59
+// # Full_scan: Yes  Full_join: No  Tmp_table: No  Tmp_table_on_disk: No
+//
+// Percona Server:
+// # Thread_id: 78959 Schema: weave3 Last_errno: 0 Killed: 0
+// # InnoDB_IO_r_ops: 0  InnoDB_IO_r_bytes: 0  InnoDB_IO_r_wait: 0.000000
+//
+// Rather than a regex per variant, any attribute on such a line is captured
+// under its lowercased name. The named fields parsed in handleEvent take
+// precedence, so the attributes only fill in what they don't cover.
+
+// attributeAliases maps attribute names to the field the named parsers
+// already use for the same thing, so that every flavour ends up in the same
+// column.
+var attributeAliases = map[string]string{
+	"qc_hit":                  queryCacheHitKey,
+	"last_errno":              errorNoKey,
+	"errno":                   errorNoKey,
+	"innodb_trx_id":           transactionIDKey,
+	"innodb_io_r_ops":         ioROpsKey,
+	"innodb_io_r_bytes":       ioRBytesKey,
+	"innodb_io_r_wait":        ioRWaitKey,
+	"innodb_rec_lock_wait":    recLockWaitKey,
+	"innodb_queue_wait":       queueWaitKey,
+	"innodb_pages_distinct":   pagesDistinctKey,
+	"log_slow_rate_type":      slRateTypeKey,
+	"log_slow_rate_limit":     slRateLimitKey,
+	"created_tmp_tables":      tmpTablesKey,
+	"created_tmp_disk_tables": tmpDiskTablesKey,
+	"start":                   "start_time",
+	"end":                     "end_time",
+}
+
+// stringAttributes are kept as strings whatever they look like, to match the
+// named parsers that set the same fields.
+var stringAttributes = map[string]bool{
+	errorNoKey:       true,
+	killedKey:        true,
+	transactionIDKey: true,
+	slRateTypeKey:    true,
+	slRateLimitKey:   true,
+}
+
+// skipAttributeLine returns true for comment lines that aren't attribute
+// lists, or whose attributes need more than a split on whitespace.
+func skipAttributeLine(line string) bool {
+	return strings.HasPrefix(line, "# Time:") ||
+		strings.HasPrefix(line, "# User@Host:") ||
+		strings.HasPrefix(line, "# administrator command:")
+}
+
+// parseAttributes adds each `Key: value` pair in a slow log comment line to
+// attrs. A key without a value, as in "Schema:  Last_errno: 0", is skipped.
+func parseAttributes(line string, attrs map[string]interface{}) {
+	if !strings.HasPrefix(line, "# ") || skipAttributeLine(line) {
+		return
+	}
+	tokens := strings.Fields(line[2:])
+	for i := 0; i < len(tokens); i++ {
+		key, ok := attributeKey(tokens[i])
+		if !ok || i+1 == len(tokens) {
+			continue
+		}
+		if _, isKey := attributeKey(tokens[i+1]); isKey {
+			continue
+		}
+		i++
+		if alias, ok := attributeAliases[key]; ok {
+			key = alias
+		}
+		if stringAttributes[key] {
+			attrs[key] = tokens[i]
+		} else {
+			attrs[key] = inferAttributeType(tokens[i])
+		}
+	}
+}
+
+// attributeKey returns the field name for a `Key:` token
+func attributeKey(token string) (string, bool) {
+	if len(token) < 2 || !strings.HasSuffix(token, ":") {
+		return "", false
+	}
+	name := token[:len(token)-1]
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c == '_', c >= '0' && c <= '9':
+			if i == 0 {
+				return "", false
+			}
+		default:
+			return "", false
+		}
+	}
+	return strings.ToLower(name), true
+}
+
+// inferAttributeType turns integers, decimals and Yes/No into ints, floats and
+// bools, and leaves everything else a string.
+func inferAttributeType(val string) interface{} {
+	if c := val[0]; c >= '0' && c <= '9' || c == '-' {
+		if i, err := strconv.Atoi(val); err == nil {
+			return i
+		}
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f
+		}
+	}
+	switch val {
+	case "Yes":
+		return true
+	case "No":
+		return false
+	}
+	return val
+}
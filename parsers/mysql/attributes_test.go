@@ -0,0 +1,194 @@
+package mysql
+
+import (
+	"testing"
+
+	"github.com/honeycombio/mysqltools/query/normalizer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAttributes(t *testing.T) {
+	tsts := []struct {
+		line     string
+		expected map[string]interface{}
+	}{
+		{"# Thread_id: 42  Schema: test  QC_hit: No", map[string]interface{}{
+			"thread_id": 42, schemaKey: "test", queryCacheHitKey: false,
+		}},
+		{"# Schema:  Last_errno: 0  Killed: 0", map[string]interface{}{
+			errorNoKey: "0", killedKey: "0",
+		}},
+		{"# Start: 2019-05-09T09:22:28.123456Z End: 2019-05-09T09:22:28.234567Z", map[string]interface{}{
+			"start_time": "2019-05-09T09:22:28.123456Z", "end_time": "2019-05-09T09:22:28.234567Z",
+		}},
+		{"# InnoDB_IO_r_wait: 0.000100  Trailing:", map[string]interface{}{
+			ioRWaitKey: 0.0001,
+		}},
+		{"# administrator command: Quit;", map[string]interface{}{}},
+		{"# User@Host: root[root] @ localhost []  Id:   233", map[string]interface{}{}},
+		{"SELECT 'a: b' FROM c;", map[string]interface{}{}},
+	}
+	for _, tt := range tsts {
+		attrs := map[string]interface{}{}
+		parseAttributes(tt.line, attrs)
+		assert.Equal(t, tt.expected, attrs, tt.line)
+	}
+}
+
+func TestSlowLogFlavours(t *testing.T) {
+	p := &Parser{}
+	ptp := &perThreadParser{
+		normalizer: &normalizer.Parser{},
+	}
+	tsts := []struct {
+		flavour  string
+		lines    []string
+		expected map[string]interface{}
+	}{
+		{
+			flavour: "MySQL 8 log_slow_extra",
+			lines: []string{
+				"# Time: 2019-05-09T09:22:28.234567Z",
+				"# User@Host: root[root] @ localhost []  Id:     8",
+				"# Query_time: 0.000216  Lock_time: 0.000096 Rows_sent: 1  Rows_examined: 1 Thread_id: 8 Errno: 0 Killed: 0 Bytes_received: 0 Bytes_sent: 75 Read_first: 0 Read_last: 0 Read_key: 1 Read_next: 0 Read_prev: 0 Read_rnd: 0 Read_rnd_next: 0 Sort_merge_passes: 0 Sort_range_count: 0 Sort_rows: 0 Sort_scan_count: 0 Created_tmp_disk_tables: 0 Created_tmp_tables: 0 Start: 2019-05-09T09:22:28.234351Z End: 2019-05-09T09:22:28.234567Z",
+				"SET timestamp=1557393748;",
+				"SELECT * FROM t1 WHERE id = 1;",
+			},
+			expected: map[string]interface{}{
+				queryTimeKey:        0.000216,
+				lockTimeKey:         0.000096,
+				rowsSentKey:         1,
+				rowsExaminedKey:     1,
+				"thread_id":         8,
+				errorNoKey:          "0",
+				killedKey:           "0",
+				"bytes_received":    0,
+				bytesSentKey:        75,
+				"read_first":        0,
+				"read_last":         0,
+				"read_key":          1,
+				"read_next":         0,
+				"read_prev":         0,
+				"read_rnd":          0,
+				"read_rnd_next":     0,
+				"sort_merge_passes": 0,
+				"sort_range_count":  0,
+				"sort_rows":         0,
+				"sort_scan_count":   0,
+				tmpDiskTablesKey:    0,
+				tmpTablesKey:        0,
+				"start_time":        "2019-05-09T09:22:28.234351Z",
+				"end_time":          "2019-05-09T09:22:28.234567Z",
+			},
+		},
+		{
+			flavour: "MariaDB",
+			lines: []string{
+				"# Time: 190509  9:22:28",
+				"# User@Host: root[root] @ localhost []",
+				"# Thread_id: 42  Schema: test  QC_hit: No",
+				"# Query_time: 1.500000  Lock_time: 0.000100  Rows_sent: 0  Rows_examined: 100000",
+				"# Rows_affected: 3  Bytes_sent: 59",
+				"# Full_scan: Yes  Full_join: No  Tmp_table: No  Tmp_table_on_disk: No",
+				"# Filesort: No  Filesort_on_disk: No  Merge_passes: 0  Priority_queue: No",
+				"SET timestamp=1557393748;",
+				"UPDATE t1 SET a = 2 WHERE b = 3;",
+			},
+			expected: map[string]interface{}{
+				"thread_id":       42,
+				schemaKey:         "test",
+				queryCacheHitKey:  false,
+				queryTimeKey:      1.5,
+				lockTimeKey:       0.0001,
+				rowsSentKey:       0,
+				rowsExaminedKey:   100000,
+				rowsAffectedKey:   3,
+				bytesSentKey:      59,
+				fullScanKey:       true,
+				fullJoinKey:       false,
+				tmpTableKey:       false,
+				tmpTableOnDiskKey: false,
+				fileSortKey:       false,
+				fileSortOnDiskKey: false,
+				mergePassesKey:    0,
+				"priority_queue":  false,
+			},
+		},
+		{
+			flavour: "Percona Server",
+			lines: []string{
+				"# Time: 2019-05-09T09:22:28.234567Z",
+				"# User@Host: root[root] @ localhost []  Id:     8",
+				"# Schema: test  Last_errno: 1062  Killed: 0",
+				"# Query_time: 0.000216  Lock_time: 0.000096  Rows_sent: 0  Rows_examined: 0  Rows_affected: 0",
+				"# Bytes_sent: 11  Tmp_tables: 0  Tmp_disk_tables: 0  Tmp_table_sizes: 0",
+				"# InnoDB_trx_id: 1A2B",
+				"# QC_Hit: No  Full_scan: No  Full_join: No  Tmp_table: No  Tmp_table_on_disk: No",
+				"# Filesort: No  Filesort_on_disk: No  Merge_passes: 0",
+				"#   InnoDB_IO_r_ops: 1  InnoDB_IO_r_bytes: 16384  InnoDB_IO_r_wait: 0.000100",
+				"#   InnoDB_rec_lock_wait: 0.000000  InnoDB_queue_wait: 0.000000",
+				"#   InnoDB_pages_distinct: 2",
+				"# Log_slow_rate_type: query  Log_slow_rate_limit: 10",
+				"SET timestamp=1557393748;",
+				"INSERT INTO t1 VALUES (1);",
+			},
+			expected: map[string]interface{}{
+				schemaKey:         "test",
+				errorNoKey:        "1062",
+				killedKey:         "0",
+				queryTimeKey:      0.000216,
+				lockTimeKey:       0.000096,
+				rowsSentKey:       0,
+				rowsExaminedKey:   0,
+				rowsAffectedKey:   0,
+				bytesSentKey:      11,
+				tmpTablesKey:      0,
+				tmpDiskTablesKey:  0,
+				tmpTableSizesKey:  0,
+				transactionIDKey:  "1A2B",
+				queryCacheHitKey:  false,
+				fullScanKey:       false,
+				fullJoinKey:       false,
+				tmpTableKey:       false,
+				tmpTableOnDiskKey: false,
+				fileSortKey:       false,
+				fileSortOnDiskKey: false,
+				mergePassesKey:    0,
+				ioROpsKey:         1,
+				ioRBytesKey:       16384,
+				ioRWaitKey:        0.0001,
+				recLockWaitKey:    0.0,
+				queueWaitKey:      0.0,
+				pagesDistinctKey:  2,
+				slRateTypeKey:     "query",
+				slRateLimitKey:    "10",
+			},
+		},
+		{
+			flavour: "comment within the query",
+			lines: []string{
+				"# Time: 2019-05-09T09:22:28.234567Z",
+				"# User@Host: root[root] @ localhost []  Id:     8",
+				"# Query_time: 0.000216  Lock_time: 0.000096 Rows_sent: 1  Rows_examined: 1",
+				"SET timestamp=1557393748;",
+				"SELECT *",
+				"# Rows_sent: 99  Owner: someone",
+				"FROM t1;",
+			},
+			expected: map[string]interface{}{
+				queryTimeKey:    0.000216,
+				lockTimeKey:     0.000096,
+				rowsSentKey:     1,
+				rowsExaminedKey: 1,
+			},
+		},
+	}
+	for _, tt := range tsts {
+		res, _ := p.handleEvent(ptp, tt.lines)
+		for _, k := range []string{userKey, clientKey, connectionIdKey, queryKey, normalizedQueryKey,
+			fingerprintKey, checksumKey, statementKey, tablesKey} {
+			delete(res, k)
+		}
+		assert.Equal(t, tt.expected, res, tt.flavour)
+	}
+}
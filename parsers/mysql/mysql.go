@@ -15,6 +15,7 @@ import (
 	"github.com/honeycombio/mysqltools/query/normalizer"
 	"github.com/sirupsen/logrus"
 
+	"github.com/AIntelligenceGame/clicktail/parsers/fingerprint"
 	"github.com/honeycombio/honeytail/event"
 	"github.com/honeycombio/honeytail/httime"
 	"github.com/honeycombio/honeytail/parsers"
@@ -68,6 +69,8 @@ const (
 	databaseKey        = "database"
 	queryKey           = "query"
 	normalizedQueryKey = "normalized_query"
+	fingerprintKey     = "query_fingerprint"
+	checksumKey        = "query_checksum"
 	statementKey       = "statement"
 	tablesKey          = "tables"
 	commentsKey        = "comments"
@@ -144,6 +147,8 @@ type Options struct {
 	User          string `long:"user" description:"MySQL username"`
 	Pass          string `long:"pass" description:"MySQL password"`
 	QueryInterval uint   `long:"interval" description:"interval for querying the MySQL DB in seconds" default:"30"`
+	DigestPoll    bool   `long:"digest_poll" description:"Poll performance_schema.events_statements_summary_by_digest every interval and send the change since the last poll for each digest. Requires --mysql.host"`
+	HistoryPoll   bool   `long:"history_poll" description:"Poll performance_schema.events_statements_history_long every interval and send each statement not seen before. Requires --mysql.host"`
 
 	NumParsers int `hidden:"true" description:"number of MySQL parsers to spin up"`
 }
@@ -155,6 +160,7 @@ type Parser struct {
 
 	conf       Options
 	wg         sync.WaitGroup
+	db         *sql.DB
 	hostedOn   string
 	readOnly   *bool
 	replicaLag *int64
@@ -193,6 +199,7 @@ func (p *Parser) Init(options interface{}) error {
 			logrus.WithError(err).Warn("failed to get role")
 		}
 		p.role = role
+		p.db = db
 
 		// update hostedOn and readOnly every <n> seconds
 		go func() {
@@ -330,6 +337,8 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 	defer p.wg.Wait()
 	p.wg.Add(1)
 	go p.handleEvents(rawEvents, send)
+	stopPoller := p.startPoller(send)
+	defer stopPoller()
 
 	// flag to indicate when we've got a complete event to send
 	var foundStatement bool
@@ -395,18 +404,7 @@ func (p *Parser) handleEvents(rawEvents <-chan []string, send chan<- event.Event
 					// skip events with no query field
 					continue
 				}
-				if p.hostedOn != "" {
-					sq[hostedOnKey] = p.hostedOn
-				}
-				if p.readOnly != nil {
-					sq[readOnlyKey] = *p.readOnly
-				}
-				if p.replicaLag != nil {
-					sq[replicaLagKey] = *p.replicaLag
-				}
-				if p.role != nil {
-					sq[roleKey] = *p.role
-				}
+				p.addHostFields(sq)
 				send <- event.Event{
 					Timestamp:  timestamp,
 					SampleRate: p.SampleRate,
@@ -420,6 +418,22 @@ func (p *Parser) handleEvents(rawEvents <-chan []string, send chan<- event.Event
 	logrus.Debug("done with mysql handleEvents")
 }
 
+// addHostFields adds what we know about the server itself to an event
+func (p *Parser) addHostFields(sq map[string]interface{}) {
+	if p.hostedOn != "" {
+		sq[hostedOnKey] = p.hostedOn
+	}
+	if p.readOnly != nil {
+		sq[readOnlyKey] = *p.readOnly
+	}
+	if p.replicaLag != nil {
+		sq[replicaLagKey] = *p.replicaLag
+	}
+	if p.role != nil {
+		sq[roleKey] = *p.role
+	}
+}
+
 // Parse a set of MySQL log lines that seem to represent a single event and
 // return a struct of extracted data as well as the highest-resolution timestamp
 // available.
@@ -433,8 +447,19 @@ func (p *Parser) handleEvent(ptp *perThreadParser, rawE []string) (
 		timeFromComment time.Time
 		timeFromSet     int64
 		query           = ""
+		// every `Key: value` attribute, for what the named fields don't cover
+		attrs = map[string]interface{}{}
+		// whether the header lines are over; a `# Key: value` line after
+		// them is a comment within the query
+		inBody = false
 	)
 	for _, line := range rawE {
+		if !strings.HasPrefix(line, "#") && strings.TrimSpace(line) != "" {
+			inBody = true
+		}
+		if !inBody {
+			parseAttributes(line, attrs)
+		}
 		// parse each line and populate the map of attributes
 		if _, mg := reTime.FindStringSubmatchMap(line); mg != nil {
 			timeFromComment, _ = httime.Parse(timeFormat, mg["time"])
@@ -453,8 +478,9 @@ func (p *Parser) handleEvent(ptp *perThreadParser, rawE []string) (
 			sq[userKey] = strings.Split(mg["user"], "[")[0]
 			sq[clientKey] = strings.TrimSpace(mg["host"])
 
-			if connectionVal, ok := mg["connection"]; ok {
-				sq[connectionIdKey] = strings.TrimSpace(connectionVal)
+			// the Id is missing from older servers' logs
+			if connection := strings.TrimSpace(mg["connection"]); connection != "" {
+				sq[connectionIdKey] = connection
 			}
 		} else if _, mg := reSchemaError.FindStringSubmatchMap(line); mg != nil {
 			sq[schemaKey] = strings.TrimSpace(mg["schema"])
@@ -576,6 +602,19 @@ func (p *Parser) handleEvent(ptp *perThreadParser, rawE []string) (
 		}
 	}
 
+	for k, v := range attrs {
+		if _, ok := sq[k]; !ok {
+			sq[k] = v
+		}
+	}
+
+	// group queries the same way pt-query-digest does
+	if q, ok := sq[queryKey].(string); ok && q != "" {
+		fp := fingerprint.Fingerprint(q)
+		sq[fingerprintKey] = fp
+		sq[checksumKey] = fingerprint.Checksum(fp)
+	}
+
 	// We always need a timestamp.
 	//
 	// timeFromComment may include millisecond resolution but doesn't include
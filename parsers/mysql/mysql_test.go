@@ -78,8 +78,9 @@ func init() {
 				"# User@Host: someuser @ hostfoo [192.168.2.1]  Id:   666",
 			},
 			sq: map[string]interface{}{
-				userKey:   "someuser",
-				clientKey: "hostfoo [192.168.2.1]",
+				userKey:         "someuser",
+				clientKey:       "hostfoo [192.168.2.1]",
+				connectionIdKey: "666",
 			},
 			timestamp: tUnparseable,
 		},
@@ -89,8 +90,9 @@ func init() {
 				"# User@Host: root @ localhost []  Id:   233",
 			},
 			sq: map[string]interface{}{
-				userKey:   "root",
-				clientKey: "localhost []",
+				userKey:         "root",
+				clientKey:       "localhost []",
+				connectionIdKey: "233",
 			},
 			timestamp: tUnparseable,
 		},
@@ -100,8 +102,9 @@ func init() {
 				"# User@Host: root @ []  Id:   233",
 			},
 			sq: map[string]interface{}{
-				userKey:   "root",
-				clientKey: "[]",
+				userKey:         "root",
+				clientKey:       "[]",
+				connectionIdKey: "233",
 			},
 			timestamp: tUnparseable,
 		},
@@ -111,8 +114,9 @@ func init() {
 				"# User@Host: root[root] @  [10.0.1.76]  Id: 325920",
 			},
 			sq: map[string]interface{}{
-				userKey:   "root",
-				clientKey: "[10.0.1.76]",
+				userKey:         "root",
+				clientKey:       "[10.0.1.76]",
+				connectionIdKey: "325920",
 			},
 			timestamp: tUnparseable,
 		},
@@ -122,8 +126,9 @@ func init() {
 				"# User@Host: root[root] @ foobar [10.0.1.76]  Id: 325920",
 			},
 			sq: map[string]interface{}{
-				userKey:   "root",
-				clientKey: "foobar [10.0.1.76]",
+				userKey:         "root",
+				clientKey:       "foobar [10.0.1.76]",
+				connectionIdKey: "325920",
 			},
 			timestamp: tUnparseable,
 		},
@@ -142,6 +147,8 @@ func init() {
 				"show status like 'Uptime';",
 			},
 			sq: map[string]interface{}{
+				fingerprintKey:     "show status like ?",
+				checksumKey:        uint64(14660297287854568655),
 				queryKey:           "show status like 'Uptime'",
 				normalizedQueryKey: "show status like ?",
 				statementKey:       "",
@@ -156,6 +163,8 @@ func init() {
 				"SELECT * FROM (SELECT  T1.orderNumber,  STATUS,  SUM(quantityOrdered * priceEach) AS  total FROM orders WHERE total > 1000 AS T1 INNER JOIN orderdetails AS T2 ON T1.orderNumber = T2.orderNumber GROUP BY  orderNumber) T WHERE total > 100;",
 			},
 			sq: map[string]interface{}{
+				fingerprintKey:     "select * from (select t1.ordernumber, status, sum(quantityordered * priceeach) as total from orders where total > ? as t1 inner join orderdetails as t2 on t1.ordernumber = t2.ordernumber group by ordernumber) t where total > ?",
+				checksumKey:        uint64(14687086668527667529),
 				queryKey:           "SELECT * FROM (SELECT  T1.orderNumber,  STATUS,  SUM(quantityOrdered * priceEach) AS  total FROM orders WHERE total > 1000 AS T1 INNER JOIN orderdetails AS T2 ON T1.orderNumber = T2.orderNumber GROUP BY  orderNumber) T WHERE total > 100",
 				normalizedQueryKey: "select * from (select t1.ordernumber, status, sum(quantityordered * priceeach) as total from orders where total > ? as t1 inner join orderdetails as t2 on t1.ordernumber = t2.ordernumber group by ordernumber) t where total > ?",
 				statementKey:       "",
@@ -169,6 +178,8 @@ func init() {
 				"SELECT * FROM orders WHERE total > 1000;",
 			},
 			sq: map[string]interface{}{
+				fingerprintKey:     "select * from orders where total > ?",
+				checksumKey:        uint64(10244309009173492684),
 				queryKey:           "SELECT * FROM orders WHERE total > 1000",
 				normalizedQueryKey: "select * from orders where total > ?",
 				tablesKey:          "orders",
@@ -186,6 +197,8 @@ func init() {
 				"total > 1000;",
 			},
 			sq: map[string]interface{}{
+				fingerprintKey:     "select * from orders where total > ?",
+				checksumKey:        uint64(10244309009173492684),
 				queryKey:           "SELECT * FROM orders WHERE total > 1000",
 				normalizedQueryKey: "select * from orders where total > ?",
 				tablesKey:          "orders",
@@ -200,6 +213,8 @@ func init() {
 				"use someDB;",
 			},
 			sq: map[string]interface{}{
+				fingerprintKey:     "use ?",
+				checksumKey:        uint64(7784923904378304051),
 				databaseKey:        "someDB",
 				queryKey:           "use someDB",
 				normalizedQueryKey: "use someDB",
@@ -217,6 +232,8 @@ func init() {
 				"total > 1000;",
 			},
 			sq: map[string]interface{}{
+				fingerprintKey:     "select * from orders where total > ?",
+				checksumKey:        uint64(10244309009173492684),
 				databaseKey:        "someDB",
 				queryKey:           "SELECT * FROM orders WHERE total > 1000",
 				normalizedQueryKey: "select * from orders where total > ?",
@@ -238,6 +255,8 @@ func init() {
 				"total > 1000;",
 			},
 			sq: map[string]interface{}{
+				fingerprintKey:     "select * from orders where total > ?",
+				checksumKey:        uint64(10244309009173492684),
 				databaseKey:        "someDB",
 				queryKey:           "SELECT * FROM orders WHERE total > 1000",
 				normalizedQueryKey: "select * from orders where total > ?",
@@ -256,6 +275,8 @@ func init() {
 				"SELECT * FROM orders WHERE total > 1000;",
 			},
 			sq: map[string]interface{}{
+				fingerprintKey:     "select * from orders where total > ?",
+				checksumKey:        uint64(10244309009173492684),
 				queryKey:           "SELECT * FROM orders WHERE total > 1000",
 				normalizedQueryKey: "select * from orders where total > ?",
 				tablesKey:          "orders",
@@ -272,6 +293,8 @@ func init() {
 				"SELECT * FROM orders WHERE total > 1000;",
 			},
 			sq: map[string]interface{}{
+				fingerprintKey:     "select * from orders where total > ?",
+				checksumKey:        uint64(10244309009173492684),
 				queryTimeKey:       0.008393,
 				lockTimeKey:        0.000154,
 				rowsSentKey:        1,
@@ -292,8 +315,11 @@ func init() {
 				"SELECT * FROM orders WHERE total > 1000;",
 			},
 			sq: map[string]interface{}{
+				fingerprintKey:     "select * from orders where total > ?",
+				checksumKey:        uint64(10244309009173492684),
 				userKey:            "someuser",
 				clientKey:          "hostfoo [192.168.2.1]",
+				connectionIdKey:    "666",
 				queryKey:           "SELECT * FROM orders WHERE total > 1000",
 				normalizedQueryKey: "select * from orders where total > ?",
 				tablesKey:          "orders",
@@ -309,8 +335,11 @@ func init() {
 				"SELECT /* from mysql.go:245 */ /* another comment */ * FROM orders WHERE total > 1000;",
 			},
 			sq: map[string]interface{}{
+				fingerprintKey:     "select * from orders where total > ?",
+				checksumKey:        uint64(10244309009173492684),
 				userKey:            "someuser",
 				clientKey:          "hostfoo [192.168.2.1]",
+				connectionIdKey:    "666",
 				queryKey:           "SELECT /* from mysql.go:245 */ /* another comment */ * FROM orders WHERE total > 1000",
 				normalizedQueryKey: "select * from orders where total > ?",
 				tablesKey:          "orders",
@@ -349,8 +378,14 @@ func init() {
 				"/* [vreegU1vU6FPXHBnW6OU_DalWUR8] [our_index_A] [/dynamic_sitemaps.php] */ SELECT * FROM `cats_index` as `Cat_Cat` WHERE `Cat_Cat`.`cat_id` BETWEEN 9670064 AND 9680063 ORDER BY `Cat_Cat`.`cat_id`;",
 			},
 			sq: map[string]interface{}{
+				fingerprintKey:     "select * from `cats_index` as `cat_cat` where `cat_cat`.`cat_id` between ? and ? order by `cat_cat`.`cat_id`",
+				checksumKey:        uint64(15821275445554367503),
 				userKey:            "rw",
 				clientKey:          "[10.96.81.110]",
+				connectionIdKey:    "1394495950",
+				schemaKey:          "our_index",
+				errorNoKey:         "0",
+				killedKey:          "0",
 				queryTimeKey:       1.294391,
 				lockTimeKey:        0.000119,
 				rowsSentKey:        4049,
@@ -399,8 +434,14 @@ func init() {
 				"/* [vreegU1vU6FPXHBnW6OU_DalWUR8] [our_index_A] [/dynamic_sitemaps.php] */ SELECT * FROM `cats_index` as `Cat_Cat` WHERE `Cat_Cat`.`cat_id` BETWEEN 9670064 AND 9680063 ORDER BY `Cat_Cat`.`cat_id`;",
 			},
 			sq: map[string]interface{}{
+				fingerprintKey:     "select * from `cats_index` as `cat_cat` where `cat_cat`.`cat_id` between ? and ? order by `cat_cat`.`cat_id`",
+				checksumKey:        uint64(15821275445554367503),
 				userKey:            "rw",
 				clientKey:          "[10.96.81.110]",
+				connectionIdKey:    "1394495950",
+				schemaKey:          "our_index",
+				errorNoKey:         "0",
+				killedKey:          "0",
 				queryTimeKey:       1.294391,
 				lockTimeKey:        0.000119,
 				rowsSentKey:        4049,
@@ -444,6 +485,8 @@ func init() {
 				"SELECT COUNT(*) FROM foo;",
 			},
 			sq: map[string]interface{}{
+				fingerprintKey:     "select count(*) from foo",
+				checksumKey:        uint64(18340103145670804862),
 				userKey:            "weaverw",
 				clientKey:          "[10.14.214.13]",
 				queryTimeKey:       10.749944,
@@ -461,6 +504,11 @@ func init() {
 				tmpDiskTablesKey:   0,
 				tmpTableSizesKey:   0,
 				transactionIDKey:   "98CF",
+				schemaKey:          "weave3",
+				errorNoKey:         "0",
+				killedKey:          "0",
+				"thread_id":        78959,
+				"rows_read":        12,
 			},
 			timestamp: time.Unix(1364506803, 0),
 		},
@@ -475,8 +523,11 @@ func init() {
 				"Time                 Id Command    Argument",
 			},
 			sq: map[string]interface{}{
+				fingerprintKey:     "select @@session.tx_read_only",
+				checksumKey:        uint64(1795810991308025280),
 				userKey:            "rdsadmin",
 				clientKey:          "localhost [127.0.0.1]",
+				connectionIdKey:    "1",
 				queryTimeKey:       0.000439,
 				lockTimeKey:        0.0,
 				rowsSentKey:        1,
@@ -496,8 +547,11 @@ func init() {
 				"SELECT * FROM users WHERE id='#';",
 			},
 			sq: map[string]interface{}{
+				fingerprintKey:     "select * from users where id=?",
+				checksumKey:        uint64(14968649402277377803),
 				userKey:            "rdsadmin",
 				clientKey:          "localhost [127.0.0.1]",
+				connectionIdKey:    "1",
 				queryTimeKey:       0.000439,
 				lockTimeKey:        0.0,
 				rowsSentKey:        1,
@@ -517,8 +571,11 @@ func init() {
 				"SELECT 1 /* this is a comment with a # in it */;",
 			},
 			sq: map[string]interface{}{
+				fingerprintKey:     "select ? ",
+				checksumKey:        uint64(6158143257572953658),
 				userKey:            "rdsadmin",
 				clientKey:          "localhost [127.0.0.1]",
+				connectionIdKey:    "1",
 				queryTimeKey:       0.000439,
 				lockTimeKey:        0.0,
 				rowsSentKey:        1,
@@ -562,6 +619,8 @@ func init() {
 				"total > 1000;",
 			},
 			sq: map[string]interface{}{
+				fingerprintKey:     "select * from orders where total > ?",
+				checksumKey:        uint64(10244309009173492684),
 				queryKey:           "SELECT * FROM orders WHERE total > 1000",
 				normalizedQueryKey: "select * from orders where total > ?",
 				tablesKey:          "orders",
@@ -581,7 +640,9 @@ func init() {
 				"",
 			},
 			sq: map[string]interface{}{
-				queryKey: "SELECT *	     	FROM orders WHERE    	total > 1000",
+				fingerprintKey:     "select * from orders where total > ?",
+				checksumKey:        uint64(10244309009173492684),
+				queryKey:           "SELECT *	     	FROM orders WHERE    	total > 1000",
 				normalizedQueryKey: "select * from orders where total > ?",
 				tablesKey:          "orders",
 				statementKey:       "select",
@@ -679,31 +740,37 @@ func TestProcessLines(t *testing.T) {
 				{
 					Timestamp: ts1,
 					Data: map[string]interface{}{
-						"client":           "hostfoo [192.168.2.1]",
-						"user":             "someuser",
-						"query_time":       0.000073,
-						"lock_time":        0.0,
-						"rows_sent":        0,
-						"rows_examined":    0,
-						"query":            "SELECT * FROM orders WHERE total > 1000",
-						"normalized_query": "select * from orders where total > ?",
-						"tables":           "orders",
-						"statement":        "select",
+						"client":            "hostfoo [192.168.2.1]",
+						"user":              "someuser",
+						"connection_id":     "666",
+						"query_time":        0.000073,
+						"lock_time":         0.0,
+						"rows_sent":         0,
+						"rows_examined":     0,
+						"query":             "SELECT * FROM orders WHERE total > 1000",
+						"normalized_query":  "select * from orders where total > ?",
+						"query_fingerprint": "select * from orders where total > ?",
+						"query_checksum":    uint64(10244309009173492684),
+						"tables":            "orders",
+						"statement":         "select",
 					},
 				},
 				{
 					Timestamp: ts1,
 					Data: map[string]interface{}{
-						"client":           "hostbar [192.168.2.1]",
-						"user":             "otheruser",
-						"query_time":       0.00457,
-						"lock_time":        0.1,
-						"rows_sent":        5,
-						"rows_examined":    35,
-						"query":            "SELECT * FROM customers",
-						"normalized_query": "select * from customers",
-						"tables":           "customers",
-						"statement":        "select",
+						"client":            "hostbar [192.168.2.1]",
+						"user":              "otheruser",
+						"connection_id":     "666",
+						"query_time":        0.00457,
+						"lock_time":         0.1,
+						"rows_sent":         5,
+						"rows_examined":     35,
+						"query":             "SELECT * FROM customers",
+						"normalized_query":  "select * from customers",
+						"query_fingerprint": "select * from customers",
+						"query_checksum":    uint64(13982548633110769662),
+						"tables":            "customers",
+						"statement":         "select",
 					},
 				},
 			},
@@ -724,31 +791,35 @@ func TestProcessLines(t *testing.T) {
 				{
 					Timestamp: time.Unix(1444264264, 0),
 					Data: map[string]interface{}{
-						"client":           "[10.252.9.33]",
-						"user":             "rails",
-						"query_time":       0.030974,
-						"lock_time":        0.000019,
-						"rows_sent":        0,
-						"rows_examined":    30259,
-						"query":            "SELECT `metadata`.* FROM `metadata` WHERE (`metadata`.app_id = 993089)",
-						"normalized_query": "select `metadata`.* from `metadata` where (`metadata`.app_id = ?)",
-						"tables":           "metadata",
-						"statement":        "select",
+						"client":            "[10.252.9.33]",
+						"user":              "rails",
+						"query_time":        0.030974,
+						"lock_time":         0.000019,
+						"rows_sent":         0,
+						"rows_examined":     30259,
+						"query":             "SELECT `metadata`.* FROM `metadata` WHERE (`metadata`.app_id = 993089)",
+						"normalized_query":  "select `metadata`.* from `metadata` where (`metadata`.app_id = ?)",
+						"query_fingerprint": "select `metadata`.* from `metadata` where (`metadata`.app_id = ?)",
+						"query_checksum":    uint64(12979890161871016102),
+						"tables":            "metadata",
+						"statement":         "select",
 					},
 				},
 				{
 					Timestamp: time.Unix(1444264264, 0), // should pick up the SET timestamp=... cmd
 					Data: map[string]interface{}{
-						"client":           "[10.252.9.33]",
-						"user":             "rails",
-						"query_time":       0.002280,
-						"lock_time":        0.000023,
-						"rows_sent":        0,
-						"rows_examined":    921,
-						"query":            "SELECT `certs`.* FROM `certs` WHERE (`certs`.app_id = 993089) LIMIT 1",
-						"normalized_query": "select `certs`.* from `certs` where (`certs`.app_id = ?) limit ?",
-						"tables":           "certs",
-						"statement":        "select",
+						"client":            "[10.252.9.33]",
+						"user":              "rails",
+						"query_time":        0.002280,
+						"lock_time":         0.000023,
+						"rows_sent":         0,
+						"rows_examined":     921,
+						"query":             "SELECT `certs`.* FROM `certs` WHERE (`certs`.app_id = 993089) LIMIT 1",
+						"normalized_query":  "select `certs`.* from `certs` where (`certs`.app_id = ?) limit ?",
+						"query_fingerprint": "select `certs`.* from `certs` where (`certs`.app_id = ?) limit ?",
+						"query_checksum":    uint64(10926921511634122117),
+						"tables":            "certs",
+						"statement":         "select",
 					},
 				},
 			},
@@ -775,31 +846,35 @@ func TestProcessLines(t *testing.T) {
 				{
 					Timestamp: time.Unix(1444264264, 0), // should pick up the SET timestamp=... cmd
 					Data: map[string]interface{}{
-						"client":           "[10.252.9.33]",
-						"user":             "rails",
-						"query_time":       0.002280,
-						"lock_time":        0.000023,
-						"rows_sent":        0,
-						"rows_examined":    921,
-						"query":            "SELECT `certs`.* FROM `certs` WHERE (`certs`.app_id = 993089) LIMIT 1",
-						"normalized_query": "select `certs`.* from `certs` where (`certs`.app_id = ?) limit ?",
-						"tables":           "certs",
-						"statement":        "select",
+						"client":            "[10.252.9.33]",
+						"user":              "rails",
+						"query_time":        0.002280,
+						"lock_time":         0.000023,
+						"rows_sent":         0,
+						"rows_examined":     921,
+						"query":             "SELECT `certs`.* FROM `certs` WHERE (`certs`.app_id = 993089) LIMIT 1",
+						"normalized_query":  "select `certs`.* from `certs` where (`certs`.app_id = ?) limit ?",
+						"query_fingerprint": "select `certs`.* from `certs` where (`certs`.app_id = ?) limit ?",
+						"query_checksum":    uint64(10926921511634122117),
+						"tables":            "certs",
+						"statement":         "select",
 					},
 				},
 				{
 					Timestamp: time.Unix(1444264264, 0), // should pick up the SET timestamp=... cmd
 					Data: map[string]interface{}{
-						"client":           "[10.252.9.33]",
-						"user":             "rails",
-						"query_time":       0.002280,
-						"lock_time":        0.000023,
-						"rows_sent":        0,
-						"rows_examined":    921,
-						"query":            "SELECT `certs`.* FROM `certs` WHERE (`certs`.app_id = 993089) LIMIT 1",
-						"normalized_query": "select `certs`.* from `certs` where (`certs`.app_id = ?) limit ?",
-						"tables":           "certs",
-						"statement":        "select",
+						"client":            "[10.252.9.33]",
+						"user":              "rails",
+						"query_time":        0.002280,
+						"lock_time":         0.000023,
+						"rows_sent":         0,
+						"rows_examined":     921,
+						"query":             "SELECT `certs`.* FROM `certs` WHERE (`certs`.app_id = 993089) LIMIT 1",
+						"normalized_query":  "select `certs`.* from `certs` where (`certs`.app_id = ?) limit ?",
+						"query_fingerprint": "select `certs`.* from `certs` where (`certs`.app_id = ?) limit ?",
+						"query_checksum":    uint64(10926921511634122117),
+						"tables":            "certs",
+						"statement":         "select",
 					},
 				},
 			},
@@ -823,16 +898,18 @@ func TestProcessLines(t *testing.T) {
 				{
 					Timestamp: time.Unix(1444264264, 0), // should pick up the SET timestamp=... cmd
 					Data: map[string]interface{}{
-						"client":           "[10.252.9.33]",
-						"user":             "rails",
-						"query_time":       0.002280,
-						"lock_time":        0.000023,
-						"rows_sent":        0,
-						"rows_examined":    921,
-						"query":            "SELECT `certs`.* FROM `certs` WHERE (`certs`.app_id = 993089) LIMIT 1",
-						"normalized_query": "select `certs`.* from `certs` where (`certs`.app_id = ?) limit ?",
-						"tables":           "certs",
-						"statement":        "select",
+						"client":            "[10.252.9.33]",
+						"user":              "rails",
+						"query_time":        0.002280,
+						"lock_time":         0.000023,
+						"rows_sent":         0,
+						"rows_examined":     921,
+						"query":             "SELECT `certs`.* FROM `certs` WHERE (`certs`.app_id = 993089) LIMIT 1",
+						"normalized_query":  "select `certs`.* from `certs` where (`certs`.app_id = ?) limit ?",
+						"query_fingerprint": "select `certs`.* from `certs` where (`certs`.app_id = ?) limit ?",
+						"query_checksum":    uint64(10926921511634122117),
+						"tables":            "certs",
+						"statement":         "select",
 					},
 				},
 				{}, // to match already closed channel
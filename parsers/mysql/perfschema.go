@@ -0,0 +1,323 @@
+package mysql
+
+import (
+	"database/sql"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/httime"
+	"github.com/honeycombio/mysqltools/query/normalizer"
+	"github.com/sirupsen/logrus"
+
+	"github.com/AIntelligenceGame/clicktail/parsers/fingerprint"
+)
+
+const (
+	digestQuery = `SELECT SCHEMA_NAME, DIGEST, DIGEST_TEXT, COUNT_STAR,
+	SUM_TIMER_WAIT, SUM_LOCK_TIME, SUM_ERRORS, SUM_WARNINGS,
+	SUM_ROWS_AFFECTED, SUM_ROWS_SENT, SUM_ROWS_EXAMINED,
+	SUM_CREATED_TMP_DISK_TABLES, SUM_CREATED_TMP_TABLES,
+	SUM_SELECT_FULL_JOIN, SUM_SELECT_SCAN, SUM_SORT_MERGE_PASSES, SUM_NO_INDEX_USED
+FROM performance_schema.events_statements_summary_by_digest`
+
+	historyQuery = `SELECT THREAD_ID, EVENT_ID, CURRENT_SCHEMA, DIGEST, SQL_TEXT,
+	TIMER_WAIT, LOCK_TIME, ROWS_AFFECTED, ROWS_SENT, ROWS_EXAMINED,
+	CREATED_TMP_DISK_TABLES, CREATED_TMP_TABLES, SELECT_FULL_JOIN, SORT_MERGE_PASSES,
+	MYSQL_ERRNO
+FROM performance_schema.events_statements_history_long
+WHERE END_EVENT_ID IS NOT NULL`
+
+	// performance_schema timers are in picoseconds
+	picosPerSecond = 1e12
+
+	sourceKey       = "source"
+	digestKey       = "digest"
+	execCountKey    = "exec_count"
+	errorCountKey   = "error_count"
+	warningCountKey = "warning_count"
+	selectScanKey   = "select_scan"
+	noIndexUsedKey  = "no_index_used"
+	threadIDKey     = "thread_id"
+
+	digestSource  = "events_statements_summary_by_digest"
+	historySource = "events_statements_history_long"
+)
+
+// only one parser polls performance_schema, no matter how many are running
+var pollerStarted int32
+
+// digestKeyT identifies a row in events_statements_summary_by_digest
+type digestKeyT struct {
+	schema string
+	digest string
+}
+
+// digestCounters are the cumulative counters of a digest row
+type digestCounters struct {
+	count, timerWait, lockTime, errors, warnings                   uint64
+	rowsAffected, rowsSent, rowsExamined, tmpDiskTables, tmpTables uint64
+	selectFullJoin, selectScan, sortMergePasses, noIndexUsed       uint64
+}
+
+// sub returns the change from prev. Counters that went backwards mean the
+// table was truncated, in which case everything since is the change.
+func (c digestCounters) sub(prev digestCounters) digestCounters {
+	if c.count < prev.count || c.timerWait < prev.timerWait {
+		return c
+	}
+	return digestCounters{
+		count:           c.count - prev.count,
+		timerWait:       c.timerWait - prev.timerWait,
+		lockTime:        c.lockTime - prev.lockTime,
+		errors:          c.errors - prev.errors,
+		warnings:        c.warnings - prev.warnings,
+		rowsAffected:    c.rowsAffected - prev.rowsAffected,
+		rowsSent:        c.rowsSent - prev.rowsSent,
+		rowsExamined:    c.rowsExamined - prev.rowsExamined,
+		tmpDiskTables:   c.tmpDiskTables - prev.tmpDiskTables,
+		tmpTables:       c.tmpTables - prev.tmpTables,
+		selectFullJoin:  c.selectFullJoin - prev.selectFullJoin,
+		selectScan:      c.selectScan - prev.selectScan,
+		sortMergePasses: c.sortMergePasses - prev.sortMergePasses,
+		noIndexUsed:     c.noIndexUsed - prev.noIndexUsed,
+	}
+}
+
+// perfSchemaPoller turns performance_schema statement statistics into events.
+// The first poll only records where things stand; every later poll sends the
+// change in each digest's counters and the statements run in between.
+type perfSchemaPoller struct {
+	db         *sql.DB
+	digests    bool
+	history    bool
+	normalizer *normalizer.Parser
+
+	lastDigests map[digestKeyT]digestCounters
+	// the highest EVENT_ID seen per THREAD_ID
+	lastEvents map[uint64]uint64
+}
+
+func newPerfSchemaPoller(db *sql.DB, digests, history bool) *perfSchemaPoller {
+	return &perfSchemaPoller{
+		db:         db,
+		digests:    digests,
+		history:    history,
+		normalizer: &normalizer.Parser{},
+	}
+}
+
+// run polls every interval until done is closed
+func (pp *perfSchemaPoller) run(interval time.Duration, done <-chan struct{}, send func(map[string]interface{}, time.Time)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		pp.poll(send)
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+func (pp *perfSchemaPoller) poll(send func(map[string]interface{}, time.Time)) {
+	now := httime.Now()
+	if pp.digests {
+		events, err := pp.pollDigests()
+		if err != nil {
+			logrus.WithError(err).Warn("failed to read events_statements_summary_by_digest")
+		}
+		for _, ev := range events {
+			send(ev, now)
+		}
+	}
+	if pp.history {
+		events, err := pp.pollHistory()
+		if err != nil {
+			logrus.WithError(err).Warn("failed to read events_statements_history_long")
+		}
+		for _, ev := range events {
+			send(ev, now)
+		}
+	}
+}
+
+func (pp *perfSchemaPoller) pollDigests() ([]map[string]interface{}, error) {
+	rows, err := pp.db.Query(digestQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	first := pp.lastDigests == nil
+	current := map[digestKeyT]digestCounters{}
+	var events []map[string]interface{}
+	for rows.Next() {
+		var schema, digest, digestText sql.NullString
+		var c digestCounters
+		if err := rows.Scan(&schema, &digest, &digestText, &c.count,
+			&c.timerWait, &c.lockTime, &c.errors, &c.warnings,
+			&c.rowsAffected, &c.rowsSent, &c.rowsExamined,
+			&c.tmpDiskTables, &c.tmpTables,
+			&c.selectFullJoin, &c.selectScan, &c.sortMergePasses, &c.noIndexUsed); err != nil {
+			return nil, err
+		}
+		key := digestKeyT{schema: schema.String, digest: digest.String}
+		current[key] = c
+		if first {
+			continue
+		}
+		delta := c.sub(pp.lastDigests[key])
+		if delta.count == 0 {
+			continue
+		}
+		sq := digestFields(digestText.String)
+		sq[sourceKey] = digestSource
+		sq[schemaKey] = schema.String
+		sq[digestKey] = digest.String
+		sq[execCountKey] = delta.count
+		sq[queryTimeKey] = float64(delta.timerWait) / picosPerSecond
+		sq[lockTimeKey] = float64(delta.lockTime) / picosPerSecond
+		sq[errorCountKey] = delta.errors
+		sq[warningCountKey] = delta.warnings
+		sq[rowsAffectedKey] = delta.rowsAffected
+		sq[rowsSentKey] = delta.rowsSent
+		sq[rowsExaminedKey] = delta.rowsExamined
+		sq[tmpDiskTablesKey] = delta.tmpDiskTables
+		sq[tmpTablesKey] = delta.tmpTables
+		sq[fullJoinKey] = delta.selectFullJoin
+		sq[selectScanKey] = delta.selectScan
+		sq[mergePassesKey] = delta.sortMergePasses
+		sq[noIndexUsedKey] = delta.noIndexUsed
+		events = append(events, sq)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	pp.lastDigests = current
+	return events, nil
+}
+
+func (pp *perfSchemaPoller) pollHistory() ([]map[string]interface{}, error) {
+	rows, err := pp.db.Query(historyQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	first := pp.lastEvents == nil
+	if first {
+		pp.lastEvents = map[uint64]uint64{}
+	}
+	seen := map[uint64]uint64{}
+	var events []map[string]interface{}
+	for rows.Next() {
+		var threadID, eventID uint64
+		var schema, digest, sqlText sql.NullString
+		var timerWait, lockTime, rowsAffected, rowsSent, rowsExamined uint64
+		var tmpDiskTables, tmpTables, selectFullJoin, sortMergePasses uint64
+		var errno sql.NullInt64
+		if err := rows.Scan(&threadID, &eventID, &schema, &digest, &sqlText,
+			&timerWait, &lockTime, &rowsAffected, &rowsSent, &rowsExamined,
+			&tmpDiskTables, &tmpTables, &selectFullJoin, &sortMergePasses,
+			&errno); err != nil {
+			return nil, err
+		}
+		if eventID > seen[threadID] {
+			seen[threadID] = eventID
+		}
+		if first || eventID <= pp.lastEvents[threadID] || !sqlText.Valid {
+			continue
+		}
+		sq := pp.queryFields(sqlText.String)
+		sq[sourceKey] = historySource
+		sq[threadIDKey] = threadID
+		sq[schemaKey] = schema.String
+		sq[digestKey] = digest.String
+		sq[queryTimeKey] = float64(timerWait) / picosPerSecond
+		sq[lockTimeKey] = float64(lockTime) / picosPerSecond
+		sq[rowsAffectedKey] = rowsAffected
+		sq[rowsSentKey] = rowsSent
+		sq[rowsExaminedKey] = rowsExamined
+		sq[tmpDiskTablesKey] = tmpDiskTables
+		sq[tmpTablesKey] = tmpTables
+		sq[fullJoinKey] = selectFullJoin
+		sq[mergePassesKey] = sortMergePasses
+		if errno.Valid {
+			sq[errorNoKey] = errno.Int64
+		}
+		events = append(events, sq)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// threads that have ended drop out of the table, and so out of lastEvents
+	pp.lastEvents = seen
+	return events, nil
+}
+
+// digestFields fills in the query derived fields for a DIGEST_TEXT. It's
+// already normalized, with ? in place of literals, which the normalizer can't
+// parse.
+func digestFields(digestText string) map[string]interface{} {
+	sq := map[string]interface{}{}
+	if digestText == "" {
+		return sq
+	}
+	sq[queryKey] = digestText
+	sq[normalizedQueryKey] = digestText
+	fp := fingerprint.Fingerprint(digestText)
+	sq[fingerprintKey] = fp
+	sq[checksumKey] = fingerprint.Checksum(fp)
+	return sq
+}
+
+// queryFields fills in the query derived fields the slow log parser sends
+func (pp *perfSchemaPoller) queryFields(query string) map[string]interface{} {
+	sq := map[string]interface{}{}
+	if query == "" {
+		return sq
+	}
+	sq[queryKey] = query
+	sq[normalizedQueryKey] = pp.normalizer.NormalizeQuery(query)
+	if len(pp.normalizer.LastTables) > 0 {
+		sq[tablesKey] = strings.Join(pp.normalizer.LastTables, " ")
+	}
+	sq[statementKey] = pp.normalizer.LastStatement
+	fp := fingerprint.Fingerprint(query)
+	sq[fingerprintKey] = fp
+	sq[checksumKey] = fingerprint.Checksum(fp)
+	return sq
+}
+
+// startPoller starts polling performance_schema, if enabled, and returns a
+// function that stops it. Only the first parser to call it polls.
+func (p *Parser) startPoller(send chan<- event.Event) func() {
+	if p.db == nil || !(p.conf.DigestPoll || p.conf.HistoryPoll) {
+		return func() {}
+	}
+	if !atomic.CompareAndSwapInt32(&pollerStarted, 0, 1) {
+		return func() {}
+	}
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	poller := newPerfSchemaPoller(p.db, p.conf.DigestPoll, p.conf.HistoryPoll)
+	go func() {
+		defer close(finished)
+		poller.run(time.Second*time.Duration(p.conf.QueryInterval), done,
+			func(sq map[string]interface{}, timestamp time.Time) {
+				p.addHostFields(sq)
+				send <- event.Event{
+					Timestamp: timestamp,
+					Data:      sq,
+				}
+			})
+	}()
+	return func() {
+		close(done)
+		<-finished
+		atomic.StoreInt32(&pollerStarted, 0)
+	}
+}
@@ -0,0 +1,217 @@
+package mysql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePerfSchema stands in for a MySQL server, answering the
+// performance_schema queries with whatever rows the test set last.
+type fakePerfSchema struct {
+	sync.Mutex
+	digests [][]driver.Value
+	history [][]driver.Value
+}
+
+var fakeDB = &fakePerfSchema{}
+
+func init() {
+	sql.Register("fakeperfschema", fakeDB)
+}
+
+func (f *fakePerfSchema) set(digests, history [][]driver.Value) {
+	f.Lock()
+	defer f.Unlock()
+	f.digests = digests
+	f.history = history
+}
+
+func (f *fakePerfSchema) Open(name string) (driver.Conn, error) { return f, nil }
+func (f *fakePerfSchema) Close() error                          { return nil }
+func (f *fakePerfSchema) Begin() (driver.Tx, error)             { return nil, driver.ErrSkip }
+func (f *fakePerfSchema) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{f: f, query: query}, nil
+}
+
+type fakeStmt struct {
+	f     *fakePerfSchema
+	query string
+}
+
+func (s *fakeStmt) Close() error                                    { return nil }
+func (s *fakeStmt) NumInput() int                                   { return 0 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) { return nil, driver.ErrSkip }
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.f.Lock()
+	defer s.f.Unlock()
+	if strings.Contains(s.query, digestSource) {
+		return &fakeRows{rows: s.f.digests, cols: 17}, nil
+	}
+	return &fakeRows{rows: s.f.history, cols: 15}, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+	cols int
+}
+
+func (r *fakeRows) Columns() []string { return make([]string, r.cols) }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func digestRow(schema, digest, text string, count, timerWait, rowsExamined int64) []driver.Value {
+	return []driver.Value{schema, digest, text, count,
+		timerWait, int64(0), int64(0), int64(0),
+		int64(0), count, rowsExamined,
+		int64(0), int64(0),
+		int64(0), count, int64(0), int64(0)}
+}
+
+func historyRow(threadID, eventID int64, text string, timerWait int64) []driver.Value {
+	return []driver.Value{threadID, eventID, "test", "abc", text,
+		timerWait, int64(0), int64(0), int64(1), int64(1),
+		int64(0), int64(0), int64(0), int64(0),
+		int64(0)}
+}
+
+func TestPollDigests(t *testing.T) {
+	db, err := sql.Open("fakeperfschema", "")
+	assert.Nil(t, err)
+	pp := newPerfSchemaPoller(db, true, false)
+
+	// the first poll is the baseline and sends nothing
+	fakeDB.set([][]driver.Value{
+		digestRow("test", "abc", "SELECT * FROM `foo` WHERE `id` = ?", 10, 5e12, 100),
+		digestRow("test", "def", "SELECT `a` FROM `bar`", 3, 1e12, 3),
+	}, nil)
+	events, err := pp.pollDigests()
+	assert.Nil(t, err)
+	assert.Len(t, events, 0)
+
+	// only digests whose count changed are sent, as deltas; new digests are
+	// sent in full
+	fakeDB.set([][]driver.Value{
+		digestRow("test", "abc", "SELECT * FROM `foo` WHERE `id` = ?", 14, 7e12, 140),
+		digestRow("test", "def", "SELECT `a` FROM `bar`", 3, 1e12, 3),
+		digestRow("other", "ghi", "DELETE FROM `baz`", 1, 2e11, 7),
+	}, nil)
+	events, err = pp.pollDigests()
+	assert.Nil(t, err)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, map[string]interface{}{
+			sourceKey:          digestSource,
+			schemaKey:          "test",
+			digestKey:          "abc",
+			queryKey:           "SELECT * FROM `foo` WHERE `id` = ?",
+			normalizedQueryKey: "SELECT * FROM `foo` WHERE `id` = ?",
+			fingerprintKey:     "select * from `foo` where `id` = ?",
+			checksumKey:        events[0][checksumKey],
+			execCountKey:       uint64(4),
+			queryTimeKey:       2.0,
+			lockTimeKey:        0.0,
+			errorCountKey:      uint64(0),
+			warningCountKey:    uint64(0),
+			rowsAffectedKey:    uint64(0),
+			rowsSentKey:        uint64(4),
+			rowsExaminedKey:    uint64(40),
+			tmpDiskTablesKey:   uint64(0),
+			tmpTablesKey:       uint64(0),
+			fullJoinKey:        uint64(0),
+			selectScanKey:      uint64(4),
+			mergePassesKey:     uint64(0),
+			noIndexUsedKey:     uint64(0),
+		}, events[0])
+		assert.Equal(t, "ghi", events[1][digestKey])
+		assert.Equal(t, uint64(1), events[1][execCountKey])
+		assert.Equal(t, 0.2, events[1][queryTimeKey])
+	}
+
+	// counters going backwards means the table was truncated
+	fakeDB.set([][]driver.Value{
+		digestRow("test", "abc", "SELECT * FROM `foo` WHERE `id` = ?", 2, 1e12, 20),
+	}, nil)
+	events, err = pp.pollDigests()
+	assert.Nil(t, err)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, uint64(2), events[0][execCountKey])
+		assert.Equal(t, 1.0, events[0][queryTimeKey])
+	}
+}
+
+func TestPollHistory(t *testing.T) {
+	db, err := sql.Open("fakeperfschema", "")
+	assert.Nil(t, err)
+	pp := newPerfSchemaPoller(db, false, true)
+
+	fakeDB.set(nil, [][]driver.Value{
+		historyRow(1, 10, "SELECT 1", 1e9),
+		historyRow(2, 5, "SELECT 2", 1e9),
+	})
+	events, err := pp.pollHistory()
+	assert.Nil(t, err)
+	assert.Len(t, events, 0)
+
+	// statements already seen are skipped
+	fakeDB.set(nil, [][]driver.Value{
+		historyRow(1, 10, "SELECT 1", 1e9),
+		historyRow(1, 11, "SELECT 3", 3e9),
+		historyRow(2, 5, "SELECT 2", 1e9),
+		historyRow(3, 1, "SELECT 4", 4e9),
+	})
+	events, err = pp.pollHistory()
+	assert.Nil(t, err)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, "SELECT 3", events[0][queryKey])
+		assert.Equal(t, uint64(1), events[0][threadIDKey])
+		assert.Equal(t, 0.003, events[0][queryTimeKey])
+		assert.Equal(t, historySource, events[0][sourceKey])
+		assert.Equal(t, int64(0), events[0][errorNoKey])
+		assert.Equal(t, "SELECT 4", events[1][queryKey])
+		assert.Equal(t, uint64(3), events[1][threadIDKey])
+	}
+}
+
+func TestPollerRun(t *testing.T) {
+	db, err := sql.Open("fakeperfschema", "")
+	assert.Nil(t, err)
+	fakeDB.set([][]driver.Value{
+		digestRow("test", "abc", "SELECT 1", 1, 1e9, 1),
+	}, nil)
+	pp := newPerfSchemaPoller(db, true, false)
+
+	sent := make(chan map[string]interface{}, 10)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		pp.run(10*time.Millisecond, done, func(sq map[string]interface{}, _ time.Time) {
+			sent <- sq
+		})
+		close(finished)
+	}()
+	time.Sleep(30 * time.Millisecond)
+	fakeDB.set([][]driver.Value{
+		digestRow("test", "abc", "SELECT 1", 3, 3e9, 3),
+	}, nil)
+	select {
+	case sq := <-sent:
+		assert.Equal(t, uint64(2), sq[execCountKey])
+	case <-time.After(time.Second):
+		t.Error("timed out waiting for the poller")
+	}
+	close(done)
+	<-finished
+}
@@ -0,0 +1,474 @@
+package mysqlaudit
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Audit log formats, as set with --mysqlaudit.log_format
+const (
+	formatAuto = "auto"
+	formatJSON = "json"
+	formatXML  = "xml"
+	formatCSV  = "csv"
+)
+
+// Event attributes, named after the columns in schema/mysqlaudit.sql
+const (
+	nameKey           = "name"
+	recordKey         = "record"
+	timestampKey      = "timestamp"
+	commandClassKey   = "command_class"
+	connectionIDKey   = "connection_id"
+	statusKey         = "status"
+	sqltextKey        = "sqltext"
+	userKey           = "user"
+	hostKey           = "host"
+	ipKey             = "ip"
+	dbKey             = "db"
+	osLoginKey        = "os_login"
+	osVersionKey      = "os_version"
+	mysqlVersionKey   = "mysql_version"
+	privUserKey       = "priv_user"
+	proxyUserKey      = "proxy_user"
+	startupOptionsKey = "startup_options"
+	serverIDKey       = "server_id"
+	serverHostKey     = "server_host"
+	queryIDKey        = "query_id"
+	objectKey         = "object"
+	classKey          = "class"
+	eventKey          = "event"
+)
+
+// fields that are numbers, however the format writes them
+var intFields = map[string]bool{
+	connectionIDKey: true,
+	statusKey:       true,
+	serverIDKey:     true,
+	queryIDKey:      true,
+}
+
+var errNotAuditRecord = errors.New("not an audit record")
+
+// the most lines and bytes a record can span. Past them, a record was most
+// likely never closed, and it's dropped rather than buffered until the end
+// of the file.
+const (
+	maxRecordLines = 1000
+	maxRecordBytes = 1 << 20
+)
+
+// recordAssembler groups lines into whole audit records. The XML formats and
+// the MySQL JSON format pretty print each record over several lines, and
+// queries in any of them may contain newlines.
+type recordAssembler struct {
+	format string
+
+	// the format of the record being assembled
+	current string
+	buf     []string
+	size    int
+	// the fields of the line prefix of the record's first line
+	prefixFields map[string]string
+	// JSON nesting depth and whether we're within a string
+	depth    int
+	inString bool
+	escaped  bool
+	// CSV quoting
+	inQuote bool
+}
+
+// add returns the next complete record if line finishes one. prefixFields
+// are the fields of the line's prefix, kept if it starts a record.
+func (a *recordAssembler) add(line string, prefixFields map[string]string) (auditRecord, bool) {
+	trimmed := strings.TrimSpace(line)
+	if a.current != "" && a.startsRecord(trimmed) {
+		// the record being assembled was never closed
+		a.drop("skipping audit record; a new record started before it was closed.")
+	}
+	if a.current == "" {
+		switch {
+		case trimmed == "", strings.HasPrefix(trimmed, "<?xml"),
+			trimmed == "<AUDIT>", trimmed == "</AUDIT>",
+			trimmed == "[", trimmed == "]", trimmed == ",":
+			// blank lines and the wrappers around the records
+			return auditRecord{}, false
+		}
+		a.current = a.detect(trimmed)
+		if a.current == "" {
+			return auditRecord{}, false
+		}
+		a.prefixFields = prefixFields
+		if a.current == formatJSON {
+			// the MySQL JSON format is one big array
+			line = strings.TrimLeft(trimmed, "[, \t")
+		}
+	}
+
+	switch a.current {
+	case formatJSON:
+		end := a.scanJSON(line)
+		if end < 0 {
+			return a.pend(line)
+		}
+		a.buf = append(a.buf, line[:end])
+	case formatXML:
+		if !strings.HasSuffix(trimmed, "/>") && !strings.HasSuffix(trimmed, "</AUDIT_RECORD>") {
+			return a.pend(line)
+		}
+		a.buf = append(a.buf, line)
+	case formatCSV:
+		if a.scanCSV(line) {
+			return a.pend(line)
+		}
+		a.buf = append(a.buf, line)
+	}
+	record := auditRecord{
+		text:         strings.Join(a.buf, "\n"),
+		format:       a.current,
+		prefixFields: a.prefixFields,
+	}
+	a.reset()
+	return record, true
+}
+
+// pend buffers a line of a record that isn't complete yet, dropping the
+// record if it's grown past the limits
+func (a *recordAssembler) pend(line string) (auditRecord, bool) {
+	a.buf = append(a.buf, line)
+	a.size += len(line)
+	if len(a.buf) >= maxRecordLines || a.size >= maxRecordBytes {
+		a.drop("skipping audit record; it wasn't closed within the size limit.")
+	}
+	return auditRecord{}, false
+}
+
+// drop logs and forgets the record being assembled
+func (a *recordAssembler) drop(msg string) {
+	logrus.WithFields(logrus.Fields{
+		"lines": len(a.buf),
+		"start": a.buf[0],
+	}).Warn(msg)
+	a.reset()
+}
+
+// startsRecord returns whether a line that comes while a record is being
+// assembled is the start of another one in the same format instead. A CSV
+// record only continues within a quoted query, so nothing starts one then.
+func (a *recordAssembler) startsRecord(trimmed string) bool {
+	switch a.current {
+	case formatJSON:
+		// nested objects follow their key, so only records start a line
+		// with a brace
+		trimmed = strings.TrimLeft(trimmed, "[, \t")
+		return !a.inString && (trimmed == "{" || strings.HasPrefix(trimmed, `{"audit_record"`))
+	case formatXML:
+		return strings.HasPrefix(trimmed, "<AUDIT_RECORD")
+	}
+	return false
+}
+
+// detect returns the format of a record that starts with line, or "" if it
+// doesn't look like the start of a record in the configured format
+func (a *recordAssembler) detect(line string) string {
+	var detected string
+	switch {
+	case strings.HasPrefix(line, "{"), strings.HasPrefix(line, "[{"), strings.HasPrefix(line, ",{"):
+		detected = formatJSON
+	case strings.HasPrefix(line, "<AUDIT_RECORD"):
+		detected = formatXML
+	case line[0] >= '0' && line[0] <= '9' && strings.Contains(line, ","):
+		detected = formatCSV
+	}
+	if a.format != formatAuto && a.format != detected {
+		return ""
+	}
+	return detected
+}
+
+// scanJSON tracks the nesting of line and returns the offset just past the
+// brace that closes the record, or -1 if it's still open
+func (a *recordAssembler) scanJSON(line string) int {
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case a.escaped:
+			a.escaped = false
+		case a.inString && c == '\\':
+			a.escaped = true
+		case c == '"':
+			a.inString = !a.inString
+		case a.inString:
+		case c == '{':
+			a.depth++
+		case c == '}':
+			a.depth--
+			if a.depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// scanCSV returns true if line leaves a quoted field open
+func (a *recordAssembler) scanCSV(line string) bool {
+	for i := 0; i < len(line); i++ {
+		switch {
+		case a.escaped:
+			a.escaped = false
+		case line[i] == '\\':
+			a.escaped = true
+		case line[i] == '\'':
+			a.inQuote = !a.inQuote
+		}
+	}
+	return a.inQuote
+}
+
+func (a *recordAssembler) reset() {
+	*a = recordAssembler{format: a.format}
+}
+
+// AuditLineParser parses a JSON audit record, either the Percona format
+// ({"audit_record":{...}}) or the MySQL Enterprise / 8.0 one
+type AuditLineParser struct {
+}
+
+func (j *AuditLineParser) ParseLine(line string) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &data); err != nil {
+		return nil, err
+	}
+	if record, ok := data["audit_record"]; ok {
+		fields, ok := record.(map[string]interface{})
+		if !ok {
+			return nil, errNotAuditRecord
+		}
+		parsed := make(map[string]interface{}, len(fields))
+		for k, v := range fields {
+			setField(parsed, strings.ToLower(k), v)
+		}
+		return parsed, nil
+	}
+	if _, ok := data["class"]; ok {
+		return parseMySQLJSON(data), nil
+	}
+	return nil, errNotAuditRecord
+}
+
+// parseMySQLJSON maps a MySQL Enterprise / 8.0 JSON record onto the fields of
+// the Percona and XML formats
+//
+//	{
+//	  "timestamp": "2019-10-03 15:02:32",
+//	  "id": 0,
+//	  "class": "general",
+//	  "event": "status",
+//	  "connection_id": 11,
+//	  "account": { "user": "root", "host": "localhost" },
+//	  "login": { "user": "root", "os": "", "ip": "::1", "proxy": "" },
+//	  "general_data": { "command": "Query", "sql_command": "show_variables", "query": "SHOW VARIABLES", "status": 0 }
+//	}
+func parseMySQLJSON(data map[string]interface{}) map[string]interface{} {
+	parsed := map[string]interface{}{}
+	setField(parsed, timestampKey, data["timestamp"])
+	setField(parsed, classKey, data["class"])
+	setField(parsed, eventKey, data["event"])
+	setField(parsed, nameKey, data["event"])
+	setField(parsed, connectionIDKey, data["connection_id"])
+	if data["id"] != nil && data["timestamp"] != nil {
+		parsed[recordKey] = fmt.Sprintf("%v_%v", data["id"], data["timestamp"])
+	}
+
+	account, _ := data["account"].(map[string]interface{})
+	setField(parsed, privUserKey, account["user"])
+	setField(parsed, hostKey, account["host"])
+	login, _ := data["login"].(map[string]interface{})
+	setField(parsed, userKey, login["user"])
+	setField(parsed, osLoginKey, login["os"])
+	setField(parsed, ipKey, login["ip"])
+	setField(parsed, proxyUserKey, login["proxy"])
+
+	if general, ok := data["general_data"].(map[string]interface{}); ok {
+		setField(parsed, nameKey, general["command"])
+		setField(parsed, commandClassKey, general["sql_command"])
+		setField(parsed, sqltextKey, general["query"])
+		setField(parsed, statusKey, general["status"])
+	}
+	if conn, ok := data["connection_data"].(map[string]interface{}); ok {
+		setField(parsed, statusKey, conn["status"])
+		setField(parsed, dbKey, conn["db"])
+	}
+	if table, ok := data["table_access_data"].(map[string]interface{}); ok {
+		setField(parsed, dbKey, table["db"])
+		setField(parsed, objectKey, table["table"])
+		setField(parsed, commandClassKey, table["sql_command"])
+		setField(parsed, sqltextKey, table["query"])
+	}
+	if startup, ok := data["startup_data"].(map[string]interface{}); ok {
+		setField(parsed, serverIDKey, startup["server_id"])
+		setField(parsed, osVersionKey, startup["os_version"])
+		setField(parsed, mysqlVersionKey, startup["mysql_version"])
+		if args, ok := startup["args"].([]interface{}); ok {
+			opts := make([]string, 0, len(args))
+			for _, arg := range args {
+				opts = append(opts, fmt.Sprint(arg))
+			}
+			parsed[startupOptionsKey] = strings.Join(opts, " ")
+		}
+	}
+	return parsed
+}
+
+// xmlLineParser parses the XML audit records of Percona Server and MySQL
+// Enterprise. The old style has the fields as attributes:
+//
+// <AUDIT_RECORD
+//
+//	NAME="Query"
+//	RECORD="4707_2014-08-27T10:43:52"
+//	TIMESTAMP="2014-08-27T10:43:52 UTC"
+//	...
+//
+// />
+//
+// and the new style as elements:
+//
+// <AUDIT_RECORD>
+//
+//	<NAME>Query</NAME>
+//	<RECORD>16684_2014-08-27T10:43:52</RECORD>
+//	...
+//
+// </AUDIT_RECORD>
+type xmlLineParser struct {
+}
+
+func (x *xmlLineParser) ParseLine(line string) (map[string]interface{}, error) {
+	parsed := map[string]interface{}{}
+	decoder := xml.NewDecoder(strings.NewReader(line))
+	var field string
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "AUDIT_RECORD" {
+				for _, attr := range t.Attr {
+					setField(parsed, strings.ToLower(attr.Name.Local), attr.Value)
+				}
+				continue
+			}
+			field = strings.ToLower(t.Name.Local)
+			text.Reset()
+		case xml.CharData:
+			if field != "" {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			if field != "" {
+				setField(parsed, field, text.String())
+				field = ""
+			}
+		}
+	}
+	if len(parsed) == 0 {
+		return nil, errNotAuditRecord
+	}
+	return parsed, nil
+}
+
+// csvLineParser parses the MariaDB server_audit plugin format:
+//
+// [timestamp],[serverhost],[username],[host],[connectionid],[queryid],[operation],[database],[object],[retcode]
+// 20200305 10:21:00,db1,root,localhost,8,12,QUERY,test,'select 1',0
+type csvLineParser struct {
+}
+
+func (c *csvLineParser) ParseLine(line string) (map[string]interface{}, error) {
+	fields := splitAuditCSV(line)
+	if len(fields) < 9 {
+		return nil, errNotAuditRecord
+	}
+	parsed := map[string]interface{}{}
+	setField(parsed, timestampKey, fields[0])
+	setField(parsed, serverHostKey, fields[1])
+	setField(parsed, userKey, fields[2])
+	setField(parsed, hostKey, fields[3])
+	setField(parsed, connectionIDKey, fields[4])
+	setField(parsed, queryIDKey, fields[5])
+	setField(parsed, nameKey, fields[6])
+	setField(parsed, dbKey, fields[7])
+	// the object is the query for QUERY operations and the table for
+	// READ/WRITE/CREATE/ALTER/RENAME/DROP ones
+	if fields[6] == "QUERY" {
+		setField(parsed, sqltextKey, fields[8])
+	} else {
+		setField(parsed, objectKey, fields[8])
+	}
+	if len(fields) > 9 {
+		setField(parsed, statusKey, fields[9])
+	}
+	return parsed, nil
+}
+
+// splitAuditCSV splits a server_audit line on commas, except within single
+// quotes, and unquotes the object field
+func splitAuditCSV(line string) []string {
+	var fields []string
+	var field strings.Builder
+	inQuote, escaped := false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case escaped:
+			field.WriteByte(c)
+			escaped = false
+		case inQuote && c == '\\':
+			escaped = true
+		case c == '\'':
+			inQuote = !inQuote
+		case c == ',' && !inQuote:
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteByte(c)
+		}
+	}
+	return append(fields, field.String())
+}
+
+// setField sets key to val, skipping empty values and making numbers of the
+// fields that are numbers
+func setField(parsed map[string]interface{}, key string, val interface{}) {
+	switch v := val.(type) {
+	case nil:
+		return
+	case string:
+		if v == "" {
+			return
+		}
+		if intFields[key] {
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				parsed[key] = i
+				return
+			}
+		}
+	case float64:
+		if intFields[key] {
+			parsed[key] = int64(v)
+			return
+		}
+	}
+	parsed[key] = val
+}
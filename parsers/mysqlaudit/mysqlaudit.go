@@ -2,7 +2,8 @@
 package mysqlaudit
 
 import (
-	"encoding/json"
+	"fmt"
+	"math/rand"
 	"regexp"
 	"strings"
 	"sync"
@@ -10,32 +11,45 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/AIntelligenceGame/clicktail/parsers/htjson"
 	"github.com/honeycombio/honeytail/event"
 	"github.com/honeycombio/honeytail/httime"
 	"github.com/honeycombio/honeytail/parsers"
 )
 
-var (
-	reTime = parsers.ExtRegexp{regexp.MustCompile("^[0-9]+_(?P<ts>[^ ]+)$")}
-)
-
 type Options struct {
 	TimeFieldName   string `long:"timefield" description:"Name of the field that contains a timestamp"`
 	TimeFieldFormat string `long:"format" description:"Format of the timestamp found in timefield (supports strftime and Golang time formats)"`
 	FilterRegex     string `long:"filter_regex" description:"a regular expression that will filter the input stream and only parse lines that match"`
 	InvertFilter    bool   `long:"invert_filter" description:"change the filter_regex to only process lines that do *not* match"`
+	LogFormat       string `long:"log_format" description:"Format of the audit log: json (Percona, MySQL Enterprise or 8.0), xml (Percona old or new style, MySQL Enterprise), csv (MariaDB server_audit) or auto to detect it from each record" default:"auto"`
+
+	htjson.FlattenOptions
 
 	NumParsers int `hidden:"true" description:"number of keyval parsers to spin up"`
 }
 
 type Parser struct {
+	// set SampleRate to cause the parser to drop records before they're
+	// parsed to save CPU
+	SampleRate int
+
 	conf        Options
-	lineParser  parsers.LineParser
+	lineParsers map[string]parsers.LineParser
 	filterRegex *regexp.Regexp
+	flattener   *htjson.Flattener
 
 	warnedAboutTime bool
 }
 
+// auditRecord is one assembled record, the format it's in, and the fields
+// of the prefix of its first line
+type auditRecord struct {
+	text         string
+	format       string
+	prefixFields map[string]string
+}
+
 func (p *Parser) Init(options interface{}) error {
 	p.conf = *options.(*Options)
 	if p.conf.FilterRegex != "" {
@@ -45,28 +59,46 @@ func (p *Parser) Init(options interface{}) error {
 		}
 	}
 
-	p.lineParser = &AuditLineParser{}
-	return nil
-}
-
-type AuditLineParser struct {
-}
-
-func (j *AuditLineParser) ParseLine(line string) (map[string]interface{}, error) {
-	parsed := make(map[string]interface{})
-	var err error
-	var data map[string]interface{}
-
-	if err := json.Unmarshal([]byte(line), &data); err != nil {
-		logrus.Debug("boom")
-	} else {
-		parsed = data["audit_record"].(map[string]interface{})
+	switch p.conf.LogFormat {
+	case "":
+		p.conf.LogFormat = formatAuto
+	case formatAuto, formatJSON, formatXML, formatCSV:
+	default:
+		return fmt.Errorf("unknown audit log format %q, must be one of auto, json, xml or csv", p.conf.LogFormat)
 	}
-
-	return parsed, err
+	p.lineParsers = map[string]parsers.LineParser{
+		formatJSON: &AuditLineParser{},
+		formatXML:  &xmlLineParser{},
+		formatCSV:  &csvLineParser{},
+	}
+	var err error
+	p.flattener, err = htjson.NewFlattener(p.conf.FlattenOptions)
+	return err
 }
 
 func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+	// records span lines, so put them back together before handing them to
+	// the parsers
+	records := make(chan auditRecord)
+	go func() {
+		assembler := &recordAssembler{format: p.conf.LogFormat}
+		for line := range lines {
+			// take care of any headers on the line
+			var prefixFields map[string]string
+			if prefixRegex != nil {
+				var prefix string
+				prefix, prefixFields = prefixRegex.FindStringSubmatchMap(line)
+				line = strings.TrimPrefix(line, prefix)
+			}
+			record, ok := assembler.add(line, prefixFields)
+			// if sampling is disabled or sampler says keep, pass along this record.
+			if ok && (p.SampleRate <= 1 || rand.Intn(p.SampleRate) == 0) {
+				records <- record
+			}
+		}
+		close(records)
+	}()
+
 	wg := sync.WaitGroup{}
 	numParsers := 1
 	if p.conf.NumParsers > 0 {
@@ -75,74 +107,63 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 	for i := 0; i < numParsers; i++ {
 		wg.Add(1)
 		go func() {
-			for line := range lines {
-				line = strings.TrimSpace(line)
+			for record := range records {
 				logrus.WithFields(logrus.Fields{
-					"line": line,
-				}).Debug("Attempting to process keyval log line")
+					"record": record.text,
+				}).Debug("Attempting to process audit log record")
 
-				// if matching regex is set, filter lines here
+				// if matching regex is set, filter records here
 				if p.filterRegex != nil {
-					matched := p.filterRegex.MatchString(line)
+					matched := p.filterRegex.MatchString(record.text)
 					// if both are true or both are false, skip. else continue
 					if matched == p.conf.InvertFilter {
 						logrus.WithFields(logrus.Fields{
-							"line":    line,
+							"record":  record.text,
 							"matched": matched,
-						}).Debug("skipping line due to FilterMatch.")
+						}).Debug("skipping record due to FilterMatch.")
 						continue
 					}
 				}
 
-				// take care of any headers on the line
-				var prefixFields map[string]string
-				if prefixRegex != nil {
-					var prefix string
-					prefix, prefixFields = prefixRegex.FindStringSubmatchMap(line)
-					line = strings.TrimPrefix(line, prefix)
-				}
-
-				parsedLine, err := p.lineParser.ParseLine(line)
+				parsedLine, err := p.lineParsers[record.format].ParseLine(record.text)
 				if err != nil {
-					// skip lines that won't parse
-					logrus.WithFields(logrus.Fields{
-						"line":  line,
-						"error": err,
-					}).Debug("skipping line; failed to parse.")
-					continue
-				}
-				if len(parsedLine) == 0 {
-					// skip empty lines, as determined by the parser
+					// skip records that won't parse
 					logrus.WithFields(logrus.Fields{
-						"line":  line,
-						"error": err,
-					}).Debug("skipping line; no key/val pairs found.")
+						"record": record.text,
+						"error":  err,
+					}).Debug("skipping record; failed to parse.")
 					continue
 				}
-				if allEmpty(parsedLine) {
-					// skip events for which all fields are the empty string, because that's
-					// probably broken
+				if len(parsedLine) == 0 || allEmpty(parsedLine) {
+					// skip empty records, as determined by the parser
 					logrus.WithFields(logrus.Fields{
-						"line":  line,
-						"error": err,
-					}).Debug("skipping line; all values are the empty string.")
+						"record": record.text,
+					}).Debug("skipping record; no fields found.")
 					continue
 				}
-				// merge the prefix fields and the parsed line contents
-				for k, v := range prefixFields {
+
+				// merge the prefix fields and the parsed record contents
+				for k, v := range record.prefixFields {
 					parsedLine[k] = v
 				}
 
 				// look for the timestamp in any of the prefix fields or regular content
-				//timestamp := httime.GetTimestamp(parsedLine, "timestamp", p.conf.TimeFieldFormat)
 				timestamp := p.getTimestamp(parsedLine)
 
-				delete(parsedLine, "timestamp")
+				data := p.flattener.Apply(parsedLine)
+				// the prefix fields aren't part of the record, so selecting
+				// fields doesn't drop them
+				for k, v := range record.prefixFields {
+					if _, ok := parsedLine[k]; ok {
+						data[k] = v
+					}
+				}
 
 				// send an event to Transmission
 				e := event.Event{
-					Timestamp: timestamp,
-					Data:      parsedLine,
+					Timestamp:  timestamp,
+					SampleRate: p.SampleRate,
+					Data:       data,
 				}
 				send <- e
 			}
@@ -150,7 +171,7 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 		}()
 	}
 	wg.Wait()
-	logrus.Debug("lines channel is closed, ending keyval processor")
+	logrus.Debug("lines channel is closed, ending mysqlaudit processor")
 }
 
 // allEmpty returns true if all values in the map are the empty string
@@ -171,23 +192,41 @@ func allEmpty(pl map[string]interface{}) bool {
 	return true
 }
 
-// tries to extract a timestamp from the log line
-func (n *Parser) getTimestamp(evMap map[string]interface{}) time.Time {
-
-	/*_, mg := reTime.FindStringSubmatchMap(evMap["record"].(string))
-
-	    if mg == nil {
-	        return httime.Now()
-	    }
-
-	    logrus.Debug("xxx")
-	    logrus.Debug(mg["ts"])
-
-		timestamp, _ := httime.Parse("2006-01-02T15:04:05", mg["ts"])*/
-
-	timestamp, _ := httime.Parse("2006-01-02T15:04:05 MST", evMap["timestamp"].(string))
+// audit log timestamp formats: Percona and MySQL XML, MySQL JSON and MariaDB
+var timeFormats = []string{
+	"2006-01-02T15:04:05 MST",
+	"2006-01-02 15:04:05",
+	"20060102 15:04:05",
+}
 
-	logrus.Debug(timestamp.Format(time.RFC3339))
+// tries to extract a timestamp from the record, removing the field it came
+// from
+func (p *Parser) getTimestamp(evMap map[string]interface{}) time.Time {
+	field := timestampKey
+	if p.conf.TimeFieldName != "" {
+		field = p.conf.TimeFieldName
+	}
+	ts, ok := evMap[field].(string)
+	if !ok {
+		return httime.Now()
+	}
+	delete(evMap, field)
 
-	return timestamp
+	if p.conf.TimeFieldFormat != "" {
+		timestamp, err := httime.Parse(p.conf.TimeFieldFormat, ts)
+		if err == nil {
+			return timestamp
+		}
+	} else {
+		for _, format := range timeFormats {
+			if timestamp, err := httime.Parse(format, ts); err == nil {
+				return timestamp
+			}
+		}
+	}
+	if !p.warnedAboutTime {
+		logrus.WithField("timestamp", ts).Warn("couldn't parse the audit record timestamp, using the current time")
+		p.warnedAboutTime = true
+	}
+	return httime.Now()
 }
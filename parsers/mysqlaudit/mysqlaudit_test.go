@@ -0,0 +1,296 @@
+package mysqlaudit
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+const (
+	perconaJSON = `{"audit_record":{"name":"Query","record":"743_2016-09-21T09:45:28","timestamp":"2016-09-21T09:45:28 UTC","command_class":"select","connection_id":"3","status":0,"sqltext":"select 1","user":"root[root] @ localhost []","host":"localhost","os_user":"","ip":"","db":""}}`
+
+	perconaOldXML = `<?xml version="1.0" encoding="UTF-8"?>
+<AUDIT>
+<AUDIT_RECORD
+  NAME="Query"
+  RECORD="4707_2014-08-27T10:43:52"
+  TIMESTAMP="2014-08-27T10:43:52 UTC"
+  COMMAND_CLASS="show_databases"
+  CONNECTION_ID="37"
+  STATUS="0"
+  SQLTEXT="select &apos;a&apos; &lt; &apos;b&apos;"
+  USER="root[root] @ localhost []"
+  HOST="localhost"
+  OS_USER=""
+  IP=""
+/>`
+
+	newXML = `<AUDIT_RECORD>
+  <NAME>Query</NAME>
+  <RECORD>16684_2014-08-27T10:43:52</RECORD>
+  <TIMESTAMP>2014-08-27T10:43:52 UTC</TIMESTAMP>
+  <COMMAND_CLASS>select</COMMAND_CLASS>
+  <CONNECTION_ID>37</CONNECTION_ID>
+  <STATUS>0</STATUS>
+  <SQLTEXT>select *
+from t1</SQLTEXT>
+  <USER>root[root] @ localhost []</USER>
+  <HOST>localhost</HOST>
+  <OS_USER></OS_USER>
+  <IP></IP>
+  <DB>test</DB>
+</AUDIT_RECORD>
+</AUDIT>`
+
+	mysqlJSON = `[
+  {
+    "timestamp": "2019-10-03 13:50:01",
+    "id": 0,
+    "class": "audit",
+    "event": "startup",
+    "connection_id": 0,
+    "startup_data": { "server_id": 1,
+                      "os_version": "x86_64-Linux",
+                      "mysql_version": "8.0.19-commercial",
+                      "args": ["/usr/sbin/mysqld", "--audit-log-format=JSON"] }
+  },
+  {
+    "timestamp": "2019-10-03 15:02:32",
+    "id": 1,
+    "class": "general",
+    "event": "status",
+    "connection_id": 11,
+    "account": { "user": "root", "host": "localhost" },
+    "login": { "user": "root", "os": "", "ip": "::1", "proxy": "" },
+    "general_data": { "command": "Query",
+                      "sql_command": "select",
+                      "query": "SELECT '{not a brace'",
+                      "status": 0 }
+  }
+]`
+
+	mariadbCSV = `20200305 10:21:00,db1,root,localhost,8,0,CONNECT,test,,0
+20200305 10:21:01,db1,root,localhost,8,12,QUERY,test,'select \'a,b\'
+from t1',0
+20200305 10:21:01,db1,root,localhost,8,12,READ,test,t1,`
+)
+
+func TestParseFormats(t *testing.T) {
+	tsts := []struct {
+		format   string
+		input    string
+		expected []map[string]interface{}
+		times    []time.Time
+	}{
+		{
+			formatAuto, perconaJSON,
+			[]map[string]interface{}{{
+				nameKey:         "Query",
+				recordKey:       "743_2016-09-21T09:45:28",
+				commandClassKey: "select",
+				connectionIDKey: int64(3),
+				statusKey:       int64(0),
+				sqltextKey:      "select 1",
+				userKey:         "root[root] @ localhost []",
+				hostKey:         "localhost",
+			}},
+			[]time.Time{time.Date(2016, 9, 21, 9, 45, 28, 0, time.UTC)},
+		},
+		{
+			formatXML, perconaOldXML,
+			[]map[string]interface{}{{
+				nameKey:         "Query",
+				recordKey:       "4707_2014-08-27T10:43:52",
+				commandClassKey: "show_databases",
+				connectionIDKey: int64(37),
+				statusKey:       int64(0),
+				sqltextKey:      "select 'a' < 'b'",
+				userKey:         "root[root] @ localhost []",
+				hostKey:         "localhost",
+			}},
+			[]time.Time{time.Date(2014, 8, 27, 10, 43, 52, 0, time.UTC)},
+		},
+		{
+			formatAuto, newXML,
+			[]map[string]interface{}{{
+				nameKey:         "Query",
+				recordKey:       "16684_2014-08-27T10:43:52",
+				commandClassKey: "select",
+				connectionIDKey: int64(37),
+				statusKey:       int64(0),
+				sqltextKey:      "select *\nfrom t1",
+				userKey:         "root[root] @ localhost []",
+				hostKey:         "localhost",
+				dbKey:           "test",
+			}},
+			[]time.Time{time.Date(2014, 8, 27, 10, 43, 52, 0, time.UTC)},
+		},
+		{
+			formatJSON, mysqlJSON,
+			[]map[string]interface{}{{
+				classKey:          "audit",
+				eventKey:          "startup",
+				nameKey:           "startup",
+				recordKey:         "0_2019-10-03 13:50:01",
+				connectionIDKey:   int64(0),
+				serverIDKey:       int64(1),
+				osVersionKey:      "x86_64-Linux",
+				mysqlVersionKey:   "8.0.19-commercial",
+				startupOptionsKey: "/usr/sbin/mysqld --audit-log-format=JSON",
+			}, {
+				classKey:        "general",
+				eventKey:        "status",
+				nameKey:         "Query",
+				recordKey:       "1_2019-10-03 15:02:32",
+				connectionIDKey: int64(11),
+				privUserKey:     "root",
+				hostKey:         "localhost",
+				userKey:         "root",
+				ipKey:           "::1",
+				commandClassKey: "select",
+				sqltextKey:      "SELECT '{not a brace'",
+				statusKey:       int64(0),
+			}},
+			[]time.Time{
+				time.Date(2019, 10, 3, 13, 50, 1, 0, time.UTC),
+				time.Date(2019, 10, 3, 15, 2, 32, 0, time.UTC),
+			},
+		},
+		{
+			formatCSV, mariadbCSV,
+			[]map[string]interface{}{{
+				serverHostKey:   "db1",
+				userKey:         "root",
+				hostKey:         "localhost",
+				connectionIDKey: int64(8),
+				queryIDKey:      int64(0),
+				nameKey:         "CONNECT",
+				dbKey:           "test",
+				statusKey:       int64(0),
+			}, {
+				serverHostKey:   "db1",
+				userKey:         "root",
+				hostKey:         "localhost",
+				connectionIDKey: int64(8),
+				queryIDKey:      int64(12),
+				nameKey:         "QUERY",
+				dbKey:           "test",
+				sqltextKey:      "select 'a,b'\nfrom t1",
+				statusKey:       int64(0),
+			}, {
+				serverHostKey:   "db1",
+				userKey:         "root",
+				hostKey:         "localhost",
+				connectionIDKey: int64(8),
+				queryIDKey:      int64(12),
+				nameKey:         "READ",
+				dbKey:           "test",
+				objectKey:       "t1",
+			}},
+			[]time.Time{
+				time.Date(2020, 3, 5, 10, 21, 0, 0, time.UTC),
+				time.Date(2020, 3, 5, 10, 21, 1, 0, time.UTC),
+				time.Date(2020, 3, 5, 10, 21, 1, 0, time.UTC),
+			},
+		},
+	}
+	for _, tt := range tsts {
+		p := &Parser{}
+		err := p.Init(&Options{LogFormat: tt.format})
+		assert.Nil(t, err)
+		lines := make(chan string)
+		send := make(chan event.Event, 10)
+		go func() {
+			for _, line := range strings.Split(tt.input, "\n") {
+				lines <- line
+			}
+			close(lines)
+		}()
+		p.ProcessLines(lines, send, nil)
+		close(send)
+
+		var data []map[string]interface{}
+		var times []time.Time
+		for ev := range send {
+			data = append(data, ev.Data)
+			times = append(times, ev.Timestamp)
+		}
+		assert.Equal(t, tt.expected, data, tt.input)
+		assert.Equal(t, tt.times, times, tt.input)
+	}
+}
+
+func TestForcedFormatSkipsOthers(t *testing.T) {
+	a := &recordAssembler{format: formatCSV}
+	_, ok := a.add(perconaJSON, nil)
+	assert.False(t, ok)
+	record, ok := a.add("20200305 10:21:00,db1,root,localhost,8,0,CONNECT,test,,0", nil)
+	assert.True(t, ok)
+	assert.Equal(t, formatCSV, record.format)
+	assert.Equal(t, "20200305 10:21:00,db1,root,localhost,8,0,CONNECT,test,,0", record.text)
+}
+
+func TestUnclosedRecords(t *testing.T) {
+	// a new record drops the one that was never closed
+	a := &recordAssembler{format: formatAuto}
+	_, ok := a.add(`{"audit_record":{"name":"Query","sqltext":"select 1"`, nil)
+	assert.False(t, ok)
+	record, ok := a.add(perconaJSON, nil)
+	assert.True(t, ok)
+	assert.Equal(t, perconaJSON, record.text)
+
+	a = &recordAssembler{format: formatXML}
+	a.add("<AUDIT_RECORD>", nil)
+	a.add("  <NAME>Query</NAME>", nil)
+	record, ok = a.add(`<AUDIT_RECORD NAME="Quit" />`, nil)
+	assert.True(t, ok)
+	assert.Equal(t, `<AUDIT_RECORD NAME="Quit" />`, record.text)
+
+	// and so does running past the limit
+	a = &recordAssembler{format: formatCSV}
+	a.add("20200305 10:21:01,db1,root,localhost,8,12,QUERY,test,'never closed", nil)
+	for i := 1; i < maxRecordLines; i++ {
+		_, ok = a.add("1,2", nil)
+		assert.False(t, ok)
+	}
+	record, ok = a.add("20200305 10:21:00,db1,root,localhost,8,0,CONNECT,test,,0", nil)
+	assert.True(t, ok)
+	assert.Equal(t, "20200305 10:21:00,db1,root,localhost,8,0,CONNECT,test,,0", record.text)
+}
+
+func TestPrefixFields(t *testing.T) {
+	p := &Parser{}
+	assert.Nil(t, p.Init(&Options{}))
+	prefix := &parsers.ExtRegexp{Regexp: regexp.MustCompile(`^(?P<hostname>\S+): `)}
+	lines := make(chan string)
+	send := make(chan event.Event, 10)
+	go func() {
+		for _, line := range strings.Split(newXML, "\n") {
+			lines <- "db1: " + line
+		}
+		close(lines)
+	}()
+	p.ProcessLines(lines, send, prefix)
+	close(send)
+	ev := <-send
+	assert.Equal(t, "db1", ev.Data["hostname"])
+	assert.Equal(t, "select *\nfrom t1", ev.Data[sqltextKey])
+}
+
+func TestBrokenRecords(t *testing.T) {
+	// these used to panic
+	jlp := &AuditLineParser{}
+	_, err := jlp.ParseLine(`{"audit_record":"nope"}`)
+	assert.Equal(t, errNotAuditRecord, err)
+	_, err = jlp.ParseLine(`{"something":"else"}`)
+	assert.Equal(t, errNotAuditRecord, err)
+
+	p := &Parser{}
+	assert.NotNil(t, p.Init(&Options{LogFormat: "yaml"}))
+}
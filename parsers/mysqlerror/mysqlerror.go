@@ -0,0 +1,199 @@
+// Package mysqlerror parses the mysql and mariadb error log
+package mysqlerror
+
+import (
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/httime"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+// Sample error log lines, by server version
+//
+// MySQL 8.0:
+// 2020-03-05T10:21:00.123456Z 0 [System] [MY-010116] [Server] /usr/sbin/mysqld (mysqld 8.0.19) starting as process 1
+// 2020-03-05T10:21:01.000000Z 8 [Warning] [MY-010055] [Server] IP address '10.0.0.1' could not be resolved
+//
+// MySQL 5.7:
+// 2020-03-05T10:21:00.123456Z 0 [Note] InnoDB: Buffer pool(s) load completed at 200305 10:21:00
+//
+// MySQL 5.6 and MariaDB 10:
+// 2020-03-05 10:21:00 140234567 [ERROR] mysqld: Table './db/t1' is marked as crashed
+//
+// MySQL 5.5 and older MariaDB:
+// 200305 10:21:00 [Note] Event Scheduler: Loaded 0 events
+// 200305 10:21:00  InnoDB: Completed initialization of buffer pool
+//
+// Lines that don't start with a timestamp, such as the stack trace after a
+// crash, continue the message of the line before.
+
+const (
+	// Event attributes
+	threadKey    = "thread"
+	severityKey  = "severity"
+	errorCodeKey = "error_code"
+	subsystemKey = "subsystem"
+	messageKey   = "message"
+
+	timeFormat    = "2006-01-02T15:04:05.999999Z07:00"
+	oldTimeFormat = "060102 15:04:05"
+)
+
+var (
+	reEntry = parsers.ExtRegexp{regexp.MustCompile("^(?P<time>[0-9]{4}-[0-9]{2}-[0-9]{2}[T ][0-9]{2}:[0-9]{2}:[0-9]{2}(?:\\.[0-9]+)?(?:Z|[+-][0-9]{2}:[0-9]{2})?|[0-9]{6} [ 0-9][0-9]:[0-9]{2}:[0-9]{2}) +(?:(?P<thread>[0-9]+) +)?(?:\\[(?P<severity>[A-Za-z]+)\\] +)?(?:\\[(?P<code>MY-[0-9]+)\\] +)?(?:\\[(?P<subsystem>[A-Za-z]+)\\] +)?(?P<message>.*)$")}
+	// before MySQL 8 the subsystem is part of the message
+	reMessageSubsystem = parsers.ExtRegexp{regexp.MustCompile("^(?P<subsystem>InnoDB|Event Scheduler|Slave I/O thread|Slave SQL thread|Semi-sync replication|Aria engine): ")}
+	// replication errors carry the error number in the message
+	reMessageErrorCode = parsers.ExtRegexp{regexp.MustCompile("Error_code: (?P<code>(?:MY-)?[0-9]+)")}
+)
+
+type Options struct {
+	Severities []string `long:"severity" description:"Only send entries with this severity (eg ERROR, Warning). May be specified multiple times. Defaults to all severities"`
+}
+
+type Parser struct {
+	// set SampleRate to cause the parser to drop events after before they're
+	// parsed to save CPU
+	SampleRate int
+
+	conf       Options
+	severities map[string]bool
+}
+
+func (p *Parser) Init(options interface{}) error {
+	p.conf = *options.(*Options)
+	if len(p.conf.Severities) > 0 {
+		p.severities = make(map[string]bool, len(p.conf.Severities))
+		for _, s := range p.conf.Severities {
+			p.severities[strings.ToLower(s)] = true
+		}
+	}
+	return nil
+}
+
+func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+	var (
+		groupedLines []string
+		// the fields of the prefix of the entry's first line
+		groupPrefixFields map[string]string
+	)
+	flush := func() {
+		if len(groupedLines) == 0 {
+			return
+		}
+		// if sampling is disabled or sampler says keep, pass along this group.
+		if p.SampleRate <= 1 || rand.Intn(p.SampleRate) == 0 {
+			data, timestamp := p.handleEvent(groupedLines)
+			if len(data) != 0 && p.keep(data) {
+				// merge the prefix fields and the parsed entry contents
+				for k, v := range groupPrefixFields {
+					data[k] = v
+				}
+				send <- event.Event{
+					Timestamp:  timestamp,
+					SampleRate: p.SampleRate,
+					Data:       data,
+				}
+			}
+		}
+		groupedLines = nil
+		groupPrefixFields = nil
+	}
+	for line := range lines {
+		line = strings.TrimRight(line, "\r\n")
+		// take care of any headers on the line
+		var prefixFields map[string]string
+		if prefixRegex != nil {
+			var prefix string
+			prefix, prefixFields = prefixRegex.FindStringSubmatchMap(line)
+			line = strings.TrimPrefix(line, prefix)
+		}
+		if reEntry.MatchString(line) {
+			flush()
+			groupedLines = []string{line}
+			groupPrefixFields = prefixFields
+			continue
+		}
+		if len(groupedLines) == 0 {
+			logrus.WithFields(logrus.Fields{
+				"line": line,
+			}).Debug("skipping line that doesn't start an entry")
+			continue
+		}
+		groupedLines = append(groupedLines, line)
+	}
+	// send the last event, if there was one collected
+	flush()
+	logrus.Debug("lines channel is closed, ending mysql error log processor")
+}
+
+// keep returns false for events filtered out by --mysqlerror.severity
+func (p *Parser) keep(data map[string]interface{}) bool {
+	if p.severities == nil {
+		return true
+	}
+	severity, _ := data[severityKey].(string)
+	return p.severities[strings.ToLower(severity)]
+}
+
+// handleEvent turns the lines of one error log entry into an event
+func (p *Parser) handleEvent(rawE []string) (map[string]interface{}, time.Time) {
+	if len(rawE) == 0 {
+		return nil, time.Time{}
+	}
+	_, mg := reEntry.FindStringSubmatchMap(rawE[0])
+	if mg == nil {
+		return nil, time.Time{}
+	}
+	data := map[string]interface{}{}
+	if thread, err := strconv.ParseInt(mg["thread"], 10, 64); err == nil {
+		data[threadKey] = thread
+	}
+	if mg["severity"] != "" {
+		data[severityKey] = mg["severity"]
+	}
+	message := strings.TrimSpace(strings.Join(append([]string{mg["message"]}, rawE[1:]...), "\n"))
+	data[messageKey] = message
+	if mg["subsystem"] != "" {
+		data[subsystemKey] = mg["subsystem"]
+	} else if _, sg := reMessageSubsystem.FindStringSubmatchMap(message); sg != nil {
+		data[subsystemKey] = sg["subsystem"]
+	}
+	if mg["code"] != "" {
+		data[errorCodeKey] = mg["code"]
+	} else if _, cg := reMessageErrorCode.FindStringSubmatchMap(message); cg != nil {
+		data[errorCodeKey] = cg["code"]
+	}
+	return data, parseTime(mg["time"])
+}
+
+// parseTime handles the timestamps of each server version, falling back to
+// now.
+func parseTime(t string) time.Time {
+	var timestamp time.Time
+	var err error
+	switch {
+	case len(t) > 10 && t[10] == 'T':
+		timestamp, err = httime.Parse(timeFormat, t)
+	case len(t) > 10 && t[10] == ' ':
+		timestamp, err = httime.Parse("2006-01-02 15:04:05", t)
+	default:
+		// single digit hours are padded with a space
+		timestamp, err = httime.Parse(oldTimeFormat, strings.Replace(t, "  ", " 0", 1))
+	}
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"time":  t,
+			"error": err,
+		}).Debug("failed to parse time")
+		return httime.Now()
+	}
+	return timestamp
+}
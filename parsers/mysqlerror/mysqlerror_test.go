@@ -0,0 +1,132 @@
+package mysqlerror
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+func TestHandleEvent(t *testing.T) {
+	p := &Parser{}
+	tsts := []struct {
+		lines    []string
+		expected map[string]interface{}
+		time     time.Time
+	}{
+		{
+			[]string{"2020-03-05T10:21:00.123456Z 0 [System] [MY-010116] [Server] /usr/sbin/mysqld (mysqld 8.0.19) starting as process 1"},
+			map[string]interface{}{
+				threadKey:    int64(0),
+				severityKey:  "System",
+				errorCodeKey: "MY-010116",
+				subsystemKey: "Server",
+				messageKey:   "/usr/sbin/mysqld (mysqld 8.0.19) starting as process 1",
+			},
+			time.Date(2020, 3, 5, 10, 21, 0, 123456000, time.UTC),
+		},
+		{
+			[]string{"2020-03-05T10:21:00.123456+01:00 0 [Note] InnoDB: Buffer pool(s) load completed at 200305 10:21:00"},
+			map[string]interface{}{
+				threadKey:    int64(0),
+				severityKey:  "Note",
+				subsystemKey: "InnoDB",
+				messageKey:   "InnoDB: Buffer pool(s) load completed at 200305 10:21:00",
+			},
+			time.Date(2020, 3, 5, 9, 21, 0, 123456000, time.UTC),
+		},
+		{
+			[]string{"2020-03-05 10:21:00 140234567 [ERROR] Slave SQL: Error 'Duplicate entry' on query. Default database: 'db'. Query: 'INSERT INTO t1 VALUES (1)', Error_code: 1062"},
+			map[string]interface{}{
+				threadKey:    int64(140234567),
+				severityKey:  "ERROR",
+				errorCodeKey: "1062",
+				messageKey:   "Slave SQL: Error 'Duplicate entry' on query. Default database: 'db'. Query: 'INSERT INTO t1 VALUES (1)', Error_code: 1062",
+			},
+			time.Date(2020, 3, 5, 10, 21, 0, 0, time.UTC),
+		},
+		{
+			[]string{"200305  3:21:00  InnoDB: Completed initialization of buffer pool"},
+			map[string]interface{}{
+				subsystemKey: "InnoDB",
+				messageKey:   "InnoDB: Completed initialization of buffer pool",
+			},
+			time.Date(2020, 3, 5, 3, 21, 0, 0, time.UTC),
+		},
+		{
+			[]string{
+				"2020-03-05 10:21:00 0 [ERROR] mysqld got signal 11 ;",
+				"This could be because you hit a bug.",
+				"Thread pointer: 0x0",
+			},
+			map[string]interface{}{
+				threadKey:   int64(0),
+				severityKey: "ERROR",
+				messageKey:  "mysqld got signal 11 ;\nThis could be because you hit a bug.\nThread pointer: 0x0",
+			},
+			time.Date(2020, 3, 5, 10, 21, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tsts {
+		data, timestamp := p.handleEvent(tt.lines)
+		assert.Equal(t, tt.expected, data, tt.lines[0])
+		assert.Equal(t, tt.time.UnixNano(), timestamp.UnixNano(), tt.lines[0])
+	}
+}
+
+func TestProcessLines(t *testing.T) {
+	p := &Parser{}
+	p.Init(&Options{Severities: []string{"error", "warning"}})
+	lines := make(chan string)
+	send := make(chan event.Event, 10)
+	go func() {
+		for _, line := range []string{
+			"stray line before the first entry",
+			"2020-03-05T10:21:00.123456Z 0 [Note] [MY-010116] [Server] starting",
+			"2020-03-05T10:21:01.000000Z 8 [Warning] [MY-010055] [Server] IP address '10.0.0.1' could not be resolved",
+			"2020-03-05T10:21:02.000000Z 0 [ERROR] [MY-000000] [Server] first line",
+			"second line",
+		} {
+			lines <- line
+		}
+		close(lines)
+	}()
+	p.ProcessLines(lines, send, nil)
+	close(send)
+
+	var messages []interface{}
+	for ev := range send {
+		messages = append(messages, ev.Data[messageKey])
+	}
+	assert.Equal(t, []interface{}{
+		"IP address '10.0.0.1' could not be resolved",
+		"first line\nsecond line",
+	}, messages)
+}
+
+func TestPrefixFields(t *testing.T) {
+	p := &Parser{}
+	p.Init(&Options{})
+	prefix := &parsers.ExtRegexp{Regexp: regexp.MustCompile(`^(?P<hostname>\S+): `)}
+	lines := make(chan string)
+	send := make(chan event.Event, 10)
+	go func() {
+		for _, line := range []string{
+			"db1: 2020-03-05T10:21:02.000000Z 0 [ERROR] [MY-000000] [Server] first line",
+			"db2: second line",
+		} {
+			lines <- line
+		}
+		close(lines)
+	}()
+	p.ProcessLines(lines, send, prefix)
+	close(send)
+
+	ev := <-send
+	assert.Equal(t, "db1", ev.Data["hostname"])
+	assert.Equal(t, "first line\nsecond line", ev.Data[messageKey])
+}
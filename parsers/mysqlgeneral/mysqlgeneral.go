@@ -0,0 +1,303 @@
+// Package mysqlgeneral parses the mysql general query log
+package mysqlgeneral
+
+import (
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeycombio/mysqltools/query/normalizer"
+	"github.com/sirupsen/logrus"
+
+	"github.com/AIntelligenceGame/clicktail/parsers/fingerprint"
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/httime"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+// Sample general query log, MySQL 5.7 and later
+//
+// /usr/sbin/mysqld, Version: 8.0.19 (MySQL Community Server - GPL). started with:
+// Tcp port: 3306  Unix socket: /var/run/mysqld/mysqld.sock
+// Time                 Id Command    Argument
+// 2020-03-05T10:21:00.123456Z	    8 Connect	root@localhost on test using Socket
+// 2020-03-05T10:21:00.123789Z	    8 Query	SELECT *
+// FROM t1
+// WHERE a = 1
+// 2020-03-05T10:21:10.000000Z	    8 Quit
+//
+// MySQL 5.6 and MariaDB only print the time when it changes from the previous
+// line:
+//
+// 200305 10:21:00	    8 Connect	root@localhost as anonymous on test
+// 		    8 Query	select 1
+//
+// A line that doesn't start a new entry continues the argument of the one
+// before it.
+
+const (
+	// Event attributes
+	connectionIDKey    = "connection_id"
+	commandKey         = "command"
+	argumentKey        = "argument"
+	userKey            = "user"
+	clientKey          = "client"
+	databaseKey        = "database"
+	connectTypeKey     = "connect_type"
+	queryKey           = "query"
+	normalizedQueryKey = "normalized_query"
+	fingerprintKey     = "query_fingerprint"
+	checksumKey        = "query_checksum"
+	statementKey       = "statement"
+	tablesKey          = "tables"
+	commentsKey        = "comments"
+
+	timeFormat    = "2006-01-02T15:04:05.999999Z07:00"
+	oldTimeFormat = "060102 15:04:05"
+)
+
+var (
+	reEntry = parsers.ExtRegexp{regexp.MustCompile("^(?:(?P<time>[0-9]{4}-[0-9]{2}-[0-9]{2}T[^\\s]+)|(?P<oldtime>[0-9]{6} [ 0-9][0-9]:[0-9]{2}:[0-9]{2})|\t)\\s+(?P<id>[0-9]+) (?P<command>[A-Za-z][A-Za-z ]*?)(?:\t(?P<argument>.*))?$")}
+	// root@localhost on test using Socket, or with MariaDB root@localhost as anonymous on test
+	reConnect = parsers.ExtRegexp{regexp.MustCompile("^(?P<user>[^@\\s]*)@(?P<host>\\S*)(?: as \\S+)? on (?P<database>\\S*)(?: using (?P<type>.+))?$")}
+
+	// the header the server writes when it opens the log
+	reVersion       = regexp.MustCompile(", Version: .* started with:$")
+	rePortSock      = regexp.MustCompile("^Tcp port: .* Unix socket: ")
+	reColumnHeaders = regexp.MustCompile("^Time +Id +Command +Argument")
+)
+
+// commands whose argument is a SQL statement
+var queryCommands = map[string]bool{
+	"Query":   true,
+	"Prepare": true,
+	"Execute": true,
+}
+
+type Options struct {
+	Commands []string `long:"command" description:"Only send entries for this command (eg Query, Connect). May be specified multiple times. Defaults to all commands"`
+
+	NumParsers int `hidden:"true" description:"number of MySQL general log parsers to spin up"`
+}
+
+type Parser struct {
+	// set SampleRate to cause the parser to drop events after before they're
+	// parsed to save CPU
+	SampleRate int
+
+	conf     Options
+	commands map[string]bool
+	wg       sync.WaitGroup
+}
+
+// the normalizer can't be shared by all threads.
+type perThreadParser struct {
+	normalizer *normalizer.Parser
+}
+
+// rawEvent is the lines of one entry, along with the time carried over from
+// a previous line when the entry didn't have its own and the fields of the
+// prefix of its first line
+type rawEvent struct {
+	lines        []string
+	lastTime     string
+	prefixFields map[string]string
+}
+
+func (p *Parser) Init(options interface{}) error {
+	p.conf = *options.(*Options)
+	if len(p.conf.Commands) > 0 {
+		p.commands = make(map[string]bool, len(p.conf.Commands))
+		for _, c := range p.conf.Commands {
+			p.commands[c] = true
+		}
+	}
+	return nil
+}
+
+func isHeaderLine(line string) bool {
+	return reVersion.MatchString(line) ||
+		rePortSock.MatchString(line) ||
+		reColumnHeaders.MatchString(line)
+}
+
+func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+	// start up a goroutine to handle grouped sets of lines
+	rawEvents := make(chan rawEvent)
+	defer p.wg.Wait()
+	p.wg.Add(1)
+	go p.handleEvents(rawEvents, send)
+
+	var (
+		groupedLines []string
+		// the last time we saw, for entries that don't have one
+		lastTime string
+		// the fields of the prefix of the entry's first line
+		groupPrefixFields map[string]string
+	)
+	flush := func() {
+		if len(groupedLines) == 0 {
+			return
+		}
+		// if sampling is disabled or sampler says keep, pass along this group.
+		if p.SampleRate <= 1 || rand.Intn(p.SampleRate) == 0 {
+			rawEvents <- rawEvent{lines: groupedLines, lastTime: lastTime, prefixFields: groupPrefixFields}
+		}
+		groupedLines = nil
+		groupPrefixFields = nil
+	}
+	for line := range lines {
+		line = strings.TrimRight(line, "\r\n")
+		// take care of any headers on the line
+		var prefixFields map[string]string
+		if prefixRegex != nil {
+			var prefix string
+			prefix, prefixFields = prefixRegex.FindStringSubmatchMap(line)
+			line = strings.TrimPrefix(line, prefix)
+		}
+		if isHeaderLine(line) {
+			flush()
+			continue
+		}
+		if _, mg := reEntry.FindStringSubmatchMap(line); mg != nil {
+			flush()
+			if mg["time"] != "" {
+				lastTime = mg["time"]
+			} else if mg["oldtime"] != "" {
+				lastTime = mg["oldtime"]
+			}
+			groupedLines = []string{line}
+			groupPrefixFields = prefixFields
+			continue
+		}
+		if len(groupedLines) == 0 {
+			logrus.WithFields(logrus.Fields{
+				"line": line,
+			}).Debug("skipping line that doesn't start an entry")
+			continue
+		}
+		groupedLines = append(groupedLines, line)
+	}
+	// send the last event, if there was one collected
+	flush()
+	logrus.Debug("lines channel is closed, ending mysql general log processor")
+	close(rawEvents)
+}
+
+func (p *Parser) handleEvents(rawEvents <-chan rawEvent, send chan<- event.Event) {
+	defer p.wg.Done()
+	wg := sync.WaitGroup{}
+	numParsers := 1
+	if p.conf.NumParsers > 0 {
+		numParsers = p.conf.NumParsers
+	}
+	for i := 0; i < numParsers; i++ {
+		ptp := perThreadParser{
+			normalizer: &normalizer.Parser{},
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rawE := range rawEvents {
+				data, timestamp := p.handleEvent(&ptp, rawE)
+				if len(data) == 0 {
+					continue
+				}
+				if p.commands != nil && !p.commands[data[commandKey].(string)] {
+					continue
+				}
+				// merge the prefix fields and the parsed entry contents
+				for k, v := range rawE.prefixFields {
+					data[k] = v
+				}
+				send <- event.Event{
+					Timestamp:  timestamp,
+					SampleRate: p.SampleRate,
+					Data:       data,
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	logrus.Debug("done with mysql general log handleEvents")
+}
+
+// handleEvent turns the lines of one general log entry into an event
+func (p *Parser) handleEvent(ptp *perThreadParser, rawE rawEvent) (map[string]interface{}, time.Time) {
+	if len(rawE.lines) == 0 {
+		return nil, time.Time{}
+	}
+	_, mg := reEntry.FindStringSubmatchMap(rawE.lines[0])
+	if mg == nil {
+		return nil, time.Time{}
+	}
+	data := map[string]interface{}{}
+	if id, err := strconv.Atoi(mg["id"]); err == nil {
+		data[connectionIDKey] = id
+	}
+	command := mg["command"]
+	data[commandKey] = command
+	argument := strings.Join(append([]string{mg["argument"]}, rawE.lines[1:]...), "\n")
+	argument = strings.TrimSpace(argument)
+	if argument != "" {
+		data[argumentKey] = argument
+	}
+
+	switch {
+	case queryCommands[command] && argument != "":
+		data[queryKey] = argument
+		data[normalizedQueryKey] = ptp.normalizer.NormalizeQuery(argument)
+		if len(ptp.normalizer.LastTables) > 0 {
+			data[tablesKey] = strings.Join(ptp.normalizer.LastTables, " ")
+		}
+		if len(ptp.normalizer.LastComments) > 0 {
+			data[commentsKey] = "/* " + strings.Join(ptp.normalizer.LastComments, " */ /* ") + " */"
+		}
+		data[statementKey] = ptp.normalizer.LastStatement
+		fp := fingerprint.Fingerprint(argument)
+		data[fingerprintKey] = fp
+		data[checksumKey] = fingerprint.Checksum(fp)
+	case command == "Connect":
+		if _, cg := reConnect.FindStringSubmatchMap(argument); cg != nil {
+			data[userKey] = cg["user"]
+			data[clientKey] = cg["host"]
+			if cg["database"] != "" {
+				data[databaseKey] = cg["database"]
+			}
+			if cg["type"] != "" {
+				data[connectTypeKey] = cg["type"]
+			}
+		}
+	case command == "Init DB":
+		data[databaseKey] = argument
+	}
+
+	return data, parseTime(rawE.lastTime)
+}
+
+// parseTime handles both the RFC3339 timestamps of MySQL 5.7 and later and
+// the older YYMMDD H:MM:SS ones, falling back to now.
+func parseTime(t string) time.Time {
+	if t == "" {
+		return httime.Now()
+	}
+	var timestamp time.Time
+	var err error
+	if strings.Contains(t, "T") {
+		timestamp, err = httime.Parse(timeFormat, t)
+	} else {
+		// single digit hours are padded with a space
+		timestamp, err = httime.Parse(oldTimeFormat, strings.Replace(t, "  ", " 0", 1))
+	}
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"time":  t,
+			"error": err,
+		}).Debug("failed to parse time")
+		return httime.Now()
+	}
+	return timestamp
+}
@@ -0,0 +1,153 @@
+package mysqlgeneral
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/mysqltools/query/normalizer"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AIntelligenceGame/clicktail/parsers/fingerprint"
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+func TestHandleEvent(t *testing.T) {
+	p := &Parser{}
+	ptp := &perThreadParser{
+		normalizer: &normalizer.Parser{},
+	}
+	tsts := []struct {
+		rawE     rawEvent
+		expected map[string]interface{}
+		time     time.Time
+	}{
+		{
+			rawEvent{
+				lines:    []string{"2020-03-05T10:21:00.123456Z\t    8 Connect\troot@localhost on test using Socket"},
+				lastTime: "2020-03-05T10:21:00.123456Z",
+			},
+			map[string]interface{}{
+				connectionIDKey: 8,
+				commandKey:      "Connect",
+				argumentKey:     "root@localhost on test using Socket",
+				userKey:         "root",
+				clientKey:       "localhost",
+				databaseKey:     "test",
+				connectTypeKey:  "Socket",
+			},
+			time.Date(2020, 3, 5, 10, 21, 0, 123456000, time.UTC),
+		},
+		{
+			rawEvent{
+				lines: []string{
+					"2020-03-05T10:21:00.123789Z\t    8 Query\tSELECT *",
+					"FROM t1",
+					"WHERE a = 1",
+				},
+				lastTime: "2020-03-05T10:21:00.123789Z",
+			},
+			map[string]interface{}{
+				connectionIDKey:    8,
+				commandKey:         "Query",
+				argumentKey:        "SELECT *\nFROM t1\nWHERE a = 1",
+				queryKey:           "SELECT *\nFROM t1\nWHERE a = 1",
+				normalizedQueryKey: "select * from t1 where a = ?",
+				fingerprintKey:     "select * from t1 where a = ?",
+				checksumKey:        fingerprint.Checksum("select * from t1 where a = ?"),
+				statementKey:       "select",
+				tablesKey:          "t1",
+			},
+			time.Date(2020, 3, 5, 10, 21, 0, 123789000, time.UTC),
+		},
+		{
+			rawEvent{
+				lines:    []string{"\t\t   12 Init DB\tshop"},
+				lastTime: "200305  3:10:22",
+			},
+			map[string]interface{}{
+				connectionIDKey: 12,
+				commandKey:      "Init DB",
+				argumentKey:     "shop",
+				databaseKey:     "shop",
+			},
+			time.Date(2020, 3, 5, 3, 10, 22, 0, time.UTC),
+		},
+		{
+			rawEvent{
+				lines:    []string{"200305 10:21:10\t   12 Quit\t"},
+				lastTime: "200305 10:21:10",
+			},
+			map[string]interface{}{
+				connectionIDKey: 12,
+				commandKey:      "Quit",
+			},
+			time.Date(2020, 3, 5, 10, 21, 10, 0, time.UTC),
+		},
+	}
+	for _, tt := range tsts {
+		data, timestamp := p.handleEvent(ptp, tt.rawE)
+		assert.Equal(t, tt.expected, data, tt.rawE.lines[0])
+		assert.Equal(t, tt.time.UnixNano(), timestamp.UnixNano(), tt.rawE.lines[0])
+	}
+}
+
+func TestProcessLines(t *testing.T) {
+	p := &Parser{}
+	p.Init(&Options{Commands: []string{"Query", "Connect"}})
+	lines := make(chan string)
+	send := make(chan event.Event, 10)
+	go func() {
+		for _, line := range []string{
+			"/usr/sbin/mysqld, Version: 5.6.40-log (MySQL Community Server (GPL)). started with:",
+			"Tcp port: 3306  Unix socket: /var/lib/mysql/mysql.sock",
+			"Time                 Id Command    Argument",
+			"200305 10:21:00\t    8 Connect\troot@localhost as anonymous on test",
+			"\t\t    8 Query\tselect 1",
+			"200305 10:21:01\t    8 Query\tselect *",
+			"from t1",
+			"\t\t    8 Quit\t",
+		} {
+			lines <- line
+		}
+		close(lines)
+	}()
+	p.ProcessLines(lines, send, nil)
+	close(send)
+
+	var got []string
+	for ev := range send {
+		got = append(got, ev.Data[commandKey].(string)+" "+ev.Timestamp.Format("15:04:05")+" "+ev.Data[argumentKey].(string))
+	}
+	sort.Strings(got)
+	assert.Equal(t, []string{
+		"Connect 10:21:00 root@localhost as anonymous on test",
+		"Query 10:21:00 select 1",
+		"Query 10:21:01 select *\nfrom t1",
+	}, got)
+}
+
+func TestPrefixFields(t *testing.T) {
+	p := &Parser{}
+	p.Init(&Options{})
+	prefix := &parsers.ExtRegexp{Regexp: regexp.MustCompile(`^(?P<hostname>\S+): `)}
+	lines := make(chan string)
+	send := make(chan event.Event, 10)
+	go func() {
+		for _, line := range []string{
+			"db1: 200305 10:21:01\t    8 Query\tselect *",
+			"db2: from t1",
+		} {
+			lines <- line
+		}
+		close(lines)
+	}()
+	p.ProcessLines(lines, send, prefix)
+	close(send)
+
+	ev := <-send
+	assert.Equal(t, "db1", ev.Data["hostname"])
+	assert.Equal(t, "select *\nfrom t1", ev.Data[argumentKey])
+}
@@ -0,0 +1,263 @@
+package nginx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/honeycombio/gonx"
+	"github.com/sirupsen/logrus"
+
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+// Formats come from a log_format directive in the nginx config:
+//
+//	log_format upstream escape=json '{"time":"$time_iso8601","status":"$status",'
+//	                                '"upstream_response_time":"$upstream_response_time"}';
+//
+// from --nginx.log_format, written the same way minus the directive and
+// name, or are one of the formats nginx (or its default nginx.conf) defines.
+
+const (
+	escapeDefault = "default"
+	escapeJSON    = "json"
+	escapeNone    = "none"
+)
+
+// builtinLogFormats can be used by name without a config file
+var builtinLogFormats = map[string]string{
+	// predefined by nginx
+	"combined": `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`,
+	// from the nginx.conf nginx ships with
+	"main": `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_x_forwarded_for"`,
+}
+
+var (
+	reEscapeParam = regexp.MustCompile(`^escape=(\w+)\s*`)
+	// a variable in a format quoted by regexp.QuoteMeta, and the character
+	// after it, as gonx finds them
+	reQuotedVariable = regexp.MustCompile(`\\\$([A-Za-z0-9_]+)(\\?(.))`)
+	// a "key":"$variable" member of a JSON format
+	reJSONVariable = regexp.MustCompile(`"([^"\\]+)"\s*:\s*"?\$([A-Za-z0-9_]+)"?\s*[,}]`)
+)
+
+// logFormat is a log_format definition
+type logFormat struct {
+	format string
+	// how nginx escapes values: default, json or none
+	escape string
+}
+
+// parseLogFormat parses the arguments of a log_format directive after the
+// name: an optional escape= parameter and the format, as one or more quoted
+// strings. An unquoted format is taken as is.
+func parseLogFormat(args string) (logFormat, error) {
+	args = strings.TrimSpace(args)
+	lf := logFormat{escape: escapeDefault}
+	if m := reEscapeParam.FindStringSubmatch(args); m != nil {
+		switch m[1] {
+		case escapeDefault, escapeJSON, escapeNone:
+			lf.escape = m[1]
+		default:
+			return lf, fmt.Errorf("unknown log_format escape %q, expected default, json or none", m[1])
+		}
+		args = args[len(m[0]):]
+	}
+	if args == "" {
+		return lf, fmt.Errorf("empty log_format")
+	}
+	if args[0] != '\'' && args[0] != '"' {
+		lf.format = args
+		return lf, nil
+	}
+	var format strings.Builder
+	for args != "" {
+		quote := args[0]
+		if quote != '\'' && quote != '"' {
+			return lf, fmt.Errorf("expected a quoted string in log_format, got %q", args)
+		}
+		i := 1
+		for ; i < len(args) && args[i] != quote; i++ {
+			if args[i] == '\\' && i+1 < len(args) {
+				i++
+				switch args[i] {
+				case 'n':
+					format.WriteByte('\n')
+				case 't':
+					format.WriteByte('\t')
+				case 'r':
+					format.WriteByte('\r')
+				case '"', '\'', '\\':
+					format.WriteByte(args[i])
+				default:
+					format.WriteByte('\\')
+					format.WriteByte(args[i])
+				}
+				continue
+			}
+			format.WriteByte(args[i])
+		}
+		if i == len(args) {
+			return lf, fmt.Errorf("unterminated string in log_format")
+		}
+		args = strings.TrimSpace(args[i+1:])
+	}
+	lf.format = format.String()
+	return lf, nil
+}
+
+// readConfigLogFormat looks for the log_format with the given name in an
+// nginx config. found is false if there isn't one.
+func readConfigLogFormat(conf io.Reader, name string) (lf logFormat, found bool, err error) {
+	b, err := ioutil.ReadAll(conf)
+	if err != nil {
+		return lf, false, err
+	}
+	re := regexp.MustCompile(`(?m)^\s*log_format\s+` + regexp.QuoteMeta(name) + `\s+`)
+	loc := re.FindIndex(b)
+	if loc == nil {
+		return lf, false, nil
+	}
+	// the directive ends at the first semicolon outside a string
+	rest := b[loc[1]:]
+	var quote byte
+	end := -1
+	for i := 0; i < len(rest) && end < 0; i++ {
+		switch c := rest[i]; {
+		case c == '\\' && quote != 0:
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ';':
+			end = i
+		}
+	}
+	if end < 0 {
+		return lf, true, fmt.Errorf("log_format %s isn't terminated with a ;", name)
+	}
+	lf, err = parseLogFormat(string(bytes.TrimSpace(rest[:end])))
+	return lf, true, err
+}
+
+// newLineParser returns a parser for lines in the format, along with the
+// fields variables are stored in for formats that name them differently,
+// by variable
+func newLineParser(lf logFormat, conv fieldConverter) (lineParser parsers.LineParser, varFields map[string]string, err error) {
+	format := strings.TrimSpace(lf.format)
+	switch {
+	case lf.escape == escapeJSON && strings.HasPrefix(format, "{"):
+		// the whole line is a JSON object, whose keys name the fields. The
+		// format isn't necessarily JSON itself, as numeric variables may be
+		// left unquoted.
+		varFields = make(map[string]string)
+		for _, m := range reJSONVariable.FindAllStringSubmatch(format, -1) {
+			if m[1] != m[2] {
+				varFields[m[2]] = m[1]
+			}
+		}
+		return &JSONLineParser{fieldConverter: conv}, varFields, nil
+	case lf.escape == escapeJSON:
+		return &EscapedLineParser{
+			regexp:         escapedFormatRegexp(lf.format),
+			fieldConverter: conv,
+		}, nil, nil
+	}
+	return &GonxLineParser{
+		parser:         gonx.NewParser(lf.format),
+		fieldConverter: conv,
+	}, nil, nil
+}
+
+// escapedFormatRegexp builds the regex gonx would for the format, but lets
+// values contain escaped delimiters
+func escapedFormatRegexp(format string) *regexp.Regexp {
+	re := reQuotedVariable.ReplaceAllString(regexp.QuoteMeta(format+" "),
+		`(?P<$1>(?:[^$3\\]|\\.)*)$2`)
+	return regexp.MustCompile("^" + strings.Trim(re, " ") + "$")
+}
+
+// JSONLineParser parses lines logged by an escape=json format that's a JSON
+// object
+type JSONLineParser struct {
+	fieldConverter
+}
+
+func (j *JSONLineParser) ParseLine(line string) (map[string]interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	var values map[string]interface{}
+	if err := dec.Decode(&values); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"logline": line,
+		}).Debug("failed to parse nginx JSON log line")
+		return nil, err
+	}
+	fields := make(map[string]string, len(values))
+	nested := make(map[string]interface{})
+	for k, v := range values {
+		switch v := v.(type) {
+		case string:
+			fields[k] = v
+		case json.Number:
+			fields[k] = v.String()
+		case bool:
+			fields[k] = strconv.FormatBool(v)
+		case nil:
+		default:
+			nested[k] = v
+		}
+	}
+	parsed := j.convert(fields)
+	for k, v := range nested {
+		parsed[k] = v
+	}
+	return parsed, nil
+}
+
+// EscapedLineParser parses lines logged by an escape=json format that isn't
+// a JSON object, whose values may contain escaped quotes and so on
+type EscapedLineParser struct {
+	regexp *regexp.Regexp
+	fieldConverter
+}
+
+func (e *EscapedLineParser) ParseLine(line string) (map[string]interface{}, error) {
+	match := e.regexp.FindStringSubmatch(line)
+	if match == nil {
+		logrus.WithFields(logrus.Fields{
+			"logline": line,
+		}).Debug("failed to parse nginx log line")
+		return nil, fmt.Errorf("access log line '%v' does not match given format '%v'", line, e.regexp)
+	}
+	fields := make(map[string]string, len(match))
+	for i, name := range e.regexp.SubexpNames() {
+		if i == 0 || name == "" {
+			continue
+		}
+		fields[name] = unescapeJSON(match[i])
+	}
+	return e.convert(fields), nil
+}
+
+// unescapeJSON undoes the escaping of escape=json, or returns the value as
+// is if it isn't escaped that way
+func unescapeJSON(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	var s string
+	if err := json.Unmarshal([]byte(`"`+value+`"`), &s); err != nil {
+		return value
+	}
+	return s
+}
@@ -0,0 +1,189 @@
+package nginx
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+func TestParseLogFormat(t *testing.T) {
+	testCases := []struct {
+		args     string
+		expected logFormat
+	}{
+		{
+			args:     `$remote_addr [$time_local] "$request"`,
+			expected: logFormat{format: `$remote_addr [$time_local] "$request"`, escape: escapeDefault},
+		},
+		{
+			args:     `'$remote_addr [$time_local] '` + "\n\t" + `'"$request" $status'`,
+			expected: logFormat{format: `$remote_addr [$time_local] "$request" $status`, escape: escapeDefault},
+		},
+		{
+			args:     `escape=json '{"status":"$status",' "\"uri\":\"$uri\"}"`,
+			expected: logFormat{format: `{"status":"$status","uri":"$uri"}`, escape: escapeJSON},
+		},
+		{
+			args:     `escape=none $request`,
+			expected: logFormat{format: `$request`, escape: escapeNone},
+		},
+	}
+	for _, tc := range testCases {
+		lf, err := parseLogFormat(tc.args)
+		if err != nil {
+			t.Fatalf("parseLogFormat(%s) unexpectedly returned error %v", tc.args, err)
+		}
+		if lf != tc.expected {
+			t.Errorf("parseLogFormat(%s): expected %+v, actual %+v", tc.args, tc.expected, lf)
+		}
+	}
+
+	for _, args := range []string{"", "escape=xml $status", `'$status`, `'$status' $uri`} {
+		if _, err := parseLogFormat(args); err == nil {
+			t.Errorf("parseLogFormat(%s) should err, instead got nil", args)
+		}
+	}
+}
+
+func TestReadConfigLogFormat(t *testing.T) {
+	conf := `http {
+    log_format  main  '$remote_addr - $remote_user [$time_local] "$request" '
+                      '$status; $body_bytes_sent';
+    log_format upstream escape=json
+        '{"time":"$time_iso8601",'
+        '"upstream_response_time":"$upstream_response_time"}';
+    access_log /var/log/nginx/access.log main;
+}`
+	lf, found, err := readConfigLogFormat(strings.NewReader(conf), "main")
+	if err != nil || !found {
+		t.Fatalf("expected to find main, got found %v and error %v", found, err)
+	}
+	expected := logFormat{format: `$remote_addr - $remote_user [$time_local] "$request" $status; $body_bytes_sent`, escape: escapeDefault}
+	if lf != expected {
+		t.Errorf("expected %+v, actual %+v", expected, lf)
+	}
+
+	lf, found, err = readConfigLogFormat(strings.NewReader(conf), "upstream")
+	if err != nil || !found {
+		t.Fatalf("expected to find upstream, got found %v and error %v", found, err)
+	}
+	expected = logFormat{format: `{"time":"$time_iso8601","upstream_response_time":"$upstream_response_time"}`, escape: escapeJSON}
+	if lf != expected {
+		t.Errorf("expected %+v, actual %+v", expected, lf)
+	}
+
+	if _, found, _ = readConfigLogFormat(strings.NewReader(conf), "mai"); found {
+		t.Error("found a log_format that isn't in the config")
+	}
+}
+
+func TestInitFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "nginx.conf")
+	if err := ioutil.WriteFile(conf, []byte("log_format custom '$status $request_time';\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	line := `10.0.0.1 - - [08/Oct/2015:00:26:26 +0000] "GET / HTTP/1.1" 200 612 "-" "curl/7.47.0"`
+	testCases := []struct {
+		desc    string
+		options Options
+		line    string
+		field   string
+		pass    bool
+	}{
+		{"built-in combined without a config", Options{LogFormatName: "combined"}, line, "http_user_agent", true},
+		{"built-in main without a config", Options{LogFormatName: "main"}, line + ` "10.1.1.1"`, "http_x_forwarded_for", true},
+		{"built-in combined missing from the config", Options{ConfigFile: conf, LogFormatName: "combined"}, line, "request", true},
+		{"format from the config", Options{ConfigFile: conf, LogFormatName: "custom"}, "200 0.120", "request_time", true},
+		{"inline format", Options{LogFormat: `'$status $request_time'`}, "200 0.120", "request_time", true},
+		{"unknown format without a config", Options{LogFormatName: "custom"}, "", "", false},
+		{"unknown format in the config", Options{ConfigFile: conf, LogFormatName: "nope"}, "", "", false},
+		{"missing config", Options{ConfigFile: filepath.Join(dir, "nope.conf")}, "", "", false},
+		{"unknown upstream mode", Options{LogFormatName: "combined", Upstream: "average"}, "", "", false},
+	}
+	for _, tc := range testCases {
+		p := &Parser{}
+		err := p.Init(&tc.options)
+		if (err == nil) != tc.pass {
+			t.Errorf("%s: expected Init to pass %v, got error %v", tc.desc, tc.pass, err)
+			continue
+		}
+		if !tc.pass {
+			continue
+		}
+		parsed, err := p.lineParser.ParseLine(tc.line)
+		if err != nil {
+			t.Errorf("%s: ParseLine unexpectedly returned error %v", tc.desc, err)
+			continue
+		}
+		if _, ok := parsed[tc.field]; !ok {
+			t.Errorf("%s: expected field %s in %v", tc.desc, tc.field, parsed)
+		}
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	p := &Parser{}
+	err := p.Init(&Options{
+		LogFormat:  `escape=json '{"time":"$time_iso8601","status":"$status","agent":"$http_user_agent","rt":$request_time,"upstream_response_time":"$upstream_response_time"}'`,
+		Upstream:   upstreamSum,
+		NumParsers: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make(chan string)
+	send := make(chan event.Event)
+	go func() {
+		lines <- `{"time":"2015-10-08T00:26:26+00:00","status":"502","agent":"say \"hi\"\u0001","rt":0.012,"upstream_response_time":"0.004, 0.008"}`
+		close(lines)
+	}()
+	go p.ProcessLines(lines, send, nil)
+	ev := <-send
+	expected := event.Event{
+		Timestamp: time.Date(2015, 10, 8, 0, 26, 26, 0, time.UTC),
+		Data: map[string]interface{}{
+			"status":                 int64(502),
+			"agent":                  "say \"hi\"\u0001",
+			"rt":                     0.012,
+			"upstream_response_time": 0.012,
+		},
+	}
+	if !ev.Timestamp.Equal(expected.Timestamp) || !reflect.DeepEqual(ev.Data, expected.Data) {
+		t.Fatalf("Expected: %+v, actual: %+v", expected, ev)
+	}
+}
+
+func TestEscapedFormat(t *testing.T) {
+	p := &Parser{}
+	err := p.Init(&Options{
+		LogFormat: `escape=json '$remote_addr "$request" $status "$http_user_agent"'`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := p.lineParser.ParseLine(`10.0.0.1 "GET /?q=\"x\" HTTP/1.1" 200 "Mozilla \\o/"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"remote_addr":     "10.0.0.1",
+		"request":         `GET /?q="x" HTTP/1.1`,
+		"status":          int64(200),
+		"http_user_agent": `Mozilla \o/`,
+	}
+	if !reflect.DeepEqual(parsed, expected) {
+		t.Fatalf("Expected: %v, actual: %v", expected, parsed)
+	}
+}
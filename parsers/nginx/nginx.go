@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -13,6 +12,7 @@ import (
 	"github.com/honeycombio/gonx"
 	"github.com/sirupsen/logrus"
 
+	"github.com/AIntelligenceGame/clicktail/parsers/fieldtype"
 	"github.com/honeycombio/honeytail/event"
 	"github.com/honeycombio/honeytail/httime"
 	"github.com/honeycombio/honeytail/parsers"
@@ -24,10 +24,13 @@ const (
 )
 
 type Options struct {
-	ConfigFile      string `long:"conf" description:"Path to Nginx config file"`
-	LogFormatName   string `long:"format" description:"Log format name to look for in the Nginx config file" default:"combined"`
-	TimeFieldName   string `long:"timefield" description:"Name of the field that contains a timestamp"`
-	TimeFieldFormat string `long:"time_format" description:"Timestamp format to use (strftime and Golang time.Parse supported)"`
+	ConfigFile      string   `long:"conf" description:"Path to Nginx config file. Not needed for the built-in formats (combined and main) or with log_format"`
+	LogFormatName   string   `long:"format" description:"Log format name to look for in the Nginx config file" default:"combined"`
+	LogFormat       string   `long:"log_format" description:"Log format to use instead of one from the Nginx config file, written as in a log_format directive after the name, eg. escape=json '{\"status\":\"$status\"}'"`
+	TimeFieldName   string   `long:"timefield" description:"Name of the field that contains a timestamp"`
+	TimeFieldFormat string   `long:"time_format" description:"Timestamp format to use (strftime and Golang time.Parse supported)"`
+	FieldTypes      []string `long:"field_type" description:"Type to convert a field to instead of guessing, as field:type[:arg], eg. \"remote_addr:ip\". Types are string, int, float, bool, duration (arg is the unit, default ms), ip, timestamp (arg is the format) and size (eg. 10KB, in bytes). May be specified multiple times."`
+	Upstream        string   `long:"upstream" description:"What to do with upstream_* fields listing several upstream servers: keep them as logged, split them into arrays, or sum them (the last value of upstream_status and upstream_addr)" default:"keep"`
 
 	NumParsers int `hidden:"true" description:"number of nginx parsers to spin up"`
 }
@@ -35,36 +38,76 @@ type Options struct {
 type Parser struct {
 	conf       Options
 	lineParser parsers.LineParser
+	fieldTypes fieldtype.Fields
+	// the fields of variables the log format names differently
+	varFields map[string]string
 }
 
 func (n *Parser) Init(options interface{}) error {
 	n.conf = *options.(*Options)
 
+	fieldTypes, err := fieldtype.ParseFields(n.conf.FieldTypes)
+	if err != nil {
+		return err
+	}
+	n.fieldTypes = fieldTypes
+	upstream := n.conf.Upstream
+	if upstream == "" {
+		upstream = upstreamKeep
+	}
+	if !isValidUpstreamMode(upstream) {
+		return fmt.Errorf("unknown --nginx.upstream %q, expected keep, split or sum", upstream)
+	}
+
+	lf, err := n.logFormat()
+	if err != nil {
+		return err
+	}
+	n.lineParser, n.varFields, err = newLineParser(lf, fieldConverter{
+		fieldTypes: fieldTypes,
+		upstream:   upstream,
+	})
+	return err
+}
+
+// logFormat returns the log format given with --nginx.log_format, or else
+// the one named by --nginx.format from the config file or the built-in ones
+func (n *Parser) logFormat() (logFormat, error) {
+	if n.conf.LogFormat != "" {
+		return parseLogFormat(n.conf.LogFormat)
+	}
+	builtin, isBuiltin := builtinLogFormats[n.conf.LogFormatName]
 	if n.conf.ConfigFile == "" {
-		return errors.New("missing required option --nginx.conf=<path to your Nginx config file>")
+		if !isBuiltin {
+			return logFormat{}, errors.New("missing required option --nginx.conf=<path to your Nginx config file> or --nginx.log_format=<format>, needed for formats other than combined and main")
+		}
+		return logFormat{format: builtin, escape: escapeDefault}, nil
 	}
 
 	// Verify we've got our config, find our format
 	nginxConfig, err := os.Open(n.conf.ConfigFile)
 	if err != nil {
-		return fmt.Errorf("couldn't open Nginx config file %s: %v", n.conf.ConfigFile, err)
+		return logFormat{}, fmt.Errorf("couldn't open Nginx config file %s: %v", n.conf.ConfigFile, err)
 	}
 	defer nginxConfig.Close()
-	// get the nginx log format from the config file
-	// get a nginx log parser
-	parser, err := gonx.NewNginxParser(nginxConfig, n.conf.LogFormatName)
+	lf, found, err := readConfigLogFormat(nginxConfig, n.conf.LogFormatName)
 	if err != nil {
-		return err
+		return logFormat{}, err
 	}
-	gonxParser := &GonxLineParser{
-		parser: parser,
+	if !found {
+		if !isBuiltin {
+			return logFormat{}, fmt.Errorf("`log_format %v` not found in given config", n.conf.LogFormatName)
+		}
+		// "combined" is predefined, and is the default for access_logs
+		// that lack a format name
+		return logFormat{format: builtin, escape: escapeDefault}, nil
 	}
-	n.lineParser = gonxParser
-	return nil
+	return lf, nil
 }
 
 type GonxLineParser struct {
 	parser *gonx.Parser
+	fieldConverter
 }
 
 func (g *GonxLineParser) ParseLine(line string) (map[string]interface{}, error) {
@@ -75,7 +118,7 @@ func (g *GonxLineParser) ParseLine(line string) (map[string]interface{}, error)
 		}).Debug("failed to parse nginx log line")
 		return nil, err
 	}
-	return typeifyParsedLine(gonxEvent.Fields), nil
+	return g.convert(gonxEvent.Fields), nil
 }
 
 func (n *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
@@ -96,7 +139,7 @@ func (n *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 					var prefix string
 					prefix, fields := prefixRegex.FindStringSubmatchMap(line)
 					line = strings.TrimPrefix(line, prefix)
-					prefixFields = typeifyParsedLine(fields)
+					prefixFields = typeifyParsedLine(fields, n.fieldTypes)
 				}
 
 				parsedLine, err := n.lineParser.ParseLine(line)
@@ -122,31 +165,19 @@ func (n *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 	logrus.Debug("lines channel is closed, ending nginx processor")
 }
 
-// typeifyParsedLine attempts to cast numbers in the event to floats or ints
-func typeifyParsedLine(pl map[string]string) map[string]interface{} {
-	// try to convert numbers, if possible
-	msi := make(map[string]interface{}, len(pl))
-	for k, v := range pl {
-		switch {
-		case strings.Contains(v, "."):
-			f, err := strconv.ParseFloat(v, 64)
-			if err == nil {
-				msi[k] = f
-				continue
-			}
-		case v == "-":
-			// no value, don't set a "-" string
-			continue
-		default:
-			i, err := strconv.ParseInt(v, 10, 64)
-			if err == nil {
-				msi[k] = i
-				continue
-			}
-		}
-		msi[k] = v
+// typeifyParsedLine converts fields with a configured type to it, and
+// attempts to cast numbers in the rest of the event to floats or ints
+func typeifyParsedLine(pl map[string]string, fieldTypes fieldtype.Fields) map[string]interface{} {
+	return fieldTypes.ConvertOrInfer(pl)
+}
+
+// typeifyValue returns the value of a field as its configured type, or as a
+// float or int if it's a number. ok is false for "-", which means no value.
+func typeifyValue(k, v string, fieldTypes fieldtype.Fields) (typed interface{}, ok bool) {
+	if typed, ok := fieldTypes.Convert(k, v); ok {
+		return typed, true
 	}
-	return msi
+	return fieldtype.Infer(v)
 }
 
 // tries to extract a timestamp from the log line
@@ -165,13 +196,21 @@ func (n *Parser) getTimestamp(evMap map[string]interface{}) time.Time {
 		return httime.GetTimestamp(evMap, n.conf.TimeFieldName, n.conf.TimeFieldFormat)
 	}
 
-	if _, ok := evMap["time_local"]; ok {
-		return httime.GetTimestamp(evMap, "time_local", commonLogFormatTimeLayout)
+	if field := n.varField("time_local"); evMap[field] != nil {
+		return httime.GetTimestamp(evMap, field, commonLogFormatTimeLayout)
 	}
 
-	if _, ok := evMap["time_iso8601"]; ok {
-		return httime.GetTimestamp(evMap, "time_iso8601", iso8601TimeLayout)
+	if field := n.varField("time_iso8601"); evMap[field] != nil {
+		return httime.GetTimestamp(evMap, field, iso8601TimeLayout)
 	}
 
 	return httime.GetTimestamp(evMap, "", "")
 }
+
+// varField returns the field a variable of the log format is stored in
+func (n *Parser) varField(variable string) string {
+	if field, ok := n.varFields[variable]; ok {
+		return field
+	}
+	return variable
+}
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/AIntelligenceGame/clicktail/parsers/fieldtype"
 	"github.com/honeycombio/gonx"
 	"github.com/honeycombio/honeytail/event"
 	"github.com/honeycombio/honeytail/httime"
@@ -143,12 +144,33 @@ func TestTypeifyParsedLine(t *testing.T) {
 			"negint": int64(-5),
 		},
 	}
-	res := typeifyParsedLine(tc.untyped)
+	res := typeifyParsedLine(tc.untyped, nil)
 	if !reflect.DeepEqual(res, tc.typed) {
 		t.Fatalf("Comparison failed. Expected: %v, Actual: %v", tc.typed, res)
 	}
 }
 
+func TestTypeifyParsedLineFieldTypes(t *testing.T) {
+	fieldTypes, err := fieldtype.ParseFields([]string{"request_time:float", "ver:string", "remote_addr:ip", "status:int"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := typeifyParsedLine(map[string]string{
+		"request_time": "0.099",
+		"ver":          "5",
+		"remote_addr":  "::ffff:10.252.4.24",
+		"status":       "-",
+	}, fieldTypes)
+	expected := map[string]interface{}{
+		"request_time": 0.099,
+		"ver":          "5",
+		"remote_addr":  "10.252.4.24",
+	}
+	if !reflect.DeepEqual(res, expected) {
+		t.Fatalf("Comparison failed. Expected: %v, Actual: %v", expected, res)
+	}
+}
+
 func TestGetTimestamp(t *testing.T) {
 	t1, _ := time.ParseInLocation(commonLogFormatTimeLayout, "08/Oct/2015:00:26:26 +0000", time.UTC)
 	t2, _ := time.ParseInLocation(commonLogFormatTimeLayout, "02/Jan/2010:12:34:56 -0000", time.UTC)
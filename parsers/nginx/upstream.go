@@ -0,0 +1,138 @@
+package nginx
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/AIntelligenceGame/clicktail/parsers/fieldtype"
+)
+
+// When a request is passed to several upstream servers, or redirected
+// internally, nginx logs the $upstream_* variables for each of them:
+//
+//	upstream_addr: 10.0.0.1:80, 10.0.0.2:80 : 10.0.1.1:80
+//	upstream_status: 502, 200 : 200
+//	upstream_response_time: 0.001, 0.010 : 0.002
+//
+// Commas separate the servers of a group, and colons the groups. They can be
+// kept as logged, split into arrays, or summed.
+
+const (
+	upstreamKeep  = "keep"
+	upstreamSplit = "split"
+	upstreamSum   = "sum"
+
+	upstreamPrefix    = "upstream_"
+	upstreamStatusKey = "upstream_status"
+)
+
+// addresses contain colons too, but not followed by a space
+var reUpstreamSeparator = regexp.MustCompile(`\s*,\s*|\s+:\s+`)
+
+// isValidUpstreamMode returns true for the ways we can handle upstream_*
+// fields
+func isValidUpstreamMode(mode string) bool {
+	switch mode {
+	case upstreamKeep, upstreamSplit, upstreamSum:
+		return true
+	}
+	return false
+}
+
+// fieldConverter types the fields of parsed lines
+type fieldConverter struct {
+	fieldTypes fieldtype.Fields
+	// what to do with the upstream_* fields: keep, split or sum
+	upstream string
+}
+
+func (c fieldConverter) convert(pl map[string]string) map[string]interface{} {
+	msi := typeifyParsedLine(pl, c.fieldTypes)
+	if c.upstream != upstreamSplit && c.upstream != upstreamSum {
+		return msi
+	}
+	for k, v := range pl {
+		if !strings.HasPrefix(k, upstreamPrefix) || v == "-" {
+			continue
+		}
+		if value, ok := c.upstreamValue(k, v); ok {
+			msi[k] = value
+		} else {
+			delete(msi, k)
+		}
+	}
+	return msi
+}
+
+// upstreamValue splits or sums the values of an upstream_* field. Servers
+// that didn't respond are logged as "-", which is 0 in numeric arrays and
+// left out of sums. Sums of upstream_status, or of fields that aren't
+// numbers, are the last value, from the server whose response was sent.
+func (c fieldConverter) upstreamValue(k, v string) (interface{}, bool) {
+	parts := reUpstreamSeparator.Split(v, -1)
+	values := make([]interface{}, len(parts))
+	numeric, isFloat := true, false
+	for i, part := range parts {
+		values[i], _ = typeifyValue(k, part, c.fieldTypes)
+		switch values[i].(type) {
+		case nil, int64:
+		case float64:
+			isFloat = true
+		default:
+			numeric = false
+		}
+	}
+
+	if c.upstream == upstreamSum {
+		if !numeric || k == upstreamStatusKey {
+			for i := len(values) - 1; i >= 0; i-- {
+				if values[i] != nil {
+					return values[i], true
+				}
+			}
+			return nil, false
+		}
+		var sum float64
+		for _, value := range values {
+			sum += toFloat(value)
+		}
+		if isFloat {
+			return sum, true
+		}
+		return int64(sum), true
+	}
+
+	switch {
+	case numeric && isFloat:
+		floats := make([]float64, len(values))
+		for i, value := range values {
+			floats[i] = toFloat(value)
+		}
+		return floats, true
+	case numeric:
+		ints := make([]int64, len(values))
+		for i, value := range values {
+			ints[i], _ = value.(int64)
+		}
+		return ints, true
+	}
+	strs := make([]string, len(values))
+	for i, value := range values {
+		if s, ok := value.(string); ok {
+			strs[i] = s
+		} else {
+			strs[i] = parts[i]
+		}
+	}
+	return strs, true
+}
+
+func toFloat(value interface{}) float64 {
+	switch value := value.(type) {
+	case float64:
+		return value
+	case int64:
+		return float64(value)
+	}
+	return 0
+}
@@ -0,0 +1,65 @@
+package nginx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUpstreamFields(t *testing.T) {
+	pl := map[string]string{
+		"upstream_addr":           "10.0.0.1:80, 10.0.0.2:80 : unix:/tmp/app.sock",
+		"upstream_status":         "502, 504 : 200",
+		"upstream_response_time":  "0.001, - : 0.010",
+		"upstream_bytes_received": "0, 0 : 612",
+		"upstream_cache_status":   "-",
+		"status":                  "200",
+	}
+	testCases := []struct {
+		mode     string
+		expected map[string]interface{}
+	}{
+		{
+			mode: upstreamKeep,
+			expected: map[string]interface{}{
+				"upstream_addr":           "10.0.0.1:80, 10.0.0.2:80 : unix:/tmp/app.sock",
+				"upstream_status":         "502, 504 : 200",
+				"upstream_response_time":  "0.001, - : 0.010",
+				"upstream_bytes_received": "0, 0 : 612",
+				"status":                  int64(200),
+			},
+		},
+		{
+			mode: upstreamSplit,
+			expected: map[string]interface{}{
+				"upstream_addr":           []string{"10.0.0.1:80", "10.0.0.2:80", "unix:/tmp/app.sock"},
+				"upstream_status":         []int64{502, 504, 200},
+				"upstream_response_time":  []float64{0.001, 0, 0.010},
+				"upstream_bytes_received": []int64{0, 0, 612},
+				"status":                  int64(200),
+			},
+		},
+		{
+			mode: upstreamSum,
+			expected: map[string]interface{}{
+				"upstream_addr":           "unix:/tmp/app.sock",
+				"upstream_status":         int64(200),
+				"upstream_response_time":  0.011,
+				"upstream_bytes_received": int64(612),
+				"status":                  int64(200),
+			},
+		},
+	}
+	for _, tc := range testCases {
+		res := fieldConverter{upstream: tc.mode}.convert(pl)
+		if !reflect.DeepEqual(res, tc.expected) {
+			t.Errorf("%s: Expected: %v, Actual: %v", tc.mode, tc.expected, res)
+		}
+	}
+
+	// single values are arrays too when splitting, so the columns have one
+	// type
+	res := fieldConverter{upstream: upstreamSplit}.convert(map[string]string{"upstream_status": "200"})
+	if expected := []int64{200}; !reflect.DeepEqual(res["upstream_status"], expected) {
+		t.Errorf("Expected: %v, Actual: %v", expected, res["upstream_status"])
+	}
+}
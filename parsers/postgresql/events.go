@@ -0,0 +1,245 @@
+package postgresql
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+// With --postgresql.all_events, the log statements that aren't slow queries
+// are sent too, with an event_type and whatever we can extract from them:
+//
+// 2017-11-07 01:50:02 UTC [3542-9] postgres@test LOG:  process 3542 still waiting for ShareLock on transaction 1234 after 1000.123 ms
+// 2017-11-07 01:50:02 UTC [3542-10] postgres@test DETAIL:  Process holding the lock: 3543. Wait queue: 3542.
+// 2017-11-07 01:50:02 UTC [3542-11] postgres@test STATEMENT:  UPDATE test SET value = 'baz' WHERE id = 1;
+//
+// The DETAIL, HINT, CONTEXT, STATEMENT, QUERY and LOCATION lines that follow
+// a log statement belong to it, and become the same fields as the csvlog
+// columns.
+
+const (
+	eventTypeKey = "event_type"
+
+	eventSlowQuery     = "slow_query"
+	eventPlan          = "plan"
+	eventError         = "error"
+	eventDeadlock      = "deadlock"
+	eventLockWait      = "lock_wait"
+	eventCheckpoint    = "checkpoint"
+	eventAutovacuum    = "autovacuum"
+	eventAutoanalyze   = "autoanalyze"
+	eventConnection    = "connection"
+	eventDisconnection = "disconnection"
+	eventOther         = "other"
+
+	deadlockSQLState = "40P01"
+)
+
+// secondaryLevels maps the levels of the lines that belong to the preceding
+// log statement to the field they're stored in
+var secondaryLevels = map[string]string{
+	"DETAIL":    "detail",
+	"HINT":      "hint",
+	"CONTEXT":   "context",
+	"STATEMENT": "statement",
+	"QUERY":     "internal_query",
+	"LOCATION":  "location",
+}
+
+// eventPattern recognises a type of log statement by its message. The named
+// groups of the regex become fields.
+type eventPattern struct {
+	eventType string
+	re        *parsers.ExtRegexp
+}
+
+func newEventPattern(eventType, re string) eventPattern {
+	return eventPattern{eventType, &parsers.ExtRegexp{regexp.MustCompile(re)}}
+}
+
+var eventPatterns = []eventPattern{
+	newEventPattern(eventCheckpoint, `^(?:checkpoint|restartpoint) starting: (?P<checkpoint_reason>.+)`),
+	newEventPattern(eventCheckpoint, `^(?:checkpoint|restartpoint) complete: wrote (?P<buffers_written>\d+) buffers \((?P<buffers_written_percent>[0-9.]+)%\); (?P<wal_files_added>\d+) (?:WAL|transaction log) file\(s\) added, (?P<wal_files_removed>\d+) removed, (?P<wal_files_recycled>\d+) recycled; write=(?P<write_time>[0-9.]+) s, sync=(?P<sync_time>[0-9.]+) s, total=(?P<total_time>[0-9.]+) s; sync files=(?P<sync_files>\d+), longest=(?P<sync_longest>[0-9.]+) s, average=(?P<sync_average>[0-9.]+) s(?:; distance=(?P<distance_kb>\d+) kB, estimate=(?P<estimate_kb>\d+) kB)?`),
+	newEventPattern(eventAutovacuum, `^automatic (?:aggressive )?vacuum (?:to prevent wraparound )?of table "(?P<relation>[^"]+)": index scans: (?P<index_scans>\d+)`),
+	newEventPattern(eventAutoanalyze, `^automatic analyze of table "(?P<relation>[^"]+)"`),
+	newEventPattern(eventLockWait, `^process (?P<waiting_pid>\d+) (?P<lock_state>still waiting|acquired)(?: for)? (?P<lock_mode>\S+) on (?P<lock_object>.+?) after (?P<lock_wait_time>[0-9.]+) ms`),
+	newEventPattern(eventDeadlock, `^deadlock detected`),
+	newEventPattern(eventConnection, `^connection received: host=(?P<host>\S+)(?: port=(?P<port>\d+))?`),
+	newEventPattern(eventConnection, `^connection authorized: user=(?P<user>\S+)(?: database=(?P<database>\S+))?(?: application_name=(?P<application>\S+))?`),
+	newEventPattern(eventDisconnection, `^disconnection: session time: (?P<session_time>[0-9:.]+) user=(?P<user>\S+) database=(?P<database>\S+) host=(?P<host>\S+)(?: port=(?P<port>\d+))?`),
+}
+
+// vacuumPatterns match the statistics on the lines following an autovacuum
+// or autoanalyze message
+var vacuumPatterns = []*parsers.ExtRegexp{
+	{regexp.MustCompile(`pages: (?P<pages_removed>\d+) removed, (?P<pages_remain>\d+) remain`)},
+	{regexp.MustCompile(`tuples: (?P<tuples_removed>\d+) removed, (?P<tuples_remain>\d+) remain, (?P<tuples_dead>\d+) are dead but not yet removable`)},
+	{regexp.MustCompile(`buffer usage: (?P<buffer_hits>\d+) hits, (?P<buffer_misses>\d+) (?:misses|reads), (?P<buffer_dirtied>\d+) dirtied`)},
+	{regexp.MustCompile(`avg read rate: (?P<avg_read_rate_mbs>[0-9.]+) MB/s, avg write rate: (?P<avg_write_rate_mbs>[0-9.]+) MB/s`)},
+	{regexp.MustCompile(`elapsed: (?P<elapsed>[0-9.]+) s`)},
+}
+
+var (
+	// Process holding the lock: 3543. Wait queue: 3542.
+	reLockHolders = regexp.MustCompile(`Process(?:es)? holding the lock: ([0-9, ]+)\.`)
+	// Process 3542 waits for ShareLock on transaction 1235; blocked by process 3543.
+	reDeadlockProcess = regexp.MustCompile(`Process (\d+) waits for`)
+)
+
+// stringFields are the extracted fields that are never converted to numbers
+var stringFields = map[string]bool{
+	"checkpoint_reason": true,
+	"relation":          true,
+	"lock_state":        true,
+	"lock_mode":         true,
+	"lock_object":       true,
+	"host":              true,
+	"user":              true,
+	"database":          true,
+	"application":       true,
+}
+
+// isSecondaryLine returns true if the line is a DETAIL, HINT etc. line that
+// belongs to the preceding log statement
+func (p *Parser) isSecondaryLine(line string) bool {
+	_, ok := p.secondaryField(line)
+	return ok
+}
+
+// secondaryField returns the field a DETAIL, HINT etc. line is stored in,
+// and the rest of the line
+func (p *Parser) secondaryField(line string) (string, bool) {
+	match, suffix, _ := parsePrefix(p.pgPrefixRegex, line)
+	if !match {
+		return "", false
+	}
+	match, _, meta := parsePrefix(levelHeaderRegex, suffix)
+	if !match {
+		return "", false
+	}
+	field, ok := secondaryLevels[meta["level"]]
+	return field, ok
+}
+
+// splitSections separates the continuation lines of the log statement from
+// the DETAIL, HINT etc. lines that followed it, which are returned by field.
+func (p *Parser) splitSections(lines []string) ([]string, map[string]string) {
+	var main []string
+	sections := make(map[string]string)
+	current := ""
+	for _, line := range lines {
+		if field, ok := p.secondaryField(line); ok {
+			_, suffix, _ := parsePrefix(p.pgPrefixRegex, line)
+			_, text, _ := parsePrefix(levelHeaderRegex, suffix)
+			if prev, ok := sections[field]; ok {
+				text = prev + "\n" + text
+			}
+			sections[field] = text
+			current = field
+			continue
+		}
+		if current == "" {
+			main = append(main, line)
+		} else {
+			sections[current] += "\n" + strings.TrimPrefix(line, "\t")
+		}
+	}
+	return main, sections
+}
+
+// handleLogEvent fills in an event for a log statement that isn't a slow
+// query
+func (p *Parser) handleLogEvent(ev *event.Event, message string, lines []string) *event.Event {
+	full := message
+	for _, line := range lines {
+		full += "\n" + strings.TrimPrefix(line, "\t")
+	}
+	ev.Data[messageKey] = full
+
+	eventType := ""
+	for _, pattern := range eventPatterns {
+		if _, fields := pattern.re.FindStringSubmatchMap(message); fields != nil {
+			eventType = pattern.eventType
+			addExtractedFields(ev, fields)
+			break
+		}
+	}
+	switch eventType {
+	case eventAutovacuum, eventAutoanalyze:
+		for _, re := range vacuumPatterns {
+			if _, fields := re.FindStringSubmatchMap(full); fields != nil {
+				addExtractedFields(ev, fields)
+			}
+		}
+	case eventLockWait:
+		if detail, ok := ev.Data["detail"].(string); ok {
+			if m := reLockHolders.FindStringSubmatch(detail); m != nil {
+				ev.Data["blocking_pids"] = m[1]
+			}
+		}
+	case eventDeadlock:
+		if _, ok := ev.Data["sql_state"]; !ok {
+			ev.Data["sql_state"] = deadlockSQLState
+		}
+		if detail, ok := ev.Data["detail"].(string); ok {
+			var pids []string
+			for _, m := range reDeadlockProcess.FindAllStringSubmatch(detail, -1) {
+				pids = append(pids, m[1])
+			}
+			if len(pids) > 0 {
+				ev.Data["deadlock_pids"] = strings.Join(pids, ", ")
+			}
+		}
+	case "":
+		switch ev.Data["severity"] {
+		case "ERROR", "FATAL", "PANIC":
+			eventType = eventError
+		default:
+			eventType = eventOther
+		}
+	}
+	ev.Data[eventTypeKey] = eventType
+	return ev
+}
+
+// addExtractedFields adds the fields extracted from a message, as numbers
+// where they look like numbers
+func addExtractedFields(ev *event.Event, fields map[string]string) {
+	for k, v := range fields {
+		if v == "" {
+			continue
+		}
+		switch {
+		case stringFields[k]:
+			ev.Data[k] = v
+		case k == "session_time":
+			ev.Data[k] = parseSessionTime(v)
+		default:
+			if i, err := strconv.Atoi(v); err == nil {
+				ev.Data[k] = i
+			} else if f, err := strconv.ParseFloat(v, 64); err == nil {
+				ev.Data[k] = f
+			} else {
+				ev.Data[k] = v
+			}
+		}
+	}
+}
+
+// parseSessionTime converts a session time like 0:00:05.123 to seconds
+func parseSessionTime(v string) interface{} {
+	parts := strings.Split(v, ":")
+	if len(parts) != 3 {
+		return v
+	}
+	hours, err1 := strconv.Atoi(parts[0])
+	minutes, err2 := strconv.Atoi(parts[1])
+	seconds, err3 := strconv.ParseFloat(parts[2], 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return v
+	}
+	return float64(hours*3600+minutes*60) + seconds
+}
@@ -0,0 +1,118 @@
+package postgresql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllEvents(t *testing.T) {
+	in := `2017-11-07 01:50:00 UTC [3542-1] postgres@test LOG:  connection authorized: user=postgres database=test application_name=psql
+2017-11-07 01:50:02 UTC [3542-9] postgres@test LOG:  process 3542 still waiting for ShareLock on transaction 1234 after 1000.123 ms
+2017-11-07 01:50:02 UTC [3542-10] postgres@test DETAIL:  Process holding the lock: 3543. Wait queue: 3542.
+2017-11-07 01:50:02 UTC [3542-11] postgres@test STATEMENT:  UPDATE test SET value = 'baz'
+	WHERE id = 1;
+2017-11-07 01:50:03 UTC [3542-12] postgres@test ERROR:  deadlock detected
+2017-11-07 01:50:03 UTC [3542-13] postgres@test DETAIL:  Process 3542 waits for ShareLock on transaction 1235; blocked by process 3543.
+	Process 3543 waits for ShareLock on transaction 1234; blocked by process 3542.
+	Process 3542: UPDATE test SET value = 'baz' WHERE id = 1;
+2017-11-07 01:50:03 UTC [3542-14] postgres@test HINT:  See server log for query details.
+2017-11-07 01:50:04 UTC [3542-15] postgres@test ERROR:  relation "nope" does not exist at character 15
+2017-11-07 01:50:04 UTC [3542-16] postgres@test STATEMENT:  SELECT * FROM nope;
+2017-11-07 01:50:05 UTC [3542-17] postgres@test LOG:  duration: 0.501 ms  statement: SELECT 1;
+2017-11-07 01:55:00 UTC [1020-1] LOG:  checkpoint starting: time
+2017-11-07 01:55:24 UTC [1020-2] LOG:  checkpoint complete: wrote 245 buffers (1.5%); 0 WAL file(s) added, 0 removed, 1 recycled; write=24.431 s, sync=0.003 s, total=24.451 s; sync files=43, longest=0.001 s, average=0.001 s; distance=1985 kB, estimate=2035 kB
+2017-11-07 01:56:00 UTC [2041-1] LOG:  automatic vacuum of table "test.public.test": index scans: 1
+	pages: 0 removed, 5 remain, 0 skipped due to pins, 0 skipped frozen
+	tuples: 10 removed, 100 remain, 2 are dead but not yet removable, oldest xmin: 1234
+	buffer usage: 57 hits, 1 misses, 3 dirtied
+	avg read rate: 0.125 MB/s, avg write rate: 0.375 MB/s
+	system usage: CPU: user: 0.00 s, system: 0.00 s, elapsed: 0.06 s
+2017-11-07 01:57:00 UTC [3542-18] postgres@test LOG:  disconnection: session time: 0:07:00.512 user=postgres database=test host=[local]
+2017-11-07 01:57:01 UTC [11534-2] LOG:  autovacuum launcher shutting down`
+	prefix := "%t [%p-%l] %q%u@%d"
+	events := processLines(t, &Options{LogLinePrefix: prefix, AllEvents: true}, in)
+	assert.Equal(t, 10, len(events))
+	for _, ev := range events {
+		assert.NotEmpty(t, ev.Data["severity"])
+	}
+
+	data := events[0].Data
+	assert.Equal(t, "connection", data["event_type"])
+	assert.Equal(t, "psql", data["application"])
+
+	data = events[1].Data
+	assert.Equal(t, "lock_wait", data["event_type"])
+	assert.Equal(t, 3542, data["waiting_pid"])
+	assert.Equal(t, "still waiting", data["lock_state"])
+	assert.Equal(t, "ShareLock", data["lock_mode"])
+	assert.Equal(t, "transaction 1234", data["lock_object"])
+	assert.Equal(t, 1000.123, data["lock_wait_time"])
+	assert.Equal(t, "3543", data["blocking_pids"])
+	assert.Equal(t, "UPDATE test SET value = 'baz'\nWHERE id = 1;", data["statement"])
+
+	data = events[2].Data
+	assert.Equal(t, "deadlock", data["event_type"])
+	assert.Equal(t, "ERROR", data["severity"])
+	assert.Equal(t, "40P01", data["sql_state"])
+	assert.Equal(t, "3542, 3543", data["deadlock_pids"])
+	assert.Equal(t, "See server log for query details.", data["hint"])
+
+	data = events[3].Data
+	assert.Equal(t, "error", data["event_type"])
+	assert.Equal(t, `relation "nope" does not exist at character 15`, data["message"])
+	assert.Equal(t, "SELECT * FROM nope;", data["statement"])
+
+	data = events[4].Data
+	assert.Equal(t, "slow_query", data["event_type"])
+	assert.Equal(t, 0.501, data["query_time"])
+
+	data = events[5].Data
+	assert.Equal(t, "checkpoint", data["event_type"])
+	assert.Equal(t, "time", data["checkpoint_reason"])
+
+	data = events[6].Data
+	assert.Equal(t, "checkpoint", data["event_type"])
+	assert.Equal(t, 245, data["buffers_written"])
+	assert.Equal(t, 24.451, data["total_time"])
+	assert.Equal(t, 43, data["sync_files"])
+	assert.Equal(t, 1985, data["distance_kb"])
+
+	data = events[7].Data
+	assert.Equal(t, "autovacuum", data["event_type"])
+	assert.Equal(t, "test.public.test", data["relation"])
+	assert.Equal(t, 1, data["index_scans"])
+	assert.Equal(t, 10, data["tuples_removed"])
+	assert.Equal(t, 2, data["tuples_dead"])
+	assert.Equal(t, 57, data["buffer_hits"])
+	assert.Equal(t, 1, data["buffer_misses"])
+	assert.Equal(t, 0.375, data["avg_write_rate_mbs"])
+	assert.Equal(t, 0.06, data["elapsed"])
+
+	data = events[8].Data
+	assert.Equal(t, "disconnection", data["event_type"])
+	assert.Equal(t, 420.512, data["session_time"])
+	assert.Equal(t, "[local]", data["host"])
+
+	data = events[9].Data
+	assert.Equal(t, "other", data["event_type"])
+	assert.Equal(t, "autovacuum launcher shutting down", data["message"])
+	assert.Nil(t, data["user"])
+
+	// without the option only the slow query is sent
+	events = processLines(t, &Options{LogLinePrefix: prefix}, in)
+	assert.Equal(t, 1, len(events))
+	assert.Nil(t, events[0].Data["event_type"])
+}
+
+func TestAllEventsCSVLog(t *testing.T) {
+	in := `2017-11-07 01:43:40.001 UTC,"postgres","test",3542,"[local]",5a0107ca.dd6,8,"idle",2017-11-07 01:43:38 UTC,3/0,0,ERROR,42P01,"relation ""nope"" does not exist",,,,,,"SELECT * FROM nope;",15,"parserOpenTable, parse_relation.c:1384","psql","client backend",,0`
+	events := processLines(t, &Options{Format: "csvlog", AllEvents: true}, in)
+	assert.Equal(t, 1, len(events))
+	data := events[0].Data
+	assert.Equal(t, "error", data["event_type"])
+	assert.Equal(t, "42P01", data["sql_state"])
+	assert.Equal(t, "SELECT * FROM nope;", data["statement"])
+	assert.Equal(t, 15, data["query_position"])
+	assert.Equal(t, "parserOpenTable, parse_relation.c:1384", data["location"])
+}
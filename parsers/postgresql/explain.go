@@ -0,0 +1,212 @@
+package postgresql
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/parsers"
+	"github.com/sirupsen/logrus"
+)
+
+// auto_explain logs the plan of slow queries instead of the statement, in
+// text:
+//
+// 2017-11-07 01:43:39 UTC [3542-7] postgres@test LOG:  duration: 15.577 ms  plan:
+//	Query Text: SELECT * FROM test WHERE id=1;
+//	Index Scan using test_pkey on test  (cost=0.15..8.17 rows=1 width=68) (actual time=0.011..0.012 rows=1 loops=1)
+//	  Index Cond: (id = 1)
+//
+// or JSON format:
+//
+// 2017-11-07 01:43:39 UTC [3542-7] postgres@test LOG:  duration: 15.577 ms  plan:
+//	{
+//	  "Query Text": "SELECT * FROM test WHERE id=1;",
+//	  "Plan": {
+//	    "Node Type": "Index Scan",
+//	    ...
+//	  }
+//	}
+
+const (
+	// Regex string that matches the header of an auto_explain message
+	planHeader = `^duration: (?P<duration>[0-9\.]+) ms\s+plan:\s*`
+
+	queryTextPrefix = "Query Text: "
+
+	planFormatText = "text"
+	planFormatJSON = "json"
+)
+
+var (
+	planHeaderRegex = &parsers.ExtRegexp{regexp.MustCompile(planHeader)}
+	// the estimates and, with ANALYZE, the actuals of a node in a text plan
+	rePlanCost   = regexp.MustCompile(`\(cost=[0-9.]+\.\.(?P<total>[0-9.]+) rows=(?P<rows>[0-9]+) width=[0-9]+\)`)
+	rePlanActual = regexp.MustCompile(`\(actual time=[0-9.]+\.\.[0-9.]+ rows=(?P<rows>[0-9]+) loops=[0-9]+\)`)
+)
+
+// planSummary is what we extract from a plan, whatever its format
+type planSummary struct {
+	format     string
+	query      string
+	plan       string
+	totalCost  *float64
+	rows       *int64
+	actualRows *int64
+	nodeTypes  []string
+}
+
+// addPlanFields adds the plan and what we extracted from it to the event
+func (s *planSummary) addPlanFields(ev *event.Event) {
+	ev.Data["plan"] = s.plan
+	ev.Data["plan_format"] = s.format
+	if s.totalCost != nil {
+		ev.Data["plan_total_cost"] = *s.totalCost
+	}
+	if s.rows != nil {
+		ev.Data["plan_rows"] = *s.rows
+	}
+	if s.actualRows != nil {
+		ev.Data["plan_actual_rows"] = *s.actualRows
+	}
+	if len(s.nodeTypes) > 0 {
+		ev.Data["plan_node_types"] = strings.Join(s.nodeTypes, ", ")
+	}
+}
+
+// parsePlan parses the plan auto_explain logged. first is whatever followed
+// "plan:" on the first line and lines are the continuation lines.
+func parsePlan(first string, lines []string) *planSummary {
+	planLines := make([]string, 0, len(lines)+1)
+	if strings.TrimSpace(first) != "" {
+		planLines = append(planLines, first)
+	}
+	for _, line := range lines {
+		// continuation lines are indented with a tab
+		planLines = append(planLines, strings.TrimPrefix(line, "\t"))
+	}
+	for len(planLines) > 0 && strings.TrimSpace(planLines[len(planLines)-1]) == "" {
+		planLines = planLines[:len(planLines)-1]
+	}
+	if len(planLines) == 0 {
+		return nil
+	}
+	if strings.HasPrefix(strings.TrimSpace(planLines[0]), "{") {
+		return parseJSONPlan(strings.Join(planLines, "\n"))
+	}
+	return parseTextPlan(planLines)
+}
+
+func parseTextPlan(lines []string) *planSummary {
+	s := &planSummary{format: planFormatText}
+	var query []string
+	var plan []string
+	seen := map[string]bool{}
+	inQuery := false
+	for _, line := range lines {
+		if strings.HasPrefix(line, queryTextPrefix) {
+			inQuery = true
+			query = append(query, strings.TrimPrefix(line, queryTextPrefix))
+			continue
+		}
+		nodeType, isNode := planNodeType(line)
+		if inQuery && !isNode {
+			// the query may span lines too
+			query = append(query, strings.TrimLeft(line, " \t"))
+			continue
+		}
+		inQuery = false
+		plan = append(plan, line)
+		if !isNode {
+			continue
+		}
+		if !seen[nodeType] {
+			seen[nodeType] = true
+			s.nodeTypes = append(s.nodeTypes, nodeType)
+		}
+		// the first node is the top of the plan, and has the totals
+		if s.totalCost == nil && s.actualRows == nil {
+			if m := rePlanCost.FindStringSubmatch(line); m != nil {
+				if cost, err := strconv.ParseFloat(m[1], 64); err == nil {
+					s.totalCost = &cost
+				}
+				if rows, err := strconv.ParseInt(m[2], 10, 64); err == nil {
+					s.rows = &rows
+				}
+			}
+			if m := rePlanActual.FindStringSubmatch(line); m != nil {
+				if rows, err := strconv.ParseInt(m[1], 10, 64); err == nil {
+					s.actualRows = &rows
+				}
+			}
+		}
+	}
+	s.query = strings.Join(query, " ")
+	s.plan = strings.Join(plan, "\n")
+	return s
+}
+
+// planNodeType returns the node type of a line of a text plan, eg "Index
+// Scan" for "->  Index Scan using test_pkey on test  (cost=...)"
+func planNodeType(line string) (string, bool) {
+	end := strings.Index(line, "  (cost=")
+	if end < 0 {
+		end = strings.Index(line, "  (actual ")
+	}
+	if end < 0 {
+		return "", false
+	}
+	node := strings.TrimSpace(line[:end])
+	node = strings.TrimSpace(strings.TrimPrefix(node, "->"))
+	for _, sep := range []string{" using ", " on "} {
+		if i := strings.Index(node, sep); i >= 0 {
+			node = node[:i]
+		}
+	}
+	return node, node != ""
+}
+
+func parseJSONPlan(text string) *planSummary {
+	s := &planSummary{format: planFormatJSON, plan: text}
+	var explain struct {
+		QueryText string                 `json:"Query Text"`
+		Plan      map[string]interface{} `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(text), &explain); err != nil {
+		logrus.WithError(err).Debug("failed to parse JSON plan")
+		return s
+	}
+	s.query = explain.QueryText
+	if explain.Plan == nil {
+		return s
+	}
+	if cost, ok := explain.Plan["Total Cost"].(float64); ok {
+		s.totalCost = &cost
+	}
+	if rows, ok := explain.Plan["Plan Rows"].(float64); ok {
+		r := int64(rows)
+		s.rows = &r
+	}
+	if rows, ok := explain.Plan["Actual Rows"].(float64); ok {
+		r := int64(rows)
+		s.actualRows = &r
+	}
+	seen := map[string]bool{}
+	var walk func(node map[string]interface{})
+	walk = func(node map[string]interface{}) {
+		if nodeType, ok := node["Node Type"].(string); ok && !seen[nodeType] {
+			seen[nodeType] = true
+			s.nodeTypes = append(s.nodeTypes, nodeType)
+		}
+		children, _ := node["Plans"].([]interface{})
+		for _, child := range children {
+			if c, ok := child.(map[string]interface{}); ok {
+				walk(c)
+			}
+		}
+	}
+	walk(explain.Plan)
+	return s
+}
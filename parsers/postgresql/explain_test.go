@@ -0,0 +1,102 @@
+package postgresql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	textPlan = `2017-11-07 01:43:39 UTC [3542-7] postgres@test LOG:  duration: 15.577 ms  plan:
+	Query Text: SELECT * FROM test t
+	  JOIN other o ON o.id = t.other_id WHERE t.id = 1;
+	Nested Loop  (cost=0.30..16.35 rows=1 width=72) (actual time=0.021..0.023 rows=1 loops=1)
+	  ->  Index Scan using test_pkey on test t  (cost=0.15..8.17 rows=1 width=68) (actual time=0.011..0.012 rows=1 loops=1)
+	        Index Cond: (id = 1)
+	  ->  Index Scan using other_pkey on other o  (cost=0.15..8.17 rows=1 width=4) (actual time=0.005..0.005 rows=1 loops=1)
+	        Index Cond: (id = t.other_id)`
+
+	jsonPlan = `2017-11-07 01:43:40 UTC [3542-8] postgres@test LOG:  duration: 2.001 ms  plan:
+	{
+	  "Query Text": "SELECT count(*) FROM test;",
+	  "Plan": {
+	    "Node Type": "Aggregate",
+	    "Startup Cost": 25.88,
+	    "Total Cost": 25.89,
+	    "Plan Rows": 1,
+	    "Actual Rows": 1,
+	    "Plans": [
+	      {
+	        "Node Type": "Seq Scan",
+	        "Relation Name": "test",
+	        "Total Cost": 22.70,
+	        "Plan Rows": 1270,
+	        "Actual Rows": 1000
+	      }
+	    ]
+	  }
+	}`
+)
+
+func TestPlanParsing(t *testing.T) {
+	p := Parser{}
+	p.Init(&Options{LogLinePrefix: "%t [%p-%l] %u@%d"})
+
+	ev := p.handleEvent(strings.Split(textPlan, "\n"))
+	assert.NotNil(t, ev)
+	assert.Equal(t, 15.577, ev.Data["query_time"])
+	assert.Equal(t, "text", ev.Data["plan_format"])
+	assert.Equal(t, 16.35, ev.Data["plan_total_cost"])
+	assert.Equal(t, int64(1), ev.Data["plan_rows"])
+	assert.Equal(t, int64(1), ev.Data["plan_actual_rows"])
+	assert.Equal(t, "Nested Loop, Index Scan", ev.Data["plan_node_types"])
+	assert.Equal(t, "SELECT * FROM test t JOIN other o ON o.id = t.other_id WHERE t.id = 1;", ev.Data["query"])
+	assert.True(t, strings.HasPrefix(ev.Data["plan"].(string), "Nested Loop  (cost=0.30..16.35"))
+	assert.True(t, strings.HasSuffix(ev.Data["plan"].(string), "Index Cond: (id = t.other_id)"))
+
+	ev = p.handleEvent(strings.Split(jsonPlan, "\n"))
+	assert.NotNil(t, ev)
+	assert.Equal(t, 2.001, ev.Data["query_time"])
+	assert.Equal(t, "json", ev.Data["plan_format"])
+	assert.Equal(t, 25.89, ev.Data["plan_total_cost"])
+	assert.Equal(t, int64(1), ev.Data["plan_rows"])
+	assert.Equal(t, int64(1), ev.Data["plan_actual_rows"])
+	assert.Equal(t, "Aggregate, Seq Scan", ev.Data["plan_node_types"])
+	assert.Equal(t, "SELECT count(*) FROM test;", ev.Data["query"])
+
+	// plans without ANALYZE don't have actual rows
+	ev = p.handleEvent([]string{
+		"2017-11-07 01:43:41 UTC [3542-9] postgres@test LOG:  duration: 1.000 ms  plan:",
+		"\tQuery Text: SELECT 1",
+		"\tResult  (cost=0.00..0.01 rows=1 width=4)",
+	})
+	assert.NotNil(t, ev)
+	assert.Equal(t, 0.01, ev.Data["plan_total_cost"])
+	assert.Nil(t, ev.Data["plan_actual_rows"])
+	assert.Equal(t, "Result", ev.Data["plan_node_types"])
+}
+
+func TestPlanGrouping(t *testing.T) {
+	p := Parser{}
+	p.Init(&Options{LogLinePrefix: "%t [%p-%l] %u@%d"})
+	lines := make(chan string)
+	send := make(chan event.Event, 10)
+	go func() {
+		for _, line := range strings.Split(jsonPlan, "\n") {
+			// some log shippers strip the leading tab
+			lines <- strings.TrimPrefix(line, "\t")
+		}
+		lines <- "2017-11-07 01:43:42 UTC [3542-10] postgres@test LOG:  duration: 0.500 ms  statement: SELECT 2;"
+		close(lines)
+	}()
+	p.ProcessLines(lines, send, nil)
+	close(send)
+
+	var queries []interface{}
+	for ev := range send {
+		queries = append(queries, ev.Data["query"])
+	}
+	assert.Equal(t, []interface{}{"SELECT count(*) FROM test;", "SELECT 2;"}, queries)
+}
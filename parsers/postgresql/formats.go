@@ -0,0 +1,189 @@
+package postgresql
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/sirupsen/logrus"
+)
+
+// Besides the stderr format described in the package comment, Postgres can
+// write its log as CSV (log_destination = 'csvlog'), where fields may be
+// quoted and span lines:
+//
+// 2017-11-07 01:43:39.314 UTC,"postgres","test",3542,"[local]",5a0107ca.dd6,7,"SELECT",2017-11-07 01:43:38 UTC,3/0,0,LOG,00000,"duration: 15.577 ms  statement: SELECT *
+// FROM test;",,,,,,,,,"psql","client backend"
+//
+// or, from Postgres 15, as JSON (log_destination = 'jsonlog'):
+//
+// {"timestamp":"2022-10-13 09:54:19.123 UTC","user":"postgres","dbname":"test","pid":3542,"error_severity":"LOG","message":"duration: 15.577 ms  statement: SELECT * FROM test;"}
+//
+// Both carry what the stderr format puts in the prefix as separate fields,
+// so log_line_prefix isn't used for them.
+
+const (
+	formatStderr  = "stderr"
+	formatCSVLog  = "csvlog"
+	formatJSONLog = "jsonlog"
+
+	messageKey = "message"
+)
+
+// csvlogColumns are the field names of the csvlog columns, in order. Older
+// versions of Postgres write fewer columns.
+var csvlogColumns = []string{
+	"timestamp_millis",        // log_time
+	"user",                    // user_name
+	"database",                // database_name
+	"pid",                     // process_id
+	"host_port",               // connection_from
+	"session_id",              // session_id
+	"session_line_number",     // session_line_num
+	"command_tag",             // command_tag
+	"session_start",           // session_start_time
+	"virtual_transaction_id",  // virtual_transaction_id
+	"transaction_id",          // transaction_id
+	"severity",                // error_severity
+	"sql_state",               // sql_state_code
+	messageKey,                // message
+	"detail",                  // detail
+	"hint",                    // hint
+	"internal_query",          // internal_query
+	"internal_query_position", // internal_query_pos
+	"context",                 // context
+	"statement",               // query
+	"query_position",          // query_pos
+	"location",                // location
+	"application",             // application_name
+	"backend_type",            // backend_type
+	"leader_pid",              // leader_pid
+	"query_id",                // query_id
+}
+
+// csvlogMinColumns is the number of columns up to and including the message
+const csvlogMinColumns = 14
+
+// jsonlogKeys maps the jsonlog keys to the same field names as csvlog
+var jsonlogKeys = map[string]string{
+	"timestamp":         "timestamp_millis",
+	"user":              "user",
+	"dbname":            "database",
+	"pid":               "pid",
+	"remote_host":       "host",
+	"session_id":        "session_id",
+	"line_num":          "session_line_number",
+	"ps":                "command_tag",
+	"session_start":     "session_start",
+	"vxid":              "virtual_transaction_id",
+	"txid":              "transaction_id",
+	"error_severity":    "severity",
+	"state_code":        "sql_state",
+	"message":           messageKey,
+	"detail":            "detail",
+	"hint":              "hint",
+	"internal_query":    "internal_query",
+	"internal_position": "internal_query_position",
+	"context":           "context",
+	"statement":         "statement",
+	"cursor_position":   "query_position",
+	"application_name":  "application",
+	"backend_type":      "backend_type",
+	"leader_pid":        "leader_pid",
+	"query_id":          "query_id",
+}
+
+// isValidFormat returns true for the log formats we can read
+func isValidFormat(format string) bool {
+	switch format {
+	case formatStderr, formatCSVLog, formatJSONLog:
+		return true
+	}
+	return false
+}
+
+// handleCSVLog parses a single, possibly multi-line, csvlog record
+func (p *Parser) handleCSVLog(record string) *event.Event {
+	r := csv.NewReader(strings.NewReader(record))
+	r.FieldsPerRecord = -1
+	columns, err := r.Read()
+	if err != nil {
+		logrus.WithError(err).WithField("record", record).Debug("failed to parse csvlog record, skipping")
+		return nil
+	}
+	if len(columns) < csvlogMinColumns {
+		logrus.WithField("record", record).Debug("csvlog record has too few columns, skipping")
+		return nil
+	}
+	fields := make(map[string]string, len(columns))
+	for i, v := range columns {
+		if i < len(csvlogColumns) && v != "" {
+			fields[csvlogColumns[i]] = v
+		}
+	}
+	return p.handleLogRecord(fields)
+}
+
+// handleJSONLog parses a single jsonlog line
+func (p *Parser) handleJSONLog(line string) *event.Event {
+	// keep numbers as they're written, so 64 bit ones such as query_id
+	// don't lose precision as floats
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+	var record map[string]interface{}
+	if err := decoder.Decode(&record); err != nil {
+		logrus.WithError(err).WithField("line", line).Debug("failed to parse jsonlog line, skipping")
+		return nil
+	}
+	fields := make(map[string]string, len(record))
+	for k, v := range record {
+		var value string
+		switch v := v.(type) {
+		case string:
+			value = v
+		case json.Number:
+			value = v.String()
+		case bool:
+			value = strconv.FormatBool(v)
+		}
+		if name, ok := jsonlogKeys[k]; ok && value != "" {
+			fields[name] = value
+		}
+	}
+	if host, ok := fields["host"]; ok {
+		if port, ok := record["remote_port"].(json.Number); ok {
+			fields["host_port"] = host + ":" + port.String()
+		}
+	}
+	// the csvlog location column is "func, file:line"
+	if file, ok := record["file_name"].(string); ok {
+		location := file
+		if line, ok := record["file_line_num"].(json.Number); ok {
+			location += ":" + line.String()
+		}
+		if fn, ok := record["func_name"].(string); ok {
+			location = fn + ", " + location
+		}
+		fields["location"] = location
+	}
+	return p.handleLogRecord(fields)
+}
+
+// handleLogRecord builds an event from the fields of a csvlog or jsonlog
+// record, whose message is parsed the same way as in the stderr format.
+func (p *Parser) handleLogRecord(fields map[string]string) *event.Event {
+	message, ok := fields[messageKey]
+	if !ok {
+		return nil
+	}
+	delete(fields, messageKey)
+
+	ev := &event.Event{
+		Data: make(map[string]interface{}, len(fields)),
+	}
+	p.addFieldsToEvent(fields, ev)
+	lines := strings.Split(message, "\n")
+	return p.handleMessage(ev, lines[0], lines[1:])
+}
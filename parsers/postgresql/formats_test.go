@@ -0,0 +1,97 @@
+package postgresql
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/stretchr/testify/assert"
+)
+
+func processLines(t *testing.T, options *Options, in string) []event.Event {
+	p := Parser{}
+	assert.Nil(t, p.Init(options))
+	lines := make(chan string)
+	send := make(chan event.Event, 10)
+	go func() {
+		for _, line := range strings.Split(in, "\n") {
+			lines <- line
+		}
+		close(lines)
+	}()
+	p.ProcessLines(lines, send, nil)
+	close(send)
+	var events []event.Event
+	for ev := range send {
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestCSVLog(t *testing.T) {
+	in := `2017-11-07 01:43:39.314 UTC,"postgres","test",3542,"[local]",5a0107ca.dd6,7,"SELECT",2017-11-07 01:43:38 UTC,3/0,0,LOG,00000,"duration: 15.577 ms  statement: SELECT ""id""
+FROM test;",,,,,,,,,"psql","client backend",,-3225081473187395431
+2017-11-07 01:43:40.001 UTC,"postgres","test",3542,"[local]",5a0107ca.dd6,8,"idle",2017-11-07 01:43:38 UTC,3/0,0,ERROR,42P01,"relation ""nope"" does not exist",,,,,,"SELECT * FROM nope;",15,,"psql","client backend",,0
+2017-11-07 01:43:41.000 UTC,"postgres","test",3542,"10.0.0.1:51234",5a0107ca.dd6,9,"SELECT",2017-11-07 01:43:38 UTC,3/0,0,LOG,00000,"duration: 1.000 ms  plan:
+Query Text: SELECT 1
+Result  (cost=0.00..0.01 rows=1 width=4)",,,,,,,,,"psql"`
+	events := processLines(t, &Options{Format: "csvlog"}, in)
+	assert.Equal(t, 2, len(events))
+
+	assert.Equal(t, time.Date(2017, 11, 7, 1, 43, 39, 314000000, time.UTC), events[0].Timestamp)
+	data := events[0].Data
+	assert.Equal(t, "postgres", data["user"])
+	assert.Equal(t, "test", data["database"])
+	assert.Equal(t, 3542, data["pid"])
+	assert.Equal(t, "[local]", data["host_port"])
+	assert.Equal(t, "5a0107ca.dd6", data["session_id"])
+	assert.Equal(t, 7, data["session_line_number"])
+	assert.Equal(t, "SELECT", data["command_tag"])
+	assert.Equal(t, "LOG", data["severity"])
+	assert.Equal(t, "00000", data["sql_state"])
+	assert.Equal(t, "psql", data["application"])
+	assert.Equal(t, "client backend", data["backend_type"])
+	assert.Equal(t, -3225081473187395431, data["query_id"])
+	assert.Equal(t, 15.577, data["query_time"])
+	assert.Equal(t, `SELECT "id" FROM test;`, data["query"])
+	assert.Nil(t, data["message"])
+
+	data = events[1].Data
+	assert.Equal(t, "10.0.0.1:51234", data["host_port"])
+	assert.Equal(t, "text", data["plan_format"])
+	assert.Equal(t, "Result", data["plan_node_types"])
+	assert.Equal(t, "SELECT 1", data["query"])
+}
+
+func TestJSONLog(t *testing.T) {
+	in := `{"timestamp":"2022-10-13 09:54:19.123 UTC","user":"postgres","dbname":"test","pid":3542,"remote_host":"10.0.0.1","remote_port":51234,"session_id":"6347e0bb.dd6","line_num":7,"ps":"SELECT","session_start":"2022-10-13 09:54:03 UTC","vxid":"3/0","txid":0,"error_severity":"LOG","message":"duration: 0.501 ms  statement: SELECT * FROM test WHERE id = 2;","application_name":"psql","backend_type":"client backend","query_id":-3225081473187395431}
+{"timestamp":"2022-10-13 09:54:20.000 UTC","user":"postgres","dbname":"test","pid":3542,"error_severity":"ERROR","state_code":"42P01","message":"relation \"nope\" does not exist","statement":"SELECT * FROM nope;","cursor_position":15,"func_name":"parserOpenTable","file_name":"parse_relation.c","file_line_num":1384}
+not json`
+	events := processLines(t, &Options{Format: "jsonlog"}, in)
+	assert.Equal(t, 1, len(events))
+
+	assert.Equal(t, time.Date(2022, 10, 13, 9, 54, 19, 123000000, time.UTC), events[0].Timestamp)
+	data := events[0].Data
+	assert.Equal(t, "postgres", data["user"])
+	assert.Equal(t, "test", data["database"])
+	assert.Equal(t, 3542, data["pid"])
+	assert.Equal(t, "10.0.0.1", data["host"])
+	assert.Equal(t, "10.0.0.1:51234", data["host_port"])
+	assert.Equal(t, 7, data["session_line_number"])
+	assert.Equal(t, "LOG", data["severity"])
+	assert.Equal(t, "client backend", data["backend_type"])
+	assert.Equal(t, 0.501, data["query_time"])
+	assert.Equal(t, "SELECT * FROM test WHERE id = 2;", data["query"])
+	assert.Equal(t, -3225081473187395431, data["query_id"])
+
+	// only slow queries are sent
+	p := Parser{}
+	p.Init(&Options{Format: "jsonlog"})
+	assert.Nil(t, p.handleJSONLog(strings.Split(in, "\n")[1]))
+}
+
+func TestInvalidFormat(t *testing.T) {
+	p := Parser{}
+	assert.NotNil(t, p.Init(&Options{Format: "syslog"}))
+}
@@ -0,0 +1,89 @@
+package postgresql
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+// The bind parameters of an execute statement are logged in the DETAIL line
+// that follows it:
+//
+// 2017-11-07 01:43:39 UTC [3542-7] postgres@test LOG:  duration: 0.051 ms  execute <unnamed>: SELECT * FROM test WHERE id = $1 AND name = $2
+// 2017-11-07 01:43:39 UTC [3542-8] postgres@test DETAIL:  parameters: $1 = '1', $2 = 'O''Brien'
+
+const parametersPrefix = "parameters: "
+
+var (
+	reParameterName = regexp.MustCompile(`^\$(\d+) = `)
+	reParameterRef  = regexp.MustCompile(`\$\d+`)
+)
+
+// takeParameters moves the bind parameters from the detail of the event to
+// their own field, and returns them by name
+func takeParameters(ev *event.Event) map[string]string {
+	detail, ok := ev.Data["detail"].(string)
+	if !ok || !strings.HasPrefix(detail, parametersPrefix) {
+		return nil
+	}
+	raw := strings.TrimPrefix(detail, parametersPrefix)
+	params := parseParameters(raw)
+	if len(params) == 0 {
+		return nil
+	}
+	delete(ev.Data, "detail")
+	ev.Data["parameters"] = raw
+	return params
+}
+
+// parseParameters parses "$1 = '1', $2 = NULL" into the values by name,
+// keeping the values quoted as they were logged.
+func parseParameters(s string) map[string]string {
+	params := make(map[string]string)
+	for s != "" {
+		m := reParameterName.FindStringSubmatch(s)
+		if m == nil {
+			break
+		}
+		s = s[len(m[0]):]
+		var value string
+		if strings.HasPrefix(s, "'") {
+			// quotes in values are doubled
+			end := 1
+			for end < len(s) {
+				if s[end] == '\'' {
+					if end+1 < len(s) && s[end+1] == '\'' {
+						end += 2
+						continue
+					}
+					break
+				}
+				end++
+			}
+			if end >= len(s) {
+				value, s = s, ""
+			} else {
+				value, s = s[:end+1], s[end+1:]
+			}
+		} else if i := strings.Index(s, ", $"); i >= 0 {
+			value, s = s[:i], s[i:]
+		} else {
+			value, s = s, ""
+		}
+		params["$"+m[1]] = value
+		s = strings.TrimPrefix(s, ", ")
+	}
+	return params
+}
+
+// substituteParameters replaces the $N references in the query with the
+// values of the parameters
+func substituteParameters(query string, params map[string]string) string {
+	return reParameterRef.ReplaceAllStringFunc(query, func(ref string) string {
+		if value, ok := params[ref]; ok {
+			return value
+		}
+		return ref
+	})
+}
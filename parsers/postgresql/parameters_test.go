@@ -0,0 +1,36 @@
+package postgresql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseParameters(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"$1":  "'1'",
+		"$2":  "'O''Brien, Jr'",
+		"$3":  "NULL",
+		"$10": "'x'",
+	}, parseParameters("$1 = '1', $2 = 'O''Brien, Jr', $3 = NULL, $10 = 'x'"))
+	assert.Equal(t, map[string]string{}, parseParameters("nonsense"))
+}
+
+func TestBindParameters(t *testing.T) {
+	in := `2017-11-07 01:43:39 UTC [3542-7] postgres@test LOG:  duration: 0.051 ms  execute <unnamed>: SELECT * FROM test WHERE id = $1 AND name = $2
+2017-11-07 01:43:39 UTC [3542-8] postgres@test DETAIL:  parameters: $1 = '1', $2 = 'O''Brien'
+2017-11-07 01:43:40 UTC [3542-9] postgres@test LOG:  duration: 0.501 ms  statement: SELECT 2;`
+	events := processLines(t, &Options{}, in)
+	assert.Equal(t, 2, len(events))
+	data := events[0].Data
+	assert.Equal(t, "SELECT * FROM test WHERE id = $1 AND name = $2", data["query"])
+	assert.Equal(t, "$1 = '1', $2 = 'O''Brien'", data["parameters"])
+	assert.Nil(t, data["detail"])
+	assert.Equal(t, 7, data["session_line_number"])
+
+	events = processLines(t, &Options{SubstituteParameters: true}, in)
+	assert.Equal(t, 2, len(events))
+	data = events[0].Data
+	assert.Equal(t, "SELECT * FROM test WHERE id = '1' AND name = 'O''Brien'", data["query"])
+	assert.Equal(t, "select * from test where id = ? and name = ?", data["normalized_query"])
+}
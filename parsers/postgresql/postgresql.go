@@ -19,9 +19,14 @@
 //   %d = database name
 //   %r = remote host and port
 //   %h = remote host
+//   %L = local address
+//   %b = backend type
 //   %p = process ID
+//   %P = process ID of parallel group leader
 //   %t = timestamp without milliseconds
 //   %m = timestamp with milliseconds
+//   %n = timestamp with milliseconds (as a Unix epoch)
+//   %Q = query ID (0 if none or not computed)
 //   %i = command tag
 //   %e = SQL state
 //   %c = session ID
@@ -57,7 +62,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/AIntelligenceGame/clicktail/parsers/fingerprint"
+	"github.com/AIntelligenceGame/clicktail/parsers/fieldtype"
 	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/httime"
 	"github.com/honeycombio/honeytail/parsers"
 	"github.com/honeycombio/mysqltools/query/normalizer"
 	"github.com/sirupsen/logrus"
@@ -65,13 +73,31 @@ import (
 
 const (
 	// Regex string that matches timestamps in log
-	timestampRe   = `\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}[.0-9]* [A-Z]+`
+	timestampRe   = `\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}[.0-9]* (?:[A-Za-z]+|[-+]\d{2,4})`
 	defaultPrefix = "%t [%p-%l] %u@%d"
-	// Regex string that matches the header of a slow query log line
-	slowQueryHeader = `\s*(?P<level>[A-Z0-9]+):\s+duration: (?P<duration>[0-9\.]+) ms\s+(?:(statement)|(execute \S+)): `
+	// Regex string that matches the level following the prefix
+	levelHeader = `^\s*(?P<level>[A-Z0-9]+):\s+`
+	// Regex string that matches the header of a slow query message
+	slowQueryHeader = `^duration: (?P<duration>[0-9\.]+) ms\s+(?:(statement)|(execute \S+)): `
 )
 
-var slowQueryHeaderRegex = &parsers.ExtRegexp{regexp.MustCompile(slowQueryHeader)}
+// timestampLayout is the layout of %t, %m and %s in zones with an
+// abbreviation
+const timestampLayout = "2006-01-02 15:04:05.999 MST"
+
+// timestampLayouts are the layouts of %t, %m and %s. Zones without an
+// abbreviation are logged as a numeric offset, which time.Parse would take
+// for an unknown abbreviation, so those are tried first.
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05.999 -0700",
+	"2006-01-02 15:04:05.999 -07",
+	timestampLayout,
+}
+
+var (
+	levelHeaderRegex     = &parsers.ExtRegexp{regexp.MustCompile(levelHeader)}
+	slowQueryHeaderRegex = &parsers.ExtRegexp{regexp.MustCompile(slowQueryHeader)}
+)
 
 // prefixField represents a specific format specifier in the log_line_prefix string
 // (see module comment for details).
@@ -90,7 +116,11 @@ var prefixValues = map[string]prefixField{
 	"%d": prefixField{Name: "database", Pattern: "\\S+"},
 	"%r": prefixField{Name: "host_port", Pattern: "\\S+"},
 	"%h": prefixField{Name: "host", Pattern: "\\S+"},
+	"%L": prefixField{Name: "local_address", Pattern: "\\S+"},
+	"%b": prefixField{Name: "backend_type", Pattern: "[a-z]+(?: [a-z]+)*?"},
 	"%p": prefixField{Name: "pid", Pattern: "\\d+"},
+	"%P": prefixField{Name: "leader_pid", Pattern: "\\d*"},
+	"%Q": prefixField{Name: "query_id", Pattern: "-?\\d+"},
 	"%t": prefixField{Name: "timestamp", Pattern: timestampRe},
 	"%m": prefixField{Name: "timestamp_millis", Pattern: timestampRe},
 	"%n": prefixField{Name: "timestamp_unix", Pattern: "\\d+"},
@@ -105,11 +135,28 @@ var prefixValues = map[string]prefixField{
 
 type Options struct {
 	LogLinePrefix string `long:"log_line_prefix" description:"Format string for PostgreSQL log line prefix"`
+	Format        string `long:"format" description:"Format of the PostgreSQL log: stderr, csvlog or jsonlog. log_line_prefix only applies to stderr" default:"stderr"`
+	AllEvents     bool   `long:"all_events" description:"Send errors, lock waits, checkpoints, autovacuum runs, connections and other log statements as well as slow queries, with an event_type field"`
+	Timezone      string `long:"timezone" description:"IANA time zone of the server (its log_timezone), used to resolve zone abbreviations such as CET in timestamps"`
+
+	SubstituteParameters bool     `long:"substitute_parameters" description:"Substitute the bind parameters logged after execute statements into the query"`
+	FieldTypes           []string `long:"field_type" description:"Type to convert a log_line_prefix (or csvlog/jsonlog) field to, as field:type[:arg], eg. \"host:ip\". Types are string, int, float, bool, duration (arg is the unit, default ms), ip, timestamp (arg is the format) and size (eg. 10KB, in bytes). May be specified multiple times."`
 }
 
 type Parser struct {
 	// regex to match the log_line_prefix format specified by the user
 	pgPrefixRegex *parsers.ExtRegexp
+	// time zone used to resolve zone abbreviations in timestamps; httime's
+	// Location when unset
+	location *time.Location
+	// stderr, csvlog or jsonlog
+	format string
+	// send log statements other than slow queries too
+	allEvents bool
+	// substitute bind parameters into the query
+	substituteParameters bool
+	// types of prefix fields, overriding the defaults
+	fieldTypes fieldtype.Fields
 }
 
 func (p *Parser) Init(options interface{}) (err error) {
@@ -120,6 +167,25 @@ func (p *Parser) Init(options interface{}) (err error) {
 	} else {
 		logLinePrefixFormat = conf.LogLinePrefix
 	}
+	p.format = formatStderr
+	if ok {
+		p.allEvents = conf.AllEvents
+		p.substituteParameters = conf.SubstituteParameters
+		if p.fieldTypes, err = fieldtype.ParseFields(conf.FieldTypes); err != nil {
+			return err
+		}
+		if conf.Timezone != "" {
+			if p.location, err = time.LoadLocation(conf.Timezone); err != nil {
+				return err
+			}
+		}
+	}
+	if ok && conf.Format != "" {
+		if !isValidFormat(conf.Format) {
+			return fmt.Errorf("unknown PostgreSQL log format %q, expected stderr, csvlog or jsonlog", conf.Format)
+		}
+		p.format = conf.Format
+	}
 	p.pgPrefixRegex, err = buildPrefixRegexp(logLinePrefixFormat)
 	return err
 }
@@ -130,6 +196,8 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 	wg.Add(1)
 	go p.handleEvents(rawEvents, send, wg)
 	var groupedLines []string
+	inPlan := false
+	quotes := 0
 	for line := range lines {
 		if prefixRegex != nil {
 			// This is the "global" prefix regex as specified by the
@@ -142,13 +210,31 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 			prefix = prefixRegex.FindString(line)
 			line = strings.TrimPrefix(line, prefix)
 		}
-		if !isContinuationLine(line) && len(groupedLines) > 0 {
+		var continued bool
+		switch p.format {
+		case formatCSVLog:
+			// Quoted fields may span lines, so a record isn't over until
+			// its quotes balance.
+			continued = quotes%2 == 1
+		case formatJSONLog:
+			continued = false
+		default:
+			continued = isContinuationLine(line) || (inPlan && !p.startsLogLine(line)) || p.isSecondaryLine(line)
+		}
+		if !continued && len(groupedLines) > 0 {
 			// If the line we just parsed is the start of a new log statement,
 			// send off the previously accumulated group.
 			rawEvents <- groupedLines
 			groupedLines = make([]string, 0, 1)
+			quotes = 0
+		}
+		if len(groupedLines) == 0 && p.format == formatStderr {
+			// auto_explain plans run until the next log line, even when
+			// they've lost the leading tab of continuation lines
+			inPlan = p.isPlanHeader(line)
 		}
 		groupedLines = append(groupedLines, line)
+		quotes += strings.Count(line, `"`)
 	}
 
 	rawEvents <- groupedLines
@@ -173,10 +259,15 @@ func (p *Parser) handleEvents(rawEvents <-chan []string, send chan<- event.Event
 // handleEvent takes a single grouped log statement (an array of lines) and attempts to parse it.
 // It returns a pointer to an Event if successful, and nil if not.
 func (p *Parser) handleEvent(rawEvent []string) *event.Event {
-	normalizer := normalizer.Parser{}
 	if len(rawEvent) == 0 {
 		return nil
 	}
+	switch p.format {
+	case formatCSVLog:
+		return p.handleCSVLog(strings.Join(rawEvent, "\n"))
+	case formatJSONLog:
+		return p.handleJSONLog(rawEvent[0])
+	}
 	firstLine := rawEvent[0]
 
 	// First, try to parse the prefix
@@ -192,68 +283,167 @@ func (p *Parser) handleEvent(rawEvent []string) *event.Event {
 		Data: make(map[string]interface{}, 0),
 	}
 
-	addFieldsToEvent(generalMeta, ev)
+	p.addFieldsToEvent(generalMeta, ev)
+
+	match, message, levelMeta := parsePrefix(levelHeaderRegex, suffix)
+	if !match {
+		logrus.WithField("line", firstLine).Debug("didn't find log level, skipping line")
+		return nil
+	}
+	if p.allEvents {
+		ev.Data["severity"] = levelMeta["level"]
+	}
+	lines, sections := p.splitSections(rawEvent[1:])
+	for k, v := range sections {
+		ev.Data[k] = v
+	}
+	return p.handleMessage(ev, message, lines)
+}
 
+// handleMessage parses the message of a log statement, the first line of
+// which is message and the rest of which is lines, into the event.
+func (p *Parser) handleMessage(ev *event.Event, message string, lines []string) *event.Event {
 	// Now, parse the slow query header
-	match, query, slowQueryMeta := parsePrefix(slowQueryHeaderRegex, suffix)
+	match, query, slowQueryMeta := parsePrefix(slowQueryHeaderRegex, message)
 
 	if !match {
-		logrus.WithField("line", firstLine).Debug("didn't find slow query header, skipping line")
+		// auto_explain logs the plan rather than the statement
+		if match, rest, planMeta := parsePrefix(planHeaderRegex, message); match {
+			return p.handlePlan(ev, planMeta, rest, lines)
+		}
+		if p.allEvents {
+			return p.handleLogEvent(ev, message, lines)
+		}
+		logrus.WithField("message", message).Debug("didn't find slow query header, skipping line")
 		return nil
 	}
 
-	if rawDuration, ok := slowQueryMeta["duration"]; ok {
-		duration, _ := strconv.ParseFloat(rawDuration, 64)
-		ev.Data["query_time"] = duration
-	} else {
-		logrus.WithField("query", query).Debug("Failed to find query duration in log line")
+	addDuration(ev, slowQueryMeta)
+	if p.allEvents {
+		ev.Data[eventTypeKey] = eventSlowQuery
 	}
 
 	// Finally, concatenate the remaining text to form the query, and attempt to
 	// normalize it.
-	for _, line := range rawEvent[1:] {
+	for _, line := range lines {
 		query += " " + strings.TrimLeft(line, " \t")
 	}
+	if params := takeParameters(ev); params != nil && p.substituteParameters {
+		query = substituteParameters(query, params)
+	}
+	addQueryFields(ev, query)
+	return ev
+}
+
+// handlePlan finishes an event for a plan logged by auto_explain
+func (p *Parser) handlePlan(ev *event.Event, meta map[string]string, first string, lines []string) *event.Event {
+	summary := parsePlan(first, lines)
+	if summary == nil {
+		logrus.Debug("found an empty plan, skipping")
+		return nil
+	}
+	addDuration(ev, meta)
+	summary.addPlanFields(ev)
+	if p.allEvents {
+		ev.Data[eventTypeKey] = eventPlan
+	}
+	if summary.query != "" {
+		addQueryFields(ev, summary.query)
+	}
+	return ev
+}
+
+func addDuration(ev *event.Event, meta map[string]string) {
+	if rawDuration, ok := meta["duration"]; ok {
+		duration, _ := strconv.ParseFloat(rawDuration, 64)
+		ev.Data["query_time"] = duration
+	} else {
+		logrus.Debug("Failed to find query duration in log line")
+	}
+}
+
+// addQueryFields adds the query and its normalized forms to the event
+func addQueryFields(ev *event.Event, query string) {
+	normalizer := normalizer.Parser{}
 	re, _ := regexp.Compile(`\$[[:digit:]]+`)
 	newQuery := re.ReplaceAllString(query, "'var'")
 	normalizedQuery := normalizer.NormalizeQuery(newQuery)
 
 	ev.Data["query"] = query
 	ev.Data["normalized_query"] = normalizedQuery
+	fp := fingerprint.Fingerprint(query)
+	ev.Data["query_fingerprint"] = fp
+	ev.Data["query_checksum"] = fingerprint.Checksum(fp)
 	if len(normalizer.LastTables) > 0 {
 		ev.Data["tables"] = strings.Join(normalizer.LastTables, " ")
 	}
 	if len(normalizer.LastComments) > 0 {
 		ev.Data["comments"] = "/* " + strings.Join(normalizer.LastComments, " */ /* ") + " */"
 	}
-
-	return ev
 }
 
 func isContinuationLine(line string) bool {
 	return strings.HasPrefix(line, "\t")
 }
 
+// startsLogLine returns true if the line begins with the log_line_prefix
+func (p *Parser) startsLogLine(line string) bool {
+	loc := p.pgPrefixRegex.FindStringIndex(line)
+	return loc != nil && loc[0] == 0 && loc[1] > 0
+}
+
+// isPlanHeader returns true if the line starts a plan logged by auto_explain
+func (p *Parser) isPlanHeader(line string) bool {
+	match, suffix, _ := parsePrefix(p.pgPrefixRegex, line)
+	if !match {
+		return false
+	}
+	match, message, _ := parsePrefix(levelHeaderRegex, suffix)
+	if !match {
+		return false
+	}
+	match, _, _ = parsePrefix(planHeaderRegex, message)
+	return match
+}
+
 // addFieldsToEvent takes a map of key-value metadata extracted from a log
-// line, and adds them to the given event. It'll convert values to integer
-// types where possible, and try to populate the event's timestamp.
-func addFieldsToEvent(fields map[string]string, ev *event.Event) {
+// line, and adds them to the given event. It'll convert values to the
+// configured types or integer types where possible, and try to populate the
+// event's timestamp.
+func (p *Parser) addFieldsToEvent(fields map[string]string, ev *event.Event) {
 	for k, v := range fields {
+		if v == "" {
+			// a group after %q that didn't match
+			continue
+		}
+		if typed, ok := p.fieldTypes.Convert(k, v); ok {
+			ev.Data[k] = typed
+			continue
+		}
 		// Try to convert values to integer types where sensible, and extract
 		// timestamp for event
 		switch k {
-		case "session_id", "pid", "session_line_number":
+		case "session_id", "pid", "session_line_number", "leader_pid", "query_id",
+			"query_position", "internal_query_position":
 			if typed, err := strconv.Atoi(v); err == nil {
 				ev.Data[k] = typed
 			} else {
 				ev.Data[k] = v
 			}
 		case "timestamp", "timestamp_millis":
-			if timestamp, err := time.Parse("2006-01-02 15:04:05.999 MST", v); err == nil {
+			if timestamp, err := p.parseTimestamp(v); err == nil {
 				ev.Timestamp = timestamp
 			} else {
 				logrus.WithField("timestamp", v).WithError(err).Debug("Error parsing query timestamp")
 			}
+		case "session_start":
+			// normalize the session start to UTC, so sessions from servers
+			// in different time zones compare
+			if timestamp, err := p.parseTimestamp(v); err == nil {
+				ev.Data[k] = timestamp.Format(timestampLayout)
+			} else {
+				ev.Data[k] = v
+			}
 		case "timestamp_unix":
 			if typed, err := strconv.Atoi(v); err == nil {
 				// Convert millisecond-resolution Unix timestamp to time.Time
@@ -281,11 +471,16 @@ func buildPrefixRegexp(prefixFormat string) (*parsers.ExtRegexp, error) {
 	prefixFormat = strings.Replace(prefixFormat, "%%", "%", -1)
 	// The %q format specifier means "if this log line isn't part of a session,
 	// stop here." The slow query logs that we care about always come from
-	// sessions, so ignore this.
-	prefixFormat = strings.Replace(prefixFormat, "%q", "", -1)
-	prefixFormat = regexp.QuoteMeta(prefixFormat)
-	for k, v := range prefixValues {
-		prefixFormat = strings.Replace(prefixFormat, k, v.ReString(), -1)
+	// sessions, but checkpoints, autovacuum etc. don't, so the rest of the
+	// prefix is optional.
+	var sessionOnly string
+	if i := strings.Index(prefixFormat, "%q"); i >= 0 {
+		sessionOnly = strings.Replace(prefixFormat[i+2:], "%q", "", -1)
+		prefixFormat = prefixFormat[:i]
+	}
+	prefixFormat = prefixRegexpString(prefixFormat)
+	if sessionOnly != "" {
+		prefixFormat += "(?:" + prefixRegexpString(sessionOnly) + ")?"
 	}
 
 	re, err := regexp.Compile(prefixFormat)
@@ -294,3 +489,28 @@ func buildPrefixRegexp(prefixFormat string) (*parsers.ExtRegexp, error) {
 	}
 	return &parsers.ExtRegexp{re}, nil
 }
+
+func prefixRegexpString(prefixFormat string) string {
+	prefixFormat = regexp.QuoteMeta(prefixFormat)
+	for k, v := range prefixValues {
+		prefixFormat = strings.Replace(prefixFormat, k, v.ReString(), -1)
+	}
+	return prefixFormat
+}
+
+// parseTimestamp parses a %t, %m or %s timestamp
+func (p *Parser) parseTimestamp(v string) (time.Time, error) {
+	var timestamp time.Time
+	var err error
+	for _, layout := range timestampLayouts {
+		if p.location != nil {
+			timestamp, err = time.ParseInLocation(layout, v, p.location)
+		} else {
+			timestamp, err = httime.Parse(layout, v)
+		}
+		if err == nil {
+			return timestamp.UTC(), nil
+		}
+	}
+	return timestamp, err
+}
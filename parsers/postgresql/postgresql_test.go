@@ -32,12 +32,14 @@ func TestSingleQueryParsing(t *testing.T) {
 			expected: event.Event{
 				Timestamp: time.Date(2017, 11, 7, 23, 5, 16, 0, time.UTC),
 				Data: map[string]interface{}{
-					"user":     "postgres",
-					"database": "postgres",
-					"duration": 0.681,
-					"pid":      3053,
+					"user":                "postgres",
+					"database":            "postgres",
+					"query_time":          0.681,
+					"pid":                 3053,
 					"session_line_number": 3,
 					"query":               "SELECT d.datname as \"Name\", pg_catalog.pg_get_userbyid(d.datdba) as \"Owner\", pg_catalog.pg_encoding_to_char(d.encoding) as \"Encoding\", d.datcollate as \"Collate\", d.datctype as \"Ctype\", pg_catalog.array_to_string(d.datacl, E'\\n') AS \"Access privileges\" FROM pg_catalog.pg_database d ORDER BY 1;",
+					"query_fingerprint":   "select d.datname as ?, pg_catalog.pg_get_userbyid(d.datdba) as ?, pg_catalog.pg_encoding_to_char(d.encoding) as ?, d.datcollate as ?, d.datctype as ?, pg_catalog.array_to_string(d.datacl, e?) as ? from pg_catalog.pg_database d order by ?;",
+					"query_checksum":      uint64(9148944215660231073),
 					"normalized_query":    "select d.datname as ?, pg_catalog.pg_get_userbyid(d.datdba) as ?, pg_catalog.pg_encoding_to_char(d.encoding) as ?, d.datcollate as ?, d.datctype as ?, pg_catalog.array_to_string(d.datacl, e?) as ? from pg_catalog.pg_database d order by ?;",
 				},
 			},
@@ -49,10 +51,10 @@ func TestSingleQueryParsing(t *testing.T) {
 			expected: event.Event{
 				Timestamp: time.Date(2017, 11, 8, 3, 2, 49, 314000000, time.UTC),
 				Data: map[string]interface{}{
-					"user":     "postgres",
-					"database": "test",
-					"duration": 2.753,
-					"pid":      8544,
+					"user":                   "postgres",
+					"database":               "test",
+					"query_time":             2.753,
+					"pid":                    8544,
 					"session_line_number":    1,
 					"virtual_transaction_id": "3/0",
 					"transaction_id":         "0",
@@ -60,6 +62,8 @@ func TestSingleQueryParsing(t *testing.T) {
 					"session_start":          "2017-11-08 03:02:38 UTC",
 					"application":            "psql",
 					"query":                  "select * from test;",
+					"query_fingerprint":      "select * from test;",
+					"query_checksum":         uint64(5505360911035379210),
 					"normalized_query":       "select * from test;",
 				},
 			},
@@ -71,12 +75,14 @@ func TestSingleQueryParsing(t *testing.T) {
 			expected: event.Event{
 				Timestamp: time.Date(2017, 11, 9, 20, 15, 41, 402000000, time.UTC),
 				Data: map[string]interface{}{
-					"user":     "postgres",
-					"database": "test",
-					"duration": 2.753,
-					"pid":      8544,
+					"user":                "postgres",
+					"database":            "test",
+					"query_time":          2.753,
+					"pid":                 8544,
 					"session_line_number": 1,
 					"query":               "select * from test;",
+					"query_fingerprint":   "select * from test;",
+					"query_checksum":      uint64(5505360911035379210),
 					"normalized_query":    "select * from test;",
 				},
 			},
@@ -88,13 +94,16 @@ func TestSingleQueryParsing(t *testing.T) {
 			expected: event.Event{
 				Timestamp: time.Date(2017, 11, 7, 23, 5, 16, 0, time.UTC),
 				Data: map[string]interface{}{
-					"user":     "postgres",
-					"database": "postgres",
-					"duration": 0.681,
-					"pid":      3053,
+					"user":                "postgres",
+					"database":            "postgres",
+					"query_time":          0.681,
+					"pid":                 3053,
 					"session_line_number": 3,
 					"query":               "SELECT c FROM sbtest1 WHERE id=$1",
-					"normalized_query":    "select c from sbtest1 where id=$?",
+					"query_fingerprint":   "select c from sbtest1 where id=$?",
+					"query_checksum":      uint64(13733158118724634009),
+					"normalized_query":    "select c from sbtest1 where id = ?",
+					"tables":              "sbtest1",
 				},
 			},
 		},
@@ -112,7 +121,7 @@ func TestSingleQueryParsing(t *testing.T) {
 			in <- strings.Split(tc.in, "\n")
 			close(in)
 			got := <-out
-			assert.Equal(t, got, tc.expected)
+			assert.Equal(t, tc.expected, got)
 		})
 	}
 }
@@ -131,48 +140,56 @@ func TestMultipleQueryParsing(t *testing.T) {
 		event.Event{
 			Timestamp: time.Date(2017, 11, 7, 1, 43, 18, 0, time.UTC),
 			Data: map[string]interface{}{
-				"user":     "postgres",
-				"database": "test",
-				"duration": 9.263,
-				"pid":      3542,
+				"user":                "postgres",
+				"database":            "test",
+				"query_time":          9.263,
+				"pid":                 3542,
 				"session_line_number": 5,
 				"query":               "INSERT INTO test (id, name, value) VALUES (1, 'Alice', 'foo');",
+				"query_fingerprint":   "insert into test (id, name, value) values(?+);",
+				"query_checksum":      uint64(7457593281117979601),
 				"normalized_query":    "insert into test (id, name, value) values (?, ?, ?);",
 			},
 		},
 		event.Event{
 			Timestamp: time.Date(2017, 11, 7, 1, 43, 27, 0, time.UTC),
 			Data: map[string]interface{}{
-				"user":     "postgres",
-				"database": "test",
-				"duration": 0.841,
-				"pid":      3542,
+				"user":                "postgres",
+				"database":            "test",
+				"query_time":          0.841,
+				"pid":                 3542,
 				"session_line_number": 6,
 				"query":               "INSERT INTO test (id, name, value) VALUES (2, 'Bob', 'bar');",
+				"query_fingerprint":   "insert into test (id, name, value) values(?+);",
+				"query_checksum":      uint64(7457593281117979601),
 				"normalized_query":    "insert into test (id, name, value) values (?, ?, ?);",
 			},
 		},
 		event.Event{
 			Timestamp: time.Date(2017, 11, 7, 1, 43, 39, 0, time.UTC),
 			Data: map[string]interface{}{
-				"user":     "postgres",
-				"database": "test",
-				"duration": 15.577,
-				"pid":      3542,
+				"user":                "postgres",
+				"database":            "test",
+				"query_time":          15.577,
+				"pid":                 3542,
 				"session_line_number": 7,
 				"query":               "SELECT * FROM test WHERE id=1;",
+				"query_fingerprint":   "select * from test where id=?;",
+				"query_checksum":      uint64(14783143326879025078),
 				"normalized_query":    "select * from test where id=?;",
 			},
 		},
 		event.Event{
 			Timestamp: time.Date(2017, 11, 7, 1, 43, 42, 0, time.UTC),
 			Data: map[string]interface{}{
-				"user":     "postgres",
-				"database": "test",
-				"duration": 0.501,
-				"pid":      3542,
+				"user":                "postgres",
+				"database":            "test",
+				"query_time":          0.501,
+				"pid":                 3542,
 				"session_line_number": 8,
 				"query":               "SELECT * FROM test WHERE id=2;",
+				"query_fingerprint":   "select * from test where id=?;",
+				"query_checksum":      uint64(14783143326879025078),
 				"normalized_query":    "select * from test where id=?;",
 			},
 		},
@@ -189,7 +206,7 @@ func TestMultipleQueryParsing(t *testing.T) {
 	close(inChan)
 	for _, expected := range out {
 		got := <-sendChan
-		assert.Equal(t, got, expected)
+		assert.Equal(t, expected, got)
 	}
 }
 
@@ -209,3 +226,58 @@ func TestSkipNonQueryLogLines(t *testing.T) {
 		assert.Nil(t, ev)
 	}
 }
+
+func TestPrefixEscapes(t *testing.T) {
+	p := Parser{}
+	p.Init(&Options{LogLinePrefix: "%m [%p] [%b] %P %Q %L %u@%d "})
+	ev := p.handleEvent([]string{"2022-10-13 09:54:19.123 UTC [3545] [parallel worker] 3542 -3225081473187395431 10.0.0.2 postgres@test LOG:  duration: 0.501 ms  statement: SELECT 1;"})
+	assert.NotNil(t, ev)
+	assert.Equal(t, "parallel worker", ev.Data["backend_type"])
+	assert.Equal(t, 3542, ev.Data["leader_pid"])
+	assert.Equal(t, -3225081473187395431, ev.Data["query_id"])
+	assert.Equal(t, "10.0.0.2", ev.Data["local_address"])
+	assert.Equal(t, "postgres", ev.Data["user"])
+
+	// %P is empty outside parallel groups
+	ev = p.handleEvent([]string{"2022-10-13 09:54:19.123 UTC [3542] [client backend]  0 [local] postgres@test LOG:  duration: 0.501 ms  statement: SELECT 1;"})
+	assert.NotNil(t, ev)
+	assert.Equal(t, "client backend", ev.Data["backend_type"])
+	assert.Nil(t, ev.Data["leader_pid"])
+}
+
+func TestTimestampZones(t *testing.T) {
+	expected := time.Date(2017, 11, 7, 0, 43, 39, 0, time.UTC)
+	p := Parser{}
+	p.Init(&Options{LogLinePrefix: "%t [%p] %s "})
+	for _, line := range []string{
+		"2017-11-07 03:43:39 +03 [3542] 2017-11-07 03:40:00 +03 LOG:  duration: 0.501 ms  statement: SELECT 1;",
+		"2017-11-07 06:13:39 +0530 [3542] 2017-11-07 06:10:00 +0530 LOG:  duration: 0.501 ms  statement: SELECT 1;",
+		"2017-11-07 00:43:39 UTC [3542] 2017-11-07 00:40:00 UTC LOG:  duration: 0.501 ms  statement: SELECT 1;",
+	} {
+		ev := p.handleEvent([]string{line})
+		assert.NotNil(t, ev, line)
+		assert.Equal(t, expected, ev.Timestamp, line)
+		assert.Equal(t, "2017-11-07 00:40:00 UTC", ev.Data["session_start"], line)
+	}
+
+	// zone abbreviations are resolved in the server's time zone
+	p.Init(&Options{LogLinePrefix: "%t [%p] %s ", Timezone: "Europe/Berlin"})
+	ev := p.handleEvent([]string{"2017-11-07 01:43:39 CET [3542] 2017-11-07 01:40:00 CET LOG:  duration: 0.501 ms  statement: SELECT 1;"})
+	assert.NotNil(t, ev)
+	assert.Equal(t, expected, ev.Timestamp)
+	assert.Equal(t, "2017-11-07 00:40:00 UTC", ev.Data["session_start"])
+
+	assert.NotNil(t, p.Init(&Options{Timezone: "Nowhere/Special"}))
+}
+
+func TestFieldTypes(t *testing.T) {
+	p := Parser{}
+	assert.NoError(t, p.Init(&Options{LogLinePrefix: "%m [%p] %h %a ", FieldTypes: []string{"host:ip", "application:bool", "pid:string"}}))
+	ev := p.handleEvent([]string{"2017-11-07 01:43:39.314 UTC [3542] ::FFFF:10.0.0.2 on LOG:  duration: 0.501 ms  statement: SELECT 1;"})
+	assert.NotNil(t, ev)
+	assert.Equal(t, "10.0.0.2", ev.Data["host"])
+	assert.Equal(t, true, ev.Data["application"])
+	assert.Equal(t, "3542", ev.Data["pid"])
+
+	assert.NotNil(t, p.Init(&Options{FieldTypes: []string{"pid:integer"}}))
+}
@@ -0,0 +1,195 @@
+// Package redis parses the Redis server log, and polls SLOWLOG GET for the
+// commands that were slow
+package redis
+
+import (
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/httime"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+// Sample log lines, by server version
+//
+// Redis 3.0 and later, as pid:role:
+// 1:C 19 Oct 2026 10:21:00.123 # oO0OoO0OoO0Oo Redis is starting oO0OoO0OoO0Oo
+// 1:M 19 Oct 2026 10:21:00.125 * Ready to accept connections
+// 27:S 19 Oct 2026 10:21:05.001 # Connection with master lost.
+//
+// Redis 2.x:
+// [4018] 19 Oct 10:21:00.123 # Server started, Redis version 2.8.4
+//
+// Lines that don't start an entry, such as the ASCII art logo at startup,
+// continue the message of the line before.
+
+const (
+	// Event attributes
+	pidKey     = "pid"
+	roleKey    = "role"
+	levelKey   = "level"
+	messageKey = "message"
+
+	timeFormat    = "02 Jan 2006 15:04:05.000"
+	oldTimeFormat = "02 Jan 15:04:05"
+)
+
+var (
+	reEntry    = parsers.ExtRegexp{Regexp: regexp.MustCompile(`^(?P<pid>[0-9]+):(?P<role>[XCSM]) (?P<time>[0-9]{1,2} [A-Z][a-z]{2} [0-9]{4} [0-9]{2}:[0-9]{2}:[0-9]{2}\.[0-9]{3}) (?P<level>[.*#-]) (?P<message>.*)$`)}
+	reOldEntry = parsers.ExtRegexp{Regexp: regexp.MustCompile(`^\[(?P<pid>[0-9]+)\] (?P<time>[0-9]{1,2} [A-Z][a-z]{2} [0-9]{2}:[0-9]{2}:[0-9]{2}(?:\.[0-9]{3})?) (?P<level>[.*#-]) (?P<message>.*)$`)}
+
+	roles = map[string]string{
+		"M": "master",
+		"S": "replica",
+		"C": "child",
+		"X": "sentinel",
+	}
+	levels = map[string]string{
+		".": "debug",
+		"-": "verbose",
+		"*": "notice",
+		"#": "warning",
+	}
+)
+
+type Options struct {
+	Host          string `long:"host" description:"Redis server to poll SLOWLOG GET on, as address:port or the path of a unix socket. Slow commands are only sent if it's set."`
+	User          string `long:"user" description:"Redis username, for servers with ACLs"`
+	Pass          string `long:"pass" description:"Redis password"`
+	QueryInterval uint   `long:"interval" description:"interval for polling the slowlog in seconds" default:"30"`
+	SlowlogCount  uint   `long:"slowlog_count" description:"Number of entries to ask SLOWLOG GET for on each poll; make it at least slowlog-max-len to not miss any" default:"128"`
+}
+
+type Parser struct {
+	// set SampleRate to cause the parser to drop events after before they're
+	// parsed to save CPU
+	SampleRate int
+
+	conf Options
+}
+
+func (p *Parser) Init(options interface{}) error {
+	p.conf = *options.(*Options)
+	return nil
+}
+
+func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+	stopPoller := p.startPoller(send)
+	defer stopPoller()
+
+	var (
+		groupedLines []string
+		// the fields of the prefix of the entry's first line
+		groupPrefixFields map[string]string
+	)
+	flush := func() {
+		if len(groupedLines) == 0 {
+			return
+		}
+		// if sampling is disabled or sampler says keep, pass along this group.
+		if p.SampleRate <= 1 || rand.Intn(p.SampleRate) == 0 {
+			data, timestamp := handleEvent(groupedLines)
+			if len(data) != 0 {
+				// merge the prefix fields and the parsed entry contents
+				for k, v := range groupPrefixFields {
+					data[k] = v
+				}
+				send <- event.Event{
+					Timestamp:  timestamp,
+					SampleRate: p.SampleRate,
+					Data:       data,
+				}
+			}
+		}
+		groupedLines = nil
+		groupPrefixFields = nil
+	}
+	for line := range lines {
+		line = strings.TrimRight(line, " \r\n")
+		// take care of any headers on the line
+		var prefixFields map[string]string
+		if prefixRegex != nil {
+			var prefix string
+			prefix, prefixFields = prefixRegex.FindStringSubmatchMap(line)
+			line = strings.TrimPrefix(line, prefix)
+		}
+		if reEntry.MatchString(line) || reOldEntry.MatchString(line) {
+			flush()
+			groupedLines = []string{line}
+			groupPrefixFields = prefixFields
+			continue
+		}
+		if len(groupedLines) == 0 {
+			logrus.WithFields(logrus.Fields{
+				"line": line,
+			}).Debug("skipping line that doesn't start an entry")
+			continue
+		}
+		groupedLines = append(groupedLines, line)
+	}
+	// send the last event, if there was one collected
+	flush()
+	logrus.Debug("lines channel is closed, ending redis processor")
+}
+
+// handleEvent turns the lines of one log entry into an event
+func handleEvent(rawE []string) (map[string]interface{}, time.Time) {
+	if len(rawE) == 0 {
+		return nil, time.Time{}
+	}
+	old := false
+	_, mg := reEntry.FindStringSubmatchMap(rawE[0])
+	if mg == nil {
+		if _, mg = reOldEntry.FindStringSubmatchMap(rawE[0]); mg == nil {
+			return nil, time.Time{}
+		}
+		old = true
+	}
+	data := map[string]interface{}{}
+	if pid, err := strconv.ParseInt(mg["pid"], 10, 64); err == nil {
+		data[pidKey] = pid
+	}
+	if role, ok := roles[mg["role"]]; ok {
+		data[roleKey] = role
+	}
+	data[levelKey] = levels[mg["level"]]
+	data[messageKey] = strings.TrimRight(strings.Join(append([]string{mg["message"]}, rawE[1:]...), "\n"), "\n")
+	return data, parseTime(mg["time"], old)
+}
+
+// parseTime handles the timestamps of each server version, falling back to
+// now. Redis 2.x doesn't log the year, so it's taken to be the last year the
+// date was in.
+func parseTime(t string, old bool) time.Time {
+	if !old {
+		timestamp, err := httime.Parse(timeFormat, t)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"time":  t,
+				"error": err,
+			}).Debug("failed to parse time")
+			return httime.Now()
+		}
+		return timestamp
+	}
+	timestamp, err := httime.Parse(oldTimeFormat, t)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"time":  t,
+			"error": err,
+		}).Debug("failed to parse time")
+		return httime.Now()
+	}
+	now := httime.Now()
+	timestamp = timestamp.AddDate(now.Year(), 0, 0)
+	if timestamp.After(now.Add(24 * time.Hour)) {
+		timestamp = timestamp.AddDate(-1, 0, 0)
+	}
+	return timestamp
+}
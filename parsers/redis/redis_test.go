@@ -0,0 +1,103 @@
+package redis
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/httime"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+func TestHandleEvent(t *testing.T) {
+	data, timestamp := handleEvent([]string{"27:S 19 Oct 2026 10:21:05.001 # Connection with master lost."})
+	assert.Equal(t, map[string]interface{}{
+		pidKey:     int64(27),
+		roleKey:    "replica",
+		levelKey:   "warning",
+		messageKey: "Connection with master lost.",
+	}, data)
+	assert.Equal(t, time.Date(2026, 10, 19, 10, 21, 5, 1e6, time.UTC), timestamp)
+
+	data, _ = handleEvent([]string{"[4018] 19 Oct 10:21:00.123 * Server started, Redis version 2.8.4"})
+	assert.Equal(t, map[string]interface{}{
+		pidKey:     int64(4018),
+		levelKey:   "notice",
+		messageKey: "Server started, Redis version 2.8.4",
+	}, data)
+
+	data, _ = handleEvent([]string{"not an entry"})
+	assert.Nil(t, data)
+}
+
+func TestParseTimeWithoutYear(t *testing.T) {
+	defer func() { httime.DefaultNower = &httime.RealNower{} }()
+	httime.DefaultNower = &fakeNower{time.Date(2027, 1, 2, 0, 0, 0, 0, time.UTC)}
+	assert.Equal(t, time.Date(2026, 12, 31, 23, 59, 59, 0, time.UTC), parseTime("31 Dec 23:59:59", true))
+	assert.Equal(t, time.Date(2027, 1, 1, 10, 0, 0, 0, time.UTC), parseTime("01 Jan 10:00:00", true))
+}
+
+type fakeNower struct {
+	now time.Time
+}
+
+func (f *fakeNower) Now() time.Time { return f.now }
+
+func TestProcessLines(t *testing.T) {
+	p := &Parser{}
+	p.Init(&Options{})
+	lines := make(chan string)
+	send := make(chan event.Event, 10)
+	go func() {
+		for _, line := range []string{
+			"stray line before the first entry",
+			"1:C 19 Oct 2026 10:21:00.123 # oO0OoO0OoO0Oo Redis is starting oO0OoO0OoO0Oo",
+			"1:M 19 Oct 2026 10:21:00.124 * Running mode=standalone, port=6379.",
+			"                _._                                                  ",
+			"           _.-``__ ''-._                                             ",
+			"1:M 19 Oct 2026 10:21:00.125 * Ready to accept connections",
+		} {
+			lines <- line
+		}
+		close(lines)
+	}()
+	p.ProcessLines(lines, send, nil)
+	close(send)
+
+	var events []event.Event
+	for ev := range send {
+		events = append(events, ev)
+	}
+	if assert.Len(t, events, 3) {
+		assert.Equal(t, "child", events[0].Data[roleKey])
+		assert.Equal(t, "Running mode=standalone, port=6379.\n                _._\n           _.-``__ ''-._", events[1].Data[messageKey])
+		assert.Equal(t, "master", events[2].Data[roleKey])
+		assert.Equal(t, "notice", events[2].Data[levelKey])
+	}
+}
+
+func TestPrefixFields(t *testing.T) {
+	p := &Parser{}
+	p.Init(&Options{})
+	prefix := &parsers.ExtRegexp{Regexp: regexp.MustCompile(`^(?P<hostname>\S+): `)}
+	lines := make(chan string)
+	send := make(chan event.Event, 10)
+	go func() {
+		for _, line := range []string{
+			"cache1: 1:M 19 Oct 2026 10:21:00.124 * Running mode=standalone, port=6379.",
+			"cache2:                 _._",
+		} {
+			lines <- line
+		}
+		close(lines)
+	}()
+	p.ProcessLines(lines, send, prefix)
+	close(send)
+
+	ev := <-send
+	assert.Equal(t, "cache1", ev.Data["hostname"])
+	assert.Equal(t, "Running mode=standalone, port=6379.\n                _._", ev.Data[messageKey])
+}
@@ -0,0 +1,404 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+const (
+	// Event attributes
+	sourceKey            = "source"
+	serverKey            = "server"
+	slowlogIDKey         = "slowlog_id"
+	durationKey          = "duration"
+	commandKey           = "command"
+	argsKey              = "args"
+	normalizedCommandKey = "normalized_command"
+	clientIPKey          = "client_ip"
+	clientPortKey        = "client_port"
+	clientNameKey        = "client_name"
+
+	slowlogSource = "slowlog"
+
+	defaultPort  = "6379"
+	dialTimeout  = 5 * time.Second
+	replyTimeout = 10 * time.Second
+)
+
+// only one parser polls the slowlog, no matter how many are running
+var pollerStarted int32
+
+// containerCommands take a subcommand as their first argument, which is part
+// of the command sent
+var containerCommands = map[string]bool{
+	"ACL":      true,
+	"CLIENT":   true,
+	"CLUSTER":  true,
+	"COMMAND":  true,
+	"CONFIG":   true,
+	"DEBUG":    true,
+	"FUNCTION": true,
+	"LATENCY":  true,
+	"MEMORY":   true,
+	"MODULE":   true,
+	"OBJECT":   true,
+	"PUBSUB":   true,
+	"SCRIPT":   true,
+	"SLOWLOG":  true,
+	"XGROUP":   true,
+	"XINFO":    true,
+}
+
+var reKeyNumber = regexp.MustCompile(`[0-9a-fA-F]{8,}(?:-[0-9a-fA-F]{4,})*|[0-9]+`)
+
+// slowlogPoller turns SLOWLOG GET entries into events. The first poll only
+// records the newest entry; every later poll sends the entries logged since.
+type slowlogPoller struct {
+	network, addr string
+	user, pass    string
+	count         uint
+
+	conn   *respConn
+	polled bool
+	// the highest slowlog ID seen, or -1 if there were none
+	lastID int64
+}
+
+func newSlowlogPoller(host, user, pass string, count uint) *slowlogPoller {
+	network, addr := "tcp", host
+	if strings.HasPrefix(host, "/") {
+		network = "unix"
+	} else if _, _, err := net.SplitHostPort(host); err != nil {
+		addr = net.JoinHostPort(host, defaultPort)
+	}
+	return &slowlogPoller{
+		network: network,
+		addr:    addr,
+		user:    user,
+		pass:    pass,
+		count:   count,
+		lastID:  -1,
+	}
+}
+
+// run polls every interval until done is closed
+func (sp *slowlogPoller) run(interval time.Duration, done <-chan struct{}, send func(map[string]interface{}, time.Time)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer sp.close()
+	for {
+		sp.poll(send)
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+func (sp *slowlogPoller) poll(send func(map[string]interface{}, time.Time)) {
+	events, err := sp.pollSlowlog()
+	if err != nil {
+		logrus.WithError(err).Warn("failed to read the redis slowlog")
+		// connect again on the next poll
+		sp.close()
+	}
+	for _, ev := range events {
+		timestamp, _ := ev[timeKey].(time.Time)
+		delete(ev, timeKey)
+		send(ev, timestamp)
+	}
+}
+
+// timeKey holds an entry's time until it's sent
+const timeKey = "time"
+
+func (sp *slowlogPoller) pollSlowlog() ([]map[string]interface{}, error) {
+	if sp.conn == nil {
+		conn, err := dialRESP(sp.network, sp.addr, sp.user, sp.pass)
+		if err != nil {
+			return nil, err
+		}
+		sp.conn = conn
+	}
+	reply, err := sp.conn.do("SLOWLOG", "GET", strconv.FormatUint(uint64(sp.count), 10))
+	if err != nil {
+		return nil, err
+	}
+	entries, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected SLOWLOG GET reply %v", reply)
+	}
+
+	first := !sp.polled
+	sp.polled = true
+	maxID := int64(-1)
+	var parsed []map[string]interface{}
+	for _, entry := range entries {
+		sq, err := slowlogFields(entry)
+		if err != nil {
+			return nil, err
+		}
+		id := sq[slowlogIDKey].(int64)
+		if id > maxID {
+			maxID = id
+		}
+		parsed = append(parsed, sq)
+	}
+	if maxID < 0 {
+		// the slowlog is empty or was reset; IDs carry on regardless
+		return nil, nil
+	}
+	if first {
+		sp.lastID = maxID
+		return nil, nil
+	}
+	lastID := sp.lastID
+	if maxID < lastID {
+		// IDs start over when the server restarts
+		lastID = -1
+	}
+	var events []map[string]interface{}
+	// entries come newest first; send them in the order they were logged
+	for i := len(parsed) - 1; i >= 0; i-- {
+		sq := parsed[i]
+		if sq[slowlogIDKey].(int64) <= lastID {
+			continue
+		}
+		sq[sourceKey] = slowlogSource
+		sq[serverKey] = sp.addr
+		events = append(events, sq)
+	}
+	sp.lastID = maxID
+	return events, nil
+}
+
+func (sp *slowlogPoller) close() {
+	if sp.conn != nil {
+		sp.conn.Close()
+		sp.conn = nil
+	}
+}
+
+// slowlogFields turns a SLOWLOG GET entry into event fields. An entry is the
+// ID, unix time, duration in microseconds and the command's arguments, then,
+// since Redis 4.0, the client's address and name.
+func slowlogFields(entry interface{}) (map[string]interface{}, error) {
+	values, ok := entry.([]interface{})
+	if !ok || len(values) < 4 {
+		return nil, fmt.Errorf("unexpected slowlog entry %v", entry)
+	}
+	id, ok1 := values[0].(int64)
+	unix, ok2 := values[1].(int64)
+	duration, ok3 := values[2].(int64)
+	rawArgs, ok4 := values[3].([]interface{})
+	if !(ok1 && ok2 && ok3 && ok4) {
+		return nil, fmt.Errorf("unexpected slowlog entry %v", entry)
+	}
+	args := make([]string, 0, len(rawArgs))
+	for _, arg := range rawArgs {
+		if s, ok := arg.(string); ok {
+			args = append(args, s)
+		}
+	}
+	sq := map[string]interface{}{
+		slowlogIDKey: id,
+		timeKey:      time.Unix(unix, 0).UTC(),
+		durationKey:  duration,
+	}
+	command, rest := splitCommand(args)
+	if command != "" {
+		sq[commandKey] = command
+		sq[argsKey] = strings.Join(rest, " ")
+		sq[normalizedCommandKey] = normalizeCommand(command, rest)
+	}
+	if len(values) > 4 {
+		if addr, ok := values[4].(string); ok && addr != "" {
+			if host, port, err := net.SplitHostPort(addr); err == nil {
+				sq[clientIPKey] = host
+				if p, err := strconv.ParseInt(port, 10, 64); err == nil {
+					sq[clientPortKey] = p
+				}
+			} else {
+				sq[clientIPKey] = addr
+			}
+		}
+	}
+	if len(values) > 5 {
+		if name, ok := values[5].(string); ok && name != "" {
+			sq[clientNameKey] = name
+		}
+	}
+	return sq, nil
+}
+
+// splitCommand returns the command, uppercased and with the subcommand of
+// container commands such as CONFIG GET, and its arguments
+func splitCommand(args []string) (string, []string) {
+	if len(args) == 0 {
+		return "", nil
+	}
+	command := strings.ToUpper(args[0])
+	if containerCommands[command] && len(args) > 1 {
+		return command + " " + strings.ToUpper(args[1]), args[2:]
+	}
+	return command, args[1:]
+}
+
+// normalizeCommand abstracts a command so that its runs group together: the
+// first argument, usually the key, has its numbers and IDs replaced by ?, and
+// the rest are replaced by a single ?+, so "HSET user:42 name bob" is
+// "HSET user:? ?+".
+func normalizeCommand(command string, args []string) string {
+	normalized := command
+	if len(args) > 0 {
+		normalized += " " + reKeyNumber.ReplaceAllString(args[0], "?")
+	}
+	switch {
+	case len(args) == 2:
+		normalized += " ?"
+	case len(args) > 2:
+		normalized += " ?+"
+	}
+	return normalized
+}
+
+// startPoller starts polling the slowlog, if a host is set, and returns a
+// function that stops it. Only the first parser to call it polls.
+func (p *Parser) startPoller(send chan<- event.Event) func() {
+	if p.conf.Host == "" {
+		return func() {}
+	}
+	if !atomic.CompareAndSwapInt32(&pollerStarted, 0, 1) {
+		return func() {}
+	}
+	interval := time.Second * time.Duration(p.conf.QueryInterval)
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	poller := newSlowlogPoller(p.conf.Host, p.conf.User, p.conf.Pass, p.conf.SlowlogCount)
+	go func() {
+		defer close(finished)
+		poller.run(interval, done,
+			func(sq map[string]interface{}, timestamp time.Time) {
+				send <- event.Event{
+					Timestamp: timestamp,
+					Data:      sq,
+				}
+			})
+	}()
+	return func() {
+		close(done)
+		<-finished
+		atomic.StoreInt32(&pollerStarted, 0)
+	}
+}
+
+// respConn is a connection to a Redis server, speaking just enough of RESP
+// to send commands and read their replies
+type respConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// respError is an error reply from the server
+type respError string
+
+func (e respError) Error() string { return string(e) }
+
+// dialRESP connects and authenticates, if a password is set
+func dialRESP(network, addr, user, pass string) (*respConn, error) {
+	conn, err := net.DialTimeout(network, addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &respConn{Conn: conn, r: bufio.NewReader(conn)}
+	if pass != "" {
+		args := []string{"AUTH", pass}
+		if user != "" {
+			args = []string{"AUTH", user, pass}
+		}
+		if _, err := c.do(args...); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// do sends a command and returns its reply: a string, int64, nil or
+// []interface{} of those
+func (c *respConn) do(args ...string) (interface{}, error) {
+	c.SetDeadline(time.Now().Add(replyTimeout))
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.Conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *respConn) readReply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty RESP reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, respError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unexpected RESP reply %q", line)
+}
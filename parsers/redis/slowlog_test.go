@@ -0,0 +1,213 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedis stands in for a Redis server, answering AUTH and SLOWLOG GET
+// with whatever entries the test set last.
+type fakeRedis struct {
+	sync.Mutex
+	listener net.Listener
+	pass     string
+	slowlog  string
+	commands []string
+}
+
+func newFakeRedis(t *testing.T, pass string) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{listener: l, pass: pass, slowlog: "*0\r\n"}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := f.pass == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		f.Lock()
+		f.commands = append(f.commands, strings.Join(args, " "))
+		reply := f.slowlog
+		f.Unlock()
+		switch {
+		case strings.ToUpper(args[0]) == "AUTH":
+			if args[len(args)-1] != f.pass {
+				reply = "-WRONGPASS invalid username-password pair\r\n"
+			} else {
+				authed = true
+				reply = "+OK\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		}
+		fmt.Fprint(conn, reply)
+	}
+}
+
+// readCommand reads a command sent as an array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	c := &respConn{r: r}
+	reply, err := c.readReply()
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	for _, arg := range reply.([]interface{}) {
+		args = append(args, arg.(string))
+	}
+	return args, nil
+}
+
+func (f *fakeRedis) set(entries ...string) {
+	f.Lock()
+	defer f.Unlock()
+	f.slowlog = fmt.Sprintf("*%d\r\n%s", len(entries), strings.Join(entries, ""))
+}
+
+// slowlogEntry encodes a Redis 4.0+ SLOWLOG GET entry
+func slowlogEntry(id, unix, micros int64, client string, args ...string) string {
+	s := fmt.Sprintf("*6\r\n:%d\r\n:%d\r\n:%d\r\n*%d\r\n", id, unix, micros, len(args))
+	for _, arg := range args {
+		s += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return s + fmt.Sprintf("$%d\r\n%s\r\n$0\r\n\r\n", len(client), client)
+}
+
+func TestPollSlowlog(t *testing.T) {
+	f := newFakeRedis(t, "secret")
+	defer f.listener.Close()
+	sp := newSlowlogPoller(f.listener.Addr().String(), "", "secret", 10)
+	defer sp.close()
+
+	// the first poll is the baseline and sends nothing
+	f.set(
+		slowlogEntry(1, 1760869261, 15000, "10.0.0.2:50312", "KEYS", "*"),
+		slowlogEntry(0, 1760869260, 12000, "10.0.0.2:50312", "GET", "a"),
+	)
+	events, err := sp.pollSlowlog()
+	assert.Nil(t, err)
+	assert.Len(t, events, 0)
+
+	// only entries logged since are sent, oldest first
+	f.set(
+		slowlogEntry(3, 1760869263, 21000, "10.0.0.3:41000", "config", "get", "maxmemory"),
+		slowlogEntry(2, 1760869262, 11000, "[::1]:6000", "HSET", "user:42", "name", "bob"),
+		slowlogEntry(1, 1760869261, 15000, "10.0.0.2:50312", "KEYS", "*"),
+	)
+	events, err = sp.pollSlowlog()
+	assert.Nil(t, err)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, map[string]interface{}{
+			sourceKey:            slowlogSource,
+			serverKey:            f.listener.Addr().String(),
+			slowlogIDKey:         int64(2),
+			timeKey:              time.Unix(1760869262, 0).UTC(),
+			durationKey:          int64(11000),
+			commandKey:           "HSET",
+			argsKey:              "user:42 name bob",
+			normalizedCommandKey: "HSET user:? ?+",
+			clientIPKey:          "::1",
+			clientPortKey:        int64(6000),
+		}, events[0])
+		assert.Equal(t, "CONFIG GET", events[1][commandKey])
+		assert.Equal(t, "maxmemory", events[1][argsKey])
+		assert.Equal(t, "CONFIG GET maxmemory", events[1][normalizedCommandKey])
+	}
+
+	// nothing new
+	events, err = sp.pollSlowlog()
+	assert.Nil(t, err)
+	assert.Len(t, events, 0)
+
+	// IDs start over after a restart
+	f.set(slowlogEntry(0, 1760869300, 30000, "10.0.0.2:50400", "FLUSHALL"))
+	events, err = sp.pollSlowlog()
+	assert.Nil(t, err)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "FLUSHALL", events[0][commandKey])
+		assert.Equal(t, "FLUSHALL", events[0][normalizedCommandKey])
+	}
+
+	f.Lock()
+	assert.Equal(t, []string{"AUTH secret", "SLOWLOG GET 10"}, f.commands[:2])
+	f.Unlock()
+}
+
+func TestPollSlowlogAuthError(t *testing.T) {
+	f := newFakeRedis(t, "secret")
+	defer f.listener.Close()
+	sp := newSlowlogPoller(f.listener.Addr().String(), "default", "wrong", 10)
+	defer sp.close()
+
+	_, err := sp.pollSlowlog()
+	assert.EqualError(t, err, "WRONGPASS invalid username-password pair")
+	assert.Nil(t, sp.conn)
+}
+
+func TestNormalizeCommand(t *testing.T) {
+	assert.Equal(t, "GET session:?", normalizeCommand("GET", []string{"session:3f2a9c1e-77b0-4c1d-9e7a-0123456789ab"}))
+	assert.Equal(t, "SET cache:? ?", normalizeCommand("SET", []string{"cache:1234", "value"}))
+	assert.Equal(t, "PING", normalizeCommand("PING", nil))
+}
+
+func TestPollerRun(t *testing.T) {
+	f := newFakeRedis(t, "")
+	defer f.listener.Close()
+	f.set(slowlogEntry(5, 1760869261, 15000, "10.0.0.2:50312", "KEYS", "*"))
+	sp := newSlowlogPoller(f.listener.Addr().String(), "", "", 128)
+
+	type sentEvent struct {
+		sq        map[string]interface{}
+		timestamp time.Time
+	}
+	sent := make(chan sentEvent, 10)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		sp.run(10*time.Millisecond, done, func(sq map[string]interface{}, timestamp time.Time) {
+			sent <- sentEvent{sq, timestamp}
+		})
+		close(finished)
+	}()
+	time.Sleep(30 * time.Millisecond)
+	f.set(
+		slowlogEntry(6, 1760869262, 17000, "10.0.0.2:50312", "SMEMBERS", "big"),
+		slowlogEntry(5, 1760869261, 15000, "10.0.0.2:50312", "KEYS", "*"),
+	)
+	select {
+	case ev := <-sent:
+		assert.Equal(t, int64(6), ev.sq[slowlogIDKey])
+		assert.Equal(t, time.Unix(1760869262, 0).UTC(), ev.timestamp)
+		_, ok := ev.sq[timeKey]
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Error("timed out waiting for the poller")
+	}
+	close(done)
+	<-finished
+	assert.Nil(t, sp.conn)
+}
@@ -0,0 +1,156 @@
+package regex
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/AIntelligenceGame/clicktail/parsers/fieldtype"
+)
+
+// Grok patterns are regexes built from named sub-patterns:
+//
+//	%{IPORHOST:client} %{WORD:method} %{NUMBER:bytes:int}
+//
+// %{NAME} matches the definition NAME, %{NAME:field} captures it as field,
+// and %{NAME:field:type} converts the value to any of the fieldtype types
+// that don't take an argument, such as int, float, bool or duration (in ms).
+
+// deeper than this, the definitions are referring to each other
+const maxGrokDepth = 32
+
+var reGrokReference = regexp.MustCompile(`%\{(\w+)(?::([^:}]+))?(?::(\w+))?\}`)
+
+// grokField is the field a capture group of a compiled grok pattern is
+// stored in
+type grokField struct {
+	name      string
+	converter *fieldtype.Converter
+}
+
+// convert returns the value as the type of the field, or as is if it isn't
+// one
+func (f grokField) convert(value string) interface{} {
+	if f.converter != nil {
+		if typed, err := f.converter.Convert(value); err == nil {
+			return typed
+		}
+	}
+	return value
+}
+
+// grokLibrary is the definitions grok patterns can refer to, by name
+type grokLibrary map[string]string
+
+// newGrokLibrary returns the built-in definitions, plus or overridden by
+// those in the given files
+func newGrokLibrary(files []string) (grokLibrary, error) {
+	library := make(grokLibrary)
+	if err := library.load(strings.NewReader(builtinGrokPatterns)); err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		err = library.load(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+	}
+	return library, nil
+}
+
+// load reads definitions, one "NAME pattern" per line. Blank lines and lines
+// starting with # are skipped.
+func (l grokLibrary) load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			return fmt.Errorf("line %d: expected a name and a pattern, got %q", n, line)
+		}
+		l[fields[0]] = strings.TrimSpace(fields[1])
+	}
+	return scanner.Err()
+}
+
+// compile expands a grok pattern into a regex and the fields of its capture
+// groups, by group index
+func (l grokLibrary) compile(pattern string) (*regexp.Regexp, []grokField, error) {
+	var fields []grokField
+	expanded, err := l.expand(pattern, &fields, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the regex may have groups of its own, so map the generated ones back
+	// to their fields by index
+	groupFields := make([]grokField, len(re.SubexpNames()))
+	numFields := 0
+	for i, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		groupFields[i] = grokField{name: name}
+		if strings.HasPrefix(name, "grok") {
+			if n, err := strconv.Atoi(name[len("grok"):]); err == nil && n < len(fields) {
+				groupFields[i] = fields[n]
+			}
+		}
+		numFields++
+	}
+	if numFields == 0 {
+		return nil, nil, fmt.Errorf("No fields captured by grok pattern: '%s'. Capture at least one with %%{PATTERN:field}", pattern)
+	}
+	return re, groupFields, nil
+}
+
+func (l grokLibrary) expand(pattern string, fields *[]grokField, depth int) (string, error) {
+	if depth > maxGrokDepth {
+		return "", fmt.Errorf("grok definitions nested too deeply expanding '%s'", pattern)
+	}
+	var err error
+	expanded := reGrokReference.ReplaceAllStringFunc(pattern, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+		m := reGrokReference.FindStringSubmatch(ref)
+		definition, ok := l[m[1]]
+		if !ok {
+			err = fmt.Errorf("unknown grok pattern %%{%s}", m[1])
+			return ""
+		}
+		var sub string
+		sub, err = l.expand(definition, fields, depth+1)
+		if err != nil {
+			return ""
+		}
+		if m[2] == "" {
+			return "(?:" + sub + ")"
+		}
+		field := grokField{name: m[2]}
+		if m[3] != "" {
+			if field.converter, err = fieldtype.New(m[3], ""); err != nil {
+				err = fmt.Errorf("grok field %s: %s", m[2], err)
+				return ""
+			}
+		}
+		*fields = append(*fields, field)
+		return fmt.Sprintf("(?P<grok%d>%s)", len(*fields)-1, sub)
+	})
+	return expanded, err
+}
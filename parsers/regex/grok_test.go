@@ -0,0 +1,137 @@
+package regex
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrokParseLine(t *testing.T) {
+	tsts := []struct {
+		grok     string
+		line     string
+		expected map[string]interface{}
+	}{
+		{
+			"%{COMBINEDAPACHELOG}",
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`,
+			map[string]interface{}{
+				"clientip":    "127.0.0.1",
+				"ident":       "-",
+				"auth":        "frank",
+				"timestamp":   "10/Oct/2000:13:55:36 -0700",
+				"verb":        "GET",
+				"request":     "/apache_pb.gif",
+				"httpversion": "1.0",
+				"response":    int64(200),
+				"bytes":       int64(2326),
+				"referrer":    `"http://www.example.com/start.html"`,
+				"agent":       `"Mozilla/4.08 [en] (Win98; I ;Nav)"`,
+			},
+		},
+		{
+			"%{IPORHOST:client.ip} %{NUMBER:duration:float} %{WORD:cached:bool} %{GREEDYDATA:rest}",
+			"db-1.example.com 0.125 true and the rest",
+			map[string]interface{}{
+				"client.ip": "db-1.example.com",
+				"duration":  0.125,
+				"cached":    true,
+				"rest":      "and the rest",
+			},
+		},
+		{
+			"took %{NOTSPACE:took:duration}, sent %{NOTSPACE:sent:size} to %{IP:peer:ip}",
+			"took 1.5s, sent 10KB to 2001:DB8::1",
+			map[string]interface{}{
+				"took": 1500.0,
+				"sent": int64(10240),
+				"peer": "2001:db8::1",
+			},
+		},
+		{
+			"%{SYSLOGBASE} %{GREEDYDATA:message}",
+			"Mar  7 04:02:16 web-1 sshd[1234]: Accepted publickey for deploy",
+			map[string]interface{}{
+				"timestamp": "Mar  7 04:02:16",
+				"logsource": "web-1",
+				"program":   "sshd",
+				"pid":       int64(1234),
+				"message":   "Accepted publickey for deploy",
+			},
+		},
+		{
+			// plain named groups are fields too
+			`%{TIMESTAMP_ISO8601:time} (?P<level>[A-Z]+) %{QS:msg}`,
+			`2017-01-02T15:04:05+07:00 WARN "disk 'sda' is full"`,
+			map[string]interface{}{
+				"time":  "2017-01-02T15:04:05+07:00",
+				"level": "WARN",
+				"msg":   `"disk 'sda' is full"`,
+			},
+		},
+	}
+	for _, tt := range tsts {
+		p := &Parser{}
+		err := p.Init(&Options{Grok: []string{tt.grok}})
+		assert.Nil(t, err, tt.grok)
+		parsed, err := p.lineParser.ParseLine(tt.line)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, parsed, tt.grok)
+	}
+}
+
+func TestGrokInit(t *testing.T) {
+	for _, grok := range []string{
+		"%{NOPE:field}",
+		"%{WORD:field:date}",
+		"%{WORD} %{NUMBER}",
+	} {
+		p := &Parser{}
+		assert.NotNil(t, p.Init(&Options{Grok: []string{grok}}), grok)
+	}
+
+	// definitions that refer to each other
+	dir, err := ioutil.TempDir("", "grok")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	loop := filepath.Join(dir, "loop")
+	assert.Nil(t, ioutil.WriteFile(loop, []byte("A %{B}\nB %{A}\n"), 0644))
+	p := &Parser{}
+	assert.NotNil(t, p.Init(&Options{Grok: []string{"%{A:a}"}, GrokPatterns: []string{loop}}))
+}
+
+func TestGrokPatternsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grok")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "patterns")
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`# our app
+APPID [A-Z]{3}-\d+
+APPLOG %{APPID:id} took %{INT:took_ms:int}ms
+# redefine a built-in
+WORD [a-z]+
+`), 0644))
+
+	p := &Parser{}
+	err = p.Init(&Options{
+		LineRegex:    []string{`^(?P<legacy>legacy) line$`},
+		Grok:         []string{"%{APPLOG} %{WORD:word}"},
+		GrokPatterns: []string{file},
+	})
+	assert.Nil(t, err)
+	parsed, err := p.lineParser.ParseLine("ABC-12 took 340ms ok")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"id": "ABC-12", "took_ms": int64(340), "word": "ok"}, parsed)
+	parsed, err = p.lineParser.ParseLine("legacy line")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"legacy": "legacy"}, parsed)
+	parsed, err = p.lineParser.ParseLine("ABC-12 took 340ms OK")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{}, parsed)
+
+	p = &Parser{}
+	assert.NotNil(t, p.Init(&Options{Grok: []string{"%{WORD:w}"}, GrokPatterns: []string{filepath.Join(dir, "missing")}}))
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/AIntelligenceGame/clicktail/parsers/fieldtype"
 	"github.com/honeycombio/honeytail/event"
 	"github.com/honeycombio/honeytail/httime"
 	"github.com/honeycombio/honeytail/parsers"
@@ -24,6 +25,9 @@ type Options struct {
 	// it's less confusing to users to input them.
 	// Might be worth making this consistent across the entire repo
 	LineRegex       []string `long:"line_regex" description:"Regular expression with named capture groups representing the fields you want parsed (RE2 syntax). You can enter multiple regexes to match (--regex.line_regex=\"(?P<foo>re)\" --regex.line_regex=\"(?P<bar>...)\"). Parses using the first regex to match a line, so list them in most-to-least-specific order."`
+	Grok            []string `long:"grok" description:"Grok pattern representing the fields you want parsed, eg. \"%{IPORHOST:client} %{NUMBER:bytes:int}\". Fields can be typed as int, float, bool, duration, ip or size. You can enter multiple patterns; they're tried after any line_regex, in order."`
+	GrokPatterns    []string `long:"grok_patterns_file" description:"File of grok definitions, one \"NAME pattern\" per line, to use alongside (or override) the built-in ones. May be specified multiple times."`
+	FieldTypes      []string `long:"field_type" description:"Type to convert a field to, as field:type[:arg], eg. \"bytes:int\" or \"took:duration:ms\". Types are string, int, float, bool, duration (arg is the unit, default ms), ip, timestamp (arg is the format) and size (eg. 10KB, in bytes). May be specified multiple times."`
 	TimeFieldName   string   `long:"timefield" description:"Name of the field that contains a timestamp"`
 	TimeFieldFormat string   `long:"time_format" description:"Timestamp format to use (strftime and Golang time.Parse supported)"`
 	NumParsers      int      `hidden:"true" description:"number of regex parsers to spin up"`
@@ -32,17 +36,28 @@ type Options struct {
 type Parser struct {
 	conf       Options
 	lineParser parsers.LineParser
+	fieldTypes fieldtype.Fields
 }
 
 func (p *Parser) Init(options interface{}) error {
 	p.conf = *options.(*Options)
-	if len(p.conf.LineRegex) == 0 {
-		return errors.New("Must provide at least one regex for parsing log lines; use `--regex.line_regex` flag.")
+	if len(p.conf.LineRegex) == 0 && len(p.conf.Grok) == 0 {
+		return errors.New("Must provide at least one regex or grok pattern for parsing log lines; use `--regex.line_regex` or `--regex.grok` flag.")
 	}
+	fieldTypes, err := fieldtype.ParseFields(p.conf.FieldTypes)
+	if err != nil {
+		return err
+	}
+	p.fieldTypes = fieldTypes
 	lineParser, err := NewRegexLineParser(p.conf.LineRegex)
 	if err != nil {
 		return err
 	}
+	if len(p.conf.Grok) > 0 {
+		if err = lineParser.addGrokPatterns(p.conf.Grok, p.conf.GrokPatterns); err != nil {
+			return err
+		}
+	}
 	p.lineParser = lineParser
 	return nil
 }
@@ -98,6 +113,9 @@ func ParseLineRegex(regexStr string) (*regexp.Regexp, error) {
 
 type RegexLineParser struct {
 	lineRegexes []*regexp.Regexp
+	// the fields of the capture groups of each regex compiled from a grok
+	// pattern, nil for plain regexes
+	grokFields [][]grokField
 }
 
 // RegexLineParser factory
@@ -109,11 +127,32 @@ func NewRegexLineParser(regexStrs []string) (*RegexLineParser, error) {
 	logrus.WithFields(logrus.Fields{
 		"lineRegexes": lineRegexes,
 	}).Debug("Compiled line regexes")
-	return &RegexLineParser{lineRegexes}, nil
+	return &RegexLineParser{lineRegexes, make([][]grokField, len(lineRegexes))}, nil
+}
+
+// addGrokPatterns compiles grok patterns, using the built-in definitions and
+// those in patternFiles, and tries them after the regexes
+func (p *RegexLineParser) addGrokPatterns(patterns []string, patternFiles []string) error {
+	library, err := newGrokLibrary(patternFiles)
+	if err != nil {
+		return err
+	}
+	for _, pattern := range patterns {
+		re, fields, err := library.compile(pattern)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"grok": pattern,
+			}).Error("Could not compile grok pattern")
+			return err
+		}
+		p.lineRegexes = append(p.lineRegexes, re)
+		p.grokFields = append(p.grokFields, fields)
+	}
+	return nil
 }
 
 func (p *RegexLineParser) ParseLine(line string) (map[string]interface{}, error) {
-	for _, lineRegex := range p.lineRegexes {
+	for n, lineRegex := range p.lineRegexes {
 		parsed := make(map[string]interface{})
 		match := lineRegex.FindAllStringSubmatch(line, -1)
 		if match == nil || len(match) == 0 {
@@ -126,9 +165,22 @@ func (p *RegexLineParser) ParseLine(line string) (map[string]interface{}, error)
 
 		// Map capture groups
 		var firstMatch []string = match[0] // We only care about the first full lineRegex match
-		for i, name := range lineRegex.SubexpNames() {
-			if i != 0 && i < len(firstMatch) {
-				parsed[name] = firstMatch[i]
+		if fields := p.grokFields[n]; fields != nil {
+			for i, field := range fields {
+				// groups that didn't participate in the match are left out,
+				// and the first to match wins when a field is captured twice
+				if field.name == "" || i >= len(firstMatch) || firstMatch[i] == "" {
+					continue
+				}
+				if _, ok := parsed[field.name]; !ok {
+					parsed[field.name] = field.convert(firstMatch[i])
+				}
+			}
+		} else {
+			for i, name := range lineRegex.SubexpNames() {
+				if i != 0 && i < len(firstMatch) {
+					parsed[name] = firstMatch[i]
+				}
 			}
 		}
 		logrus.WithFields(logrus.Fields{
@@ -184,6 +236,7 @@ func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, pref
 
 				// look for the timestamp in any of the prefix fields or regular content
 				timestamp := httime.GetTimestamp(parsedLine, p.conf.TimeFieldName, p.conf.TimeFieldFormat)
+				p.fieldTypes.Apply(parsedLine)
 
 				// send an event to Transmission
 				e := event.Event{
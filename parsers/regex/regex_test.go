@@ -274,3 +274,37 @@ func TestProcessLines(t *testing.T) {
 		}
 	}
 }
+
+func TestProcessLinesFieldTypes(t *testing.T) {
+	p := &Parser{}
+	err := p.Init(&Options{
+		LineRegex: []string{
+			`(?P<time>\S+) (?P<client>\S+) (?P<status>\d+) (?P<bytes>\S+) (?P<took>\S+) (?P<cached>\w+)`,
+		},
+		FieldTypes:    []string{"status:int", "bytes:size", "took:duration:ms", "cached:bool", "client:ip"},
+		TimeFieldName: "time",
+	})
+	assert.NoError(t, err)
+
+	lines := make(chan string)
+	send := make(chan event.Event)
+	go func() {
+		lines <- "2015-10-08T00:26:26Z 10.0.0.1 200 1.5KB 0.25s yes"
+		close(lines)
+	}()
+	go p.ProcessLines(lines, send, nil)
+	ev := <-send
+	assert.Equal(t, time.Date(2015, 10, 8, 0, 26, 26, 0, time.UTC), ev.Timestamp)
+	assert.Equal(t, map[string]interface{}{
+		"client": "10.0.0.1",
+		"status": int64(200),
+		"bytes":  int64(1536),
+		"took":   250.0,
+		"cached": true,
+	}, ev.Data)
+
+	assert.Error(t, p.Init(&Options{
+		LineRegex:  []string{`(?P<status>\d+)`},
+		FieldTypes: []string{"status:integer"},
+	}))
+}
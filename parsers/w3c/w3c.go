@@ -0,0 +1,292 @@
+// Package w3c consumes logs in the W3C extended log file format, such as
+// CloudFront standard logs and IIS logs, with the columns named by their
+// #Fields directive
+package w3c
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/AIntelligenceGame/clicktail/parsers/fieldtype"
+	"github.com/honeycombio/honeytail/event"
+	"github.com/honeycombio/honeytail/httime"
+	"github.com/honeycombio/honeytail/parsers"
+)
+
+const (
+	flavorAuto       = "auto"
+	flavorCloudFront = "cloudfront"
+	flavorIIS        = "iis"
+
+	fieldsDirective = "#Fields:"
+
+	dateField     = "date"
+	timeField     = "time"
+	dateLayout    = "2006-01-02"
+	timeLayout    = "15:04:05"
+	dateTimeField = "datetime"
+)
+
+var (
+	reNonWord = regexp.MustCompile(`[^a-z0-9]+`)
+
+	errNoFields = errors.New("no #Fields directive before the entry, or --w3c.fields")
+)
+
+// decodedFields are the fields that are URL encoded, by flavor. CloudFront
+// encodes spaces and other characters as %XX, some of them twice; IIS
+// writes spaces as +.
+var decodedFields = map[string][]string{
+	flavorCloudFront: {"cs_uri_stem", "cs_referer", "cs_user_agent", "cs_cookie", "x_host_header"},
+	flavorIIS:        {"cs_referer", "cs_user_agent", "cs_cookie"},
+}
+
+type Options struct {
+	Flavor     string   `long:"flavor" description:"Where the logs come from, to decode their fields: cloudfront, iis, or auto to tell from the separator (tabs for CloudFront, spaces for IIS)" default:"auto"`
+	Fields     string   `long:"fields" description:"Space separated fields, as in the #Fields directive, for logs that don't have one, eg. \"date time c-ip cs-method cs-uri-stem sc-status\""`
+	FieldTypes []string `long:"field_type" description:"Type to convert a field to instead of guessing, as field:type[:arg], eg. \"c_ip:ip\". Types are string, int, float, bool, duration (arg is the unit, default ms), ip, timestamp (arg is the format) and size (eg. 10KB, in bytes). May be specified multiple times."`
+
+	LogFiles []string `hidden:"true" description:"log files to read the #Fields directive from"`
+}
+
+type Parser struct {
+	conf       Options
+	lineParser *W3CLineParser
+	// whether dropping an entry for want of a #Fields directive was logged
+	loggedNoFields bool
+}
+
+func (p *Parser) Init(options interface{}) error {
+	p.conf = *options.(*Options)
+	switch p.conf.Flavor {
+	case "":
+		p.conf.Flavor = flavorAuto
+	case flavorAuto, flavorCloudFront, flavorIIS:
+	default:
+		return fmt.Errorf("unknown w3c log flavor %q, expected cloudfront, iis or auto", p.conf.Flavor)
+	}
+	fieldTypes, err := fieldtype.ParseFields(p.conf.FieldTypes)
+	if err != nil {
+		return err
+	}
+	p.lineParser = &W3CLineParser{
+		flavor:     p.conf.Flavor,
+		fieldTypes: fieldTypes,
+	}
+	if p.conf.Fields != "" {
+		p.lineParser.setFields(p.conf.Fields)
+		return nil
+	}
+	// tailing usually resumes past the #Fields directive or starts at the end
+	// of the file, so it has to be read from the file
+	directive, err := lastFieldsDirective(p.conf.LogFiles)
+	if err != nil {
+		return err
+	}
+	if directive != "" {
+		p.lineParser.setFields(directive)
+	}
+	return nil
+}
+
+// lastFieldsDirective returns the fields of the last #Fields directive in the
+// most recently modified of the files, which is the one being written to, or
+// "" if there's none
+func lastFieldsDirective(patterns []string) (string, error) {
+	var (
+		newest  string
+		modTime time.Time
+	)
+	for _, pattern := range patterns {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			info, err := os.Stat(file)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			if newest == "" || info.ModTime().After(modTime) {
+				newest, modTime = file, info.ModTime()
+			}
+		}
+	}
+	if newest == "" {
+		return "", nil
+	}
+	fh, err := os.Open(newest)
+	if err != nil {
+		return "", fmt.Errorf("couldn't read the #Fields directive of %s: %s", newest, err)
+	}
+	defer fh.Close()
+	r := bufio.NewReader(fh)
+	var directive string
+	for {
+		line, err := r.ReadString('\n')
+		if strings.HasPrefix(line, fieldsDirective) {
+			directive = strings.TrimRight(strings.TrimPrefix(line, fieldsDirective), "\r\n")
+		}
+		if err == io.EOF {
+			return directive, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("couldn't read the #Fields directive of %s: %s", newest, err)
+		}
+	}
+}
+
+// W3CLineParser parses entries into fields named by the #Fields directive
+type W3CLineParser struct {
+	flavor     string
+	fields     []string
+	fieldTypes fieldtype.Fields
+}
+
+// setFields names the columns after a #Fields directive's fields, as
+// identifiers: cs(User-Agent) is cs_user_agent
+func (w *W3CLineParser) setFields(directive string) {
+	names := strings.Fields(directive)
+	w.fields = make([]string, len(names))
+	for i, name := range names {
+		w.fields[i] = strings.Trim(reNonWord.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	}
+}
+
+// ParseLine returns the fields of an entry, decoded and typed, with the
+// date and time put together as datetime
+func (w *W3CLineParser) ParseLine(line string) (map[string]interface{}, error) {
+	if len(w.fields) == 0 {
+		return nil, errNoFields
+	}
+	flavor := w.flavor
+	var values []string
+	if strings.Contains(line, "\t") {
+		values = strings.Split(line, "\t")
+		if flavor == flavorAuto {
+			flavor = flavorCloudFront
+		}
+	} else {
+		values = strings.Fields(line)
+		if flavor == flavorAuto {
+			flavor = flavorIIS
+		}
+	}
+	if len(values) != len(w.fields) {
+		return nil, fmt.Errorf("entry has %d fields, the #Fields directive %d", len(values), len(w.fields))
+	}
+	fields := make(map[string]string, len(values))
+	for i, v := range values {
+		fields[w.fields[i]] = v
+	}
+	for _, name := range decodedFields[flavor] {
+		if v, ok := fields[name]; ok && v != "-" {
+			fields[name] = decode(flavor, v)
+		}
+	}
+	date, hasDate := fields[dateField]
+	clock, hasTime := fields[timeField]
+	delete(fields, dateField)
+	delete(fields, timeField)
+
+	parsed := w.fieldTypes.ConvertOrInfer(fields)
+	if hasDate && hasTime {
+		parsed[dateTimeField] = date + " " + clock
+	}
+	return parsed, nil
+}
+
+// decode undoes the URL encoding of a field
+func decode(flavor, value string) string {
+	if flavor == flavorIIS {
+		return strings.Replace(value, "+", " ", -1)
+	}
+	// CloudFront encodes the % of some encoded values again, as %2520
+	for i := 0; i < 2 && strings.Contains(value, "%"); i++ {
+		decoded, err := url.PathUnescape(value)
+		if err != nil {
+			break
+		}
+		value = decoded
+	}
+	return value
+}
+
+func (p *Parser) ProcessLines(lines <-chan string, send chan<- event.Event, prefixRegex *parsers.ExtRegexp) {
+	// the #Fields directive applies to the entries after it, so entries are
+	// parsed in order, by one goroutine
+	for line := range lines {
+		line = strings.TrimRight(line, "\r\n")
+		logrus.WithFields(logrus.Fields{
+			"line": line,
+		}).Debug("Attempting to process w3c log line")
+
+		if strings.HasPrefix(line, "#") {
+			if strings.HasPrefix(line, fieldsDirective) && p.conf.Fields == "" {
+				p.lineParser.setFields(strings.TrimPrefix(line, fieldsDirective))
+			}
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		// take care of any headers on the line
+		var prefixFields map[string]string
+		if prefixRegex != nil {
+			var prefix string
+			prefix, prefixFields = prefixRegex.FindStringSubmatchMap(line)
+			line = strings.TrimPrefix(line, prefix)
+		}
+
+		parsedLine, err := p.lineParser.ParseLine(line)
+		if err == errNoFields && !p.loggedNoFields {
+			// every entry is dropped until a #Fields directive shows up
+			p.loggedNoFields = true
+			logrus.WithFields(logrus.Fields{
+				"line": line,
+			}).Error("skipping entries until a #Fields directive is read; set --w3c.fields if the log has none")
+			continue
+		}
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"line":  line,
+				"error": err,
+			}).Debug("skipping line; failed to parse.")
+			continue
+		}
+		// merge the prefix fields and the parsed line contents
+		for k, v := range prefixFields {
+			parsedLine[k] = v
+		}
+
+		send <- event.Event{
+			Timestamp: getTimestamp(parsedLine),
+			Data:      parsedLine,
+		}
+	}
+	logrus.Debug("lines channel is closed, ending w3c processor")
+}
+
+// getTimestamp returns the date and time of the entry, which are UTC, and
+// removes them from the event
+func getTimestamp(data map[string]interface{}) time.Time {
+	value, _ := data[dateTimeField].(string)
+	delete(data, dateTimeField)
+	t, err := time.Parse(dateLayout+" "+timeLayout, value)
+	if err != nil {
+		logrus.WithField("datetime", value).Debug("couldn't parse the entry's date and time, using the current time")
+		return httime.Now()
+	}
+	return t
+}
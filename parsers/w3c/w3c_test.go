@@ -0,0 +1,130 @@
+package w3c
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/honeycombio/honeytail/event"
+)
+
+const (
+	cloudFrontFields = "#Fields: date time x-edge-location sc-bytes c-ip cs-method cs(Host) cs-uri-stem sc-status cs(Referer) cs(User-Agent) cs-uri-query cs(Cookie) x-edge-result-type time-taken"
+	cloudFrontLine   = "2019-12-04\t21:02:31\tLAX1-C3\t392\t192.0.2.100\tGET\td111111abcdef8.cloudfront.net\t/caf%C3%A9.html\t200\t-\tMozilla/5.0%2520(Windows%2520NT%252010.0)\ta=1&b=%20\t-\tHit\t0.001"
+	iisFields        = "#Fields: date time s-ip cs-method cs-uri-stem cs-uri-query s-port cs-username c-ip cs(User-Agent) cs(Referer) sc-status sc-substatus sc-win32-status time-taken"
+	iisLine          = "2019-12-04 21:02:31 10.0.0.4 GET /default.aspx - 443 - 203.0.113.7 Mozilla/5.0+(Windows+NT+10.0) https://example.com/ 404 0 2 15"
+)
+
+func processLines(t *testing.T, opts *Options, input []string) []event.Event {
+	p := &Parser{}
+	assert.NoError(t, p.Init(opts))
+	lines := make(chan string)
+	send := make(chan event.Event)
+	go func() {
+		for _, line := range input {
+			lines <- line
+		}
+		close(lines)
+	}()
+	go func() {
+		p.ProcessLines(lines, send, nil)
+		close(send)
+	}()
+	var events []event.Event
+	for ev := range send {
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestProcessLinesCloudFront(t *testing.T) {
+	events := processLines(t, &Options{}, []string{
+		"#Version: 1.0",
+		cloudFrontFields,
+		cloudFrontLine,
+	})
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, time.Date(2019, 12, 4, 21, 2, 31, 0, time.UTC), events[0].Timestamp)
+	assert.Equal(t, map[string]interface{}{
+		"x_edge_location":    "LAX1-C3",
+		"sc_bytes":           int64(392),
+		"c_ip":               "192.0.2.100",
+		"cs_method":          "GET",
+		"cs_host":            "d111111abcdef8.cloudfront.net",
+		"cs_uri_stem":        "/café.html",
+		"sc_status":          int64(200),
+		"cs_user_agent":      "Mozilla/5.0 (Windows NT 10.0)",
+		"cs_uri_query":       "a=1&b=%20",
+		"x_edge_result_type": "Hit",
+		"time_taken":         0.001,
+	}, events[0].Data)
+}
+
+func TestProcessLinesIIS(t *testing.T) {
+	events := processLines(t, &Options{}, []string{
+		"#Software: Microsoft Internet Information Services 10.0",
+		iisFields,
+		iisLine,
+		"#Fields: date time c-ip sc-status",
+		"2019-12-04 21:02:32 203.0.113.8 500",
+		"2019-12-04 21:02:33 too many fields here",
+	})
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, map[string]interface{}{
+		"s_ip":            "10.0.0.4",
+		"cs_method":       "GET",
+		"cs_uri_stem":     "/default.aspx",
+		"s_port":          int64(443),
+		"c_ip":            "203.0.113.7",
+		"cs_user_agent":   "Mozilla/5.0 (Windows NT 10.0)",
+		"cs_referer":      "https://example.com/",
+		"sc_status":       int64(404),
+		"sc_substatus":    int64(0),
+		"sc_win32_status": int64(2),
+		"time_taken":      int64(15),
+	}, events[0].Data)
+	assert.Equal(t, map[string]interface{}{
+		"c_ip":      "203.0.113.8",
+		"sc_status": int64(500),
+	}, events[1].Data)
+	assert.Equal(t, time.Date(2019, 12, 4, 21, 2, 32, 0, time.UTC), events[1].Timestamp)
+}
+
+func TestProcessLinesConfiguredFields(t *testing.T) {
+	events := processLines(t, &Options{Fields: "date time c-ip sc-status", Flavor: flavorIIS}, []string{
+		"#Fields: date time ignored",
+		"2019-12-04 21:02:32 203.0.113.8 500",
+	})
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, int64(500), events[0].Data["sc_status"])
+
+	events = processLines(t, &Options{}, []string{"2019-12-04 21:02:32 203.0.113.8 500"})
+	assert.Equal(t, 0, len(events))
+
+	p := &Parser{}
+	assert.Error(t, p.Init(&Options{Flavor: "apache"}))
+}
+
+func TestInitReadsFieldsFromFile(t *testing.T) {
+	dir := t.TempDir()
+	older := filepath.Join(dir, "u_ex191203.log")
+	newer := filepath.Join(dir, "u_ex191204.log")
+	assert.NoError(t, ioutil.WriteFile(older, []byte("#Fields: date time cs-method\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(newer, []byte("#Fields: date time cs-method\n2019-12-04 21:02:31 GET\n#Fields: date time c-ip sc-status\r\n2019-12-04 21:02:32 203.0.113.8 500\n"), 0644))
+	old := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(older, old, old))
+
+	// resuming past the #Fields directive
+	events := processLines(t, &Options{Flavor: flavorIIS, LogFiles: []string{filepath.Join(dir, "*.log")}}, []string{
+		"2019-12-04 21:02:33 203.0.113.9 200",
+	})
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, map[string]interface{}{
+		"c_ip":      "203.0.113.9",
+		"sc_status": int64(200),
+	}, events[0].Data)
+}
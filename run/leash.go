@@ -21,18 +21,28 @@ import (
 	"github.com/honeycombio/urlshaper"
 	"github.com/sirupsen/logrus"
 
+	"github.com/AIntelligenceGame/clicktail/parsers/apache"
+	"github.com/AIntelligenceGame/clicktail/parsers/arangodb"
+	"github.com/AIntelligenceGame/clicktail/parsers/clickhouse"
+	"github.com/AIntelligenceGame/clicktail/parsers/csv"
+	"github.com/AIntelligenceGame/clicktail/parsers/elb"
+	"github.com/AIntelligenceGame/clicktail/parsers/envoy"
+	"github.com/AIntelligenceGame/clicktail/parsers/haproxy"
+	"github.com/AIntelligenceGame/clicktail/parsers/htjson"
+	"github.com/AIntelligenceGame/clicktail/parsers/keyval"
+	"github.com/AIntelligenceGame/clicktail/parsers/mongodb"
 	"github.com/AIntelligenceGame/clicktail/parsers/mysql"
 	"github.com/AIntelligenceGame/clicktail/parsers/mysqlaudit"
+	"github.com/AIntelligenceGame/clicktail/parsers/mysqlerror"
+	"github.com/AIntelligenceGame/clicktail/parsers/mysqlgeneral"
+	"github.com/AIntelligenceGame/clicktail/parsers/nginx"
 	"github.com/AIntelligenceGame/clicktail/parsers/postgresql"
+	"github.com/AIntelligenceGame/clicktail/parsers/redis"
+	"github.com/AIntelligenceGame/clicktail/parsers/regex"
+	"github.com/AIntelligenceGame/clicktail/parsers/w3c"
+	"github.com/AIntelligenceGame/clicktail/tail"
 	"github.com/honeycombio/honeytail/event"
 	"github.com/honeycombio/honeytail/parsers"
-	"github.com/honeycombio/honeytail/parsers/arangodb"
-	"github.com/honeycombio/honeytail/parsers/htjson"
-	"github.com/honeycombio/honeytail/parsers/keyval"
-	"github.com/honeycombio/honeytail/parsers/mongodb"
-	"github.com/honeycombio/honeytail/parsers/nginx"
-	"github.com/honeycombio/honeytail/parsers/regex"
-	"github.com/honeycombio/honeytail/tail"
 )
 
 // actually go and be leashy
@@ -81,16 +91,22 @@ func Run(options globals.GlobalOptions) {
 	var linesChans []chan string
 	var err error
 	tc := tail.Config{
-		Paths: options.Reqs.LogFiles,
-		Type:  tail.RotateStyleSyslog,
-		Options: tail.TailOptions{
-			ReadFrom:  options.Tail.ReadFrom,
-			Stop:      options.Tail.Stop,
-			Poll:      options.Tail.Poll,
-			StateFile: options.Tail.StateFile,
-		},
+		Paths:       options.Reqs.LogFiles,
+		Type:        tail.RotateStyleSyslog,
+		Options:     options.Tail,
+		PrefixRegex: options.PrefixRegex,
+		// let the HTTP listener turn clients away while we can't keep up
+		Backpressure: libclick.QueueFull,
 	}
-	if options.TailSample {
+	if globals.PollOnly(&options) {
+		// nothing to tail; the parser polls for its events until we're cancelled
+		idle := make(chan string)
+		go func() {
+			<-ctx.Done()
+			close(idle)
+		}()
+		linesChans = []chan string{idle}
+	} else if options.TailSample {
 		linesChans, err = tail.GetSampledEntries(ctx, tc, options.SampleRate)
 	} else {
 		linesChans, err = tail.GetEntries(ctx, tc)
@@ -231,15 +247,69 @@ func getParserAndOptions(options globals.GlobalOptions) (parsers.Parser, interfa
 		opts = &options.MySQL
 		opts.(*mysql.Options).NumParsers = int(options.NumSenders)
 	case "mysqlaudit":
-		parser = &mysqlaudit.Parser{}
+		parser = &mysqlaudit.Parser{
+			SampleRate: int(options.SampleRate),
+		}
 		opts = &options.MySQLAudit
 		opts.(*mysqlaudit.Options).NumParsers = int(options.NumSenders)
+	case "mysqlerror":
+		parser = &mysqlerror.Parser{
+			SampleRate: int(options.SampleRate),
+		}
+		opts = &options.MySQLError
+	case "mysqlgeneral":
+		parser = &mysqlgeneral.Parser{
+			SampleRate: int(options.SampleRate),
+		}
+		opts = &options.MySQLGeneral
+		opts.(*mysqlgeneral.Options).NumParsers = int(options.NumSenders)
+	case "clickhouse":
+		parser = &clickhouse.Parser{
+			SampleRate: int(options.SampleRate),
+		}
+		opts = &options.ClickHouse
+	case "redis":
+		parser = &redis.Parser{
+			SampleRate: int(options.SampleRate),
+		}
+		opts = &options.Redis
 	case "postgresql":
 		opts = &options.PostgreSQL
 		parser = &postgresql.Parser{}
 	case "arangodb":
 		parser = &arangodb.Parser{}
 		opts = &options.ArangoDB
+	case "apache":
+		parser = &apache.Parser{}
+		opts = &options.Apache
+		opts.(*apache.Options).NumParsers = int(options.NumSenders)
+	case "haproxy":
+		parser = &haproxy.Parser{}
+		opts = &options.HAProxy
+		opts.(*haproxy.Options).NumParsers = int(options.NumSenders)
+	case "envoy":
+		parser = &envoy.Parser{}
+		opts = &options.Envoy
+		opts.(*envoy.Options).NumParsers = int(options.NumSenders)
+	case "csv", "tsv":
+		parser = &csv.Parser{}
+		opts = &options.CSV
+		if options.Reqs.ParserName == "tsv" && options.CSV.Delimiter == "" {
+			opts.(*csv.Options).Delimiter = "tab"
+		}
+		opts.(*csv.Options).NumParsers = int(options.NumSenders)
+		opts.(*csv.Options).LogFiles = options.Reqs.LogFiles
+	case "elb":
+		parser = &elb.Parser{}
+		opts = &options.ELB
+		opts.(*elb.Options).NumParsers = int(options.NumSenders)
+	case "w3c", "cloudfront", "iis":
+		parser = &w3c.Parser{}
+		opts = &options.W3C
+		if options.Reqs.ParserName != "w3c" {
+			opts.(*w3c.Options).Flavor = options.Reqs.ParserName
+		}
+		opts.(*w3c.Options).LogFiles = options.Reqs.LogFiles
 	}
 	parser, _ = parser.(parsers.Parser)
 	return parser, opts
@@ -536,5 +606,25 @@ func logStats(stats *responseStats, interval uint) {
 	ticker := time.NewTicker(time.Second * time.Duration(interval))
 	for range ticker.C {
 		stats.logAndReset()
+		logTailStats()
+	}
+}
+
+// logTailStats reports how far behind each tailed file we are
+func logTailStats() {
+	for file, state := range tail.FileStats() {
+		fields := logrus.Fields{
+			"file":          file,
+			"size":          state.Size,
+			"offset":        state.Offset,
+			"bytes_behind":  state.BytesBehind,
+			"lines":         state.Lines,
+			"lines_per_sec": state.LinesPerSec,
+			"rotated":       state.Rotated,
+		}
+		if !state.LastLine.IsZero() {
+			fields["since_last_line"] = time.Since(state.LastLine).Round(time.Millisecond)
+		}
+		logrus.WithFields(fields).Info("Tail progress")
 	}
 }
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS clicktail.apache_log
+(
+    `_time` DateTime,
+    `_date` Date default toDate(`_time`),
+    `_ms` UInt32,
+
+    remote_host String,
+    remote_logname String,
+    remote_user String,
+    request String,
+    request_method String,
+    request_path String,
+    request_pathshape String,
+    request_protocol_version String,
+    request_shape String,
+    request_uri String,
+    request_query String,
+    request_queryshape String,
+    status UInt32,
+    body_bytes_sent UInt64,
+    bytes_received UInt64,
+    bytes_sent UInt64,
+    request_time_us UInt64,
+    http_referer String,
+    http_user_agent String,
+    server_name String,
+    server_port UInt32
+
+) ENGINE = MergeTree(`_date`, (`_time`, request_method, status), 8192);
@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS clicktail.arangodb_log
+(
+    `_time` DateTime,
+    `_date` Date default toDate(`_time`),
+    `_ms` UInt32,
+
+    pid String,
+    threadId UInt64,
+    threadName String,
+    hostname String,
+    role String,
+    logLevel String,
+    logId String,
+    logTopic String,
+    message String,
+    id String,
+    sourceIP String,
+    method String,
+    protocol String,
+    responseCode UInt32,
+    reqBodyLen UInt64,
+    resBodyLen UInt64,
+    fullURL String,
+    totalTime Float64,
+    query String,
+    queryTime Float64,
+    streaming UInt8,
+    bindVars String,
+    database String,
+    user String,
+    queryId UInt64,
+    peakMemoryUsage UInt64,
+    fingerprint String,
+    checksum UInt64
+
+) ENGINE = MergeTree(`_date`, (`_time`, logTopic, logLevel), 8192);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS clicktail.clickhouse_log
+(
+    `_time` DateTime,
+    `_date` Date default toDate(`_time`),
+    `_ms` UInt32,
+
+    thread_id UInt64,
+    query_id String,
+    level String,
+    logger String,
+    message String,
+    exception_code Int32,
+    read_rows UInt64,
+    read_bytes UInt64,
+    elapsed Float64
+
+) ENGINE = MergeTree(`_date`, (`_time`, level), 8192);
@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS clicktail.cloudfront_log
+(
+    `_time` DateTime,
+    `_date` Date default toDate(`_time`),
+    `_ms` UInt32,
+
+    x_edge_location String,
+    sc_bytes UInt64,
+    c_ip String,
+    cs_method String,
+    cs_host String,
+    cs_uri_stem String,
+    sc_status UInt32,
+    cs_referer String,
+    cs_user_agent String,
+    cs_uri_query String,
+    cs_cookie String,
+    x_edge_result_type String,
+    x_edge_request_id String,
+    x_host_header String,
+    cs_protocol String,
+    cs_bytes UInt64,
+    time_taken Float64,
+    x_forwarded_for String,
+    ssl_protocol String,
+    ssl_cipher String,
+    x_edge_response_result_type String,
+    cs_protocol_version String,
+    fle_status String,
+    fle_encrypted_fields String,
+    c_port UInt32,
+    time_to_first_byte Float64,
+    x_edge_detailed_result_type String,
+    sc_content_type String,
+    sc_content_len UInt64,
+    sc_range_start String,
+    sc_range_end String
+
+) ENGINE = MergeTree(`_date`, (`_time`, cs_host, sc_status), 8192);
@@ -0,0 +1,42 @@
+CREATE TABLE IF NOT EXISTS clicktail.elb_log
+(
+    `_time` DateTime,
+    `_date` Date default toDate(`_time`),
+    `_ms` UInt32,
+
+    type String,
+    elb String,
+    client_ip String,
+    client_port UInt32,
+    target_ip String,
+    target_port UInt32,
+    request_processing_time Float64,
+    target_processing_time Float64,
+    response_processing_time Float64,
+    elb_status_code UInt32,
+    target_status_code UInt32,
+    received_bytes UInt64,
+    sent_bytes UInt64,
+    user_agent String,
+    ssl_cipher String,
+    ssl_protocol String,
+    target_group_arn String,
+    trace_id String,
+    domain_name String,
+    chosen_cert_arn String,
+    matched_rule_priority String,
+    request_creation_time String,
+    actions_executed String,
+    redirect_url String,
+    error_reason String,
+    request String,
+    request_method String,
+    request_path String,
+    request_pathshape String,
+    request_protocol_version String,
+    request_shape String,
+    request_uri String,
+    request_query String,
+    request_queryshape String
+
+) ENGINE = MergeTree(`_date`, (`_time`, elb, elb_status_code), 8192);
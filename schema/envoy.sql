@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS clicktail.envoy_log
+(
+    `_time` DateTime,
+    `_date` Date default toDate(`_time`),
+    `_ms` UInt32,
+
+    method String,
+    path String,
+    protocol String,
+    response_code UInt32,
+    response_flags String,
+    bytes_received UInt64,
+    bytes_sent UInt64,
+    duration UInt64,
+    response_x_envoy_upstream_service_time UInt64,
+    x_forwarded_for String,
+    user_agent String,
+    x_request_id String,
+    authority String,
+    upstream_host String
+
+) ENGINE = MergeTree(`_date`, (`_time`, authority, response_code), 8192);
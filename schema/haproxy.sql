@@ -0,0 +1,46 @@
+CREATE TABLE IF NOT EXISTS clicktail.haproxy_log
+(
+    `_time` DateTime,
+    `_date` Date default toDate(`_time`),
+    `_ms` UInt32,
+
+    log_type String,
+    hostname String,
+    pid UInt32,
+    client_ip String,
+    client_port UInt32,
+    frontend_name String,
+    backend_name String,
+    server_name String,
+    time_request Int32,
+    time_queue Int32,
+    time_connect Int32,
+    time_response Int32,
+    time_total Int32,
+    status_code Int32,
+    bytes_read UInt64,
+    captured_request_cookie String,
+    captured_response_cookie String,
+    termination_state String,
+    termination_cause String,
+    termination_phase String,
+    actconn UInt32,
+    feconn UInt32,
+    beconn UInt32,
+    srv_conn UInt32,
+    retries UInt32,
+    srv_queue UInt32,
+    backend_queue UInt32,
+    captured_request_headers String,
+    captured_response_headers String,
+    request String,
+    request_method String,
+    request_path String,
+    request_pathshape String,
+    request_protocol_version String,
+    request_shape String,
+    request_uri String,
+    request_query String,
+    request_queryshape String
+
+) ENGINE = MergeTree(`_date`, (`_time`, frontend_name, backend_name), 8192);
@@ -7,6 +7,8 @@ CREATE TABLE IF NOT EXISTS clicktail.mysql_slow_log
     client String,
     query String,
     normalized_query String,
+    query_fingerprint String,
+    query_checksum UInt64,
     query_time Float32,
     user String,
     statement String,
@@ -47,6 +49,15 @@ CREATE TABLE IF NOT EXISTS clicktail.mysql_slow_log
     sl_rate_type String,
     sl_rate_limit UInt16,
 
+    source String,
+    digest String,
+    exec_count UInt64,
+    error_count UInt64,
+    warning_count UInt64,
+    select_scan UInt64,
+    no_index_used UInt64,
+    thread_id UInt64,
+
     hosted_on String,
     read_only UInt8,
     replica_lag UInt64,
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS clicktail.mysql_error_log
+(
+    `_time` DateTime,
+    `_date` Date default toDate(`_time`),
+    `_ms` UInt32,
+
+    thread UInt64,
+    severity String,
+    error_code String,
+    subsystem String,
+    message String
+
+) ENGINE = MergeTree(`_date`, (`_time`, severity), 8192);
\ No newline at end of file
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS clicktail.mysql_general_log
+(
+    `_time` DateTime,
+    `_date` Date default toDate(`_time`),
+    `_ms` UInt32,
+
+    connection_id UInt32,
+    command String,
+    argument String,
+    user String,
+    client String,
+    database String,
+    connect_type String,
+
+    query String,
+    normalized_query String,
+    query_fingerprint String,
+    query_checksum UInt64,
+    statement String,
+    tables String,
+    comments String
+
+) ENGINE = MergeTree(`_date`, (`_time`, command), 8192);
\ No newline at end of file
@@ -20,6 +20,13 @@ CREATE TABLE IF NOT EXISTS clicktail.mysql_audit_log
     sqltext String,
     status UInt32,
     user String,
-    startup_optionsi String
+    startup_options String,
+    server_id UInt32,
+
+    class String,
+    event String,
+    object String,
+    server_host String,
+    query_id UInt64
 
 ) ENGINE = MergeTree(`_date`, (`_time`, host, user), 8192);
\ No newline at end of file
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS clicktail.redis_log
+(
+    `_time` DateTime,
+    `_date` Date default toDate(`_time`),
+    `_ms` UInt32,
+
+    pid UInt32,
+    role String,
+    level String,
+    message String,
+    source String,
+    server String,
+    slowlog_id UInt64,
+    duration UInt64,
+    command String,
+    args String,
+    normalized_command String,
+    client_ip String,
+    client_port UInt32,
+    client_name String
+
+) ENGINE = MergeTree(`_date`, (`_time`, level), 8192);
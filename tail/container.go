@@ -0,0 +1,314 @@
+package tail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultContainerLogs is where the kubelet links the logs of every
+	// container running on the node
+	DefaultContainerLogs = "/var/log/containers/*.log"
+
+	// ContainerPrefixRegex matches the header put in front of every line read
+	// with --tail.container_format. It's merged into --log_prefix so that the
+	// pod metadata ends up in the event and the parser only sees the original
+	// line.
+	ContainerPrefixRegex = `^(?P<container_time>\S+) (?P<stream>stdout|stderr) (?P<k8s_namespace>[^/\s]+)/(?P<k8s_pod>[^/\s]+)/(?P<k8s_container>[^/\s]+)/(?P<k8s_container_id>[^/\s]+): `
+
+	// partial lines longer than this are sent on without waiting for the rest
+	maxContainerLineSize = 1024 * 1024
+)
+
+var (
+	// /var/log/containers/<pod>_<namespace>_<container>-<container id>.log
+	containerLogName = regexp.MustCompile(`^([^_]+)_([^_]+)_(.+)-([0-9a-f]{64})\.log$`)
+	// /var/log/pods/<namespace>_<pod>_<pod uid>/<container>/<restart count>.log
+	podLogDir = regexp.MustCompile(`^([^_]+)_([^_]+)_[^_]+$`)
+)
+
+// containerMeta identifies the container a log file belongs to
+type containerMeta struct {
+	namespace string
+	pod       string
+	container string
+	id        string
+}
+
+// containerMetaFromPath extracts the pod metadata from the log file name
+func containerMetaFromPath(path string) containerMeta {
+	meta := containerMeta{namespace: "-", pod: "-", container: "-", id: "-"}
+	if m := containerLogName.FindStringSubmatch(filepath.Base(path)); m != nil {
+		meta.pod, meta.namespace, meta.container, meta.id = m[1], m[2], m[3], m[4]
+		return meta
+	}
+	containerDir := filepath.Dir(path)
+	if m := podLogDir.FindStringSubmatch(filepath.Base(filepath.Dir(containerDir))); m != nil {
+		meta.namespace, meta.pod = m[1], m[2]
+		meta.container = filepath.Base(containerDir)
+	}
+	return meta
+}
+
+// containerLine is a single line unwrapped from a container runtime log
+type containerLine struct {
+	time    string
+	stream  string
+	log     string
+	partial bool
+}
+
+// parseCRILine parses the CRI log format used by containerd and cri-o:
+// <RFC3339Nano time> <stream> <P|F>[:more tags] <log>
+func parseCRILine(line string) (containerLine, bool) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) < 3 || (fields[1] != "stdout" && fields[1] != "stderr") {
+		return containerLine{}, false
+	}
+	cl := containerLine{
+		time:    fields[0],
+		stream:  fields[1],
+		partial: strings.SplitN(fields[2], ":", 2)[0] == "P",
+	}
+	if len(fields) == 4 {
+		cl.log = fields[3]
+	}
+	return cl, true
+}
+
+// parseDockerLine parses a line written by docker's json-file log driver. The
+// log field ends in a newline unless the line was split by docker.
+func parseDockerLine(line string) (containerLine, bool) {
+	var entry struct {
+		Log    *string `json:"log"`
+		Stream string  `json:"stream"`
+		Time   string  `json:"time"`
+	}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.Log == nil {
+		return containerLine{}, false
+	}
+	cl := containerLine{
+		time:    entry.Time,
+		stream:  entry.Stream,
+		log:     *entry.Log,
+		partial: !strings.HasSuffix(*entry.Log, "\n"),
+	}
+	if cl.stream != "stderr" {
+		cl.stream = "stdout"
+	}
+	if cl.time == "" {
+		cl.time = "-"
+	}
+	cl.log = strings.TrimSuffix(strings.TrimSuffix(cl.log, "\n"), "\r")
+	return cl, true
+}
+
+// containerDecoder unwraps the lines of a single container log file and
+// reassembles lines the runtime split into several partial ones
+type containerDecoder struct {
+	format  string
+	meta    containerMeta
+	pending map[string]*containerLine
+}
+
+func newContainerDecoder(format string, path string) *containerDecoder {
+	return &containerDecoder{
+		format:  format,
+		meta:    containerMetaFromPath(path),
+		pending: map[string]*containerLine{},
+	}
+}
+
+// decode returns the complete line to send on, or false if line was partial
+func (d *containerDecoder) decode(line string) (string, bool) {
+	var cl containerLine
+	var ok bool
+	switch {
+	case d.format == "docker", d.format == "auto" && strings.HasPrefix(line, "{"):
+		cl, ok = parseDockerLine(line)
+	default:
+		cl, ok = parseCRILine(line)
+	}
+	if !ok {
+		logrus.WithFields(logrus.Fields{
+			"line":   line,
+			"format": d.format,
+		}).Debug("line isn't in the container log format, passing it through")
+		return line, true
+	}
+	// partial lines are per stream, stdout and stderr may be interleaved
+	if prev, ok := d.pending[cl.stream]; ok {
+		prev.log += cl.log
+		prev.partial = cl.partial
+		cl = *prev
+	}
+	if cl.partial && len(cl.log) < maxContainerLineSize {
+		d.pending[cl.stream] = &cl
+		return "", false
+	}
+	delete(d.pending, cl.stream)
+	return d.render(cl), true
+}
+
+// flush returns any partial lines still waiting for the rest of their content
+func (d *containerDecoder) flush() []string {
+	var lines []string
+	for _, stream := range []string{"stdout", "stderr"} {
+		if cl, ok := d.pending[stream]; ok {
+			lines = append(lines, d.render(*cl))
+			delete(d.pending, stream)
+		}
+	}
+	return lines
+}
+
+// render renders the line with the header matched by ContainerPrefixRegex
+func (d *containerDecoder) render(cl containerLine) string {
+	return fmt.Sprintf("%s %s %s/%s/%s/%s: %s", cl.time, cl.stream,
+		d.meta.namespace, d.meta.pod, d.meta.container, d.meta.id, cl.log)
+}
+
+// decodeContainerLines unwraps every line read from a container log file
+func decodeContainerLines(format string, path string, lines chan string) chan string {
+	decoded := make(chan string)
+	d := newContainerDecoder(format, path)
+	go func() {
+		defer close(decoded)
+		for line := range lines {
+			if out, ok := d.decode(line); ok {
+				decoded <- out
+			}
+		}
+		for _, out := range d.flush() {
+			decoded <- out
+		}
+	}()
+	return decoded
+}
+
+// containerStateFile returns the statefile of a container log. In the
+// /var/log/pods layout every container's log is named 0.log and the like, so
+// it's named after the whole path rather than the file's name.
+func containerStateFile(conf Config, file string) string {
+	name := strings.Trim(strings.Replace(filepath.Clean(file), string(filepath.Separator), "_", -1), "_")
+	return getStateFile(conf, name, 0)
+}
+
+// tailContainerLogs tails every file matching conf.Paths and merges their
+// unwrapped lines into a single channel. Unless --tail.stop is set, the globs
+// are expanded again every ContainerRescan seconds so that containers started
+// later are picked up from the beginning of their log, and files that are
+// gone (eg the pod was deleted) stop being tailed.
+func tailContainerLogs(ctx context.Context, conf Config, joiner *multilineJoiner) (chan string, error) {
+	switch conf.Options.ContainerFormat {
+	case "cri", "docker", "auto":
+	default:
+		return nil, fmt.Errorf("unknown option to --container_format: %s", conf.Options.ContainerFormat)
+	}
+	merged := make(chan string)
+	wg := sync.WaitGroup{}
+	tailing := map[string]func(){}
+
+	startFile := func(file string, readConf Config) {
+		fileCtx, cancel := context.WithCancel(ctx)
+		stateFile := containerStateFile(readConf, file)
+		tailer, err := getTailer(readConf, file, stateFile)
+		if err != nil {
+			logrus.WithError(err).WithField("file", file).Warn("failed to tail container log")
+			cancel()
+			return
+		}
+		gone := make(chan struct{})
+		tailing[file] = func() {
+			close(gone)
+			cancel()
+			tailer.Stop()
+			tailer.Cleanup()
+		}
+		lines := decodeContainerLines(conf.Options.ContainerFormat, file,
+			tailSingleFile(fileCtx, tailer, file, stateFile))
+		if joiner != nil {
+			lines = joiner.join(lines)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for line := range lines {
+				merged <- line
+			}
+			if fileCtx.Err() != nil {
+				// the file is gone, don't keep reporting on it
+				forgetFileStats(file)
+			}
+			select {
+			case <-gone:
+				// the lines are only closed once the statefile is written
+				// for the last time, so it's safe to remove now
+				os.Remove(stateFile)
+			default:
+			}
+		}()
+	}
+
+	scan := func(readConf Config) {
+		seen := map[string]bool{}
+		for _, path := range conf.Paths {
+			files, err := filepath.Glob(path)
+			if err != nil {
+				continue
+			}
+			for _, file := range removeStateFiles(files, conf) {
+				seen[file] = true
+				if _, ok := tailing[file]; !ok {
+					logrus.WithField("file", file).Debug("tailing container log")
+					startFile(file, readConf)
+				}
+			}
+		}
+		for file, stop := range tailing {
+			if !seen[file] {
+				logrus.WithField("file", file).Debug("container log is gone, no longer tailing it")
+				stop()
+				delete(tailing, file)
+			}
+		}
+	}
+
+	scan(conf)
+	go func() {
+		defer func() {
+			wg.Wait()
+			close(merged)
+		}()
+		if conf.Options.Stop {
+			return
+		}
+		rescan := time.Duration(conf.Options.ContainerRescan) * time.Second
+		if rescan <= 0 {
+			rescan = 10 * time.Second
+		}
+		ticker := time.NewTicker(rescan)
+		defer ticker.Stop()
+		// containers that show up from now on are read from the start
+		newConf := conf
+		newConf.Options.ReadFrom = "beginning"
+		for {
+			select {
+			case <-ticker.C:
+				scan(newConf)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return merged, nil
+}
@@ -0,0 +1,259 @@
+package tail
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testContainerID = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestContainerMetaFromPath(t *testing.T) {
+	tsts := []struct {
+		path     string
+		expected containerMeta
+	}{
+		{
+			"/var/log/containers/web-7d9f_prod_nginx-" + testContainerID + ".log",
+			containerMeta{namespace: "prod", pod: "web-7d9f", container: "nginx", id: testContainerID},
+		},
+		{
+			"/var/log/pods/prod_web-7d9f_8c1e6a0c-2b7a-4c1e-9c57-1f2e3d4c5b6a/nginx/0.log",
+			containerMeta{namespace: "prod", pod: "web-7d9f", container: "nginx", id: "-"},
+		},
+		{
+			"/var/log/app.log",
+			containerMeta{namespace: "-", pod: "-", container: "-", id: "-"},
+		},
+	}
+	for _, tt := range tsts {
+		if meta := containerMetaFromPath(tt.path); meta != tt.expected {
+			t.Errorf("%s: got %+v, expected %+v", tt.path, meta, tt.expected)
+		}
+	}
+}
+
+func TestContainerDecoder(t *testing.T) {
+	path := "/var/log/containers/web_prod_nginx-" + testContainerID + ".log"
+	tsts := []struct {
+		desc     string
+		format   string
+		in       []string
+		expected []string
+	}{
+		{
+			desc:   "cri with partial lines",
+			format: "cri",
+			in: []string{
+				"2018-10-11T22:14:15.003Z stdout F first",
+				"2018-10-11T22:14:16.000Z stdout P sec",
+				"2018-10-11T22:14:16.001Z stderr F oops",
+				"2018-10-11T22:14:16.002Z stdout F ond",
+				"2018-10-11T22:14:17.000Z stdout F",
+			},
+			expected: []string{
+				"2018-10-11T22:14:15.003Z stdout prod/web/nginx/" + testContainerID + ": first",
+				"2018-10-11T22:14:16.001Z stderr prod/web/nginx/" + testContainerID + ": oops",
+				"2018-10-11T22:14:16.000Z stdout prod/web/nginx/" + testContainerID + ": second",
+				"2018-10-11T22:14:17.000Z stdout prod/web/nginx/" + testContainerID + ": ",
+			},
+		},
+		{
+			desc:   "docker json-file",
+			format: "docker",
+			in: []string{
+				`{"log":"{\"status\":200}\n","stream":"stdout","time":"2018-10-11T22:14:15.003Z"}`,
+				`{"log":"split ","stream":"stderr","time":"2018-10-11T22:14:16Z"}`,
+				`{"log":"line\n","stream":"stderr","time":"2018-10-11T22:14:16.1Z"}`,
+			},
+			expected: []string{
+				`2018-10-11T22:14:15.003Z stdout prod/web/nginx/` + testContainerID + `: {"status":200}`,
+				"2018-10-11T22:14:16Z stderr prod/web/nginx/" + testContainerID + ": split line",
+			},
+		},
+		{
+			desc:   "auto detects each line and passes through unknown ones",
+			format: "auto",
+			in: []string{
+				`{"log":"a\n","stream":"stdout","time":"t1"}`,
+				"t2 stderr F b",
+				"not a container line",
+				"t3 stdout P never finished",
+			},
+			expected: []string{
+				"t1 stdout prod/web/nginx/" + testContainerID + ": a",
+				"t2 stderr prod/web/nginx/" + testContainerID + ": b",
+				"not a container line",
+				"t3 stdout prod/web/nginx/" + testContainerID + ": never finished",
+			},
+		},
+	}
+	for _, tt := range tsts {
+		lines := make(chan string)
+		go func(in []string) {
+			for _, line := range in {
+				lines <- line
+			}
+			close(lines)
+		}(tt.in)
+		var actual []string
+		for line := range decodeContainerLines(tt.format, path, lines) {
+			actual = append(actual, line)
+		}
+		if strings.Join(actual, "|") != strings.Join(tt.expected, "|") {
+			t.Errorf("%s:\n\tgot      %q\n\texpected %q", tt.desc, actual, tt.expected)
+		}
+	}
+}
+
+func TestContainerPrefixRegex(t *testing.T) {
+	prefix := regexp.MustCompile(ContainerPrefixRegex)
+	d := newContainerDecoder("cri", "/var/log/containers/web_prod_nginx-"+testContainerID+".log")
+	line, _ := d.decode("2018-10-11T22:14:15Z stdout F hello")
+	match := prefix.FindStringSubmatch(line)
+	if match == nil {
+		t.Fatalf("%q doesn't match the container prefix", line)
+	}
+	fields := map[string]string{}
+	for i, name := range prefix.SubexpNames() {
+		if name != "" {
+			fields[name] = match[i]
+		}
+	}
+	expected := map[string]string{
+		"container_time":   "2018-10-11T22:14:15Z",
+		"stream":           "stdout",
+		"k8s_namespace":    "prod",
+		"k8s_pod":          "web",
+		"k8s_container":    "nginx",
+		"k8s_container_id": testContainerID,
+	}
+	for k, v := range expected {
+		if fields[k] != v {
+			t.Errorf("%s: got %q, expected %q", k, fields[k], v)
+		}
+	}
+	if rest := line[len(match[0]):]; rest != "hello" {
+		t.Errorf("expected the prefix to leave the line, got %q", rest)
+	}
+}
+
+func TestTailContainerLogs(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+
+	ts.writeFile(t, filepath.Join(ts.tmpdir, "a_ns_c1-"+testContainerID+".log"),
+		"t1 stdout F one\nt2 stdout F two\n")
+	ts.writeFile(t, filepath.Join(ts.tmpdir, "b_ns_c2-"+testContainerID+".log"),
+		`{"log":"three\n","stream":"stderr","time":"t3"}`+"\n")
+	statedir := filepath.Join(ts.tmpdir, "state")
+	os.Mkdir(statedir, 0755)
+
+	opts := tailOpts
+	opts.ContainerFormat = "auto"
+	opts.StateFile = statedir
+	conf := Config{
+		Paths:   []string{filepath.Join(ts.tmpdir, "*.log")},
+		Options: opts,
+	}
+	chans, err := GetEntries(ts.ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chans) != 1 {
+		t.Fatalf("expected container logs to be merged into one channel, got %d", len(chans))
+	}
+	var actual []string
+	timeout := time.After(5 * time.Second)
+	for done := false; !done; {
+		select {
+		case line, ok := <-chans[0]:
+			if !ok {
+				done = true
+				break
+			}
+			actual = append(actual, line)
+		case <-timeout:
+			t.Fatal("timed out waiting for container logs")
+		}
+	}
+	sort.Strings(actual)
+	expected := []string{
+		"t1 stdout ns/a/c1/" + testContainerID + ": one",
+		"t2 stdout ns/a/c1/" + testContainerID + ": two",
+		"t3 stderr ns/b/c2/" + testContainerID + ": three",
+	}
+	if strings.Join(actual, "|") != strings.Join(expected, "|") {
+		t.Errorf("got %q, expected %q", actual, expected)
+	}
+
+	conf.Options.ContainerFormat = "podman"
+	if _, err := GetEntries(ts.ctx, conf); err == nil {
+		t.Error("expected an unknown container format to be rejected")
+	}
+}
+
+func TestContainerStateFile(t *testing.T) {
+	statedir := t.TempDir()
+	conf := Config{Options: TailOptions{StateFile: statedir}}
+	a := containerStateFile(conf, "/var/log/pods/prod_web-7d9f_8c1e6a0c-2b7a-4c1e-9c57-1f2e3d4c5b6a/nginx/0.log")
+	b := containerStateFile(conf, "/var/log/pods/prod_api-5c2b_1d2e3f4a-5b6c-7d8e-9f0a-1b2c3d4e5f6a/nginx/0.log")
+	if a == b {
+		t.Errorf("expected containers with the same log file name to have different statefiles, both got %s", a)
+	}
+	if filepath.Dir(a) != statedir || !strings.HasSuffix(a, ".leash.state") {
+		t.Errorf("unexpected statefile %s", a)
+	}
+}
+
+func TestTailContainerLogsSameFileName(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+
+	for _, pod := range []string{"ns_a_uid1", "ns_b_uid2"} {
+		dir := filepath.Join(ts.tmpdir, pod, "c")
+		os.MkdirAll(dir, 0755)
+		ts.writeFile(t, filepath.Join(dir, "0.log"), "t1 stdout F from "+pod+"\n")
+	}
+	statedir := filepath.Join(ts.tmpdir, "state")
+	os.Mkdir(statedir, 0755)
+
+	opts := tailOpts
+	opts.ContainerFormat = "cri"
+	opts.StateFile = statedir
+	conf := Config{
+		Paths:   []string{filepath.Join(ts.tmpdir, "*", "c", "0.log")},
+		Options: opts,
+	}
+	chans, err := GetEntries(ts.ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual []string
+	timeout := time.After(5 * time.Second)
+	for done := false; !done; {
+		select {
+		case line, ok := <-chans[0]:
+			if !ok {
+				done = true
+				break
+			}
+			actual = append(actual, line)
+		case <-timeout:
+			t.Fatal("timed out waiting for container logs")
+		}
+	}
+	if len(actual) != 2 {
+		t.Errorf("expected a line from each pod, got %q", actual)
+	}
+	stateFiles, _ := filepath.Glob(filepath.Join(statedir, "*.leash.state"))
+	if len(stateFiles) != 2 {
+		t.Errorf("expected a statefile per container, got %q", stateFiles)
+	}
+}
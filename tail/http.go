@@ -0,0 +1,222 @@
+package tail
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// httpScheme prefixes a listen address given to --file, eg
+	// http://0.0.0.0:8080/ingest
+	httpScheme = "http://"
+
+	// largest request body we'll accept, after decompression
+	maxIngestBodySize = 16 * 1024 * 1024
+
+	// how long a request waits for the pipeline to take a line before giving
+	// up and telling the client to back off
+	ingestSendTimeout = 5 * time.Second
+
+	// suggested wait, in seconds, before retrying a request we turned away
+	ingestRetryAfter = "1"
+)
+
+// IsHTTPSource returns true if the path given to --file is an address to
+// accept log lines on over HTTP
+func IsHTTPSource(path string) bool {
+	return strings.HasPrefix(path, httpScheme)
+}
+
+// ingestResponse is the body returned for every POST
+type ingestResponse struct {
+	Accepted int    `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ingestHandler accepts log lines POSTed as newline delimited text, or as a
+// JSON array of strings or objects. Each object is passed on as one line of
+// JSON, ready for the json parser.
+type ingestHandler struct {
+	lines        chan<- string
+	backpressure func() bool
+	sendTimeout  time.Duration
+}
+
+func (h *ingestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		h.respond(w, http.StatusMethodNotAllowed, 0, errors.New("only POST is supported"))
+		return
+	}
+	if h.backpressure != nil && h.backpressure() {
+		w.Header().Set("Retry-After", ingestRetryAfter)
+		h.respond(w, http.StatusTooManyRequests, 0, errors.New("send queue is full"))
+		return
+	}
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			h.respond(w, http.StatusBadRequest, 0, err)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(body, maxIngestBodySize+1))
+	if err != nil {
+		h.respond(w, http.StatusBadRequest, 0, err)
+		return
+	}
+	if len(data) > maxIngestBodySize {
+		h.respond(w, http.StatusRequestEntityTooLarge, 0,
+			fmt.Errorf("request body exceeds %d bytes", maxIngestBodySize))
+		return
+	}
+
+	var lines []string
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		if lines, err = decodeJSONBody(data); err != nil {
+			h.respond(w, http.StatusBadRequest, 0, err)
+			return
+		}
+	} else {
+		lines = decodeTextBody(data)
+	}
+
+	timeout := time.NewTimer(h.sendTimeout)
+	defer timeout.Stop()
+	for i, line := range lines {
+		select {
+		case h.lines <- line:
+		case <-timeout.C:
+			w.Header().Set("Retry-After", ingestRetryAfter)
+			h.respond(w, http.StatusTooManyRequests, i, errors.New("timed out waiting for the send queue"))
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+	h.respond(w, http.StatusAccepted, len(lines), nil)
+}
+
+func (h *ingestHandler) respond(w http.ResponseWriter, status int, accepted int, err error) {
+	resp := ingestResponse{Accepted: accepted}
+	if err != nil {
+		resp.Error = err.Error()
+		logrus.WithFields(logrus.Fields{
+			"status":   status,
+			"accepted": accepted,
+		}).WithError(err).Debug("rejected ingest request")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// decodeTextBody splits the body into lines, dropping empty ones
+func decodeTextBody(data []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSuffix(line, "\r"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// decodeJSONBody turns a JSON array of strings or objects, or a single
+// object, into lines
+func decodeJSONBody(data []byte) ([]string, error) {
+	raw := bytes.TrimSpace(data)
+	var items []json.RawMessage
+	if bytes.HasPrefix(raw, []byte("[")) {
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, err
+		}
+	} else {
+		items = []json.RawMessage{json.RawMessage(raw)}
+	}
+	lines := make([]string, 0, len(items))
+	for _, item := range items {
+		var s string
+		if err := json.Unmarshal(item, &s); err == nil {
+			lines = append(lines, s)
+			continue
+		}
+		var obj map[string]interface{}
+		if err := json.Unmarshal(item, &obj); err != nil {
+			return nil, errors.New("expected an array of strings or objects")
+		}
+		// re-encode to get rid of any newlines in the original formatting
+		line, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, string(line))
+	}
+	return lines, nil
+}
+
+// listenHTTP serves the ingest endpoint described by source, eg
+// http://0.0.0.0:8080/ingest. The endpoint answers on / if no path is given.
+func listenHTTP(ctx context.Context, source string, backpressure func() bool) (chan string, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	listener, err := net.Listen("tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	logrus.WithFields(logrus.Fields{
+		"address": listener.Addr().String(),
+		"path":    path,
+	}).Info("Listening for log lines over HTTP")
+
+	lines := make(chan string)
+	mux := http.NewServeMux()
+	mux.Handle(path, &ingestHandler{
+		lines:        lines,
+		backpressure: backpressure,
+		sendTimeout:  ingestSendTimeout,
+	})
+	server := &http.Server{
+		Handler: mux,
+		// requests still waiting on the pipeline give up once we're cancelled
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		if err := server.Serve(listener); err != http.ErrServerClosed {
+			logrus.WithError(err).Warn("HTTP ingest listener failed")
+		}
+	}()
+	go func() {
+		defer close(lines)
+		<-ctx.Done()
+		// Shutdown waits for the handlers to return, so none of them are left
+		// to send on lines once it's closed
+		server.Shutdown(context.Background())
+	}()
+	return lines, nil
+}
@@ -0,0 +1,170 @@
+package tail
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIngestHandler(t *testing.T) {
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write([]byte("one\ntwo\n"))
+	gz.Close()
+
+	tsts := []struct {
+		desc        string
+		method      string
+		contentType string
+		encoding    string
+		body        string
+		full        bool
+		status      int
+		expected    []string
+	}{
+		{
+			desc:     "newline delimited text",
+			body:     "a=1\r\n\nb=2\nc=3",
+			status:   http.StatusAccepted,
+			expected: []string{"a=1", "b=2", "c=3"},
+		},
+		{
+			desc:        "json array of objects and strings",
+			contentType: "application/json; charset=utf-8",
+			body:        "[{\"a\":\n1}, \"raw line\"]",
+			status:      http.StatusAccepted,
+			expected:    []string{`{"a":1}`, "raw line"},
+		},
+		{
+			desc:        "single json object",
+			contentType: "application/json",
+			body:        `{"b":2}`,
+			status:      http.StatusAccepted,
+			expected:    []string{`{"b":2}`},
+		},
+		{
+			desc:     "gzipped body",
+			encoding: "gzip",
+			body:     gzipped.String(),
+			status:   http.StatusAccepted,
+			expected: []string{"one", "two"},
+		},
+		{
+			desc:        "invalid json",
+			contentType: "application/json",
+			body:        `[1, 2]`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			desc:   "only POST is allowed",
+			method: "GET",
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			desc:   "backpressure",
+			body:   "a=1",
+			full:   true,
+			status: http.StatusTooManyRequests,
+		},
+	}
+	for _, tt := range tsts {
+		lines := make(chan string, 10)
+		h := &ingestHandler{
+			lines:        lines,
+			backpressure: func() bool { return tt.full },
+			sendTimeout:  time.Second,
+		}
+		method := tt.method
+		if method == "" {
+			method = "POST"
+		}
+		req := httptest.NewRequest(method, "/", strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		if tt.encoding != "" {
+			req.Header.Set("Content-Encoding", tt.encoding)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		close(lines)
+
+		if rec.Code != tt.status {
+			t.Errorf("%s: got status %d, expected %d (%s)", tt.desc, rec.Code, tt.status, rec.Body.String())
+		}
+		var actual []string
+		for line := range lines {
+			actual = append(actual, line)
+		}
+		if strings.Join(actual, "|") != strings.Join(tt.expected, "|") {
+			t.Errorf("%s:\n\tgot      %q\n\texpected %q", tt.desc, actual, tt.expected)
+		}
+		if tt.status == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: expected a Retry-After header", tt.desc)
+		}
+	}
+}
+
+func TestIngestHandlerSendTimeout(t *testing.T) {
+	// nobody reads from lines, so the pipeline looks stuck
+	h := &ingestHandler{lines: make(chan string), sendTimeout: 10 * time.Millisecond}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/", strings.NewReader("a\nb")))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d, expected %d", rec.Code, http.StatusTooManyRequests)
+	}
+	resp := ingestResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Accepted != 0 {
+		t.Errorf("expected no lines to be accepted, got %+v, %v", resp, err)
+	}
+}
+
+func TestListenHTTP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	chans, err := GetEntries(ctx, Config{Options: tailOpts, Paths: []string{"http://" + addr + "/ingest"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		resp, err := http.Post("http://"+addr+"/ingest", "text/plain", strings.NewReader("hello\n"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Errorf("got status %d, expected %d", resp.StatusCode, http.StatusAccepted)
+		}
+	}()
+	select {
+	case line := <-chans[0]:
+		if line != "hello" {
+			t.Errorf("got %q, expected %q", line, "hello")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the POSTed line")
+	}
+	cancel()
+	select {
+	case _, ok := <-chans[0]:
+		if ok {
+			t.Error("expected the lines channel to be closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("lines channel wasn't closed on cancel")
+	}
+}
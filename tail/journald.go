@@ -0,0 +1,249 @@
+package tail
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// journaldScheme selects the systemd journal as a source. It may be
+	// followed by a comma separated list of units to filter on, eg
+	// journald:nginx.service,mysql.service
+	journaldScheme = "journald:"
+
+	// binary journal fields larger than this are considered corrupt
+	maxJournalFieldSize = 16 * 1024 * 1024
+)
+
+// journalctlCommand is the binary used to read the journal
+var journalctlCommand = "journalctl"
+
+// tailJournal runs journalctl in export mode and hands on one line per journal
+// entry, prefixed as described by SourcePrefixRegex. The cursor of the last
+// entry read is kept in stateFile so --tail.read_from=last can resume.
+func tailJournal(ctx context.Context, units string, conf Config, stateFile string) (chan string, error) {
+	args := journalctlArgs(units, conf.Options, readJournalCursor(stateFile))
+	cmd := exec.Command(journalctlCommand, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	logrus.WithFields(logrus.Fields{
+		"command": journalctlCommand,
+		"args":    args,
+	}).Debug("about to start journalctl")
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("couldn't start %s: %v", journalctlCommand, err)
+	}
+
+	var cursorLock sync.Mutex
+	var cursor, savedCursor string
+	saveCursor := func() {
+		cursorLock.Lock()
+		defer cursorLock.Unlock()
+		if cursor != savedCursor {
+			writeJournalCursor(stateFile, cursor)
+			savedCursor = cursor
+		}
+	}
+	ticker := time.NewTicker(time.Second)
+	finished := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				saveCursor()
+			case <-ctx.Done():
+				// let journalctl exit cleanly rather than killing it
+				cmd.Process.Signal(syscall.SIGTERM)
+				return
+			case <-finished:
+				return
+			}
+		}
+	}()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		br := bufio.NewReader(stdout)
+	ReadEntries:
+		for {
+			entry, err := readJournalEntry(br)
+			if err != nil {
+				if err != io.EOF && ctx.Err() == nil {
+					logrus.WithError(err).Warn("failed to read from journalctl")
+				}
+				break
+			}
+			if _, ok := entry["MESSAGE"]; ok {
+				select {
+				case lines <- journalMessage(entry).String():
+				case <-ctx.Done():
+					break ReadEntries
+				}
+			}
+			if c, ok := entry["__CURSOR"]; ok {
+				cursorLock.Lock()
+				cursor = c
+				cursorLock.Unlock()
+			}
+		}
+		close(finished)
+		ticker.Stop()
+		io.Copy(ioutil.Discard, stdout)
+		if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+			logrus.WithError(err).Warn("journalctl exited with an error")
+		}
+		saveCursor()
+	}()
+	return lines, nil
+}
+
+// journalctlArgs translates the tail options into journalctl flags
+func journalctlArgs(units string, opts TailOptions, cursor string) []string {
+	args := []string{"--output=export"}
+	if !opts.Stop {
+		args = append(args, "--follow")
+	}
+	switch opts.ReadFrom {
+	case "start", "beginning":
+		// journalctl starts at the beginning by default
+	case "last":
+		if cursor != "" {
+			args = append(args, "--after-cursor="+cursor)
+			break
+		}
+		// like a missing statefile for a regular file, start at the end
+		fallthrough
+	default:
+		args = append(args, "--lines=0")
+	}
+	for _, unit := range strings.Split(units, ",") {
+		if unit = strings.TrimSpace(unit); unit != "" {
+			args = append(args, "--unit="+unit)
+		}
+	}
+	return args
+}
+
+// readJournalEntry reads a single entry in the journal export format: one
+// KEY=value line per field, terminated by an empty line. Fields that aren't
+// plain text are written as the field name on its own line, followed by the
+// data length as a little endian uint64, the data, and a newline.
+func readJournalEntry(br *bufio.Reader) (map[string]string, error) {
+	entry := map[string]string{}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && len(entry) > 0 {
+				return entry, nil
+			}
+			return nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if len(entry) == 0 {
+				continue
+			}
+			return entry, nil
+		}
+		if eq := strings.IndexByte(line, '='); eq >= 0 {
+			entry[line[:eq]] = line[eq+1:]
+			continue
+		}
+		var size uint64
+		if err := binary.Read(br, binary.LittleEndian, &size); err != nil {
+			return nil, err
+		}
+		if size > maxJournalFieldSize {
+			return nil, fmt.Errorf("journal field %s claims to be %d bytes long", line, size)
+		}
+		data := make([]byte, size+1)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, err
+		}
+		entry[line] = string(data[:size])
+	}
+}
+
+// journalMessage picks the syslog compatible fields out of a journal entry
+func journalMessage(entry map[string]string) *sourceMessage {
+	msg := &sourceMessage{
+		host:     entry["_HOSTNAME"],
+		app:      entry["SYSLOG_IDENTIFIER"],
+		pid:      entry["SYSLOG_PID"],
+		facility: 3, // daemon
+		severity: 6, // info
+		message:  entry["MESSAGE"],
+	}
+	if msg.app == "" {
+		msg.app = entry["_COMM"]
+	}
+	if msg.pid == "" {
+		msg.pid = entry["_PID"]
+	}
+	if usec, err := strconv.ParseInt(entry["__REALTIME_TIMESTAMP"], 10, 64); err == nil {
+		msg.timestamp = time.Unix(usec/1e6, (usec%1e6)*1e3).UTC()
+	}
+	if f, err := strconv.Atoi(entry["SYSLOG_FACILITY"]); err == nil {
+		msg.facility = f
+	}
+	if p, err := strconv.Atoi(entry["PRIORITY"]); err == nil {
+		msg.severity = p
+	}
+	return msg
+}
+
+// readJournalCursor returns the cursor saved in the statefile, if any
+func readJournalCursor(stateFile string) string {
+	content, err := ioutil.ReadFile(stateFile)
+	if err != nil {
+		logrus.WithError(err).Debug("readJournalCursor failed to read the statefile")
+		return ""
+	}
+	state := State{}
+	if err := json.Unmarshal(content, &state); err != nil {
+		logrus.WithError(err).Debug("readJournalCursor failed to json decode the statefile")
+		return ""
+	}
+	return state.Cursor
+}
+
+// writeJournalCursor records the journal cursor in the statefile
+func writeJournalCursor(stateFile string, cursor string) {
+	if cursor == "" {
+		return
+	}
+	out, err := json.Marshal(State{Cursor: cursor})
+	if err != nil {
+		return
+	}
+	out = append(out, '\n')
+	if err := ioutil.WriteFile(stateFile, out, 0644); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"statefile": stateFile,
+		}).Warn("Failed to write statefile. Journal position will not be saved.")
+	}
+}
+
+// journalStateName is used to derive a statefile name for a journal source
+func journalStateName(units string) string {
+	if units == "" {
+		return "journald"
+	}
+	return "journald-" + strings.Replace(units, ",", "-", -1)
+}
@@ -0,0 +1,113 @@
+package tail
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadJournalEntry(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("__CURSOR=s=abc;i=1\n__REALTIME_TIMESTAMP=1539296055003000\n")
+	buf.WriteString("_HOSTNAME=db1\nSYSLOG_IDENTIFIER=mysqld\n_PID=123\nPRIORITY=3\n")
+	// binary safe encoding is used for messages with newlines in them
+	msg := "first line\nsecond line"
+	buf.WriteString("MESSAGE\n")
+	binary.Write(&buf, binary.LittleEndian, uint64(len(msg)))
+	buf.WriteString(msg + "\n\n")
+	buf.WriteString("__CURSOR=s=abc;i=2\nMESSAGE=next\n\n")
+
+	br := bufio.NewReader(&buf)
+	entry, err := readJournalEntry(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"__CURSOR":             "s=abc;i=1",
+		"__REALTIME_TIMESTAMP": "1539296055003000",
+		"_HOSTNAME":            "db1",
+		"SYSLOG_IDENTIFIER":    "mysqld",
+		"_PID":                 "123",
+		"PRIORITY":             "3",
+		"MESSAGE":              msg,
+	}
+	if !reflect.DeepEqual(entry, expected) {
+		t.Errorf("got %v, expected %v", entry, expected)
+	}
+
+	m := journalMessage(entry)
+	expectedMsg := sourceMessage{
+		timestamp: time.Date(2018, 10, 11, 22, 14, 15, 3000000, time.UTC),
+		host:      "db1",
+		app:       "mysqld",
+		pid:       "123",
+		facility:  3,
+		severity:  3,
+		message:   msg,
+	}
+	if *m != expectedMsg {
+		t.Errorf("got %+v, expected %+v", *m, expectedMsg)
+	}
+
+	entry, err = readJournalEntry(br)
+	if err != nil || entry["MESSAGE"] != "next" {
+		t.Errorf("expected second entry, got %v, %v", entry, err)
+	}
+	if _, err = readJournalEntry(br); err == nil {
+		t.Error("expected an error at the end of the stream")
+	}
+}
+
+func TestJournalctlArgs(t *testing.T) {
+	tsts := []struct {
+		opts     TailOptions
+		units    string
+		cursor   string
+		expected []string
+	}{
+		{
+			TailOptions{ReadFrom: "beginning", Stop: true}, "", "",
+			[]string{"--output=export"},
+		},
+		{
+			TailOptions{ReadFrom: "end"}, "nginx.service,mysql.service", "",
+			[]string{"--output=export", "--follow", "--lines=0", "--unit=nginx.service", "--unit=mysql.service"},
+		},
+		{
+			TailOptions{ReadFrom: "last"}, "", "s=abc",
+			[]string{"--output=export", "--follow", "--after-cursor=s=abc"},
+		},
+		{
+			TailOptions{ReadFrom: "last"}, "", "",
+			[]string{"--output=export", "--follow", "--lines=0"},
+		},
+	}
+	for _, tt := range tsts {
+		args := journalctlArgs(tt.units, tt.opts, tt.cursor)
+		if !reflect.DeepEqual(args, tt.expected) {
+			t.Errorf("got %v, expected %v", args, tt.expected)
+		}
+	}
+}
+
+func TestJournalCursorStateFile(t *testing.T) {
+	tmpdir, err := ioutil.TempDir(os.TempDir(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	stateFile := filepath.Join(tmpdir, "journald.leash.state")
+	if cursor := readJournalCursor(stateFile); cursor != "" {
+		t.Errorf("expected no cursor from a missing statefile, got %q", cursor)
+	}
+	writeJournalCursor(stateFile, "s=abc;i=2")
+	if cursor := readJournalCursor(stateFile); cursor != "s=abc;i=2" {
+		t.Errorf("expected the saved cursor, got %q", cursor)
+	}
+}
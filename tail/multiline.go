@@ -0,0 +1,126 @@
+package tail
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultMultilineMaxLines caps how many lines are folded into a single event
+// when --tail.multiline_max_lines is unset, so a runaway continuation pattern
+// can't accumulate the whole file in memory.
+const defaultMultilineMaxLines = 500
+
+// multilineJoiner groups consecutive lines that belong to the same logical
+// event (eg a Java stack trace following the log line that caused it) and
+// hands them on as a single newline-separated entry.
+//
+// A line is treated as a continuation of the pending event if it matches the
+// continuation pattern, or if a start pattern is configured and the line
+// doesn't match it. Any other line flushes the pending event and starts a new
+// one.
+type multilineJoiner struct {
+	start    *regexp.Regexp
+	cont     *regexp.Regexp
+	prefix   *regexp.Regexp
+	timeout  time.Duration
+	maxLines int
+}
+
+// newMultilineJoiner builds a joiner from the tail options. It returns nil if
+// neither a start nor a continuation pattern was configured.
+func newMultilineJoiner(conf Config) (*multilineJoiner, error) {
+	opts := conf.Options
+	if opts.MultilineStart == "" && opts.MultilineContinue == "" {
+		return nil, nil
+	}
+	m := &multilineJoiner{
+		timeout:  time.Duration(opts.MultilineTimeout) * time.Millisecond,
+		maxLines: int(opts.MultilineMaxLines),
+	}
+	if m.maxLines <= 0 {
+		m.maxLines = defaultMultilineMaxLines
+	}
+	var err error
+	if opts.MultilineStart != "" {
+		if m.start, err = regexp.Compile(opts.MultilineStart); err != nil {
+			return nil, err
+		}
+	}
+	if opts.MultilineContinue != "" {
+		if m.cont, err = regexp.Compile(opts.MultilineContinue); err != nil {
+			return nil, err
+		}
+	}
+	if conf.PrefixRegex != "" {
+		if m.prefix, err = regexp.Compile(conf.PrefixRegex); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// classify strips any line prefix and reports whether the remainder continues
+// the pending event.
+func (m *multilineJoiner) classify(line string) (bool, string) {
+	body := line
+	if m.prefix != nil {
+		body = strings.TrimPrefix(line, m.prefix.FindString(line))
+	}
+	if m.cont != nil && m.cont.MatchString(body) {
+		return true, body
+	}
+	if m.start != nil && !m.start.MatchString(body) {
+		return true, body
+	}
+	return false, body
+}
+
+// join reads lines and returns a channel of assembled events. An event is sent
+// once the next event starts, once maxLines have been collected, after the
+// input has been idle for the configured timeout, or when lines is closed.
+func (m *multilineJoiner) join(lines chan string) chan string {
+	joined := make(chan string)
+	go func() {
+		defer close(joined)
+		var pending []string
+		// idle is nil (and so never fires) while there's nothing pending
+		var idle <-chan time.Time
+		flush := func() {
+			if len(pending) > 0 {
+				joined <- strings.Join(pending, "\n")
+				pending = nil
+			}
+			idle = nil
+		}
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					flush()
+					return
+				}
+				isCont, body := m.classify(line)
+				if isCont && len(pending) > 0 && len(pending) < m.maxLines {
+					pending = append(pending, body)
+				} else {
+					if isCont && len(pending) == 0 {
+						logrus.WithField("line", line).Debug(
+							"multi-line continuation without a start line, sending it on its own")
+					}
+					flush()
+					pending = append(pending, line)
+				}
+				if m.timeout > 0 {
+					idle = time.After(m.timeout)
+				}
+			case <-idle:
+				logrus.Debug("multi-line event idle timeout reached, flushing")
+				flush()
+			}
+		}
+	}()
+	return joined
+}
@@ -0,0 +1,136 @@
+package tail
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMultilineJoin(t *testing.T) {
+	tsts := []struct {
+		desc     string
+		conf     Config
+		in       []string
+		expected []string
+	}{
+		{
+			desc: "java stack trace with a continuation pattern",
+			conf: Config{Options: TailOptions{MultilineContinue: `^\s+at |^Caused by: `}},
+			in: []string{
+				"level=error msg=boom",
+				"java.lang.NullPointerException",
+				"\tat com.example.Foo.bar(Foo.java:12)",
+				"\tat com.example.Main.main(Main.java:5)",
+				"Caused by: java.io.IOException",
+				"level=info msg=ok",
+			},
+			expected: []string{
+				"level=error msg=boom",
+				"java.lang.NullPointerException\n\tat com.example.Foo.bar(Foo.java:12)\n\tat com.example.Main.main(Main.java:5)\nCaused by: java.io.IOException",
+				"level=info msg=ok",
+			},
+		},
+		{
+			desc: "start pattern",
+			conf: Config{Options: TailOptions{MultilineStart: `^\d{4}-\d{2}-\d{2} `}},
+			in: []string{
+				"2018-01-01 first",
+				"  more of first",
+				"2018-01-01 second",
+				"  more of second",
+				"  and more",
+			},
+			expected: []string{
+				"2018-01-01 first\n  more of first",
+				"2018-01-01 second\n  more of second\n  and more",
+			},
+		},
+		{
+			desc: "continuation before any start line is sent on its own",
+			conf: Config{Options: TailOptions{MultilineStart: `^START`}},
+			in:   []string{"orphan", "START a", "b"},
+			expected: []string{
+				"orphan",
+				"START a\nb",
+			},
+		},
+		{
+			desc: "line prefix is ignored when matching and dropped when joining",
+			conf: Config{
+				Options:     TailOptions{MultilineStart: `^\{`},
+				PrefixRegex: `^host\d+: `,
+			},
+			in: []string{
+				`host1: {"a":`,
+				`host1: 1}`,
+				`host1: {"b":2}`,
+			},
+			expected: []string{
+				"host1: {\"a\":\n1}",
+				`host1: {"b":2}`,
+			},
+		},
+		{
+			desc: "events are capped at max lines",
+			conf: Config{Options: TailOptions{MultilineStart: `^S`, MultilineMaxLines: 2}},
+			in:   []string{"S", "a", "b", "c"},
+			expected: []string{
+				"S\na",
+				"b\nc",
+			},
+		},
+	}
+	for _, tt := range tsts {
+		joiner, err := newMultilineJoiner(tt.conf)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %s", tt.desc, err)
+		}
+		lines := make(chan string)
+		go func(in []string) {
+			for _, line := range in {
+				lines <- line
+			}
+			close(lines)
+		}(tt.in)
+		var actual []string
+		for ev := range joiner.join(lines) {
+			actual = append(actual, ev)
+		}
+		if strings.Join(actual, "|") != strings.Join(tt.expected, "|") {
+			t.Errorf("%s:\n\tgot      %q\n\texpected %q", tt.desc, actual, tt.expected)
+		}
+	}
+}
+
+func TestMultilineIdleTimeout(t *testing.T) {
+	joiner, err := newMultilineJoiner(Config{Options: TailOptions{
+		MultilineStart:   `^START`,
+		MultilineTimeout: 10,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make(chan string)
+	defer close(lines)
+	joined := joiner.join(lines)
+	lines <- "START"
+	lines <- "continued"
+	select {
+	case ev := <-joined:
+		if ev != "START\ncontinued" {
+			t.Errorf("expected incomplete event to be flushed, got %q", ev)
+		}
+	case <-time.After(time.Second):
+		t.Error("incomplete event was not flushed after the idle timeout")
+	}
+}
+
+func TestMultilineNotConfigured(t *testing.T) {
+	joiner, err := newMultilineJoiner(Config{Options: tailOpts})
+	if err != nil || joiner != nil {
+		t.Errorf("expected no joiner and no error, got %v, %v", joiner, err)
+	}
+	if _, err := newMultilineJoiner(Config{Options: TailOptions{MultilineStart: "("}}); err == nil {
+		t.Error("expected an invalid start pattern to be rejected")
+	}
+}
@@ -0,0 +1,63 @@
+package tail
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	fileStatsLock sync.Mutex
+	fileStats     = map[string]State{}
+)
+
+// FileStats returns, for every file being tailed, how far behind the end of
+// the file we are and how quickly lines are being read from it. It's updated
+// once a second.
+func FileStats() map[string]State {
+	fileStatsLock.Lock()
+	defer fileStatsLock.Unlock()
+	stats := make(map[string]State, len(fileStats))
+	for file, state := range fileStats {
+		stats[file] = state
+	}
+	return stats
+}
+
+func publishFileStats(file string, state State) {
+	fileStatsLock.Lock()
+	defer fileStatsLock.Unlock()
+	fileStats[file] = state
+}
+
+func forgetFileStats(file string) {
+	fileStatsLock.Lock()
+	defer fileStatsLock.Unlock()
+	delete(fileStats, file)
+}
+
+// tailProgress counts the lines read from a file. It's updated by the
+// goroutine reading the file and read by the one updating the statefile.
+type tailProgress struct {
+	lines    uint64
+	lastLine int64 // unix nanoseconds
+}
+
+func (p *tailProgress) lineRead() {
+	atomic.AddUint64(&p.lines, 1)
+	atomic.StoreInt64(&p.lastLine, time.Now().UnixNano())
+}
+
+// update fills in the line counts and rate in state
+func (p *tailProgress) update(state *State) {
+	now := time.Now()
+	lines := atomic.LoadUint64(&p.lines)
+	if elapsed := now.Sub(state.updated).Seconds(); !state.updated.IsZero() && elapsed > 0 {
+		state.LinesPerSec = float64(lines-state.Lines) / elapsed
+	}
+	state.Lines = lines
+	state.updated = now
+	if last := atomic.LoadInt64(&p.lastLine); last != 0 {
+		state.LastLine = time.Unix(0, last)
+	}
+}
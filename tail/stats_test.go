@@ -0,0 +1,108 @@
+package tail
+
+import (
+	"testing"
+)
+
+func TestUpdatePosition(t *testing.T) {
+	tsts := []struct {
+		desc     string
+		state    State
+		ino      uint64
+		size     int64
+		offset   int64
+		expected State
+	}{
+		{
+			desc:     "first update",
+			ino:      10,
+			size:     100,
+			offset:   40,
+			expected: State{INode: 10, Offset: 40, Size: 100, BytesBehind: 60, readSize: 100},
+		},
+		{
+			desc:     "caught up",
+			state:    State{INode: 10, Offset: 40},
+			ino:      10,
+			size:     100,
+			offset:   100,
+			expected: State{INode: 10, Offset: 100, Size: 100, readSize: 100},
+		},
+		{
+			desc:     "truncated",
+			state:    State{INode: 10, Offset: 100},
+			ino:      10,
+			size:     20,
+			offset:   100,
+			expected: State{INode: 10, Offset: 100, Size: 20, BytesBehind: 20, Rotated: true, readSize: 20},
+		},
+		{
+			desc:     "rotated, still reading the old file",
+			state:    State{INode: 10, Offset: 40, readSize: 80},
+			ino:      11,
+			size:     30,
+			offset:   50,
+			expected: State{INode: 10, Offset: 50, Size: 30, BytesBehind: 60, Rotated: true, readSize: 80},
+		},
+		{
+			desc:     "rotated, read past the size the old file was last seen at",
+			state:    State{INode: 10, Offset: 80, readSize: 80},
+			ino:      11,
+			size:     30,
+			offset:   90,
+			expected: State{INode: 10, Offset: 90, Size: 30, BytesBehind: 30, Rotated: true, readSize: 80},
+		},
+		{
+			desc:     "rotated, moved on to the new file",
+			state:    State{INode: 10, Offset: 50, Rotated: true},
+			ino:      11,
+			size:     30,
+			offset:   5,
+			expected: State{INode: 11, Offset: 5, Size: 30, BytesBehind: 25, readSize: 30},
+		},
+	}
+	for _, tt := range tsts {
+		state := tt.state
+		state.updatePosition(tt.ino, tt.size, tt.offset)
+		if state != tt.expected {
+			t.Errorf("%s:\n\tgot      %+v\n\texpected %+v", tt.desc, state, tt.expected)
+		}
+	}
+}
+
+func TestFileStats(t *testing.T) {
+	ts := &testSetup{}
+	ts.start(t)
+	defer ts.stop()
+
+	filename := ts.tmpdir + "/stats.log"
+	ts.writeFile(t, filename, "a\nb\nc\n")
+	// keep following so the tailer can still tell us its position
+	tailer, err := getTailer(Config{Options: TailOptions{ReadFrom: "start"}}, filename, filename+".state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tailer.Stop()
+	progress := &tailProgress{}
+	state := State{}
+	for i := 0; i < 3; i++ {
+		<-tailer.Lines
+		progress.lineRead()
+	}
+	updateStateFile(&state, tailer, filename, nil, progress)
+
+	stats, ok := FileStats()[filename]
+	if !ok {
+		t.Fatalf("expected stats for %s, got %v", filename, FileStats())
+	}
+	if stats.Lines != 3 || stats.Size != 6 || stats.BytesBehind != 0 || stats.Rotated {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if stats.LastLine.IsZero() {
+		t.Error("expected the time of the last line to be recorded")
+	}
+	forgetFileStats(filename)
+	if _, ok := FileStats()[filename]; ok {
+		t.Error("expected stats to be forgotten")
+	}
+}
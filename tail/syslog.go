@@ -0,0 +1,388 @@
+package tail
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeycombio/honeytail/httime"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// syslogUDPScheme and syslogTCPScheme prefix a listen address given to
+	// --file, eg syslog+udp://0.0.0.0:514
+	syslogUDPScheme = "syslog+udp://"
+	syslogTCPScheme = "syslog+tcp://"
+
+	// maximum size of a single syslog message we're willing to buffer
+	maxSyslogMessageSize = 64 * 1024
+)
+
+// SourcePrefixRegex matches the header the journald and syslog sources put in
+// front of every message they hand on. It's merged into --log_prefix when one
+// of those sources is in use so that the fields end up in the event and the
+// parser only sees the original message.
+const SourcePrefixRegex = `^(?P<syslog_timestamp>\S+) (?P<syslog_host>\S+) (?P<syslog_app>[^\s\[]+)\[(?P<syslog_pid>[^\]]*)\] (?P<syslog_facility>[a-z0-9-]+)\.(?P<syslog_severity>[a-z]+): `
+
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var syslogSeverities = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+// sourceMessage is a single message read from journald or a syslog socket
+type sourceMessage struct {
+	timestamp time.Time
+	host      string
+	app       string
+	pid       string
+	facility  int
+	severity  int
+	message   string
+}
+
+// String renders the message with the header matched by SourcePrefixRegex
+func (m *sourceMessage) String() string {
+	orDash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	ts := m.timestamp
+	if ts.IsZero() {
+		ts = httime.Now()
+	}
+	return fmt.Sprintf("%s %s %s[%s] %s.%s: %s",
+		ts.Format(time.RFC3339Nano), orDash(m.host), orDash(m.app), m.pid,
+		facilityName(m.facility), severityName(m.severity), m.message)
+}
+
+func facilityName(f int) string {
+	if f < 0 || f >= len(syslogFacilities) {
+		return "user"
+	}
+	return syslogFacilities[f]
+}
+
+func severityName(s int) string {
+	if s < 0 || s >= len(syslogSeverities) {
+		return "notice"
+	}
+	return syslogSeverities[s]
+}
+
+// IsStreamSource returns true if the path given to --file names something
+// other than a file on disk: STDIN, the systemd journal, or a syslog or HTTP
+// listener.
+func IsStreamSource(path string) bool {
+	return path == "-" || IsSyslogSource(path) || IsHTTPSource(path)
+}
+
+// IsSyslogSource returns true if the path given to --file names a source whose
+// lines are prefixed with the header described by SourcePrefixRegex.
+func IsSyslogSource(path string) bool {
+	return strings.HasPrefix(path, journaldScheme) ||
+		strings.HasPrefix(path, syslogUDPScheme) ||
+		strings.HasPrefix(path, syslogTCPScheme)
+}
+
+// parseSyslogMessage parses a single RFC5424 or RFC3164 message. Messages that
+// don't look like either are passed through as the message body.
+func parseSyslogMessage(raw string) *sourceMessage {
+	raw = strings.TrimRight(raw, "\r\n\x00")
+	// default priority is user.notice, per RFC3164 section 4.3.3
+	msg := &sourceMessage{facility: 1, severity: 5}
+	rest := raw
+	if strings.HasPrefix(rest, "<") {
+		end := strings.IndexByte(rest, '>')
+		if end > 1 && end <= 4 {
+			if pri, err := strconv.Atoi(rest[1:end]); err == nil {
+				msg.facility = pri / 8
+				msg.severity = pri % 8
+				rest = rest[end+1:]
+			}
+		}
+	}
+	if strings.HasPrefix(rest, "1 ") {
+		if parseRFC5424(rest[2:], msg) {
+			return msg
+		}
+	} else if parseRFC3164(rest, msg) {
+		return msg
+	}
+	msg.message = rest
+	return msg
+}
+
+// parseRFC5424 fills in msg from everything following the version field:
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func parseRFC5424(s string, msg *sourceMessage) bool {
+	fields := strings.SplitN(s, " ", 6)
+	if len(fields) < 6 {
+		return false
+	}
+	nilDash := func(v string) string {
+		if v == "-" {
+			return ""
+		}
+		return v
+	}
+	if fields[0] != "-" {
+		ts, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return false
+		}
+		msg.timestamp = ts
+	}
+	msg.host = nilDash(fields[1])
+	msg.app = nilDash(fields[2])
+	msg.pid = nilDash(fields[3])
+	// fields[4] is the MSGID; structured data and the message follow
+	rest := fields[5]
+	if strings.HasPrefix(rest, "-") {
+		rest = rest[1:]
+	} else {
+		rest = skipStructuredData(rest)
+	}
+	rest = strings.TrimPrefix(rest, " ")
+	msg.message = strings.TrimPrefix(rest, "\ufeff")
+	return true
+}
+
+// skipStructuredData drops the [id key="val"...] elements from the front of s
+func skipStructuredData(s string) string {
+	for strings.HasPrefix(s, "[") {
+		end := structuredDataEnd(s)
+		if end < 0 {
+			return ""
+		}
+		s = s[end+1:]
+	}
+	return s
+}
+
+// structuredDataEnd returns the index of the ']' closing the structured data
+// element at the start of s, or -1 if it isn't closed
+func structuredDataEnd(s string) int {
+	inQuote := false
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuote = !inQuote
+		case ']':
+			if !inQuote {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parseRFC3164 fills in msg from a BSD style message:
+// Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG
+func parseRFC3164(s string, msg *sourceMessage) bool {
+	if len(s) < len(time.Stamp)+1 {
+		return false
+	}
+	ts, err := httime.Parse(time.Stamp, s[:len(time.Stamp)])
+	if err != nil {
+		return false
+	}
+	// the BSD timestamp has no year; assume it's from the last twelve months
+	now := httime.Now()
+	ts = ts.AddDate(now.Year(), 0, 0)
+	if ts.After(now.Add(24 * time.Hour)) {
+		ts = ts.AddDate(-1, 0, 0)
+	}
+	msg.timestamp = ts
+	rest := strings.TrimPrefix(s[len(time.Stamp):], " ")
+
+	if sp := strings.IndexByte(rest, ' '); sp > 0 && !strings.HasSuffix(rest[:sp], ":") {
+		msg.host = rest[:sp]
+		rest = rest[sp+1:]
+	}
+	// the tag runs up to the first ": " and may carry the pid in brackets
+	if colon := strings.Index(rest, ": "); colon > 0 && !strings.Contains(rest[:colon], " ") {
+		tag := rest[:colon]
+		if open := strings.IndexByte(tag, '['); open > 0 && strings.HasSuffix(tag, "]") {
+			msg.pid = tag[open+1 : len(tag)-1]
+			tag = tag[:open]
+		}
+		msg.app = tag
+		rest = rest[colon+2:]
+	}
+	msg.message = rest
+	return true
+}
+
+// listenSyslogUDP receives one syslog message per datagram on addr
+func listenSyslogUDP(ctx context.Context, addr string) (chan string, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	logrus.WithField("address", conn.LocalAddr().String()).Info("Listening for syslog messages over UDP")
+	lines := make(chan string)
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go func() {
+		defer close(lines)
+		buf := make([]byte, maxSyslogMessageSize)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				if ctx.Err() == nil {
+					logrus.WithError(err).Warn("syslog UDP listener failed")
+				}
+				return
+			}
+			line := parseSyslogMessage(string(buf[:n])).String()
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return lines, nil
+}
+
+// listenSyslogTCP accepts connections on addr and reads syslog messages framed
+// either by newlines or by octet counting (RFC6587)
+func listenSyslogTCP(ctx context.Context, addr string) (chan string, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	logrus.WithField("address", listener.Addr().String()).Info("Listening for syslog messages over TCP")
+	lines := make(chan string)
+
+	var lock sync.Mutex
+	conns := map[net.Conn]struct{}{}
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+		lock.Lock()
+		for conn := range conns {
+			conn.Close()
+		}
+		lock.Unlock()
+	}()
+
+	go func() {
+		wg := sync.WaitGroup{}
+		defer func() {
+			wg.Wait()
+			close(lines)
+		}()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if ctx.Err() == nil {
+					logrus.WithError(err).Warn("syslog TCP listener failed")
+				}
+				return
+			}
+			lock.Lock()
+			conns[conn] = struct{}{}
+			lock.Unlock()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				readSyslogStream(ctx, conn, lines)
+				lock.Lock()
+				delete(conns, conn)
+				lock.Unlock()
+				conn.Close()
+			}()
+		}
+	}()
+	return lines, nil
+}
+
+// readSyslogStream reads framed syslog messages from r until it's exhausted
+func readSyslogStream(ctx context.Context, r io.Reader, lines chan<- string) {
+	br := bufio.NewReaderSize(r, maxSyslogMessageSize)
+	for {
+		raw, err := readSyslogFrame(br)
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				logrus.WithError(err).Debug("closing syslog connection")
+			}
+			return
+		}
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		select {
+		case lines <- parseSyslogMessage(raw).String():
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// readSyslogFrame returns the next message from the stream. Octet counted
+// frames start with the message length in ASCII digits followed by a space;
+// anything else, including a message that merely starts with a digit, is read
+// up to the next newline.
+func readSyslogFrame(br *bufio.Reader) (string, error) {
+	if length, ok := peekOctetCount(br); ok {
+		if length > maxSyslogMessageSize {
+			return "", fmt.Errorf("syslog frame of %d bytes exceeds the maximum of %d", length, maxSyslogMessageSize)
+		}
+		// skip the count and its space
+		if _, err := br.ReadString(' '); err != nil {
+			return "", err
+		}
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return "", err
+		}
+		return string(buf), nil
+	}
+	line, err := br.ReadString('\n')
+	if err == io.EOF && line != "" {
+		return line, nil
+	}
+	return line, err
+}
+
+// maxOctetCountDigits is the most digits an octet count can have
+const maxOctetCountDigits = 10
+
+// peekOctetCount returns the length of an octet counted frame, if the stream
+// is at the start of one, without reading past it
+func peekOctetCount(br *bufio.Reader) (int, bool) {
+	// Peek returns what's buffered along with an error when there's less
+	peeked, _ := br.Peek(maxOctetCountDigits + 1)
+	if len(peeked) == 0 || peeked[0] < '1' || peeked[0] > '9' {
+		return 0, false
+	}
+	for i, c := range peeked {
+		if c == ' ' {
+			length, err := strconv.Atoi(string(peeked[:i]))
+			return length, err == nil
+		}
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	return 0, false
+}
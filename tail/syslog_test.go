@@ -0,0 +1,178 @@
+package tail
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSyslogMessage(t *testing.T) {
+	tsts := []struct {
+		desc     string
+		raw      string
+		expected sourceMessage
+	}{
+		{
+			desc: "rfc5424 with structured data",
+			raw:  `<165>1 2018-10-11T22:14:15.003Z mymachine.example.com evntslog 1234 ID47 [exampleSDID@32473 iut="3" eventSource="App]lication"] An application event`,
+			expected: sourceMessage{
+				timestamp: time.Date(2018, 10, 11, 22, 14, 15, 3000000, time.UTC),
+				host:      "mymachine.example.com",
+				app:       "evntslog",
+				pid:       "1234",
+				facility:  20,
+				severity:  5,
+				message:   "An application event",
+			},
+		},
+		{
+			desc: "rfc5424 with nil values",
+			raw:  "<34>1 2018-10-11T22:14:15Z - su - - - 'su root' failed\n",
+			expected: sourceMessage{
+				timestamp: time.Date(2018, 10, 11, 22, 14, 15, 0, time.UTC),
+				app:       "su",
+				facility:  4,
+				severity:  2,
+				message:   "'su root' failed",
+			},
+		},
+		{
+			desc: "rfc3164",
+			raw:  "<30>Oct 11 22:14:15 db1 mysqld[123]: ready for connections",
+			expected: sourceMessage{
+				host:     "db1",
+				app:      "mysqld",
+				pid:      "123",
+				facility: 3,
+				severity: 6,
+				message:  "ready for connections",
+			},
+		},
+		{
+			desc: "rfc3164 without a hostname",
+			raw:  "<13>Oct  1 02:03:04 cron: job done",
+			expected: sourceMessage{
+				app:      "cron",
+				facility: 1,
+				severity: 5,
+				message:  "job done",
+			},
+		},
+		{
+			desc: "unrecognized messages are passed through",
+			raw:  "just some text",
+			expected: sourceMessage{
+				facility: 1,
+				severity: 5,
+				message:  "just some text",
+			},
+		},
+	}
+	for _, tt := range tsts {
+		msg := parseSyslogMessage(tt.raw)
+		if !tt.expected.timestamp.IsZero() && !msg.timestamp.Equal(tt.expected.timestamp) {
+			t.Errorf("%s: timestamp %v, expected %v", tt.desc, msg.timestamp, tt.expected.timestamp)
+		}
+		msg.timestamp = time.Time{}
+		tt.expected.timestamp = time.Time{}
+		if *msg != tt.expected {
+			t.Errorf("%s:\n\tgot      %+v\n\texpected %+v", tt.desc, *msg, tt.expected)
+		}
+	}
+}
+
+func TestSourceMessageMatchesPrefix(t *testing.T) {
+	prefix := regexp.MustCompile(SourcePrefixRegex)
+	line := parseSyslogMessage("<30>Oct 11 22:14:15 db1 mysqld[123]: key=val").String()
+	match := prefix.FindStringSubmatch(line)
+	if match == nil {
+		t.Fatalf("%q doesn't match the source prefix", line)
+	}
+	fields := map[string]string{}
+	for i, name := range prefix.SubexpNames() {
+		if name != "" {
+			fields[name] = match[i]
+		}
+	}
+	expected := map[string]string{
+		"syslog_host":     "db1",
+		"syslog_app":      "mysqld",
+		"syslog_pid":      "123",
+		"syslog_facility": "daemon",
+		"syslog_severity": "info",
+	}
+	for k, v := range expected {
+		if fields[k] != v {
+			t.Errorf("%s: got %q, expected %q", k, fields[k], v)
+		}
+	}
+	if rest := line[len(match[0]):]; rest != "key=val" {
+		t.Errorf("expected the prefix to leave the message, got %q", rest)
+	}
+}
+
+func TestReadSyslogFrame(t *testing.T) {
+	in := "11 <13>1 - - a<13>second line\n2019-01-01 plain line\n42\n12345678901234 long\n5 third"
+	br := bufio.NewReader(strings.NewReader(in))
+	expected := []string{"<13>1 - - a", "<13>second line\n", "2019-01-01 plain line\n", "42\n", "12345678901234 long\n", "third"}
+	for _, exp := range expected {
+		frame, err := readSyslogFrame(br)
+		if err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+		if frame != exp {
+			t.Errorf("got frame %q, expected %q", frame, exp)
+		}
+	}
+	if _, err := readSyslogFrame(br); err == nil {
+		t.Error("expected an error at the end of the stream")
+	}
+}
+
+func TestSyslogListeners(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, network := range []string{"udp", "tcp"} {
+		// grab a free port, then hand it to the listener
+		var addr string
+		if network == "udp" {
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			addr = conn.LocalAddr().String()
+			conn.Close()
+		} else {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			addr = l.Addr().String()
+			l.Close()
+		}
+		conf := Config{Options: tailOpts, Paths: []string{"syslog+" + network + "://" + addr}}
+		chans, err := GetEntries(ctx, conf)
+		if err != nil {
+			t.Fatalf("%s: %s", network, err)
+		}
+		conn, err := net.Dial(network, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write([]byte("<30>Oct 11 22:14:15 db1 app: hello " + network + "\n"))
+		select {
+		case line := <-chans[0]:
+			if !strings.HasSuffix(line, " db1 app[] daemon.info: hello "+network) {
+				t.Errorf("%s: unexpected line %q", network, line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("%s: timed out waiting for a message", network)
+		}
+		conn.Close()
+	}
+	cancel()
+}
@@ -36,6 +36,14 @@ type TailOptions struct {
 	Stop      bool   `long:"stop" description:"Stop reading the file after reaching the end rather than continuing to tail. When --backfill is set, it will override this option=true"`
 	Poll      bool   `long:"poll" description:"use poll instead of inotify to tail files"`
 	StateFile string `long:"statefile" description:"File in which to store the last read position. Defaults to a file in /tmp named $logfile.leash.state. If tailing multiple files, default is forced."`
+
+	MultilineStart    string `long:"multiline_start" description:"Regular expression matching the first line of a multi-line event. Lines that don't match are appended to the previous event."`
+	MultilineContinue string `long:"multiline_continue" description:"Regular expression matching lines that continue the previous event, eg '^\\s+at ' for Java stack traces."`
+	MultilineTimeout  uint   `long:"multiline_timeout" description:"How long, in milliseconds, to wait for more lines before sending an incomplete multi-line event" default:"1000"`
+	MultilineMaxLines uint   `long:"multiline_max_lines" description:"Maximum number of lines to join into a single multi-line event" default:"500"`
+
+	ContainerFormat string `long:"container_format" description:"Unwrap container runtime logs, eg /var/log/containers/*.log, and add the pod's namespace, name and container to each event. Partial lines are reassembled. New files matching --file are picked up as containers start. Values: cri, docker, auto"`
+	ContainerRescan uint   `long:"container_rescan" description:"How often, in seconds, to look for new container log files when using --tail.container_format" default:"10"`
 }
 
 // Statefile mechanics when ReadFrom is 'last'
@@ -51,12 +59,37 @@ type Config struct {
 	Type RotateStyle
 	// Tail specific options
 	Options TailOptions
+	// Backpressure, if set, reports whether events are being read faster than
+	// they can be sent. Sources that can push back on their clients, like the
+	// HTTP listener, use it to turn requests away rather than queue them.
+	Backpressure func() bool
+	// PrefixRegex, if set, is stripped from lines before matching them against
+	// the multi-line patterns, and from continuation lines before joining them
+	PrefixRegex string
 }
 
 // State is what's stored in a statefile
 type State struct {
 	INode  uint64 // the inode
 	Offset int64
+	// Cursor is the position in the systemd journal, for journald sources
+	Cursor string `json:",omitempty"`
+
+	// the rest describes how well we're keeping up with the file and is only
+	// kept in memory, see FileStats
+	Size        int64     `json:"-"` // size of the file currently at the path
+	BytesBehind int64     `json:"-"` // how much is left to read, including the rest of a rotated file
+	Lines       uint64    `json:"-"` // lines read since we started tailing
+	LinesPerSec float64   `json:"-"` // lines read per second since the last update
+	LastLine    time.Time `json:"-"` // when the most recent line was read
+	// Rotated is true while we're still reading a file that's been rotated
+	// away or truncated underneath us
+	Rotated bool `json:"-"`
+
+	// size of the file being read the last time it was at the path. What's
+	// written to a rotated file after it's rotated isn't counted.
+	readSize int64
+	updated  time.Time
 }
 
 // GetSampledEntries wraps GetEntries and returns a list of channels that
@@ -106,10 +139,22 @@ func GetEntries(ctx context.Context, conf Config) ([]chan string, error) {
 	if conf.Type != RotateStyleSyslog {
 		return nil, errors.New("Only Syslog style rotation currently supported")
 	}
+	joiner, err := newMultilineJoiner(conf)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Options.ContainerFormat != "" {
+		lines, err := tailContainerLogs(ctx, conf, joiner)
+		if err != nil {
+			return nil, err
+		}
+		return []chan string{lines}, nil
+	}
+
 	// expand any globs in the list of files so our list all represents real files
 	var filenames []string
 	for _, filePath := range conf.Paths {
-		if filePath == "-" {
+		if IsStreamSource(filePath) {
 			filenames = append(filenames, filePath)
 		} else {
 			files, err := filepath.Glob(filePath)
@@ -129,9 +174,28 @@ func GetEntries(ctx context.Context, conf Config) ([]chan string, error) {
 	numFiles := len(filenames)
 	for _, file := range filenames {
 		var lines chan string
-		if file == "-" {
+		switch {
+		case file == "-":
 			lines = tailStdIn(ctx)
-		} else {
+		case strings.HasPrefix(file, journaldScheme):
+			units := strings.TrimPrefix(file, journaldScheme)
+			stateFile := getStateFile(conf, journalStateName(units), numFiles)
+			if lines, err = tailJournal(ctx, units, conf, stateFile); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(file, syslogUDPScheme):
+			if lines, err = listenSyslogUDP(ctx, strings.TrimPrefix(file, syslogUDPScheme)); err != nil {
+				return nil, err
+			}
+		case IsHTTPSource(file):
+			if lines, err = listenHTTP(ctx, file, conf.Backpressure); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(file, syslogTCPScheme):
+			if lines, err = listenSyslogTCP(ctx, strings.TrimPrefix(file, syslogTCPScheme)); err != nil {
+				return nil, err
+			}
+		default:
 			stateFile := getStateFile(conf, file, numFiles)
 			tailer, err := getTailer(conf, file, stateFile)
 			if err != nil {
@@ -139,6 +203,9 @@ func GetEntries(ctx context.Context, conf Config) ([]chan string, error) {
 			}
 			lines = tailSingleFile(ctx, tailer, file, stateFile)
 		}
+		if joiner != nil {
+			lines = joiner.join(lines)
+		}
 		linesChans = append(linesChans, lines)
 	}
 
@@ -171,9 +238,6 @@ func removeStateFiles(files []string, conf Config) []string {
 
 func tailSingleFile(ctx context.Context, tailer *tail.Tail, file string, stateFile string) chan string {
 	lines := make(chan string)
-	// TODO report some metric to indicate whether we're keeping up with the
-	// front of the file, of if it's being written faster than we can send
-	// events
 
 	stateFh, err := os.OpenFile(stateFile, os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
@@ -185,9 +249,10 @@ func tailSingleFile(ctx context.Context, tailer *tail.Tail, file string, stateFi
 
 	ticker := time.NewTicker(time.Second)
 	state := State{}
+	progress := &tailProgress{}
 	go func() {
 		for range ticker.C {
-			updateStateFile(&state, tailer, file, stateFh)
+			updateStateFile(&state, tailer, file, stateFh, progress)
 		}
 	}()
 
@@ -204,16 +269,17 @@ func tailSingleFile(ctx context.Context, tailer *tail.Tail, file string, stateFi
 					// skip errored lines
 					continue
 				}
+				progress.lineRead()
 				lines <- line.Text
 			case <-ctx.Done():
 				// will only trigger when the context is cancelled
 				break ReadLines
 			}
 		}
-		close(lines)
 		ticker.Stop()
-		updateStateFile(&state, tailer, file, stateFh)
+		updateStateFile(&state, tailer, file, stateFh, progress)
 		stateFh.Close()
+		close(lines)
 	}()
 	return lines
 }
@@ -386,16 +452,19 @@ func getStateFile(conf Config, filename string, numFiles int) string {
 }
 
 // updateStateFile updates the state file once per second with the current
-// values for the logfile's inode number and offset
-func updateStateFile(state *State, t *tail.Tail, file string, stateFh *os.File) {
+// values for the logfile's inode number and offset, and publishes how far
+// behind the end of the file we are
+func updateStateFile(state *State, t *tail.Tail, file string, stateFh *os.File, progress *tailProgress) {
 	logStat := unix.Stat_t{}
 	unix.Stat(file, &logStat)
 	currentPos, err := t.Tell()
 	if err != nil {
 		return
 	}
-	state.INode = logStat.Ino
-	state.Offset = currentPos
+	state.updatePosition(logStat.Ino, logStat.Size, currentPos)
+	progress.update(state)
+	publishFileStats(file, *state)
+
 	out, err := json.Marshal(state)
 	if err != nil {
 		return
@@ -405,3 +474,39 @@ func updateStateFile(state *State, t *tail.Tail, file string, stateFh *os.File)
 	stateFh.WriteAt(out, 0)
 	stateFh.Sync()
 }
+
+// updatePosition records the current read offset and works out how far it is
+// from the end of the file now at the path, which has inode ino and is size
+// bytes long
+func (state *State) updatePosition(ino uint64, size int64, offset int64) {
+	switch {
+	case state.INode == 0 || state.INode == ino:
+		state.INode = ino
+		state.Rotated = offset > size
+		state.readSize = size
+	case offset < state.Offset:
+		// the tailer has moved on to the new file
+		state.INode = ino
+		state.Rotated = false
+		state.readSize = size
+	default:
+		// still reading what's left of the old file. Keep its inode so that
+		// a restart doesn't apply the old offset to the new file.
+		state.Rotated = true
+	}
+	state.Offset = offset
+	state.Size = size
+	switch {
+	case state.INode == ino && offset <= size:
+		state.BytesBehind = size - offset
+	case state.INode == ino:
+		// truncated; what wasn't read is gone
+		state.BytesBehind = size
+	default:
+		// what's left of the rotated file, then all of the new one
+		state.BytesBehind = size
+		if state.readSize > offset {
+			state.BytesBehind += state.readSize - offset
+		}
+	}
+}